@@ -0,0 +1,132 @@
+package animation
+
+import (
+	"github.com/joelhays/go-jk/jk/jktypes"
+)
+
+const (
+	CEL_ANIM_LOOP                  = 0x1
+	CEL_ANIM_SKIP_FIRST_FRAME      = 0x2
+	CEL_ANIM_SKIP_FIRST_TWO_FRAMES = 0x4
+)
+
+type celAnim struct {
+	numCels int
+	cel     int
+	fps     float64
+	flags   int64
+	elapsed float64
+	playing bool
+}
+
+func (a *celAnim) update(deltaTime float64) {
+	if !a.playing || a.fps <= 0 || a.numCels <= 1 {
+		return
+	}
+
+	frameTime := 1 / a.fps
+	a.elapsed += deltaTime
+	for a.elapsed >= frameTime {
+		a.elapsed -= frameTime
+		a.cel++
+		if a.cel < a.numCels {
+			continue
+		}
+		if a.flags&CEL_ANIM_LOOP == 0 {
+			a.cel = a.numCels - 1
+			a.playing = false
+			return
+		}
+		a.cel = a.loopStart()
+	}
+}
+
+func (a *celAnim) loopStart() int {
+	start := 0
+	if a.flags&CEL_ANIM_SKIP_FIRST_TWO_FRAMES != 0 {
+		start = 2
+	} else if a.flags&CEL_ANIM_SKIP_FIRST_FRAME != 0 {
+		start = 1
+	}
+	if start >= a.numCels {
+		start = a.numCels - 1
+	}
+	return start
+}
+
+// CelAnimator tracks the cel shown for animated materials. Materials are animated
+// by name so the level and the 3dos using the same MAT stay in step, a single
+// surface can also be animated on its own.
+type CelAnimator struct {
+	materials map[string]*celAnim
+	surfaces  map[int64]*celAnim
+}
+
+func NewCelAnimator() *CelAnimator {
+	return &CelAnimator{materials: make(map[string]*celAnim), surfaces: make(map[int64]*celAnim)}
+}
+
+// MaterialAnim starts cycling the cels of a material at fps frames per second.
+func (a *CelAnimator) MaterialAnim(material *jktypes.Material, fps float64, flags int64) {
+	a.materials[material.Name] = &celAnim{numCels: len(material.Cels), fps: fps, flags: flags, playing: true}
+}
+
+// SurfaceAnim starts cycling the cels of a single surface at fps frames per second.
+func (a *CelAnimator) SurfaceAnim(surface int64, material *jktypes.Material, fps float64, flags int64) {
+	a.surfaces[surface] = &celAnim{numCels: len(material.Cels), fps: fps, flags: flags, playing: true}
+}
+
+func (a *CelAnimator) StopMaterialAnim(material *jktypes.Material) {
+	if anim, ok := a.materials[material.Name]; ok {
+		anim.playing = false
+	}
+}
+
+func (a *CelAnimator) StopSurfaceAnim(surface int64) {
+	if anim, ok := a.surfaces[surface]; ok {
+		anim.playing = false
+	}
+}
+
+func (a *CelAnimator) SetMaterialCel(material *jktypes.Material, cel int) {
+	a.materials[material.Name] = &celAnim{numCels: len(material.Cels), cel: clampCel(cel, len(material.Cels))}
+}
+
+func (a *CelAnimator) SetSurfaceCel(surface int64, material *jktypes.Material, cel int) {
+	a.surfaces[surface] = &celAnim{numCels: len(material.Cels), cel: clampCel(cel, len(material.Cels))}
+}
+
+// MaterialCel returns the cel to draw for a material.
+func (a *CelAnimator) MaterialCel(material *jktypes.Material) int {
+	if anim, ok := a.materials[material.Name]; ok {
+		return clampCel(anim.cel, len(material.Cels))
+	}
+	return 0
+}
+
+// SurfaceCel returns the cel to draw for a surface, falling back to the cel of its material.
+func (a *CelAnimator) SurfaceCel(surface int64, material *jktypes.Material) int {
+	if anim, ok := a.surfaces[surface]; ok {
+		return clampCel(anim.cel, len(material.Cels))
+	}
+	return a.MaterialCel(material)
+}
+
+func (a *CelAnimator) Update(deltaTime float64) {
+	for _, anim := range a.materials {
+		anim.update(deltaTime)
+	}
+	for _, anim := range a.surfaces {
+		anim.update(deltaTime)
+	}
+}
+
+func clampCel(cel int, numCels int) int {
+	if cel >= numCels {
+		cel = numCels - 1
+	}
+	if cel < 0 {
+		cel = 0
+	}
+	return cel
+}
@@ -0,0 +1,109 @@
+package animation
+
+import (
+	"github.com/go-gl/mathgl/mgl32"
+	"github.com/joelhays/go-jk/jk/jktypes"
+)
+
+// FrameMover moves a thing between the frames of its path, e.g. doors and
+// elevators. Moving to a frame passes through every frame in between.
+type FrameMover struct {
+	thing     *jktypes.Thing
+	curFrame  int
+	goalFrame int
+	nextFrame int
+	speed     float32
+	moving    bool
+}
+
+func NewFrameMover(thing *jktypes.Thing) *FrameMover {
+	return &FrameMover{thing: thing}
+}
+
+func (m *FrameMover) CurFrame() int {
+	return m.curFrame
+}
+
+func (m *FrameMover) GoalFrame() int {
+	return m.goalFrame
+}
+
+func (m *FrameMover) Moving() bool {
+	return m.moving
+}
+
+// MoveToFrame starts moving towards frame at speed units per second.
+func (m *FrameMover) MoveToFrame(frame int, speed float32) {
+	if frame < 0 || frame >= len(m.thing.Frames) || speed <= 0 {
+		return
+	}
+	m.goalFrame = frame
+	m.speed = speed
+	m.moving = frame != m.curFrame || m.thing.Position != m.thing.Frames[frame].Position
+	m.nextFrame = m.curFrame
+	m.stepFrame()
+}
+
+// JumpToFrame places the thing at frame right away.
+func (m *FrameMover) JumpToFrame(frame int) {
+	if frame < 0 || frame >= len(m.thing.Frames) {
+		return
+	}
+	m.curFrame = frame
+	m.goalFrame = frame
+	m.moving = false
+	m.setPose(m.thing.Frames[frame].Position, m.thing.Frames[frame].Orientation)
+}
+
+func (m *FrameMover) Stop() {
+	m.moving = false
+	m.goalFrame = m.curFrame
+}
+
+func (m *FrameMover) stepFrame() {
+	switch {
+	case m.goalFrame > m.curFrame:
+		m.nextFrame = m.curFrame + 1
+	case m.goalFrame < m.curFrame:
+		m.nextFrame = m.curFrame - 1
+	default:
+		m.nextFrame = m.curFrame
+	}
+}
+
+func (m *FrameMover) Update(deltaTime float64) {
+	distance := m.speed * float32(deltaTime)
+	for m.moving && distance > 0 {
+		target := m.thing.Frames[m.nextFrame]
+		toTarget := target.Position.Sub(m.thing.Position)
+		remaining := toTarget.Len()
+
+		if remaining > distance {
+			t := distance / remaining
+			orientation := m.orientation()
+			m.setPose(m.thing.Position.Add(toTarget.Mul(t)),
+				orientation.Add(target.Orientation.Sub(orientation).Mul(t)))
+			return
+		}
+
+		distance -= remaining
+		m.setPose(target.Position, target.Orientation)
+		m.curFrame = m.nextFrame
+		if m.curFrame == m.goalFrame {
+			m.moving = false
+			return
+		}
+		m.stepFrame()
+	}
+}
+
+func (m *FrameMover) orientation() mgl32.Vec3 {
+	return mgl32.Vec3{float32(m.thing.Pitch), float32(m.thing.Yaw), float32(m.thing.Roll)}
+}
+
+func (m *FrameMover) setPose(position mgl32.Vec3, orientation mgl32.Vec3) {
+	m.thing.Position = position
+	m.thing.Pitch = float64(orientation[0])
+	m.thing.Yaw = float64(orientation[1])
+	m.thing.Roll = float64(orientation[2])
+}
@@ -0,0 +1,200 @@
+package animation
+
+import (
+	"github.com/go-gl/mathgl/mgl32"
+	"github.com/joelhays/go-jk/jk/jktypes"
+	"math"
+	"strings"
+)
+
+// NodePose is the position and the pitch, yaw and roll (in degrees) of a hierarchy node.
+type NodePose struct {
+	Position    mgl32.Vec3
+	Orientation mgl32.Vec3
+}
+
+// RestPose returns the pose of every hierarchy node as stored in the 3do.
+func RestPose(model *jktypes.Jk3doFile) []NodePose {
+	pose := make([]NodePose, len(model.Hierarchy))
+	for i, node := range model.Hierarchy {
+		pose[i] = NodePose{
+			Position:    node.Position,
+			Orientation: mgl32.Vec3{float32(node.Pitch), float32(node.Yaw), float32(node.Roll)},
+		}
+	}
+	return pose
+}
+
+// SampleNode returns the pose of a keyframe node at the given frame. Between two
+// entries the values move by the per frame deltas of the earlier entry.
+func SampleNode(node *jktypes.KeyframeNode, frame float64) (NodePose, bool) {
+	if len(node.Entries) == 0 {
+		return NodePose{}, false
+	}
+
+	entry := node.Entries[0]
+	for _, e := range node.Entries[1:] {
+		if float64(e.Frame) > frame {
+			break
+		}
+		entry = e
+	}
+
+	delta := float32(frame - float64(entry.Frame))
+	if delta < 0 {
+		delta = 0
+	}
+
+	return NodePose{
+		Position:    entry.Offset.Add(entry.DeltaOffset.Mul(delta)),
+		Orientation: entry.Orientation.Add(entry.DeltaOrientation.Mul(delta)),
+	}, true
+}
+
+// RotationMatrix builds the rotation for a pitch, yaw and roll given in degrees.
+// Yaw turns around the z axis, pitch around x and roll around y.
+func RotationMatrix(orientation mgl32.Vec3) mgl32.Mat4 {
+	pitch := mgl32.HomogRotate3DX(mgl32.DegToRad(orientation[0]))
+	yaw := mgl32.HomogRotate3DZ(mgl32.DegToRad(orientation[1]))
+	roll := mgl32.HomogRotate3DY(mgl32.DegToRad(orientation[2]))
+	return yaw.Mul4(pitch).Mul4(roll)
+}
+
+// NodeMatrices returns the model matrix of the mesh attached to every hierarchy
+// node. Every node is positioned relative to its parent, the pivot only offsets
+// the node's own mesh.
+func NodeMatrices(model *jktypes.Jk3doFile, pose []NodePose) []mgl32.Mat4 {
+	nodeMatrices := make([]mgl32.Mat4, len(model.Hierarchy))
+	done := make([]bool, len(model.Hierarchy))
+
+	var nodeMatrix func(idx int64, depth int) mgl32.Mat4
+	nodeMatrix = func(idx int64, depth int) mgl32.Mat4 {
+		if done[idx] {
+			return nodeMatrices[idx]
+		}
+
+		p := pose[idx]
+		m := mgl32.Translate3D(p.Position[0], p.Position[1], p.Position[2]).Mul4(RotationMatrix(p.Orientation))
+
+		parent := model.Hierarchy[idx].ParentID
+		if parent >= 0 && parent < int64(len(model.Hierarchy)) && depth < len(model.Hierarchy) {
+			m = nodeMatrix(parent, depth+1).Mul4(m)
+		}
+
+		nodeMatrices[idx] = m
+		done[idx] = true
+		return m
+	}
+
+	meshMatrices := make([]mgl32.Mat4, len(model.Hierarchy))
+	for i, node := range model.Hierarchy {
+		pivot := mgl32.Translate3D(node.Pivot[0], node.Pivot[1], node.Pivot[2])
+		meshMatrices[i] = nodeMatrix(int64(i), 0).Mul4(pivot)
+	}
+	return meshMatrices
+}
+
+// KeyAnimation plays a KEY on the hierarchy of a 3do. The mode is one of the
+// KEY_FLAG_* values and decides what happens after the last frame.
+type KeyAnimation struct {
+	key     *jktypes.Key
+	model   *jktypes.Jk3doFile
+	mode    int
+	tracks  []int
+	time    float64
+	done    bool
+	holding bool
+}
+
+func NewKeyAnimation(key *jktypes.Key, model *jktypes.Jk3doFile, mode int) *KeyAnimation {
+	a := &KeyAnimation{key: key, model: model, mode: mode}
+	a.tracks = make([]int, len(model.Hierarchy))
+	for i, node := range model.Hierarchy {
+		a.tracks[i] = -1
+		for j, keyNode := range key.KeyframeNodes {
+			if strings.EqualFold(keyNode.MeshName, node.NodeName) {
+				a.tracks[i] = j
+				break
+			}
+		}
+	}
+	return a
+}
+
+func (a *KeyAnimation) Update(deltaTime float64) {
+	if a.done || a.holding {
+		return
+	}
+	a.SetTime(a.time + deltaTime)
+}
+
+// SetTime moves the animation to t seconds from its start.
+func (a *KeyAnimation) SetTime(t float64) {
+	a.time = t
+	a.done = false
+	a.holding = false
+
+	frames := float64(a.key.Header.Frames)
+	if t*float64(a.key.Header.FPS) < frames || frames <= 0 {
+		return
+	}
+
+	switch a.mode {
+	case jktypes.KEY_FLAG_LOOPING:
+		duration := frames / float64(a.key.Header.FPS)
+		a.time = math.Mod(t, duration)
+	case jktypes.KEY_FLAT_STOP_AT_LAST_FRAME_UNTIL_EVENT:
+		a.holding = true
+	default:
+		a.done = true
+	}
+}
+
+// Frame returns the current, fractional, frame number.
+func (a *KeyAnimation) Frame() float64 {
+	frame := a.time * float64(a.key.Header.FPS)
+	if last := float64(a.key.Header.Frames); frame >= last && a.mode != jktypes.KEY_FLAG_LOOPING {
+		frame = math.Max(last-1, 0)
+	}
+	return frame
+}
+
+// Done reports whether a KEY_FLAG_STOP_AFTER_LAST_FRAME animation has finished,
+// after which Pose returns the rest pose.
+func (a *KeyAnimation) Done() bool {
+	return a.done
+}
+
+// Holding reports whether a KEY_FLAT_STOP_AT_LAST_FRAME_UNTIL_EVENT animation is
+// holding its last frame.
+func (a *KeyAnimation) Holding() bool {
+	return a.holding
+}
+
+// Release ends an animation holding its last frame.
+func (a *KeyAnimation) Release() {
+	if a.holding {
+		a.holding = false
+		a.done = true
+	}
+}
+
+// Pose samples every animated node at the current frame. Nodes the key has no
+// track for keep their rest pose.
+func (a *KeyAnimation) Pose() []NodePose {
+	pose := RestPose(a.model)
+	if a.done {
+		return pose
+	}
+
+	frame := a.Frame()
+	for i, track := range a.tracks {
+		if track < 0 {
+			continue
+		}
+		if p, ok := SampleNode(&a.key.KeyframeNodes[track], frame); ok {
+			pose[i] = p
+		}
+	}
+	return pose
+}
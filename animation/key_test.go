@@ -0,0 +1,140 @@
+package animation
+
+import (
+	"github.com/go-gl/mathgl/mgl32"
+	"github.com/joelhays/go-jk/jk/jkparsers"
+	"github.com/joelhays/go-jk/jk/jktypes"
+	"io/ioutil"
+	"math"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func readTestKey(t *testing.T, name string) *jktypes.Key {
+	t.Helper()
+	data, err := ioutil.ReadFile(filepath.Join("..", "_testfiles", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := jkparsers.NewKeyLineParser().ParseFromString(string(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &key
+}
+
+func keyTrack(t *testing.T, key *jktypes.Key, meshName string) *jktypes.KeyframeNode {
+	t.Helper()
+	for i := range key.KeyframeNodes {
+		if strings.EqualFold(key.KeyframeNodes[i].MeshName, meshName) {
+			return &key.KeyframeNodes[i]
+		}
+	}
+	t.Fatalf("no track for %s", meshName)
+	return nil
+}
+
+// restModel makes a 3do of a node per mesh name, all at z 1 in the rest pose.
+func restModel(meshNames ...string) *jktypes.Jk3doFile {
+	model := &jktypes.Jk3doFile{}
+	for _, name := range meshNames {
+		model.Hierarchy = append(model.Hierarchy, jktypes.HierarchyDef{NodeName: name, MeshID: -1, ParentID: -1, Position: mgl32.Vec3{0, 0, 1}})
+	}
+	return model
+}
+
+func TestSampleNode(t *testing.T) {
+	idle := readTestKey(t, "ryidleg.key")
+	walk := readTestKey(t, "8twalk.key")
+	calf := keyTrack(t, idle, "relcalf")
+	torso := keyTrack(t, walk, "8t88_torso")
+
+	tests := []struct {
+		name  string
+		node  *jktypes.KeyframeNode
+		frame float64
+		want  float32
+		value func(NodePose) float32
+	}{
+		{"first entry", calf, 0, 327.49975586, pitch},
+		{"between entries", calf, 4, 327.49975586 - 4*0.16858673, pitch},
+		{"at an entry", calf, 8, 326.15106201, pitch},
+		{"before the first entry", calf, -2, 327.49975586, pitch},
+		{"last entry", calf, 161, -32.50025177, pitch},
+		{"fractional frame", torso, 3.5, 0.00139982 - 3.5*0.00021322, z},
+		{"past the last entry", torso, 47, 0.00148770 - 2*0.00002929, z},
+	}
+	for _, test := range tests {
+		pose, ok := SampleNode(test.node, test.frame)
+		if got := test.value(pose); !ok || math.Abs(float64(got-test.want)) > 1e-4*math.Max(1, math.Abs(float64(test.want))) {
+			t.Errorf("%s: sampled %v at frame %v, expected %v", test.name, got, test.frame, test.want)
+		}
+	}
+
+	if _, ok := SampleNode(&jktypes.KeyframeNode{}, 0); ok {
+		t.Error("sampled a node without entries")
+	}
+}
+
+func pitch(p NodePose) float32 {
+	return p.Orientation[0]
+}
+
+func z(p NodePose) float32 {
+	return p.Position[2]
+}
+
+func TestKeyAnimationModes(t *testing.T) {
+	walk := readTestKey(t, "8twalk.key")
+	model := restModel("8T88_TORSO")
+	// 48 frames at 15 fps end at 3.2 seconds
+	end := float64(walk.Header.Frames) / float64(walk.Header.FPS)
+
+	tests := []struct {
+		name    string
+		mode    int
+		time    float64
+		frame   float64
+		done    bool
+		holding bool
+		z       float32
+	}{
+		{"looping before the end", jktypes.KEY_FLAG_LOOPING, 2, 30, false, false, 0.00139984 - 6*0.00021322},
+		{"looping at the end", jktypes.KEY_FLAG_LOOPING, end, 0, false, false, 0.00139982},
+		{"looping past the end", jktypes.KEY_FLAG_LOOPING, end + 1, 15, false, false, 0.00096105 + 0.00007524},
+		{"holding before the end", jktypes.KEY_FLAT_STOP_AT_LAST_FRAME_UNTIL_EVENT, end - 0.1, 46.5, false, false, 0.00148770 - 1.5*0.00002929},
+		{"holding at the end", jktypes.KEY_FLAT_STOP_AT_LAST_FRAME_UNTIL_EVENT, end, 47, false, true, 0.00148770 - 2*0.00002929},
+		{"holding past the end", jktypes.KEY_FLAT_STOP_AT_LAST_FRAME_UNTIL_EVENT, end + 10, 47, false, true, 0.00148770 - 2*0.00002929},
+		{"stopping before the end", jktypes.KEY_FLAG_STOP_AFTER_LAST_FRAME, end - 0.1, 46.5, false, false, 0.00148770 - 1.5*0.00002929},
+		{"stopping at the end", jktypes.KEY_FLAG_STOP_AFTER_LAST_FRAME, end, 47, true, false, 1},
+		{"stopping past the end", jktypes.KEY_FLAG_STOP_AFTER_LAST_FRAME, end + 10, 47, true, false, 1},
+	}
+	for _, test := range tests {
+		a := NewKeyAnimation(walk, model, test.mode)
+		a.SetTime(test.time)
+		if frame := a.Frame(); math.Abs(frame-test.frame) > 1e-6 || a.Done() != test.done || a.Holding() != test.holding {
+			t.Errorf("%s: at frame %v done %v holding %v, expected %v %v %v", test.name, frame, a.Done(), a.Holding(),
+				test.frame, test.done, test.holding)
+		}
+		if got := a.Pose()[0].Position[2]; math.Abs(float64(got-test.z)) > 1e-7 {
+			t.Errorf("%s: torso at z %v, expected %v", test.name, got, test.z)
+		}
+	}
+}
+
+func TestKeyAnimationRelease(t *testing.T) {
+	walk := readTestKey(t, "8twalk.key")
+	a := NewKeyAnimation(walk, restModel("8t88_torso"), jktypes.KEY_FLAT_STOP_AT_LAST_FRAME_UNTIL_EVENT)
+	a.Update(3)
+	a.Update(0.5)
+	a.Update(100)
+	if !a.Holding() || a.Frame() != 47 {
+		t.Fatalf("at frame %v holding %v, expected to hold frame 47", a.Frame(), a.Holding())
+	}
+
+	a.Release()
+	if a.Holding() || !a.Done() || a.Pose()[0].Position[2] != 1 {
+		t.Errorf("released at z %v holding %v done %v, expected the rest pose", a.Pose()[0].Position[2], a.Holding(), a.Done())
+	}
+}
@@ -0,0 +1,242 @@
+package animation
+
+import (
+	"fmt"
+	"github.com/go-gl/mathgl/mgl32"
+	"github.com/joelhays/go-jk/jk/jktypes"
+	"strings"
+)
+
+const (
+	pupFlagHoldLastFrame = 0x04
+	pupFlagPlayOnce      = 0x20
+)
+
+// PoseSource provides the pose of a 3do hierarchy.
+type PoseSource interface {
+	Pose() []NodePose
+}
+
+// KeyLoader loads a KEY by name.
+type KeyLoader func(name string) (*jktypes.Key, error)
+
+type puppetTrack struct {
+	subMode jktypes.PupSubMode
+	key     *jktypes.Key
+	anim    *KeyAnimation
+}
+
+// Puppet plays the submodes of a PUP on a 3do. A looping submode such as stand or
+// walk replaces the looping submode playing before it, other submodes such as fire
+// or hit are played on top until they finish.
+type Puppet struct {
+	model   *jktypes.Jk3doFile
+	pup     *jktypes.Pup
+	loadKey KeyLoader
+	mode    int32
+	tracks  []*puppetTrack
+}
+
+func NewPuppet(model *jktypes.Jk3doFile, pup *jktypes.Pup, loadKey KeyLoader) *Puppet {
+	return &Puppet{model: model, pup: pup, loadKey: loadKey}
+}
+
+// SetMode switches to another PUP mode, e.g. from unarmed to armed. Playing
+// submodes are restarted with the keys of the new mode.
+func (p *Puppet) SetMode(mode int32) error {
+	if p.findMode(mode) == nil {
+		return fmt.Errorf("puppet has no mode %d", mode)
+	}
+	p.mode = mode
+
+	tracks := p.tracks
+	p.tracks = nil
+	for _, track := range tracks {
+		if err := p.Play(track.subMode.Name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *Puppet) Mode() int32 {
+	return p.mode
+}
+
+func (p *Puppet) findMode(number int32) *jktypes.PupMode {
+	for i := range p.pup.Modes {
+		if p.pup.Modes[i].Number == number {
+			return &p.pup.Modes[i]
+		}
+	}
+	return nil
+}
+
+// SubMode looks up a submode in the current mode, following the basedon chain
+// when the mode does not define it.
+func (p *Puppet) SubMode(name string) (jktypes.PupSubMode, bool) {
+	number := p.mode
+	for i := 0; i <= len(p.pup.Modes); i++ {
+		mode := p.findMode(number)
+		if mode == nil {
+			break
+		}
+		for _, subMode := range mode.SubModes {
+			if strings.EqualFold(subMode.Name, name) {
+				return subMode, true
+			}
+		}
+		if !mode.IsInherited {
+			break
+		}
+		number = mode.BasedOn
+	}
+	return jktypes.PupSubMode{}, false
+}
+
+// Play starts a submode.
+func (p *Puppet) Play(name string) error {
+	subMode, ok := p.SubMode(name)
+	if !ok {
+		return fmt.Errorf("puppet mode %d has no submode %q", p.mode, name)
+	}
+
+	key, err := p.loadKey(subMode.Keyframe)
+	if err != nil {
+		return err
+	}
+
+	keyMode := KeyModeFromFlags(subMode.Flags)
+	track := &puppetTrack{subMode: subMode, key: key, anim: NewKeyAnimation(key, p.model, keyMode)}
+
+	tracks := p.tracks[:0]
+	for _, t := range p.tracks {
+		if strings.EqualFold(t.subMode.Name, name) {
+			continue
+		}
+		if keyMode == jktypes.KEY_FLAG_LOOPING && KeyModeFromFlags(t.subMode.Flags) == jktypes.KEY_FLAG_LOOPING {
+			continue
+		}
+		tracks = append(tracks, t)
+	}
+	p.tracks = append(tracks, track)
+	return nil
+}
+
+// Stop ends a submode.
+func (p *Puppet) Stop(name string) {
+	tracks := p.tracks[:0]
+	for _, t := range p.tracks {
+		if !strings.EqualFold(t.subMode.Name, name) {
+			tracks = append(tracks, t)
+		}
+	}
+	p.tracks = tracks
+}
+
+// Playing reports whether a submode is playing or holding its last frame.
+func (p *Puppet) Playing(name string) bool {
+	for _, t := range p.tracks {
+		if strings.EqualFold(t.subMode.Name, name) {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *Puppet) Update(deltaTime float64) {
+	tracks := p.tracks[:0]
+	for _, t := range p.tracks {
+		t.anim.Update(deltaTime)
+		if !t.anim.Done() {
+			tracks = append(tracks, t)
+		}
+	}
+	p.tracks = tracks
+}
+
+// Pose combines the playing submodes. Every node is driven by the tracks with the
+// highest priority for it, a track uses its HiPri on the nodes whose type is part
+// of the key type mask and its LoPri on all others. Tracks sharing the highest
+// priority are blended evenly.
+func (p *Puppet) Pose() []NodePose {
+	pose := RestPose(p.model)
+	if len(p.tracks) == 0 {
+		return pose
+	}
+
+	frames := make([]float64, len(p.tracks))
+	for i, t := range p.tracks {
+		frames[i] = t.anim.Frame()
+	}
+
+	for nodeIdx, node := range p.model.Hierarchy {
+		bestPri := int32(-1)
+		var blended []NodePose
+		for i, t := range p.tracks {
+			track := t.anim.tracks[nodeIdx]
+			if track < 0 {
+				continue
+			}
+			nodePose, ok := SampleNode(&t.key.KeyframeNodes[track], frames[i])
+			if !ok {
+				continue
+			}
+
+			pri := t.subMode.LoPri
+			if int64(t.key.Header.Type)&node.Type != 0 {
+				pri = t.subMode.HiPri
+			}
+
+			if pri > bestPri {
+				bestPri = pri
+				blended = blended[:0]
+			}
+			if pri == bestPri {
+				blended = append(blended, nodePose)
+			}
+		}
+		if len(blended) > 0 {
+			pose[nodeIdx] = blendPoses(blended)
+		}
+	}
+
+	return pose
+}
+
+func blendPoses(poses []NodePose) NodePose {
+	result := poses[0]
+	if len(poses) == 1 {
+		return result
+	}
+
+	var position, orientation mgl32.Vec3
+	for _, pose := range poses {
+		position = position.Add(pose.Position)
+		for i := 0; i < 3; i++ {
+			// blend the shortest way around
+			delta := pose.Orientation[i] - result.Orientation[i]
+			for delta > 180 {
+				delta -= 360
+			}
+			for delta < -180 {
+				delta += 360
+			}
+			orientation[i] += result.Orientation[i] + delta
+		}
+	}
+
+	weight := 1 / float32(len(poses))
+	return NodePose{Position: position.Mul(weight), Orientation: orientation.Mul(weight)}
+}
+
+// KeyModeFromFlags maps the flags of a PUP submode to one of the KEY_FLAG_* play modes.
+func KeyModeFromFlags(flags byte) int {
+	if flags&pupFlagPlayOnce != 0 {
+		return jktypes.KEY_FLAG_STOP_AFTER_LAST_FRAME
+	}
+	if flags&pupFlagHoldLastFrame != 0 {
+		return jktypes.KEY_FLAT_STOP_AT_LAST_FRAME_UNTIL_EVENT
+	}
+	return jktypes.KEY_FLAG_LOOPING
+}
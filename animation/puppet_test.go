@@ -0,0 +1,171 @@
+package animation
+
+import (
+	"fmt"
+	"github.com/go-gl/mathgl/mgl32"
+	"github.com/joelhays/go-jk/jk/jkparsers"
+	"github.com/joelhays/go-jk/jk/jktypes"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+const (
+	testUpperBody = 0x08
+	testLowerBody = 0x20
+)
+
+func readTestPup(t *testing.T) *jktypes.Pup {
+	t.Helper()
+	data, err := ioutil.ReadFile(filepath.Join("..", "_testfiles", "rystr.pup"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	pup, err := jkparsers.NewPupLineParser().ParseFromString(string(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &pup
+}
+
+// testKeyLoader makes a 10 frame KEY for every name, moving the nodes it
+// tracks to x = its 1 based index in keys. It records the names it loads.
+type testKeyLoader struct {
+	keys   []string
+	tracks map[string][]string
+	types  map[string]int32
+	loaded []string
+}
+
+func (l *testKeyLoader) load(name string) (*jktypes.Key, error) {
+	l.loaded = append(l.loaded, name)
+	for i, keyName := range l.keys {
+		if keyName != name {
+			continue
+		}
+		key := &jktypes.Key{Header: jktypes.KeyHeader{Type: l.types[name], Frames: 10, FPS: 10}}
+		for _, node := range l.tracks[name] {
+			key.KeyframeNodes = append(key.KeyframeNodes, jktypes.KeyframeNode{
+				MeshName: node,
+				Entries:  []jktypes.KeyframeNodeEntry{{Offset: mgl32.Vec3{float32(i + 1), 0, 0}}},
+			})
+		}
+		return key, nil
+	}
+	return nil, fmt.Errorf("no key %s", name)
+}
+
+// testPuppetModel has a head of the upper body, a hip of neither half and legs
+// of the lower body.
+func testPuppetModel() *jktypes.Jk3doFile {
+	model := restModel("head", "hip", "legs")
+	model.Hierarchy[0].Type = testUpperBody
+	model.Hierarchy[2].Type = testLowerBody
+	return model
+}
+
+func TestPuppetSubModeBasedOn(t *testing.T) {
+	pup := readTestPup(t)
+	p := NewPuppet(testPuppetModel(), pup, nil)
+
+	tests := []struct {
+		mode    int32
+		subMode string
+		key     string
+	}{
+		{0, "walk", "rystroll.key"},
+		{1, "walk", "rywalk.key"}, // defined by mode 1 itself
+		{1, "run", "ryrun.key"},   // inherited from mode 0
+		{1, "fire", "ryfire.key"}, // only in mode 1
+		{3, "walk", "ryfall.key"}, // mode 3 replaces every move of mode 0
+		{3, "death", "rycrumpg.key"},
+		{4, "walk", "ryfall.key"}, // inherited from mode 3
+		{4, "hit", "ryhitg.key"},  // inherited from mode 0 through mode 3
+		{0, "fire", ""},
+		{4, "fire", ""},
+	}
+	for _, test := range tests {
+		if err := p.SetMode(test.mode); err != nil {
+			t.Fatal(err)
+		}
+		subMode, ok := p.SubMode(test.subMode)
+		if ok != (test.key != "") || subMode.Keyframe != test.key {
+			t.Errorf("mode %d %s plays %q, expected %q", test.mode, test.subMode, subMode.Keyframe, test.key)
+		}
+	}
+
+	if err := p.SetMode(2); err == nil {
+		t.Error("switched to mode 2, which rystr.pup does not have")
+	}
+}
+
+func TestPuppetSetModeRestarts(t *testing.T) {
+	loader := &testKeyLoader{keys: []string{"rystroll.key", "rywalk.key"}}
+	p := NewPuppet(testPuppetModel(), readTestPup(t), loader.load)
+	if err := p.Play("walk"); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.SetMode(1); err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(loader.loaded) != "[rystroll.key rywalk.key]" || !p.Playing("walk") {
+		t.Errorf("loaded %v, expected walk to restart with the key of mode 1", loader.loaded)
+	}
+}
+
+func TestPuppetPriorities(t *testing.T) {
+	loader := &testKeyLoader{
+		keys: []string{"rywalk.key", "ryfire.key", "ryrun.key"},
+		tracks: map[string][]string{
+			"rywalk.key": {"head", "hip", "legs"},
+			"ryfire.key": {"head", "legs"},
+			"ryrun.key":  {"head", "hip", "legs"},
+		},
+		types: map[string]int32{"rywalk.key": 0xff, "ryfire.key": testUpperBody, "ryrun.key": 0xff},
+	}
+	p := NewPuppet(testPuppetModel(), readTestPup(t), loader.load)
+	if err := p.SetMode(1); err != nil {
+		t.Fatal(err)
+	}
+
+	positions := func() string {
+		pose := p.Pose()
+		return fmt.Sprint(pose[0].Position[0], pose[1].Position[0], pose[2].Position[0])
+	}
+	play := func(name string) {
+		t.Helper()
+		if err := p.Play(name); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if got := positions(); got != "0 0 0" {
+		t.Errorf("rest pose at %s, expected 0 0 0", got)
+	}
+
+	// walk is 2 2, fire 1 4: fire takes the head with its HiPri, on the legs
+	// its LoPri loses to walk and it has no hip track
+	play("walk")
+	play("fire")
+	if got := positions(); got != "2 1 1" {
+		t.Errorf("walking and firing at %s, expected the head firing, the rest walking: 2 1 1", got)
+	}
+
+	// run replaces walk, another looping submode, but not fire
+	play("run")
+	if p.Playing("walk") || !p.Playing("fire") {
+		t.Errorf("walk playing %v, fire playing %v, expected only fire kept", p.Playing("walk"), p.Playing("fire"))
+	}
+	if got := positions(); got != "2 3 3" {
+		t.Errorf("running and firing at %s, expected 2 3 3", got)
+	}
+
+	// fire plays once, after its 10 frames run drives every node again
+	p.Update(1.5)
+	if p.Playing("fire") {
+		t.Error("fire still playing after its last frame")
+	}
+	if got := positions(); got != "3 3 3" {
+		t.Errorf("running at %s, expected 3 3 3", got)
+	}
+}
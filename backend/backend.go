@@ -0,0 +1,89 @@
+// Package backend defines what scenes need from the platform they run on: a
+// Backend uploading levels, 3dos and images and drawing them every frame, and a
+// Window giving the size, time and input. The opengl package implements them
+// with a GLFW window, the raster package in software without a display and the
+// mock package records the calls for tests.
+package backend
+
+import (
+	"github.com/go-gl/mathgl/mgl32"
+	"github.com/joelhays/go-jk/animation"
+	"github.com/joelhays/go-jk/camera"
+	"github.com/joelhays/go-jk/jk/jktypes"
+)
+
+type ShadingMode int32
+
+const (
+	// SHADING_PHONG lights everything with a light placed at the camera
+	SHADING_PHONG ShadingMode = 0
+	// SHADING_COLORMAP shades texels through the colormap light levels like the original game
+	SHADING_COLORMAP ShadingMode = 1
+)
+
+// MeshHandle identifies geometry uploaded with its textures. The zero handle is never returned.
+type MeshHandle int32
+
+// TextureHandle identifies an uploaded image. The zero handle is never returned.
+type TextureHandle int32
+
+// Backend uploads resources and draws them. Uploads and draws happen on the
+// thread running the frames, releases may happen on any goroutine.
+type Backend interface {
+	// UploadLevel uploads the level geometry. Animated materials show the cel
+	// picked by animator, or their first cel when it is nil.
+	UploadLevel(mesh *jktypes.JkMesh, sectors []jktypes.Sector, animator *animation.CelAnimator) MeshHandle
+	// Upload3do uploads a 3do, animated like UploadLevel.
+	Upload3do(object *jktypes.Jk3doFile, animator *animation.CelAnimator) MeshHandle
+	// UploadImage uploads every image of a BM.
+	UploadImage(bm *jktypes.BMFile) TextureHandle
+	ReleaseMesh(mesh MeshHandle)
+	ReleaseTexture(texture TextureHandle)
+
+	// BeginFrame clears the frame and draws the following calls from cam.
+	BeginFrame(cam *camera.Camera)
+	// DrawLevel draws the surfaces of the given sectors, or all of them when sectors is nil.
+	DrawLevel(mesh MeshHandle, sectors []int64)
+	// Draw3do draws a 3do placed by thing and lit by sector, or fully lit when
+	// sector is nil. The hierarchy is posed by pose, or the rest pose when it is nil.
+	Draw3do(mesh MeshHandle, thing *jktypes.Thing, sector *jktypes.Sector, pose []animation.NodePose)
+	// DrawImage draws an image of an uploaded BM centered, scale being the
+	// fraction of the frame it covers. Nothing is drawn when there is no such image.
+	DrawImage(texture TextureHandle, image int, scale mgl32.Vec2)
+	// DrawQuads draws parts of an image of an uploaded BM over everything, all
+	// quads in one batch.
+	DrawQuads(texture TextureHandle, image int, quads []Quad)
+	// DrawMenu draws the main menu and returns what was clicked.
+	DrawMenu(menu MenuView) MenuEvent
+	EndFrame()
+
+	SetShadingMode(mode ShadingMode)
+	GetShadingMode() ShadingMode
+}
+
+// Quad is a rectangle of an image drawn to a rectangle of the frame, both in
+// pixels from their top left corner.
+type Quad struct {
+	X, Y, Width, Height             float32
+	SrcX, SrcY, SrcWidth, SrcHeight float32
+}
+
+// MenuView is what the main menu shows.
+type MenuView struct {
+	Background TextureHandle
+	Title      string
+	Tabs       []string
+	Tab        int
+	Items      []string
+}
+
+// MenuEvent is what was clicked in the main menu.
+type MenuEvent struct {
+	// Tab is the index of the clicked tab, or -1
+	Tab  int
+	Item string
+	Quit bool
+}
+
+// NoMenuEvent is returned by DrawMenu when nothing was clicked.
+var NoMenuEvent = MenuEvent{Tab: -1}
@@ -0,0 +1,150 @@
+// Package mock provides a backend.Backend recording what it is asked to do, to
+// check scenes without a display.
+package mock
+
+import (
+	"fmt"
+	"github.com/go-gl/mathgl/mgl32"
+	"github.com/joelhays/go-jk/animation"
+	"github.com/joelhays/go-jk/backend"
+	"github.com/joelhays/go-jk/camera"
+	"github.com/joelhays/go-jk/jk/jktypes"
+	"sync"
+)
+
+// Backend records every call as a line like "Draw3do 2 thing=walkplayer sector=4".
+// Uploads return increasing handles.
+type Backend struct {
+	// Menu answers DrawMenu, which returns backend.NoMenuEvent when it is nil
+	Menu func(view backend.MenuView) backend.MenuEvent
+
+	mutex      sync.Mutex
+	calls      []string
+	frames     int
+	nextHandle int32
+	live       map[int32]bool
+	shading    backend.ShadingMode
+}
+
+func NewBackend() *Backend {
+	return &Backend{live: make(map[int32]bool)}
+}
+
+// Calls returns the calls recorded since the last Reset.
+func (b *Backend) Calls() []string {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return append([]string(nil), b.calls...)
+}
+
+// Frames returns the number of frames ended.
+func (b *Backend) Frames() int {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.frames
+}
+
+// Live returns the number of handles uploaded and not released.
+func (b *Backend) Live() int {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return len(b.live)
+}
+
+// Reset forgets the recorded calls.
+func (b *Backend) Reset() {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.calls = nil
+}
+
+func (b *Backend) record(format string, args ...interface{}) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.calls = append(b.calls, fmt.Sprintf(format, args...))
+}
+
+func (b *Backend) upload() int32 {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.nextHandle++
+	b.live[b.nextHandle] = true
+	return b.nextHandle
+}
+
+func (b *Backend) release(handle int32) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	delete(b.live, handle)
+}
+
+func (b *Backend) UploadLevel(mesh *jktypes.JkMesh, sectors []jktypes.Sector, animator *animation.CelAnimator) backend.MeshHandle {
+	handle := b.upload()
+	b.record("UploadLevel %d surfaces=%d sectors=%d", handle, len(mesh.Surfaces), len(sectors))
+	return backend.MeshHandle(handle)
+}
+
+func (b *Backend) Upload3do(object *jktypes.Jk3doFile, animator *animation.CelAnimator) backend.MeshHandle {
+	handle := b.upload()
+	b.record("Upload3do %d geosets=%d", handle, len(object.GeoSets))
+	return backend.MeshHandle(handle)
+}
+
+func (b *Backend) UploadImage(bm *jktypes.BMFile) backend.TextureHandle {
+	handle := b.upload()
+	b.record("UploadImage %d images=%d", handle, len(bm.Images))
+	return backend.TextureHandle(handle)
+}
+
+func (b *Backend) ReleaseMesh(mesh backend.MeshHandle) {
+	b.release(int32(mesh))
+	b.record("ReleaseMesh %d", mesh)
+}
+
+func (b *Backend) ReleaseTexture(texture backend.TextureHandle) {
+	b.release(int32(texture))
+	b.record("ReleaseTexture %d", texture)
+}
+
+func (b *Backend) BeginFrame(cam *camera.Camera) {
+	b.record("BeginFrame")
+}
+
+func (b *Backend) DrawLevel(mesh backend.MeshHandle, sectors []int64) {
+	b.record("DrawLevel %d sectors=%d", mesh, len(sectors))
+}
+
+func (b *Backend) Draw3do(mesh backend.MeshHandle, thing *jktypes.Thing, sector *jktypes.Sector, pose []animation.NodePose) {
+	b.record("Draw3do %d thing=%s posed=%v", mesh, thing.TemplateName, pose != nil)
+}
+
+func (b *Backend) DrawImage(texture backend.TextureHandle, image int, scale mgl32.Vec2) {
+	b.record("DrawImage %d image=%d scale=%.2f,%.2f", texture, image, scale.X(), scale.Y())
+}
+
+func (b *Backend) DrawQuads(texture backend.TextureHandle, image int, quads []backend.Quad) {
+	b.record("DrawQuads %d image=%d quads=%d", texture, image, len(quads))
+}
+
+func (b *Backend) DrawMenu(menu backend.MenuView) backend.MenuEvent {
+	b.record("DrawMenu tab=%d items=%d", menu.Tab, len(menu.Items))
+	if b.Menu == nil {
+		return backend.NoMenuEvent
+	}
+	return b.Menu(menu)
+}
+
+func (b *Backend) EndFrame() {
+	b.record("EndFrame")
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.frames++
+}
+
+func (b *Backend) SetShadingMode(mode backend.ShadingMode) {
+	b.shading = mode
+}
+
+func (b *Backend) GetShadingMode() backend.ShadingMode {
+	return b.shading
+}
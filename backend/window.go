@@ -0,0 +1,136 @@
+package backend
+
+type Key int
+
+const (
+	KEY_UNKNOWN Key = iota
+	KEY_ESCAPE
+	KEY_L
+	KEY_W
+	KEY_A
+	KEY_S
+	KEY_D
+	KEY_UP
+	KEY_DOWN
+	KEY_LEFT
+	KEY_RIGHT
+	KEY_KP_SUBTRACT
+	KEY_KP_DECIMAL
+	KEY_KP_ADD
+	KEY_KP_1
+	KEY_KP_2
+	KEY_KP_3
+	KEY_KP_4
+)
+
+type Action int
+
+const (
+	ACTION_RELEASE Action = 0
+	ACTION_PRESS   Action = 1
+	ACTION_REPEAT  Action = 2
+)
+
+// Window is where the frames are shown and the input comes from.
+type Window interface {
+	GetSize() (int, int)
+	// GetTime returns the seconds since the window was created.
+	GetTime() float64
+	SetTitle(title string)
+	// SetCursorCaptured hides the cursor and reports unbounded movement, for mouse look.
+	SetCursorCaptured(captured bool)
+	SetKeyCallback(callback func(key Key, action Action))
+	SetCursorCallback(callback func(x float64, y float64))
+	// PollEvents calls the callbacks of the input received since the last call.
+	PollEvents()
+	ShouldClose() bool
+	SetShouldClose(close bool)
+}
+
+type inputEvent struct {
+	key    Key
+	action Action
+	x      float64
+	y      float64
+	cursor bool
+}
+
+// HeadlessWindow is a Window without a display. Time only passes and input only
+// happens when told to, so frames are the same on every run.
+type HeadlessWindow struct {
+	Title          string
+	CursorCaptured bool
+
+	width          int
+	height         int
+	time           float64
+	events         []inputEvent
+	keyCallback    func(key Key, action Action)
+	cursorCallback func(x float64, y float64)
+	shouldClose    bool
+}
+
+func NewHeadlessWindow(width int, height int) *HeadlessWindow {
+	return &HeadlessWindow{width: width, height: height}
+}
+
+func (w *HeadlessWindow) GetSize() (int, int) {
+	return w.width, w.height
+}
+
+func (w *HeadlessWindow) GetTime() float64 {
+	return w.time
+}
+
+// Advance lets seconds pass.
+func (w *HeadlessWindow) Advance(seconds float64) {
+	w.time += seconds
+}
+
+func (w *HeadlessWindow) SetTitle(title string) {
+	w.Title = title
+}
+
+func (w *HeadlessWindow) SetCursorCaptured(captured bool) {
+	w.CursorCaptured = captured
+}
+
+func (w *HeadlessWindow) SetKeyCallback(callback func(key Key, action Action)) {
+	w.keyCallback = callback
+}
+
+func (w *HeadlessWindow) SetCursorCallback(callback func(x float64, y float64)) {
+	w.cursorCallback = callback
+}
+
+// SendKey queues a key event for the next PollEvents.
+func (w *HeadlessWindow) SendKey(key Key, action Action) {
+	w.events = append(w.events, inputEvent{key: key, action: action})
+}
+
+// MoveCursor queues a cursor movement for the next PollEvents.
+func (w *HeadlessWindow) MoveCursor(x float64, y float64) {
+	w.events = append(w.events, inputEvent{x: x, y: y, cursor: true})
+}
+
+func (w *HeadlessWindow) PollEvents() {
+	events := w.events
+	w.events = nil
+	for _, event := range events {
+		if event.cursor {
+			if w.cursorCallback != nil {
+				w.cursorCallback(event.x, event.y)
+			}
+		} else if w.keyCallback != nil {
+			w.keyCallback(event.key, event.action)
+		}
+	}
+}
+
+func (w *HeadlessWindow) ShouldClose() bool {
+	return w.shouldClose
+}
+
+func (w *HeadlessWindow) SetShouldClose(close bool) {
+	w.shouldClose = close
+}
@@ -91,3 +91,9 @@ func (c *Camera) UpdateCameraVectors() {
 	c.Right = c.Front.Cross(c.WorldUp).Normalize()
 	c.Up = c.Right.Cross(c.Front).Normalize()
 }
+
+// ProjectionMatrix returns the perspective projection used when drawing with the
+// camera into a width by height picture.
+func (c *Camera) ProjectionMatrix(width int, height int) mgl32.Mat4 {
+	return mgl32.Perspective(mgl32.DegToRad(float32(c.Zoom)), float32(width)/float32(height), 0.01, 1000.0)
+}
@@ -0,0 +1,257 @@
+// Command gob lists, extracts and builds GOB archives.
+//
+//	gob ls archive.gob [pattern...]
+//	gob extract [-o dir] archive.gob [pattern...]
+//	gob cat archive.gob name
+//	gob pack archive.gob dir
+//	gob diff old.gob new.gob
+//
+// Patterns are globs matched case-insensitively against the entry path, using /
+// or \ as separator, or against the file name when they contain no separator.
+package main
+
+import (
+	"crypto/sha1"
+	"flag"
+	"fmt"
+	"github.com/joelhays/go-jk/jk"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+var commands = map[string]func(args []string) error{
+	"ls":      list,
+	"extract": extract,
+	"cat":     cat,
+	"pack":    pack,
+	"diff":    diff,
+}
+
+func main() {
+	flag.Usage = usage
+	flag.Parse()
+	if flag.NArg() == 0 {
+		usage()
+		os.Exit(2)
+	}
+
+	command, ok := commands[flag.Arg(0)]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "gob: unknown command %q\n", flag.Arg(0))
+		usage()
+		os.Exit(2)
+	}
+	if err := command(flag.Args()[1:]); err != nil {
+		fmt.Fprintf(os.Stderr, "gob: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, `usage:
+	gob ls archive.gob [pattern...]
+	gob extract [-o dir] archive.gob [pattern...]
+	gob cat archive.gob name
+	gob pack archive.gob dir
+	gob diff old.gob new.gob`)
+}
+
+func list(args []string) error {
+	if len(args) < 1 {
+		return fmt.Errorf("ls: missing archive")
+	}
+	gob, err := jk.ReadGOB(args[0])
+	if err != nil {
+		return err
+	}
+	for _, item := range gob.Items {
+		if matchAny(item.FileName, args[1:]) {
+			fmt.Printf("%10d %10d  %s\n", item.FileOffset, item.FileLength, item.FileName)
+		}
+	}
+	return nil
+}
+
+func extract(args []string) error {
+	flags := flag.NewFlagSet("extract", flag.ExitOnError)
+	outDir := flags.String("o", ".", "directory to extract to")
+	flags.Parse(args)
+	if flags.NArg() < 1 {
+		return fmt.Errorf("extract: missing archive")
+	}
+
+	gob, err := jk.ReadGOB(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	for _, item := range gob.Items {
+		if !matchAny(item.FileName, flags.Args()[1:]) {
+			continue
+		}
+		name := path.Clean("/" + strings.Replace(item.FileName, "\\", "/", -1))
+		if err := extractItem(gob, item, filepath.Join(*outDir, filepath.FromSlash(name))); err != nil {
+			return err
+		}
+		fmt.Println(item.FileName)
+	}
+	return nil
+}
+
+func extractItem(gob jk.GOB, item jk.GOBItem, outPath string) error {
+	if err := os.MkdirAll(filepath.Dir(outPath), 0755); err != nil {
+		return err
+	}
+	data, err := gob.Open(item)
+	if err != nil {
+		return err
+	}
+	defer data.Close()
+
+	out, err := os.Create(outPath)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, data); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+func cat(args []string) error {
+	if len(args) != 2 {
+		return fmt.Errorf("cat: expected an archive and an entry name")
+	}
+	gob, err := jk.ReadGOB(args[0])
+	if err != nil {
+		return err
+	}
+
+	name := entryKey(args[1])
+	for _, item := range gob.Items {
+		if entryKey(item.FileName) != name {
+			continue
+		}
+		data, err := gob.Open(item)
+		if err != nil {
+			return err
+		}
+		defer data.Close()
+		_, err = io.Copy(os.Stdout, data)
+		return err
+	}
+	return fmt.Errorf("%s: no entry %s", args[0], args[1])
+}
+
+func pack(args []string) error {
+	if len(args) != 2 {
+		return fmt.Errorf("pack: expected an archive and a directory")
+	}
+	out, err := os.Create(args[0])
+	if err != nil {
+		return err
+	}
+	if err := jk.WriteGOBDir(out, args[1]); err != nil {
+		out.Close()
+		os.Remove(args[0])
+		return err
+	}
+	return out.Close()
+}
+
+// diff prints the entries only in the old archive with -, only in the new one
+// with + and the entries whose content changed with M.
+func diff(args []string) error {
+	if len(args) != 2 {
+		return fmt.Errorf("diff: expected two archives")
+	}
+	oldHashes, oldNames, err := hashItems(args[0])
+	if err != nil {
+		return err
+	}
+	newHashes, newNames, err := hashItems(args[1])
+	if err != nil {
+		return err
+	}
+
+	var changed bool
+	for _, name := range oldNames {
+		newHash, ok := newHashes[entryKey(name)]
+		switch {
+		case !ok:
+			fmt.Printf("- %s\n", name)
+		case newHash != oldHashes[entryKey(name)]:
+			fmt.Printf("M %s\n", name)
+		default:
+			continue
+		}
+		changed = true
+	}
+	for _, name := range newNames {
+		if _, ok := oldHashes[entryKey(name)]; !ok {
+			fmt.Printf("+ %s\n", name)
+			changed = true
+		}
+	}
+
+	if changed {
+		os.Exit(1)
+	}
+	return nil
+}
+
+// hashItems returns the SHA-1 of every entry by entry key and the entry
+// names in archive order.
+func hashItems(gobPath string) (map[string][sha1.Size]byte, []string, error) {
+	gob, err := jk.ReadGOB(gobPath)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	hashes := make(map[string][sha1.Size]byte)
+	var names []string
+	for _, item := range gob.Items {
+		data, err := gob.Open(item)
+		if err != nil {
+			return nil, nil, err
+		}
+		hash := sha1.New()
+		_, err = io.Copy(hash, data)
+		data.Close()
+		if err != nil {
+			return nil, nil, &jk.GOBError{Path: gobPath, Err: err}
+		}
+
+		var sum [sha1.Size]byte
+		copy(sum[:], hash.Sum(nil))
+		hashes[entryKey(item.FileName)] = sum
+		names = append(names, item.FileName)
+	}
+	return hashes, names, nil
+}
+
+// entryKey identifies an entry regardless of case and path separator.
+func entryKey(name string) string {
+	return strings.ToUpper(strings.Replace(name, "/", "\\", -1))
+}
+
+func matchAny(name string, patterns []string) bool {
+	if len(patterns) == 0 {
+		return true
+	}
+	name = strings.ToLower(strings.Replace(name, "\\", "/", -1))
+	for _, pattern := range patterns {
+		pattern = strings.ToLower(strings.Replace(pattern, "\\", "/", -1))
+		target := name
+		if !strings.Contains(pattern, "/") {
+			target = path.Base(name)
+		}
+		if ok, _ := path.Match(pattern, target); ok {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,463 @@
+// Command jkconvert converts game files to formats other tools read.
+//
+//	jkconvert [flags] gltf [-o out.gltf|out.glb] name.jkl
+//	jkconvert [flags] gltf [-o out.gltf|out.glb] [-pup name.pup] name.3do [name.key...]
+//	jkconvert [flags] obj [-o dir] [-geoset n] name.jkl|name.3do
+//	jkconvert [flags] png [-o dir] [-cmp name.cmp] name.bm|name.mat|name.sft
+//	jkconvert [flags] mat [-o out.mat] [-cmp name.cmp] [-mipmaps n] cel.png...
+//	jkconvert [flags] bm [-o out.bm] [-cmp name.cmp] image.png...
+//
+// A 3do is exported with its hierarchy and every KEY as an animation. With -pup
+// the animations are named after the submodes playing them, and every KEY of the
+// puppet is exported when none are given. OBJ models are written to a directory
+// with their material library and a PNG per material.
+//
+// Images are exported to PNG, every image of a BM and every cel and mipmap of a
+// MAT in its own file. MATs and BMs are made of PNGs quantized to the colors of
+// a colormap, dflt.cmp unless given, with transparent pixels as color 0.
+//
+// Files are read from the game GOBs, or from a directory with -dir.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/joelhays/go-jk/convert"
+	"github.com/joelhays/go-jk/jk"
+	"github.com/joelhays/go-jk/jk/jkparsers"
+	"github.com/joelhays/go-jk/jk/jktypes"
+	"image"
+	"image/png"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+var (
+	installDir = flag.String("installdir", "", "path to the Jedi Knight install directory (overrides "+jk.InstallDirEnv+")")
+	dir        = flag.String("dir", "", "read the files from this directory instead of the game GOBs")
+)
+
+var commands = map[string]func(resolver jk.ResourceResolver, args []string) error{
+	"bm":   bm,
+	"gltf": gltf,
+	"mat":  mat,
+	"obj":  obj,
+	"png":  pngs,
+}
+
+func main() {
+	flag.Usage = usage
+	flag.Parse()
+	if flag.NArg() == 0 {
+		usage()
+		os.Exit(2)
+	}
+
+	command, ok := commands[flag.Arg(0)]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "jkconvert: unknown command %q\n", flag.Arg(0))
+		usage()
+		os.Exit(2)
+	}
+
+	resolver, err := newResolver()
+	if err == nil {
+		err = command(resolver, flag.Args()[1:])
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "jkconvert: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, `usage:
+	jkconvert [flags] gltf [-o out.gltf|out.glb] name.jkl
+	jkconvert [flags] gltf [-o out.gltf|out.glb] [-pup name.pup] name.3do [name.key...]
+	jkconvert [flags] obj [-o dir] [-geoset n] name.jkl|name.3do
+	jkconvert [flags] png [-o dir] [-cmp name.cmp] name.bm|name.mat|name.sft
+	jkconvert [flags] mat [-o out.mat] [-cmp name.cmp] [-mipmaps n] cel.png...
+	jkconvert [flags] bm [-o out.bm] [-cmp name.cmp] image.png...`)
+	flag.PrintDefaults()
+}
+
+func newResolver() (jk.ResourceResolver, error) {
+	if *dir != "" {
+		return jk.FSResolver{FS: os.DirFS(*dir)}, nil
+	}
+
+	cfg, err := jk.LoadConfig(*installDir)
+	if err != nil {
+		return nil, err
+	}
+	if err := jk.InitLoader(cfg); err != nil {
+		return nil, err
+	}
+	return jk.GetLoader().FS(), nil
+}
+
+func gltf(resolver jk.ResourceResolver, args []string) error {
+	flags := flag.NewFlagSet("gltf", flag.ExitOnError)
+	out := flags.String("o", "", "file to write, .glb for a binary glTF, defaults to the name with a .gltf extension")
+	pupName := flags.String("pup", "", "name the animations of a 3do after the submodes of this puppet")
+	flags.Parse(args)
+	if flags.NArg() < 1 {
+		return fmt.Errorf("gltf: missing level or 3do")
+	}
+	name := flags.Arg(0)
+
+	var doc *convert.GLTF
+	switch strings.ToLower(path.Ext(name)) {
+	case ".jkl":
+		if flags.NArg() > 1 {
+			return fmt.Errorf("gltf: expected a single level")
+		}
+		level, err := loadLevel(resolver, name)
+		if err != nil {
+			return err
+		}
+		if doc, err = convert.FromJkl2gltf(&level, baseName(name)); err != nil {
+			return err
+		}
+
+	case ".3do":
+		object, err := load3do(resolver, name)
+		if err != nil {
+			return err
+		}
+		clips, err := loadClips(resolver, *pupName, flags.Args()[1:])
+		if err != nil {
+			return err
+		}
+		if doc, err = convert.From3do2gltf(&object, baseName(name), clips); err != nil {
+			return err
+		}
+
+	default:
+		return fmt.Errorf("%s: not a level or 3do", name)
+	}
+	return doc.Save(outPath(*out, name, ".gltf"))
+}
+
+func obj(resolver jk.ResourceResolver, args []string) error {
+	flags := flag.NewFlagSet("obj", flag.ExitOnError)
+	out := flags.String("o", ".", "directory to write the .obj, .mtl and textures to")
+	geoset := flags.Int("geoset", 0, "geoset of a 3do to export, 0 is the most detailed")
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		return fmt.Errorf("obj: expected a single level or 3do")
+	}
+	name := flags.Arg(0)
+
+	var model *convert.OBJ
+	switch strings.ToLower(path.Ext(name)) {
+	case ".jkl":
+		level, err := loadLevel(resolver, name)
+		if err != nil {
+			return err
+		}
+		if level.Model == nil {
+			return fmt.Errorf("%s: level has no geometry", name)
+		}
+		model = convert.FromJkMesh2obj(level.Model, baseName(name))
+
+	case ".3do":
+		object, err := load3do(resolver, name)
+		if err != nil {
+			return err
+		}
+		if model, err = convert.From3do2obj(&object, baseName(name), *geoset); err != nil {
+			return err
+		}
+
+	default:
+		return fmt.Errorf("%s: not a level or 3do", name)
+	}
+	return model.Save(*out)
+}
+
+func pngs(resolver jk.ResourceResolver, args []string) error {
+	flags := flag.NewFlagSet("png", flag.ExitOnError)
+	out := flags.String("o", ".", "directory to write the images to")
+	cmpName := flags.String("cmp", "", "colormap of a MAT, or of a BM without a palette, defaults to dflt.cmp for MATs")
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		return fmt.Errorf("png: expected a single BM, MAT or SFT")
+	}
+	name := flags.Arg(0)
+	data, err := resolver.ReadResource(name)
+	if err != nil {
+		return err
+	}
+
+	images := make(map[string]image.Image)
+	switch strings.ToLower(path.Ext(name)) {
+	case ".bm":
+		parser := jkparsers.NewBmParser(resolver)
+		parser.SetFileName(name)
+		file, err := parser.ParseFromBytes(data)
+		if err != nil {
+			return err
+		}
+		if err := setPalette(resolver, &file, *cmpName); err != nil {
+			return err
+		}
+		for i := range file.Images {
+			img, err := convert.BMImage(&file, i)
+			if err != nil {
+				return fmt.Errorf("%s: %v", name, err)
+			}
+			if len(file.Images) == 1 {
+				images[baseName(name)+".png"] = img
+			} else {
+				images[fmt.Sprintf("%s_%d.png", baseName(name), i)] = img
+			}
+		}
+
+	case ".sft":
+		parser := jkparsers.NewSftParser(resolver)
+		parser.SetFileName(name)
+		file, err := parser.ParseFromBytes(data)
+		if err != nil {
+			return err
+		}
+		if err := setPalette(resolver, &file.BMFile, *cmpName); err != nil {
+			return err
+		}
+		img, err := convert.SFTImage(&file)
+		if err != nil {
+			return fmt.Errorf("%s: %v", name, err)
+		}
+		images[baseName(name)+".png"] = img
+
+	case ".mat":
+		parser := jkparsers.NewMatParser()
+		parser.SetFileName(name)
+		material, err := parser.ParseFromBytes(data)
+		if err != nil {
+			return err
+		}
+		if *cmpName == "" {
+			*cmpName = "dflt.cmp"
+		}
+		colorMap, err := loadColorMap(resolver, *cmpName)
+		if err != nil {
+			return err
+		}
+		for cel, levels := range convert.MaterialImages(&material, colorMap.Palette) {
+			for level, img := range levels {
+				images[fmt.Sprintf("%s_%d_%d.png", baseName(name), cel, level)] = img
+			}
+		}
+
+	default:
+		return fmt.Errorf("%s: not a BM, MAT or SFT", name)
+	}
+
+	if err := os.MkdirAll(*out, 0755); err != nil {
+		return err
+	}
+	for fileName, img := range images {
+		if err := savePNG(filepath.Join(*out, fileName), img); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func mat(resolver jk.ResourceResolver, args []string) error {
+	flags := flag.NewFlagSet("mat", flag.ExitOnError)
+	out := flags.String("o", "", "file to write, defaults to the name of the first image with a .mat extension")
+	cmpName := flags.String("cmp", "dflt.cmp", "colormap to quantize the images to")
+	mipMaps := flags.Int("mipmaps", 4, "number of mipmap levels of every cel")
+	flags.Parse(args)
+	if flags.NArg() == 0 {
+		return fmt.Errorf("mat: expected an image per cel")
+	}
+
+	colorMap, err := loadColorMap(resolver, *cmpName)
+	if err != nil {
+		return err
+	}
+	cels, err := loadPNGs(flags.Args())
+	if err != nil {
+		return err
+	}
+	fileName := outPath(*out, flags.Arg(0), ".mat")
+	material, err := convert.NewMaterial(path.Base(fileName), cels, colorMap.Palette, *mipMaps)
+	if err != nil {
+		return err
+	}
+	return writeFile(fileName, func(w io.Writer) error {
+		return convert.WriteMAT(w, &material)
+	})
+}
+
+func bm(resolver jk.ResourceResolver, args []string) error {
+	flags := flag.NewFlagSet("bm", flag.ExitOnError)
+	out := flags.String("o", "", "file to write, defaults to the name of the first image with a .bm extension")
+	cmpName := flags.String("cmp", "dflt.cmp", "colormap to quantize the images to, stored in the BM")
+	flags.Parse(args)
+	if flags.NArg() == 0 {
+		return fmt.Errorf("bm: expected at least one image")
+	}
+
+	colorMap, err := loadColorMap(resolver, *cmpName)
+	if err != nil {
+		return err
+	}
+	images, err := loadPNGs(flags.Args())
+	if err != nil {
+		return err
+	}
+	file, err := convert.NewBM(images, colorMap.Palette)
+	if err != nil {
+		return err
+	}
+	return writeFile(outPath(*out, flags.Arg(0), ".bm"), func(w io.Writer) error {
+		return convert.WriteBM(w, &file)
+	})
+}
+
+// setPalette replaces the palette of a BM that does not include one with the colors of cmpName, when given.
+func setPalette(resolver jk.ResourceResolver, bm *jktypes.BMFile, cmpName string) error {
+	if cmpName == "" || bm.Header.PaletteIncluded == 2 {
+		return nil
+	}
+	colorMap, err := loadColorMap(resolver, cmpName)
+	if err != nil {
+		return err
+	}
+	bm.Palette.Palette = colorMap.Palette
+	return nil
+}
+
+func loadColorMap(resolver jk.ResourceResolver, name string) (jktypes.ColorMap, error) {
+	data, err := resolver.ReadResource(name)
+	if err != nil {
+		return jktypes.ColorMap{}, err
+	}
+	parser := jkparsers.NewCmpParser()
+	parser.SetFileName(name)
+	return parser.ParseFromBytes(data)
+}
+
+// loadPNGs reads images from the local file system rather than the game files.
+func loadPNGs(fileNames []string) ([]image.Image, error) {
+	var images []image.Image
+	for _, fileName := range fileNames {
+		file, err := os.Open(fileName)
+		if err != nil {
+			return nil, err
+		}
+		img, err := png.Decode(file)
+		file.Close()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", fileName, err)
+		}
+		images = append(images, img)
+	}
+	return images, nil
+}
+
+func savePNG(fileName string, img image.Image) error {
+	return writeFile(fileName, func(w io.Writer) error {
+		return png.Encode(w, img)
+	})
+}
+
+func writeFile(fileName string, write func(w io.Writer) error) error {
+	file, err := os.Create(fileName)
+	if err != nil {
+		return err
+	}
+	if err := write(file); err != nil {
+		file.Close()
+		return fmt.Errorf("%s: %v", fileName, err)
+	}
+	return file.Close()
+}
+
+// loadClips loads the KEYs to export, named after their first submode when a puppet is given.
+func loadClips(resolver jk.ResourceResolver, pupName string, keyNames []string) ([]convert.Clip, error) {
+	var subModes map[string][]string
+	if pupName != "" {
+		data, err := resolver.ReadResource(pupName)
+		if err != nil {
+			return nil, err
+		}
+		pup, err := jkparsers.NewPupLineParser().ParseFromString(string(data))
+		if err != nil {
+			return nil, err
+		}
+		subModes = convert.PupClipNames(&pup)
+
+		if len(keyNames) == 0 {
+			for keyName := range subModes {
+				keyNames = append(keyNames, keyName)
+			}
+			sort.Strings(keyNames)
+		}
+	}
+
+	var clips []convert.Clip
+	for _, keyName := range keyNames {
+		data, err := resolver.ReadResource(keyName)
+		if err != nil {
+			if pupName != "" {
+				// puppets name the KEYs of every mode, not all of them ship
+				fmt.Fprintf(os.Stderr, "jkconvert: %v\n", err)
+				continue
+			}
+			return nil, err
+		}
+		key, err := jkparsers.NewKeyLineParser().ParseFromString(string(data))
+		if err != nil {
+			return nil, err
+		}
+
+		clip := convert.Clip{Name: baseName(keyName), Key: &key, SubModes: subModes[strings.ToLower(path.Base(keyName))]}
+		if len(clip.SubModes) > 0 {
+			clip.Name = clip.SubModes[0]
+		}
+		clips = append(clips, clip)
+	}
+	return clips, nil
+}
+
+func loadLevel(resolver jk.ResourceResolver, name string) (jktypes.Jkl, error) {
+	data, err := resolver.ReadResource(name)
+	if err != nil {
+		return jktypes.Jkl{}, err
+	}
+	parser := jkparsers.NewJklLineParser(resolver)
+	parser.SetFileName(name)
+	return parser.ParseFromString(string(data))
+}
+
+func load3do(resolver jk.ResourceResolver, name string) (jktypes.Jk3doFile, error) {
+	data, err := resolver.ReadResource(name)
+	if err != nil {
+		return jktypes.Jk3doFile{}, err
+	}
+	parser := jkparsers.NewJk3doLineParser(resolver)
+	parser.SetFileName(name)
+	return parser.ParseFromString(string(data))
+}
+
+// baseName returns the file name of a resource without its directory and extension.
+func baseName(name string) string {
+	name = path.Base(strings.Replace(name, "\\", "/", -1))
+	return strings.TrimSuffix(name, path.Ext(name))
+}
+
+func outPath(out string, name string, ext string) string {
+	if out != "" {
+		return out
+	}
+	return baseName(name) + ext
+}
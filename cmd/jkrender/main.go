@@ -0,0 +1,209 @@
+// Command jkrender draws a level or 3do to a PNG without a window or GPU.
+//
+//	jkrender [flags] name.jkl|name.3do
+//
+// Levels are seen from the player start, 3dos from the front. With -golden the
+// picture is compared to a reference PNG instead, the command fails when too
+// many pixels differ and writes the reference when it does not exist yet.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/go-gl/mathgl/mgl32"
+	"github.com/joelhays/go-jk/camera"
+	"github.com/joelhays/go-jk/jk"
+	"github.com/joelhays/go-jk/jk/jkparsers"
+	"github.com/joelhays/go-jk/jk/jktypes"
+	"github.com/joelhays/go-jk/raster"
+	"github.com/joelhays/go-jk/visibility"
+	"image"
+	"image/png"
+	"os"
+	"path"
+	"strings"
+)
+
+var (
+	installDir = flag.String("installdir", "", "path to the Jedi Knight install directory (overrides "+jk.InstallDirEnv+")")
+	dir        = flag.String("dir", "", "read the files from this directory instead of the game GOBs")
+	out        = flag.String("o", "", "PNG file to write, defaults to the name with a .png extension")
+	width      = flag.Int("w", 640, "width of the picture")
+	height     = flag.Int("h", 480, "height of the picture")
+	colormap   = flag.Bool("colormap", false, "shade through the colormap like the game instead of with a light at the camera")
+	position   = flag.String("pos", "", "camera position as x,y,z")
+	yaw        = flag.Float64("yaw", 0, "camera yaw in degrees, used with -pos")
+	pitch      = flag.Float64("pitch", 0, "camera pitch in degrees, used with -pos")
+	golden     = flag.String("golden", "", "compare to this PNG, writing it when missing")
+	tolerance  = flag.Int("tolerance", 8, "largest channel difference of pixels considered equal with -golden")
+	maxDiff    = flag.Float64("maxdiff", 0.001, "largest fraction of differing pixels accepted with -golden")
+)
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: jkrender [flags] name.jkl|name.3do")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	if err := run(flag.Arg(0)); err != nil {
+		fmt.Fprintf(os.Stderr, "jkrender: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func run(name string) error {
+	resolver, err := newResolver()
+	if err != nil {
+		return err
+	}
+
+	cam := camera.NewCamera(mgl32.Vec3{0, 0, 0}, mgl32.Vec3{0, 0, 1}, 0, 0)
+	fb := raster.NewFramebuffer(*width, *height)
+	if *colormap {
+		fb.Shading = raster.SHADING_COLORMAP
+	}
+
+	img, err := render(resolver, name, fb, &cam)
+	if err != nil {
+		return err
+	}
+
+	if *golden != "" {
+		return compare(img, *golden)
+	}
+	outPath := *out
+	if outPath == "" {
+		outPath = strings.TrimSuffix(path.Base(strings.Replace(name, "\\", "/", -1)), path.Ext(name)) + ".png"
+	}
+	return writePNG(outPath, img)
+}
+
+func newResolver() (jk.ResourceResolver, error) {
+	if *dir != "" {
+		return jk.FSResolver{FS: os.DirFS(*dir)}, nil
+	}
+
+	cfg, err := jk.LoadConfig(*installDir)
+	if err != nil {
+		return nil, err
+	}
+	if err := jk.InitLoader(cfg); err != nil {
+		return nil, err
+	}
+	return jk.GetLoader().FS(), nil
+}
+
+func render(resolver jk.ResourceResolver, name string, fb *raster.Framebuffer, cam *camera.Camera) (image.Image, error) {
+	data, err := resolver.ReadResource(name)
+	if err != nil {
+		return nil, err
+	}
+
+	switch strings.ToLower(path.Ext(name)) {
+	case ".jkl":
+		parser := jkparsers.NewJklLineParser(resolver)
+		parser.SetFileName(name)
+		level, err := parser.ParseFromString(string(data))
+		if err != nil {
+			return nil, err
+		}
+
+		culler := visibility.NewCuller(&level)
+		for _, thing := range level.Things {
+			if thing.TemplateName == "walkplayer" {
+				// things face +y at yaw 0, the camera faces +x
+				cam.Position = thing.Position
+				cam.Yaw = -(thing.Yaw + 90)
+				culler.SetSector(thing.Sector)
+				break
+			}
+		}
+		if err := placeCamera(cam); err != nil {
+			return nil, err
+		}
+		fb.SetCamera(cam)
+		culler.Update(cam.Position, fb.ViewProjection())
+		raster.Draw(fb, cam, []raster.Renderer{raster.NewJklRenderer(&level, culler, nil)})
+
+	case ".3do":
+		parser := jkparsers.NewJk3doLineParser(resolver)
+		parser.SetFileName(name)
+		obj, err := parser.ParseFromString(string(data))
+		if err != nil {
+			return nil, err
+		}
+
+		renderer := raster.NewJk3doRenderer(&jktypes.Thing{}, &obj, nil, nil)
+		min, max := renderer.Bounds()
+		raster.FrameBounds(cam, min, max)
+		if err := placeCamera(cam); err != nil {
+			return nil, err
+		}
+		raster.Draw(fb, cam, []raster.Renderer{renderer})
+
+	default:
+		return nil, fmt.Errorf("%s: not a level or 3do", name)
+	}
+	return fb.Image(), nil
+}
+
+// placeCamera applies the -pos, -yaw and -pitch flags.
+func placeCamera(cam *camera.Camera) error {
+	if *position == "" {
+		cam.UpdateCameraVectors()
+		return nil
+	}
+	var x, y, z float32
+	if _, err := fmt.Sscanf(*position, "%f,%f,%f", &x, &y, &z); err != nil {
+		return fmt.Errorf("invalid -pos %q: %v", *position, err)
+	}
+	cam.Position = mgl32.Vec3{x, y, z}
+	cam.Yaw = *yaw
+	cam.Pitch = *pitch
+	cam.UpdateCameraVectors()
+	return nil
+}
+
+func compare(img image.Image, goldenPath string) error {
+	file, err := os.Open(goldenPath)
+	if os.IsNotExist(err) {
+		fmt.Printf("writing %s\n", goldenPath)
+		return writePNG(goldenPath, img)
+	}
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	want, err := png.Decode(file)
+	if err != nil {
+		return fmt.Errorf("%s: %v", goldenPath, err)
+	}
+
+	bounds := img.Bounds()
+	diff := raster.Diff(img, want, *tolerance)
+	if float64(diff) > *maxDiff*float64(bounds.Dx()*bounds.Dy()) {
+		if *out != "" {
+			writePNG(*out, img)
+		}
+		return fmt.Errorf("%d of %d pixels differ from %s", diff, bounds.Dx()*bounds.Dy(), goldenPath)
+	}
+	return nil
+}
+
+func writePNG(outPath string, img image.Image) error {
+	file, err := os.Create(outPath)
+	if err != nil {
+		return err
+	}
+	if err := png.Encode(file, img); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
@@ -0,0 +1,214 @@
+package cog
+
+import (
+	"fmt"
+	"github.com/go-gl/mathgl/mgl32"
+	"log"
+)
+
+// builtinVerbs returns the verbs handled by the VM itself, the flow control,
+// message, timer, math and print verbs. A library can override any of them.
+func builtinVerbs() map[string]Verb {
+	return map[string]Verb{
+		"sleep": func(ctx *Context, args Args) (Value, error) {
+			ctx.Sleep(float64(args.Flex(0)))
+			return IntValue(0), nil
+		},
+		"getsenderref": func(ctx *Context, args Args) (Value, error) {
+			return IntValue(ctx.Message().Sender), nil
+		},
+		"getsenderid": func(ctx *Context, args Args) (Value, error) {
+			return IntValue(ctx.Message().SenderID), nil
+		},
+		"getsendertype": func(ctx *Context, args Args) (Value, error) {
+			return IntValue(ctx.Message().SenderType), nil
+		},
+		"getsourceref": func(ctx *Context, args Args) (Value, error) {
+			return IntValue(ctx.Message().Source), nil
+		},
+		"getsourcetype": func(ctx *Context, args Args) (Value, error) {
+			return IntValue(ctx.Message().SourceType), nil
+		},
+		"getparam": func(ctx *Context, args Args) (Value, error) {
+			n := args.Int(0)
+			if n < 0 || n > 3 {
+				return Value{}, fmt.Errorf("no parameter %d", n)
+			}
+			return ctx.thread.message.Params[n], nil
+		},
+		"setparam": func(ctx *Context, args Args) (Value, error) {
+			n := args.Int(0)
+			if n < 0 || n > 3 {
+				return Value{}, fmt.Errorf("no parameter %d", n)
+			}
+			ctx.thread.message.Params[n] = args.Value(1)
+			return IntValue(0), nil
+		},
+		"returnex": func(ctx *Context, args Args) (Value, error) {
+			ctx.thread.returnValue = args.Value(0)
+			return IntValue(0), nil
+		},
+		"getselfcog": func(ctx *Context, args Args) (Value, error) {
+			return IntValue(ctx.Instance().ID), nil
+		},
+		"getmastercog": func(ctx *Context, args Args) (Value, error) {
+			return IntValue(ctx.vm.master), nil
+		},
+		"setmastercog": func(ctx *Context, args Args) (Value, error) {
+			ctx.vm.master = args.Int(0)
+			return IntValue(0), nil
+		},
+		"setpulse": func(ctx *Context, args Args) (Value, error) {
+			instance := ctx.Instance()
+			instance.pulse = float64(args.Flex(0))
+			instance.nextPulse = ctx.vm.time + instance.pulse
+			return IntValue(0), nil
+		},
+		"settimer": func(ctx *Context, args Args) (Value, error) {
+			instance := ctx.Instance()
+			timers := instance.timers[:0]
+			for _, tm := range instance.timers {
+				if tm.ex {
+					timers = append(timers, tm)
+				}
+			}
+			instance.timers = timers
+			if args.Flex(0) > 0 {
+				instance.timers = append(instance.timers, timer{due: ctx.vm.time + float64(args.Flex(0))})
+			}
+			return IntValue(0), nil
+		},
+		"settimerex": func(ctx *Context, args Args) (Value, error) {
+			instance := ctx.Instance()
+			instance.timers = append(instance.timers, timer{
+				due:    ctx.vm.time + float64(args.Flex(0)),
+				id:     args.Int(1),
+				params: [2]Value{args.Value(2), args.Value(3)},
+				ex:     true,
+			})
+			return IntValue(0), nil
+		},
+		"killtimerex": func(ctx *Context, args Args) (Value, error) {
+			instance := ctx.Instance()
+			timers := instance.timers[:0]
+			for _, tm := range instance.timers {
+				if !tm.ex || tm.id != args.Int(0) {
+					timers = append(timers, tm)
+				}
+			}
+			instance.timers = timers
+			return IntValue(0), nil
+		},
+		"sendmessage": func(ctx *Context, args Args) (Value, error) {
+			return sendMessage(ctx, args, false)
+		},
+		"sendmessageex": func(ctx *Context, args Args) (Value, error) {
+			return sendMessage(ctx, args, true)
+		},
+		"sendtrigger": func(ctx *Context, args Args) (Value, error) {
+			message := NewMessage("trigger")
+			message.SenderID = args.Int(1)
+			for i := 0; i < 4; i++ {
+				message.Params[i] = args.Value(2 + i)
+			}
+			return IntValue(0), ctx.vm.Broadcast(message)
+		},
+		"getleveltime": func(ctx *Context, args Args) (Value, error) {
+			return FlexValue(float32(ctx.vm.time)), nil
+		},
+		"getgametime": func(ctx *Context, args Args) (Value, error) {
+			return IntValue(int32(ctx.vm.time * 1000)), nil
+		},
+		"getflexgametime": func(ctx *Context, args Args) (Value, error) {
+			return FlexValue(float32(ctx.vm.time)), nil
+		},
+		"rand": func(ctx *Context, args Args) (Value, error) {
+			return FlexValue(ctx.vm.rand.Float32()), nil
+		},
+		"randvec": func(ctx *Context, args Args) (Value, error) {
+			r := ctx.vm.rand
+			return VectorValue(mgl32.Vec3{r.Float32()*2 - 1, r.Float32()*2 - 1, r.Float32()*2 - 1}), nil
+		},
+		"bitset": func(ctx *Context, args Args) (Value, error) {
+			return IntValue(args.Int(0) | args.Int(1)), nil
+		},
+		"bittest": func(ctx *Context, args Args) (Value, error) {
+			return IntValue(args.Int(0) & args.Int(1)), nil
+		},
+		"bitclear": func(ctx *Context, args Args) (Value, error) {
+			return IntValue(args.Int(0) &^ args.Int(1)), nil
+		},
+		"vectorset": func(ctx *Context, args Args) (Value, error) {
+			return VectorValue(mgl32.Vec3{args.Flex(0), args.Flex(1), args.Flex(2)}), nil
+		},
+		"vectoradd": func(ctx *Context, args Args) (Value, error) {
+			return VectorValue(args.Vector(0).Add(args.Vector(1))), nil
+		},
+		"vectorsub": func(ctx *Context, args Args) (Value, error) {
+			return VectorValue(args.Vector(0).Sub(args.Vector(1))), nil
+		},
+		"vectorscale": func(ctx *Context, args Args) (Value, error) {
+			return VectorValue(args.Vector(0).Mul(args.Flex(1))), nil
+		},
+		"vectordot": func(ctx *Context, args Args) (Value, error) {
+			return FlexValue(args.Vector(0).Dot(args.Vector(1))), nil
+		},
+		"vectorcross": func(ctx *Context, args Args) (Value, error) {
+			return VectorValue(args.Vector(0).Cross(args.Vector(1))), nil
+		},
+		"vectorlen": func(ctx *Context, args Args) (Value, error) {
+			return FlexValue(args.Vector(0).Len()), nil
+		},
+		"vectornorm": func(ctx *Context, args Args) (Value, error) {
+			v := args.Vector(0)
+			if v.Len() == 0 {
+				return VectorValue(v), nil
+			}
+			return VectorValue(v.Normalize()), nil
+		},
+		"vectordist": func(ctx *Context, args Args) (Value, error) {
+			return FlexValue(args.Vector(0).Sub(args.Vector(1)).Len()), nil
+		},
+		"vectorequal": func(ctx *Context, args Args) (Value, error) {
+			return BoolValue(args.Vector(0) == args.Vector(1)), nil
+		},
+		"vectorx": func(ctx *Context, args Args) (Value, error) {
+			return FlexValue(args.Vector(0)[0]), nil
+		},
+		"vectory": func(ctx *Context, args Args) (Value, error) {
+			return FlexValue(args.Vector(0)[1]), nil
+		},
+		"vectorz": func(ctx *Context, args Args) (Value, error) {
+			return FlexValue(args.Vector(0)[2]), nil
+		},
+		"print":       printVerb,
+		"printint":    printVerb,
+		"printflex":   printVerb,
+		"printvector": printVerb,
+	}
+}
+
+// sendMessage implements SendMessage(cog, message) and SendMessageEx(cog,
+// message, param0, param1, param2, param3).
+func sendMessage(ctx *Context, args Args, ex bool) (Value, error) {
+	target := ctx.vm.Instance(args.Int(0))
+	if target == nil {
+		return IntValue(-1), nil
+	}
+
+	message := NewMessage(args.Str(1))
+	message.SenderType = SENDER_TYPE_SYSTEM
+	message.Sender = ctx.Instance().ID
+	message.Source = ctx.Instance().ID
+	if ex {
+		for i := 0; i < 4; i++ {
+			message.Params[i] = args.Value(2 + i)
+		}
+	}
+	return ctx.vm.Send(target, message)
+}
+
+func printVerb(ctx *Context, args Args) (Value, error) {
+	log.Printf("%s: %s", ctx.Instance().Program.Name, args.Value(0))
+	return IntValue(0), nil
+}
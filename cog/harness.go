@@ -0,0 +1,179 @@
+package cog
+
+import (
+	"fmt"
+	"github.com/joelhays/go-jk/animation"
+	"github.com/joelhays/go-jk/jk/jkparsers"
+	"github.com/joelhays/go-jk/jk/jktypes"
+	"strings"
+)
+
+// MockWorld is a minimal level for running COGs without a renderer. It has
+// things moving between their frames and sectors and surfaces with a light and a cel.
+type MockWorld struct {
+	Things       []jktypes.Thing
+	SectorLights map[int32]float32
+	SurfaceCels  map[int32]int32
+	movers       []*animation.FrameMover
+}
+
+func NewMockWorld(things ...jktypes.Thing) *MockWorld {
+	w := &MockWorld{Things: things, SectorLights: make(map[int32]float32), SurfaceCels: make(map[int32]int32)}
+	for i := range w.Things {
+		w.movers = append(w.movers, animation.NewFrameMover(&w.Things[i]))
+	}
+	return w
+}
+
+func (w *MockWorld) mover(thing int32) (*animation.FrameMover, error) {
+	if thing < 0 || int(thing) >= len(w.movers) {
+		return nil, fmt.Errorf("no thing %d", thing)
+	}
+	return w.movers[thing], nil
+}
+
+func (w *MockWorld) Update(deltaTime float64) {
+	for _, mover := range w.movers {
+		mover.Update(deltaTime)
+	}
+}
+
+func (w *MockWorld) RegisterVerbs(library *Library) {
+	library.Register("MoveToFrame", func(ctx *Context, args Args) (Value, error) {
+		mover, err := w.mover(args.Int(0))
+		if err != nil {
+			return Value{}, err
+		}
+		mover.MoveToFrame(int(args.Int(1)), args.Flex(2))
+		return IntValue(0), nil
+	})
+	library.Register("GetCurFrame", func(ctx *Context, args Args) (Value, error) {
+		mover, err := w.mover(args.Int(0))
+		if err != nil {
+			return Value{}, err
+		}
+		return IntValue(int32(mover.CurFrame())), nil
+	})
+	library.Register("IsThingMoving", func(ctx *Context, args Args) (Value, error) {
+		mover, err := w.mover(args.Int(0))
+		if err != nil {
+			return Value{}, err
+		}
+		return BoolValue(mover.Moving()), nil
+	})
+	library.Register("WaitForStop", func(ctx *Context, args Args) (Value, error) {
+		mover, err := w.mover(args.Int(0))
+		if err != nil {
+			return Value{}, err
+		}
+		ctx.WaitUntil(func() bool { return !mover.Moving() })
+		return IntValue(0), nil
+	})
+	library.Register("GetThingPos", func(ctx *Context, args Args) (Value, error) {
+		if _, err := w.mover(args.Int(0)); err != nil {
+			return Value{}, err
+		}
+		return VectorValue(w.Things[args.Int(0)].Position), nil
+	})
+	library.Register("SetSectorLight", func(ctx *Context, args Args) (Value, error) {
+		w.SectorLights[args.Int(0)] = args.Flex(1)
+		return IntValue(0), nil
+	})
+	library.Register("GetSectorLight", func(ctx *Context, args Args) (Value, error) {
+		return FlexValue(w.SectorLights[args.Int(0)]), nil
+	})
+	library.Register("SetWallCel", func(ctx *Context, args Args) (Value, error) {
+		previous := w.SurfaceCels[args.Int(0)]
+		w.SurfaceCels[args.Int(0)] = args.Int(1)
+		return IntValue(previous), nil
+	})
+	library.Register("GetWallCel", func(ctx *Context, args Args) (Value, error) {
+		return IntValue(w.SurfaceCels[args.Int(0)]), nil
+	})
+}
+
+// Harness runs COGs headless, e.g. to check a script against a MockWorld. It
+// records every verb call, verbs missing from the library return the value set
+// with Returns, or 0.
+type Harness struct {
+	VM      *VM
+	World   *MockWorld
+	calls   []VerbCall
+	results map[string]Value
+}
+
+// NewHarness creates a harness running COGs against world, which may be nil.
+func NewHarness(world *MockWorld) *Harness {
+	h := &Harness{World: world, results: make(map[string]Value)}
+
+	library := NewLibrary()
+	if world != nil {
+		library = NewLibrary(world)
+	}
+	library.SetFallback(func(ctx *Context, args Args) (Value, error) {
+		if value, ok := h.results[strings.ToLower(ctx.Verb())]; ok {
+			return value, nil
+		}
+		return IntValue(0), nil
+	})
+
+	h.VM = NewVM(library)
+	h.VM.SetTrace(func(call VerbCall) {
+		h.calls = append(h.calls, call)
+	})
+	return h
+}
+
+// Load parses and instantiates a COG, values are assigned as by VM.Load.
+func (h *Harness) Load(name string, source string, values ...string) (*Instance, error) {
+	parser := jkparsers.NewCogParser()
+	parser.SetFileName(name)
+	cog, err := parser.ParseFromString(source)
+	if err != nil {
+		return nil, err
+	}
+	program, err := NewProgram(name, &cog)
+	if err != nil {
+		return nil, err
+	}
+	return h.VM.Load(program, values)
+}
+
+// Returns sets the result of a verb the library doesn't provide.
+func (h *Harness) Returns(verb string, value Value) {
+	h.results[strings.ToLower(verb)] = value
+}
+
+// Send sends a message from the system to an instance.
+func (h *Harness) Send(instance *Instance, message string) (Value, error) {
+	return h.VM.Send(instance, NewMessage(message))
+}
+
+// Advance runs the world and the VM for the given time in steps of step seconds.
+func (h *Harness) Advance(seconds float64, step float64) error {
+	for elapsed := 0.0; elapsed < seconds; elapsed += step {
+		if h.World != nil {
+			h.World.Update(step)
+		}
+		if err := h.VM.Update(step); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Calls returns the recorded calls of a verb, or of every verb when verb is empty.
+func (h *Harness) Calls(verb string) []VerbCall {
+	var calls []VerbCall
+	for _, call := range h.calls {
+		if verb == "" || strings.EqualFold(call.Verb, verb) {
+			calls = append(calls, call)
+		}
+	}
+	return calls
+}
+
+// ClearCalls forgets the recorded calls.
+func (h *Harness) ClearCalls() {
+	h.calls = nil
+}
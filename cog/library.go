@@ -0,0 +1,71 @@
+package cog
+
+import (
+	"github.com/go-gl/mathgl/mgl32"
+	"strings"
+)
+
+// Verb implements a COG verb called with the evaluated arguments.
+type Verb func(ctx *Context, args Args) (Value, error)
+
+// VerbProvider adds the verbs of a host to a library, e.g. the verbs changing the
+// level shown by the viewer or the verbs of a mock world.
+type VerbProvider interface {
+	RegisterVerbs(library *Library)
+}
+
+// Library holds the verbs available to the COGs run by a VM. Verb names are
+// case insensitive. Calls to verbs missing from the library go to the fallback,
+// which returns 0 when not set.
+type Library struct {
+	verbs    map[string]Verb
+	fallback Verb
+}
+
+func NewLibrary(providers ...VerbProvider) *Library {
+	l := &Library{verbs: make(map[string]Verb)}
+	for _, provider := range providers {
+		provider.RegisterVerbs(l)
+	}
+	return l
+}
+
+func (l *Library) Register(name string, verb Verb) {
+	l.verbs[strings.ToLower(name)] = verb
+}
+
+func (l *Library) SetFallback(verb Verb) {
+	l.fallback = verb
+}
+
+func (l *Library) Lookup(name string) (Verb, bool) {
+	verb, ok := l.verbs[strings.ToLower(name)]
+	return verb, ok
+}
+
+// Args are the arguments of a verb call. Reading an argument the script didn't
+// pass gives the zero value.
+type Args []Value
+
+func (a Args) Value(i int) Value {
+	if i < 0 || i >= len(a) {
+		return IntValue(0)
+	}
+	return a[i]
+}
+
+func (a Args) Int(i int) int32 {
+	return a.Value(i).Int()
+}
+
+func (a Args) Flex(i int) float32 {
+	return a.Value(i).Flex()
+}
+
+func (a Args) Vector(i int) mgl32.Vec3 {
+	return a.Value(i).Vector()
+}
+
+func (a Args) Str(i int) string {
+	return a.Value(i).Str()
+}
@@ -0,0 +1,270 @@
+package cog
+
+import (
+	"fmt"
+	"github.com/joelhays/go-jk/jk/jktypes"
+	"strings"
+)
+
+type opcode int
+
+const (
+	opPush opcode = iota
+	opLoad
+	opStore
+	opLoadIndex
+	opStoreIndex
+	opUnary
+	opBinary
+	opVerb
+	opPop
+	opJump
+	opJumpFalse
+	opCall
+	opReturn
+	opStop
+)
+
+type instruction struct {
+	op    opcode
+	arg   int
+	name  string
+	value Value
+	pos   jktypes.CogPos
+}
+
+// Program is a COG compiled for the VM. The code section is flattened into
+// instructions so a handler can be suspended by Sleep at any point, and can
+// fall through into the label following it.
+type Program struct {
+	Name    string
+	Cog     *jktypes.Cog
+	code    []instruction
+	labels  map[string]int
+	symbols []jktypes.CogSymbol
+	lookup  map[string]int
+}
+
+// NewProgram compiles a parsed COG. Names used by the code without being
+// declared become local int symbols, as the parser reports them already.
+func NewProgram(name string, cog *jktypes.Cog) (*Program, error) {
+	p := &Program{
+		Name:    name,
+		Cog:     cog,
+		labels:  make(map[string]int),
+		symbols: append([]jktypes.CogSymbol(nil), cog.Symbols...),
+		lookup:  make(map[string]int),
+	}
+	for i, symbol := range p.symbols {
+		if _, ok := p.lookup[strings.ToLower(symbol.Name)]; !ok {
+			p.lookup[strings.ToLower(symbol.Name)] = i
+		}
+	}
+
+	for _, stmt := range cog.Code {
+		if err := p.compileStmt(stmt); err != nil {
+			return nil, err
+		}
+	}
+	p.emit(instruction{op: opStop})
+
+	for _, ins := range p.code {
+		if ins.op != opCall {
+			continue
+		}
+		if _, ok := p.labels[strings.ToLower(ins.name)]; !ok {
+			return nil, fmt.Errorf("%s:%d: call to undefined label %s", name, ins.pos.Line, ins.name)
+		}
+	}
+
+	return p, nil
+}
+
+// HasHandler reports whether the code section has a label for message.
+func (p *Program) HasHandler(message string) bool {
+	_, ok := p.labels[strings.ToLower(message)]
+	return ok
+}
+
+// Symbols returns the declared symbols followed by the implicitly declared ones.
+func (p *Program) Symbols() []jktypes.CogSymbol {
+	return p.symbols
+}
+
+func (p *Program) emit(ins instruction) int {
+	p.code = append(p.code, ins)
+	return len(p.code) - 1
+}
+
+func (p *Program) symbolIndex(name string, pos jktypes.CogPos) int {
+	key := strings.ToLower(name)
+	if idx, ok := p.lookup[key]; ok {
+		return idx
+	}
+	p.symbols = append(p.symbols, jktypes.CogSymbol{CogPos: pos, Type: jktypes.COG_SYMBOL_INT, Name: name, Local: true,
+		LinkID: -1})
+	p.lookup[key] = len(p.symbols) - 1
+	return len(p.symbols) - 1
+}
+
+func (p *Program) compileStmt(stmt jktypes.CogStmt) error {
+	switch s := stmt.(type) {
+	case *jktypes.CogLabelStmt:
+		key := strings.ToLower(s.Name)
+		if _, ok := p.labels[key]; !ok {
+			p.labels[key] = len(p.code)
+		}
+	case *jktypes.CogExprStmt:
+		if err := p.compileExpr(s.X); err != nil {
+			return err
+		}
+		p.emit(instruction{op: opPop, pos: s.CogPos})
+	case *jktypes.CogBlockStmt:
+		for _, child := range s.List {
+			if err := p.compileStmt(child); err != nil {
+				return err
+			}
+		}
+	case *jktypes.CogIfStmt:
+		if err := p.compileExpr(s.Cond); err != nil {
+			return err
+		}
+		jumpElse := p.emit(instruction{op: opJumpFalse, pos: s.CogPos})
+		if err := p.compileStmt(s.Then); err != nil {
+			return err
+		}
+		if s.Else == nil {
+			p.code[jumpElse].arg = len(p.code)
+			break
+		}
+		jumpEnd := p.emit(instruction{op: opJump, pos: s.CogPos})
+		p.code[jumpElse].arg = len(p.code)
+		if err := p.compileStmt(s.Else); err != nil {
+			return err
+		}
+		p.code[jumpEnd].arg = len(p.code)
+	case *jktypes.CogWhileStmt:
+		start := len(p.code)
+		if err := p.compileExpr(s.Cond); err != nil {
+			return err
+		}
+		jumpEnd := p.emit(instruction{op: opJumpFalse, pos: s.CogPos})
+		if err := p.compileStmt(s.Body); err != nil {
+			return err
+		}
+		p.emit(instruction{op: opJump, arg: start, pos: s.CogPos})
+		p.code[jumpEnd].arg = len(p.code)
+	case *jktypes.CogDoStmt:
+		start := len(p.code)
+		if err := p.compileStmt(s.Body); err != nil {
+			return err
+		}
+		if err := p.compileExpr(s.Cond); err != nil {
+			return err
+		}
+		jumpEnd := p.emit(instruction{op: opJumpFalse, pos: s.CogPos})
+		p.emit(instruction{op: opJump, arg: start, pos: s.CogPos})
+		p.code[jumpEnd].arg = len(p.code)
+	case *jktypes.CogForStmt:
+		if s.Init != nil {
+			if err := p.compileExpr(s.Init); err != nil {
+				return err
+			}
+			p.emit(instruction{op: opPop, pos: s.CogPos})
+		}
+		start := len(p.code)
+		jumpEnd := -1
+		if s.Cond != nil {
+			if err := p.compileExpr(s.Cond); err != nil {
+				return err
+			}
+			jumpEnd = p.emit(instruction{op: opJumpFalse, pos: s.CogPos})
+		}
+		if err := p.compileStmt(s.Body); err != nil {
+			return err
+		}
+		if s.Post != nil {
+			if err := p.compileExpr(s.Post); err != nil {
+				return err
+			}
+			p.emit(instruction{op: opPop, pos: s.CogPos})
+		}
+		p.emit(instruction{op: opJump, arg: start, pos: s.CogPos})
+		if jumpEnd >= 0 {
+			p.code[jumpEnd].arg = len(p.code)
+		}
+	case *jktypes.CogCallStmt:
+		p.emit(instruction{op: opCall, name: s.Label, pos: s.CogPos})
+	case *jktypes.CogReturnStmt:
+		p.emit(instruction{op: opReturn, pos: s.CogPos})
+	case *jktypes.CogStopStmt:
+		p.emit(instruction{op: opStop, pos: s.CogPos})
+	case *jktypes.CogEmptyStmt:
+	default:
+		return fmt.Errorf("%s:%d: unsupported statement %T", p.Name, stmt.Pos().Line, stmt)
+	}
+	return nil
+}
+
+// compileExpr leaves the value of expr on the stack. Both operands of && and ||
+// are always evaluated, like the original engine does.
+func (p *Program) compileExpr(expr jktypes.CogExpr) error {
+	switch x := expr.(type) {
+	case *jktypes.CogIdent:
+		p.emit(instruction{op: opLoad, arg: p.symbolIndex(x.Name, x.CogPos), pos: x.CogPos})
+	case *jktypes.CogIndexExpr:
+		if err := p.compileExpr(x.Index); err != nil {
+			return err
+		}
+		p.emit(instruction{op: opLoadIndex, arg: p.symbolIndex(x.Name, x.CogPos), pos: x.CogPos})
+	case *jktypes.CogIntLit:
+		p.emit(instruction{op: opPush, value: IntValue(x.Value), pos: x.CogPos})
+	case *jktypes.CogFloatLit:
+		p.emit(instruction{op: opPush, value: FlexValue(x.Value), pos: x.CogPos})
+	case *jktypes.CogStringLit:
+		p.emit(instruction{op: opPush, value: StringValue(x.Value), pos: x.CogPos})
+	case *jktypes.CogVectorLit:
+		p.emit(instruction{op: opPush, value: VectorValue(x.Value), pos: x.CogPos})
+	case *jktypes.CogUnaryExpr:
+		if err := p.compileExpr(x.X); err != nil {
+			return err
+		}
+		p.emit(instruction{op: opUnary, name: x.Op, pos: x.CogPos})
+	case *jktypes.CogBinaryExpr:
+		if err := p.compileExpr(x.X); err != nil {
+			return err
+		}
+		if err := p.compileExpr(x.Y); err != nil {
+			return err
+		}
+		p.emit(instruction{op: opBinary, name: x.Op, pos: x.CogPos})
+	case *jktypes.CogAssignExpr:
+		switch target := x.Target.(type) {
+		case *jktypes.CogIdent:
+			if err := p.compileExpr(x.Value); err != nil {
+				return err
+			}
+			p.emit(instruction{op: opStore, arg: p.symbolIndex(target.Name, target.CogPos), pos: x.CogPos})
+		case *jktypes.CogIndexExpr:
+			if err := p.compileExpr(target.Index); err != nil {
+				return err
+			}
+			if err := p.compileExpr(x.Value); err != nil {
+				return err
+			}
+			p.emit(instruction{op: opStoreIndex, arg: p.symbolIndex(target.Name, target.CogPos), pos: x.CogPos})
+		default:
+			return fmt.Errorf("%s:%d: cannot assign to %T", p.Name, x.Line, x.Target)
+		}
+	case *jktypes.CogCallExpr:
+		for _, arg := range x.Args {
+			if err := p.compileExpr(arg); err != nil {
+				return err
+			}
+		}
+		p.emit(instruction{op: opVerb, arg: len(x.Args), name: x.Verb, pos: x.CogPos})
+	default:
+		return fmt.Errorf("%s:%d: unsupported expression %T", p.Name, expr.Pos().Line, expr)
+	}
+	return nil
+}
@@ -0,0 +1,252 @@
+package cog
+
+import (
+	"fmt"
+	"github.com/go-gl/mathgl/mgl32"
+	"strconv"
+)
+
+type ValueType int
+
+const (
+	VALUE_INT ValueType = iota
+	VALUE_FLEX
+	VALUE_VECTOR
+	VALUE_STRING
+)
+
+// Value is a COG value. Things, sectors, surfaces and cogs are referenced by
+// their index as ints, resources such as sounds and templates by their name.
+type Value struct {
+	typ ValueType
+	i   int32
+	f   float32
+	v   mgl32.Vec3
+	s   string
+}
+
+func IntValue(i int32) Value {
+	return Value{typ: VALUE_INT, i: i}
+}
+
+func FlexValue(f float32) Value {
+	return Value{typ: VALUE_FLEX, f: f}
+}
+
+func VectorValue(v mgl32.Vec3) Value {
+	return Value{typ: VALUE_VECTOR, v: v}
+}
+
+func StringValue(s string) Value {
+	return Value{typ: VALUE_STRING, s: s}
+}
+
+// BoolValue returns 1 for true and 0 for false, as the comparison operators do.
+func BoolValue(b bool) Value {
+	if b {
+		return IntValue(1)
+	}
+	return IntValue(0)
+}
+
+func (v Value) Type() ValueType {
+	return v.typ
+}
+
+// Int converts the value to an int, flex values are truncated.
+func (v Value) Int() int32 {
+	switch v.typ {
+	case VALUE_INT:
+		return v.i
+	case VALUE_FLEX:
+		return int32(v.f)
+	case VALUE_STRING:
+		i, _ := strconv.ParseInt(v.s, 0, 32)
+		return int32(i)
+	}
+	return 0
+}
+
+func (v Value) Flex() float32 {
+	switch v.typ {
+	case VALUE_INT:
+		return float32(v.i)
+	case VALUE_FLEX:
+		return v.f
+	case VALUE_STRING:
+		f, _ := strconv.ParseFloat(v.s, 32)
+		return float32(f)
+	}
+	return 0
+}
+
+func (v Value) Vector() mgl32.Vec3 {
+	if v.typ == VALUE_VECTOR {
+		return v.v
+	}
+	return mgl32.Vec3{}
+}
+
+// Str returns the name held by a resource value, or the value formatted as text.
+func (v Value) Str() string {
+	if v.typ == VALUE_STRING {
+		return v.s
+	}
+	return v.String()
+}
+
+// Bool reports whether the value is true in a condition.
+func (v Value) Bool() bool {
+	switch v.typ {
+	case VALUE_INT:
+		return v.i != 0
+	case VALUE_FLEX:
+		return v.f != 0
+	case VALUE_VECTOR:
+		return v.v != mgl32.Vec3{}
+	}
+	return v.s != ""
+}
+
+func (v Value) String() string {
+	switch v.typ {
+	case VALUE_INT:
+		return strconv.Itoa(int(v.i))
+	case VALUE_FLEX:
+		return strconv.FormatFloat(float64(v.f), 'f', -1, 32)
+	case VALUE_VECTOR:
+		return fmt.Sprintf("(%g/%g/%g)", v.v[0], v.v[1], v.v[2])
+	}
+	return v.s
+}
+
+func (v Value) isNumber() bool {
+	return v.typ == VALUE_INT || v.typ == VALUE_FLEX
+}
+
+func unaryOp(op string, x Value) (Value, error) {
+	switch op {
+	case "-":
+		switch x.typ {
+		case VALUE_INT:
+			return IntValue(-x.i), nil
+		case VALUE_FLEX:
+			return FlexValue(-x.f), nil
+		case VALUE_VECTOR:
+			return VectorValue(x.v.Mul(-1)), nil
+		}
+	case "!":
+		return BoolValue(!x.Bool()), nil
+	}
+	return Value{}, fmt.Errorf("operator %s not defined on %v", op, x)
+}
+
+// binaryOp applies a binary operator. Ints stay ints unless combined with a
+// flex, vectors can be added, subtracted and scaled.
+func binaryOp(op string, x Value, y Value) (Value, error) {
+	switch op {
+	case "&&":
+		return BoolValue(x.Bool() && y.Bool()), nil
+	case "||":
+		return BoolValue(x.Bool() || y.Bool()), nil
+	case "&":
+		return IntValue(x.Int() & y.Int()), nil
+	case "|":
+		return IntValue(x.Int() | y.Int()), nil
+	case "^":
+		return IntValue(x.Int() ^ y.Int()), nil
+	case "==":
+		return BoolValue(valuesEqual(x, y)), nil
+	case "!=":
+		return BoolValue(!valuesEqual(x, y)), nil
+	}
+
+	if x.typ == VALUE_VECTOR || y.typ == VALUE_VECTOR {
+		return vectorOp(op, x, y)
+	}
+	if !x.isNumber() || !y.isNumber() {
+		return Value{}, fmt.Errorf("operator %s not defined on %v and %v", op, x, y)
+	}
+
+	if x.typ == VALUE_INT && y.typ == VALUE_INT {
+		a, b := x.i, y.i
+		switch op {
+		case "+":
+			return IntValue(a + b), nil
+		case "-":
+			return IntValue(a - b), nil
+		case "*":
+			return IntValue(a * b), nil
+		case "/":
+			if b == 0 {
+				return IntValue(0), nil
+			}
+			return IntValue(a / b), nil
+		case "%":
+			if b == 0 {
+				return IntValue(0), nil
+			}
+			return IntValue(a % b), nil
+		}
+	} else {
+		a, b := x.Flex(), y.Flex()
+		switch op {
+		case "+":
+			return FlexValue(a + b), nil
+		case "-":
+			return FlexValue(a - b), nil
+		case "*":
+			return FlexValue(a * b), nil
+		case "/":
+			if b == 0 {
+				return FlexValue(0), nil
+			}
+			return FlexValue(a / b), nil
+		case "%":
+			if int32(b) == 0 {
+				return FlexValue(0), nil
+			}
+			return FlexValue(float32(int32(a) % int32(b))), nil
+		}
+	}
+
+	switch op {
+	case "<":
+		return BoolValue(x.Flex() < y.Flex()), nil
+	case "<=":
+		return BoolValue(x.Flex() <= y.Flex()), nil
+	case ">":
+		return BoolValue(x.Flex() > y.Flex()), nil
+	case ">=":
+		return BoolValue(x.Flex() >= y.Flex()), nil
+	}
+	return Value{}, fmt.Errorf("unknown operator %s", op)
+}
+
+func vectorOp(op string, x Value, y Value) (Value, error) {
+	switch {
+	case x.typ == VALUE_VECTOR && y.typ == VALUE_VECTOR && op == "+":
+		return VectorValue(x.v.Add(y.v)), nil
+	case x.typ == VALUE_VECTOR && y.typ == VALUE_VECTOR && op == "-":
+		return VectorValue(x.v.Sub(y.v)), nil
+	case x.typ == VALUE_VECTOR && y.isNumber() && op == "*":
+		return VectorValue(x.v.Mul(y.Flex())), nil
+	case x.isNumber() && y.typ == VALUE_VECTOR && op == "*":
+		return VectorValue(y.v.Mul(x.Flex())), nil
+	case x.typ == VALUE_VECTOR && y.isNumber() && op == "/" && y.Flex() != 0:
+		return VectorValue(x.v.Mul(1 / y.Flex())), nil
+	}
+	return Value{}, fmt.Errorf("operator %s not defined on %v and %v", op, x, y)
+}
+
+func valuesEqual(x Value, y Value) bool {
+	switch {
+	case x.typ == VALUE_VECTOR || y.typ == VALUE_VECTOR:
+		return x.typ == y.typ && x.v == y.v
+	case x.typ == VALUE_STRING && y.typ == VALUE_STRING:
+		return x.s == y.s
+	case x.typ == VALUE_INT && y.typ == VALUE_INT:
+		return x.i == y.i
+	}
+	return x.Flex() == y.Flex()
+}
@@ -0,0 +1,499 @@
+package cog
+
+import (
+	"errors"
+	"fmt"
+	"github.com/go-gl/mathgl/mgl32"
+	"github.com/joelhays/go-jk/jk/jktypes"
+	"math/rand"
+	"strconv"
+	"strings"
+)
+
+const (
+	SENDER_TYPE_SYSTEM  = 0
+	SENDER_TYPE_THING   = 3
+	SENDER_TYPE_SECTOR  = 5
+	SENDER_TYPE_SURFACE = 6
+
+	// maxSteps stops scripts looping without ever sleeping.
+	maxSteps = 100000
+)
+
+// ErrStepLimit is returned when a handler runs too long without sleeping.
+var ErrStepLimit = errors.New("step limit exceeded")
+
+// Message is a message sent to a COG, e.g. startup or entered. SenderID is the
+// linkid of the symbol the sender is linked to, or the id passed to SetTimerEx.
+type Message struct {
+	Name       string
+	SenderType int32
+	Sender     int32
+	SenderID   int32
+	SourceType int32
+	Source     int32
+	Params     [4]Value
+}
+
+// NewMessage returns a message sent by the system.
+func NewMessage(name string) Message {
+	return Message{Name: name, SenderType: SENDER_TYPE_SYSTEM, Sender: -1, SenderID: -1, Source: -1}
+}
+
+// VerbCall describes a verb called by a COG, as passed to the trace function.
+type VerbCall struct {
+	Time   float64
+	Cog    int32
+	Verb   string
+	Args   []Value
+	Result Value
+}
+
+type timer struct {
+	due    float64
+	id     int32
+	params [2]Value
+	ex     bool
+}
+
+// Instance is a COG placed in the level with its own symbol values.
+type Instance struct {
+	ID        int32
+	Program   *Program
+	symbols   []Value
+	timers    []timer
+	pulse     float64
+	nextPulse float64
+}
+
+// Symbol returns the value of a symbol.
+func (i *Instance) Symbol(name string) (Value, bool) {
+	idx, ok := i.Program.lookup[strings.ToLower(name)]
+	if !ok {
+		return Value{}, false
+	}
+	return i.symbols[idx], true
+}
+
+func (i *Instance) SetSymbol(name string, value Value) error {
+	idx, ok := i.Program.lookup[strings.ToLower(name)]
+	if !ok {
+		return fmt.Errorf("%s has no symbol %s", i.Program.Name, name)
+	}
+	i.symbols[idx] = value
+	return nil
+}
+
+// thread runs one message handler of an instance. A handler sleeping or
+// waiting keeps its thread until it resumes and returns.
+type thread struct {
+	instance    *Instance
+	message     Message
+	pc          int
+	stack       []Value
+	calls       []int
+	wake        float64
+	wait        func() bool
+	suspended   bool
+	returnValue Value
+}
+
+// VM runs the message handlers of COG instances. Time only advances through
+// Update, so sleeping handlers, timers and pulses are driven by the host.
+type VM struct {
+	library   *Library
+	builtins  map[string]Verb
+	instances []*Instance
+	threads   []*thread
+	time      float64
+	rand      *rand.Rand
+	master    int32
+	trace     func(call VerbCall)
+}
+
+func NewVM(library *Library) *VM {
+	vm := &VM{library: library, rand: rand.New(rand.NewSource(1)), master: -1}
+	vm.builtins = builtinVerbs()
+	return vm
+}
+
+// SetTrace sets a function called after every verb call.
+func (vm *VM) SetTrace(trace func(call VerbCall)) {
+	vm.trace = trace
+}
+
+func (vm *VM) Time() float64 {
+	return vm.time
+}
+
+func (vm *VM) Instances() []*Instance {
+	return vm.instances
+}
+
+func (vm *VM) Instance(id int32) *Instance {
+	if id < 0 || int(id) >= len(vm.instances) {
+		return nil
+	}
+	return vm.instances[id]
+}
+
+// Load creates an instance of program. The values, e.g. from the cogs section of
+// a JKL, are assigned in order to the symbols that are neither local nor messages.
+func (vm *VM) Load(program *Program, values []string) (*Instance, error) {
+	instance := &Instance{ID: int32(len(vm.instances)), Program: program}
+	instance.symbols = make([]Value, len(program.symbols))
+
+	valueIdx := 0
+	for i, symbol := range program.symbols {
+		value := symbol.Default
+		hasValue := symbol.HasDefault
+		if !symbol.Local && symbol.Type != jktypes.COG_SYMBOL_MESSAGE && valueIdx < len(values) {
+			value = values[valueIdx]
+			hasValue = true
+			valueIdx++
+		}
+		instance.symbols[i] = symbolValue(symbol, value, hasValue)
+	}
+	if valueIdx < len(values) {
+		return nil, fmt.Errorf("%s: %d values for %d symbols", program.Name, len(values), valueIdx)
+	}
+
+	vm.instances = append(vm.instances, instance)
+	return instance, nil
+}
+
+func symbolValue(symbol jktypes.CogSymbol, value string, hasValue bool) Value {
+	switch symbol.Type {
+	case jktypes.COG_SYMBOL_MESSAGE:
+		return StringValue(strings.ToLower(symbol.Name))
+	case jktypes.COG_SYMBOL_INT:
+		i, _ := strconv.ParseInt(value, 0, 32)
+		return IntValue(int32(i))
+	case jktypes.COG_SYMBOL_FLEX, jktypes.COG_SYMBOL_FLOAT:
+		f, _ := strconv.ParseFloat(value, 32)
+		return FlexValue(float32(f))
+	case jktypes.COG_SYMBOL_VECTOR:
+		var v mgl32.Vec3
+		fmt.Sscanf(value, "(%f/%f/%f)", &v[0], &v[1], &v[2])
+		return VectorValue(v)
+	case jktypes.COG_SYMBOL_THING, jktypes.COG_SYMBOL_SECTOR, jktypes.COG_SYMBOL_SURFACE, jktypes.COG_SYMBOL_COG:
+		if !hasValue {
+			return IntValue(-1)
+		}
+		i, err := strconv.ParseInt(value, 0, 32)
+		if err != nil {
+			return IntValue(-1)
+		}
+		return IntValue(int32(i))
+	}
+	return StringValue(value)
+}
+
+// Send runs the handler of instance for the message until it returns or
+// sleeps, and returns the value passed to ReturnEx. Instances without a
+// handler for the message ignore it.
+func (vm *VM) Send(instance *Instance, message Message) (Value, error) {
+	pc, ok := instance.Program.labels[strings.ToLower(message.Name)]
+	if !ok {
+		return Value{}, nil
+	}
+	t := &thread{instance: instance, message: message, pc: pc, returnValue: IntValue(-1)}
+	err := vm.run(t)
+	if t.suspended {
+		vm.threads = append(vm.threads, t)
+	}
+	return t.returnValue, err
+}
+
+// Broadcast sends a message to every instance.
+func (vm *VM) Broadcast(message Message) error {
+	var firstErr error
+	for _, instance := range vm.instances {
+		if _, err := vm.Send(instance, message); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// SendLinked sends a message to the instances with a linked symbol, i.e. one
+// that is neither local nor nolink, referencing the sender. The sender id of
+// each message is the linkid of that symbol.
+func (vm *VM) SendLinked(message Message) error {
+	var symbolType jktypes.CogSymbolType
+	switch message.SenderType {
+	case SENDER_TYPE_THING:
+		symbolType = jktypes.COG_SYMBOL_THING
+	case SENDER_TYPE_SECTOR:
+		symbolType = jktypes.COG_SYMBOL_SECTOR
+	case SENDER_TYPE_SURFACE:
+		symbolType = jktypes.COG_SYMBOL_SURFACE
+	default:
+		return fmt.Errorf("cannot link messages from sender type %d", message.SenderType)
+	}
+
+	var firstErr error
+	for _, instance := range vm.instances {
+		for i, symbol := range instance.Program.symbols {
+			if symbol.Type != symbolType || symbol.Local || symbol.NoLink || instance.symbols[i].Int() != message.Sender {
+				continue
+			}
+			linked := message
+			linked.SenderID = int32(symbol.LinkID)
+			if _, err := vm.Send(instance, linked); err != nil && firstErr == nil {
+				firstErr = err
+			}
+			break
+		}
+	}
+	return firstErr
+}
+
+// Update advances the time by deltaTime seconds, resumes the handlers done
+// sleeping or waiting and sends the timer and pulse messages that are due.
+func (vm *VM) Update(deltaTime float64) error {
+	vm.time += deltaTime
+
+	var firstErr error
+	keep := func(err error) {
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	threads := vm.threads
+	vm.threads = nil
+	for _, t := range threads {
+		ready := vm.time >= t.wake
+		if t.wait != nil {
+			ready = t.wait()
+		}
+		if !ready {
+			vm.threads = append(vm.threads, t)
+			continue
+		}
+		t.suspended = false
+		t.wait = nil
+		keep(vm.run(t))
+		if t.suspended {
+			vm.threads = append(vm.threads, t)
+		}
+	}
+
+	for _, instance := range vm.instances {
+		timers := instance.timers
+		instance.timers = nil
+		var due []timer
+		for _, tm := range timers {
+			if vm.time >= tm.due {
+				due = append(due, tm)
+			} else {
+				instance.timers = append(instance.timers, tm)
+			}
+		}
+		for _, tm := range due {
+			message := NewMessage("timer")
+			if tm.ex {
+				message.SenderID = tm.id
+				message.Params[0] = tm.params[0]
+				message.Params[1] = tm.params[1]
+			}
+			_, err := vm.Send(instance, message)
+			keep(err)
+		}
+
+		if instance.pulse > 0 && vm.time >= instance.nextPulse {
+			instance.nextPulse += instance.pulse
+			if instance.nextPulse <= vm.time {
+				instance.nextPulse = vm.time + instance.pulse
+			}
+			_, err := vm.Send(instance, NewMessage("pulse"))
+			keep(err)
+		}
+	}
+
+	return firstErr
+}
+
+// Suspended returns the number of handlers sleeping or waiting.
+func (vm *VM) Suspended() int {
+	return len(vm.threads)
+}
+
+func (vm *VM) runtimeError(t *thread, err error) error {
+	pos := t.instance.Program.code[t.pc].pos
+	return fmt.Errorf("%s:%d: %s: %w", t.instance.Program.Name, pos.Line, t.message.Name, err)
+}
+
+func (vm *VM) pop(t *thread) Value {
+	if len(t.stack) == 0 {
+		return IntValue(0)
+	}
+	v := t.stack[len(t.stack)-1]
+	t.stack = t.stack[:len(t.stack)-1]
+	return v
+}
+
+func (vm *VM) symbolAt(t *thread, idx int) (int, error) {
+	if idx < 0 || idx >= len(t.instance.symbols) {
+		return 0, fmt.Errorf("symbol index %d out of range", idx)
+	}
+	return idx, nil
+}
+
+func (vm *VM) run(t *thread) error {
+	code := t.instance.Program.code
+	symbols := t.instance.symbols
+
+	for steps := 0; ; steps++ {
+		if steps >= maxSteps {
+			return vm.runtimeError(t, ErrStepLimit)
+		}
+		if t.pc < 0 || t.pc >= len(code) {
+			return nil
+		}
+
+		ins := code[t.pc]
+		switch ins.op {
+		case opPush:
+			t.stack = append(t.stack, ins.value)
+		case opLoad:
+			t.stack = append(t.stack, symbols[ins.arg])
+		case opStore:
+			value := vm.pop(t)
+			symbols[ins.arg] = value
+			t.stack = append(t.stack, value)
+		case opLoadIndex:
+			idx, err := vm.symbolAt(t, ins.arg+int(vm.pop(t).Int()))
+			if err != nil {
+				return vm.runtimeError(t, err)
+			}
+			t.stack = append(t.stack, symbols[idx])
+		case opStoreIndex:
+			value := vm.pop(t)
+			idx, err := vm.symbolAt(t, ins.arg+int(vm.pop(t).Int()))
+			if err != nil {
+				return vm.runtimeError(t, err)
+			}
+			symbols[idx] = value
+			t.stack = append(t.stack, value)
+		case opUnary:
+			value, err := unaryOp(ins.name, vm.pop(t))
+			if err != nil {
+				return vm.runtimeError(t, err)
+			}
+			t.stack = append(t.stack, value)
+		case opBinary:
+			y := vm.pop(t)
+			x := vm.pop(t)
+			value, err := binaryOp(ins.name, x, y)
+			if err != nil {
+				return vm.runtimeError(t, err)
+			}
+			t.stack = append(t.stack, value)
+		case opVerb:
+			args := make(Args, ins.arg)
+			for i := ins.arg - 1; i >= 0; i-- {
+				args[i] = vm.pop(t)
+			}
+			value, err := vm.callVerb(t, ins.name, args)
+			if err != nil {
+				return vm.runtimeError(t, err)
+			}
+			t.stack = append(t.stack, value)
+			if t.suspended {
+				t.pc++
+				return nil
+			}
+		case opPop:
+			vm.pop(t)
+		case opJump:
+			t.pc = ins.arg
+			continue
+		case opJumpFalse:
+			if !vm.pop(t).Bool() {
+				t.pc = ins.arg
+				continue
+			}
+		case opCall:
+			t.calls = append(t.calls, t.pc+1)
+			t.pc = t.instance.Program.labels[strings.ToLower(ins.name)]
+			continue
+		case opReturn:
+			if len(t.calls) == 0 {
+				return nil
+			}
+			t.pc = t.calls[len(t.calls)-1]
+			t.calls = t.calls[:len(t.calls)-1]
+			continue
+		case opStop:
+			return nil
+		}
+		t.pc++
+	}
+}
+
+func (vm *VM) callVerb(t *thread, name string, args Args) (Value, error) {
+	ctx := &Context{vm: vm, thread: t, verb: name}
+
+	verb, ok := vm.library.Lookup(name)
+	if !ok {
+		verb, ok = vm.builtins[strings.ToLower(name)]
+	}
+	if !ok {
+		verb = vm.library.fallback
+	}
+
+	value := IntValue(0)
+	if verb != nil {
+		var err error
+		if value, err = verb(ctx, args); err != nil {
+			return Value{}, fmt.Errorf("%s: %w", name, err)
+		}
+	}
+
+	if vm.trace != nil {
+		vm.trace(VerbCall{Time: vm.time, Cog: t.instance.ID, Verb: name, Args: args, Result: value})
+	}
+	return value, nil
+}
+
+// Context gives verbs access to the handler calling them.
+type Context struct {
+	vm     *VM
+	thread *thread
+	verb   string
+}
+
+func (c *Context) VM() *VM {
+	return c.vm
+}
+
+func (c *Context) Instance() *Instance {
+	return c.thread.instance
+}
+
+func (c *Context) Message() Message {
+	return c.thread.message
+}
+
+// Verb returns the name of the verb as written in the script.
+func (c *Context) Verb() string {
+	return c.verb
+}
+
+// Sleep suspends the handler for the given number of seconds after the verb returns.
+func (c *Context) Sleep(seconds float64) {
+	c.thread.suspended = true
+	c.thread.wake = c.vm.time + seconds
+}
+
+// WaitUntil suspends the handler after the verb returns until done reports true,
+// it is checked on every Update.
+func (c *Context) WaitUntil(done func() bool) {
+	if done() {
+		return
+	}
+	c.thread.suspended = true
+	c.thread.wait = done
+}
@@ -0,0 +1,123 @@
+package cog
+
+import (
+	"io/ioutil"
+	"testing"
+)
+
+const forceHealPlayer = 7
+
+func loadForceHeal(t *testing.T) (*Harness, *Instance) {
+	source, err := ioutil.ReadFile("../_testfiles/force_heal.cog")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	h := NewHarness(nil)
+	h.Returns("GetLocalPlayerThing", IntValue(forceHealPlayer))
+	h.Returns("GetThingHealth", IntValue(50))
+	h.Returns("GetInv", IntValue(300))
+	instance, err := h.Load("force_heal.cog", string(source))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := h.Send(instance, "startup"); err != nil {
+		t.Fatal(err)
+	}
+	return h, instance
+}
+
+// expectCalls checks the number of calls of a verb and the integer arguments of the last one.
+func expectCalls(t *testing.T, h *Harness, verb string, count int, args ...int32) {
+	t.Helper()
+	calls := h.Calls(verb)
+	if len(calls) != count {
+		t.Errorf("%s called %d times, expected %d", verb, len(calls), count)
+		return
+	}
+	if count == 0 {
+		return
+	}
+	call := calls[len(calls)-1]
+	for i, arg := range args {
+		if i >= len(call.Args) || call.Args[i].Int() != arg {
+			t.Errorf("%s called with %v, expected %v", verb, call.Args, args)
+			return
+		}
+	}
+}
+
+func TestForceHealStartup(t *testing.T) {
+	h, instance := loadForceHeal(t)
+
+	expectCalls(t, h, "GetLocalPlayerThing", 1)
+	expectCalls(t, h, "SetInvActivated", 1, forceHealPlayer, 25, 0)
+	if player, _ := instance.Symbol("player"); player.Int() != forceHealPlayer {
+		t.Errorf("player is %v, expected %d", player, forceHealPlayer)
+	}
+	if h.VM.Suspended() != 0 {
+		t.Errorf("%d handlers suspended after startup", h.VM.Suspended())
+	}
+}
+
+func TestForceHealActivated(t *testing.T) {
+	h, instance := loadForceHeal(t)
+	h.ClearCalls()
+
+	if _, err := h.Send(instance, "activated"); err != nil {
+		t.Fatal(err)
+	}
+	expectCalls(t, h, "SetInvActivated", 1, forceHealPlayer, 25, 1)
+	expectCalls(t, h, "PlayMode", 1, forceHealPlayer, 24)
+	expectCalls(t, h, "CreateThingAtPosNR", 1)
+	expectCalls(t, h, "AttachThingToThingEx", 1)
+	if calls := h.Calls("ChangeInv"); len(calls) != 1 || calls[0].Args[2].Flex() != -200 {
+		t.Errorf("ChangeInv calls %v, expected one taking 200 mana", calls)
+	}
+	if h.VM.Suspended() != 1 {
+		t.Fatalf("%d handlers suspended, expected the one sleeping", h.VM.Suspended())
+	}
+
+	// resumes 0.6 seconds after the sphere is created
+	if err := h.Advance(0.5, 0.25); err != nil {
+		t.Fatal(err)
+	}
+	expectCalls(t, h, "SetParticleGrowthSpeed", 0)
+
+	if err := h.Advance(0.25, 0.25); err != nil {
+		t.Fatal(err)
+	}
+	expectCalls(t, h, "SetParticleGrowthSpeed", 1)
+	if calls := h.Calls("HealThing"); len(calls) != 1 || calls[0].Time != 0.75 || calls[0].Args[1].Flex() != 20*300 {
+		t.Errorf("HealThing calls %v, expected one healing 20 per rank at 0.75s", calls)
+	}
+
+	// and sleeps for 0.4 seconds before destroying it
+	if err := h.Advance(0.25, 0.25); err != nil {
+		t.Fatal(err)
+	}
+	expectCalls(t, h, "DestroyThing", 0)
+
+	if err := h.Advance(0.25, 0.25); err != nil {
+		t.Fatal(err)
+	}
+	expectCalls(t, h, "DestroyThing", 1)
+	expectCalls(t, h, "SetInvActivated", 2, forceHealPlayer, 25, 0)
+	if calls := h.Calls("DestroyThing"); calls[0].Time != 1.25 {
+		t.Errorf("DestroyThing called at %vs, expected 1.25s", calls[0].Time)
+	}
+	if h.VM.Suspended() != 0 {
+		t.Errorf("%d handlers suspended after the power stopped", h.VM.Suspended())
+	}
+}
+
+func TestForceHealKilledByOther(t *testing.T) {
+	h, instance := loadForceHeal(t)
+	h.ClearCalls()
+
+	// GetSenderRef is -1 for messages from the system, not the player
+	if _, err := h.Send(instance, "killed"); err != nil {
+		t.Fatal(err)
+	}
+	expectCalls(t, h, "SetInvActivated", 0)
+}
@@ -0,0 +1,161 @@
+package convert
+
+import (
+	"fmt"
+	"github.com/joelhays/go-jk/animation"
+	"github.com/joelhays/go-jk/jk/jktypes"
+	"strings"
+)
+
+// Clip is a KEY exported as a glTF animation named Name.
+type Clip struct {
+	Name string
+	Key  *jktypes.Key
+	// SubModes lists the puppet submodes playing the KEY, see PupClipNames
+	SubModes []string
+}
+
+// From3do2gltf converts a 3do to glTF with its hierarchy as a tree of nodes in
+// the rest pose, the meshes of the first geoset attached to their node, and
+// every clip as an animation of the nodes the KEY has tracks for. Tracks are
+// sampled at every frame, the markers of the KEY are kept in the extras of the
+// animation. Clips without a track for any node of the 3do are left out.
+func From3do2gltf(object *jktypes.Jk3doFile, name string, clips []Clip) (*GLTF, error) {
+	g := newGLTF()
+	g.doc.Scenes[0].Name = name
+
+	model, err := g.add3do(name, object, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	// a node per hierarchy node, its mesh in a child offset by the pivot
+	pose := animation.RestPose(object)
+	nodes := make([]int, len(object.Hierarchy))
+	for i, node := range object.Hierarchy {
+		nodes[i] = g.addNode(gltfNode{
+			Name:        node.NodeName,
+			Translation: []float32{pose[i].Position[0], pose[i].Position[1], pose[i].Position[2]},
+			Rotation:    rotationQuat(pose[i].Orientation),
+		})
+	}
+
+	root := gltfNode{Name: name, Rotation: zUpToYUp}
+	for j, mesh := range model.meshes {
+		if node := model.nodes[j]; node >= 0 {
+			pivot := object.Hierarchy[node].Pivot
+			child := g.addNode(gltfNode{Mesh: intRef(mesh), Translation: []float32{pivot[0], pivot[1], pivot[2]}})
+			g.doc.Nodes[nodes[node]].Children = append(g.doc.Nodes[nodes[node]].Children, child)
+		} else {
+			root.Children = append(root.Children, g.addNode(gltfNode{Mesh: intRef(mesh), Matrix: model.matrices[j][:]}))
+		}
+	}
+
+	for i, node := range object.Hierarchy {
+		parent := node.ParentID
+		if parent >= 0 && parent < int64(len(nodes)) && parent != int64(i) {
+			g.doc.Nodes[nodes[parent]].Children = append(g.doc.Nodes[nodes[parent]].Children, nodes[i])
+		} else {
+			root.Children = append(root.Children, nodes[i])
+		}
+	}
+	g.doc.Scenes[0].Nodes = []int{g.addNode(root)}
+
+	for _, clip := range clips {
+		g.addClip(object, nodes, clip)
+	}
+	return g, nil
+}
+
+// addClip adds an animation with a translation and a rotation channel for
+// every hierarchy node the KEY has a track for.
+func (g *GLTF) addClip(object *jktypes.Jk3doFile, nodes []int, clip Clip) {
+	key := clip.Key
+	fps := float64(key.Header.FPS)
+	if fps <= 0 {
+		fps = 15
+	}
+	frames := int(key.Header.Frames)
+	if frames < 1 {
+		frames = 1
+	}
+
+	anim := gltfAnimation{Name: clip.Name}
+	times := make([]float32, frames)
+	for f := range times {
+		times[f] = float32(float64(f) / fps)
+	}
+	input := -1
+
+	for i, node := range object.Hierarchy {
+		var track *jktypes.KeyframeNode
+		for j := range key.KeyframeNodes {
+			if strings.EqualFold(key.KeyframeNodes[j].MeshName, node.NodeName) {
+				track = &key.KeyframeNodes[j]
+				break
+			}
+		}
+		if track == nil || len(track.Entries) == 0 {
+			continue
+		}
+
+		translations := make([]float32, 0, frames*3)
+		rotations := make([]float32, 0, frames*4)
+		var previous []float32
+		for f := 0; f < frames; f++ {
+			p, _ := animation.SampleNode(track, float64(f))
+			translations = append(translations, p.Position[0], p.Position[1], p.Position[2])
+
+			// keep neighbouring rotations in the same hemisphere so they interpolate the short way
+			q := rotationQuat(p.Orientation)
+			if previous != nil && q[0]*previous[0]+q[1]*previous[1]+q[2]*previous[2]+q[3]*previous[3] < 0 {
+				q = []float32{-q[0], -q[1], -q[2], -q[3]}
+			}
+			rotations = append(rotations, q...)
+			previous = q
+		}
+
+		if input < 0 {
+			input = g.addFloats(times, "SCALAR", 0, true)
+		}
+		for _, channel := range []struct {
+			path   string
+			values []float32
+			kind   string
+		}{{"translation", translations, "VEC3"}, {"rotation", rotations, "VEC4"}} {
+			anim.Samplers = append(anim.Samplers, gltfAnimSampler{Input: input, Output: g.addFloats(channel.values, channel.kind, 0, false),
+				Interpolation: "LINEAR"})
+			anim.Channels = append(anim.Channels, gltfChannel{Sampler: len(anim.Samplers) - 1,
+				Target: gltfChannelTarget{Node: nodes[i], Path: channel.path}})
+		}
+	}
+	if len(anim.Channels) == 0 {
+		return
+	}
+
+	markers := make([]map[string]interface{}, len(key.Markers))
+	for i, marker := range key.Markers {
+		markers[i] = map[string]interface{}{"frame": marker.Frame, "time": float64(marker.Frame) / fps, "type": marker.Type}
+	}
+	anim.Extras = map[string]interface{}{"fps": key.Header.FPS, "frames": key.Header.Frames, "flags": key.Header.Flags, "markers": markers}
+	if len(clip.SubModes) > 0 {
+		anim.Extras["submodes"] = clip.SubModes
+	}
+	g.doc.Animations = append(g.doc.Animations, anim)
+}
+
+// PupClipNames maps every KEY played by a puppet, in lower case, to the submodes
+// playing it as "mode/submode", e.g. "0/walk", in the order of the PUP.
+func PupClipNames(pup *jktypes.Pup) map[string][]string {
+	names := make(map[string][]string)
+	for _, mode := range pup.Modes {
+		for _, subMode := range mode.SubModes {
+			key := strings.ToLower(subMode.Keyframe)
+			if key == "" || key == "none" {
+				continue
+			}
+			names[key] = append(names[key], fmt.Sprintf("%d/%s", mode.Number, subMode.Name))
+		}
+	}
+	return names
+}
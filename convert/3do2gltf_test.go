@@ -0,0 +1,175 @@
+package convert
+
+import (
+	"github.com/joelhays/go-jk/jk"
+	"github.com/joelhays/go-jk/jk/jkparsers"
+	"github.com/joelhays/go-jk/jk/jktypes"
+	"math"
+	"testing"
+)
+
+func parseTestKey(t *testing.T, resolver jk.ResourceResolver, name string) jktypes.Key {
+	t.Helper()
+	data, err := resolver.ReadResource(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := jkparsers.NewKeyLineParser().ParseFromString(string(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func TestPupClipNames(t *testing.T) {
+	resolver := newTestResolver(t)
+	data, err := resolver.ReadResource("rystr.pup")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pup, err := jkparsers.NewPupLineParser().ParseFromString(string(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	names := PupClipNames(&pup)
+	for key, want := range map[string][]string{
+		"ryidleg.key":  {"0/stand"},
+		"rywalk.key":   {"1/walk", "1/walkback", "1/strafeleft", "1/straferight"},
+		"rystroll.key": {"0/walk", "0/walkback", "0/strafeleft", "0/straferight"},
+	} {
+		if got := names[key]; len(got) != len(want) {
+			t.Errorf("%s is played by %v, expected %v", key, got, want)
+		} else {
+			for i := range want {
+				if got[i] != want[i] {
+					t.Errorf("%s is played by %v, expected %v", key, got, want)
+					break
+				}
+			}
+		}
+	}
+}
+
+func Test3do2gltf(t *testing.T) {
+	resolver := newTestResolver(t)
+	object := parseTest3do(t, resolver, "3do/rystr.3do")
+	idle := parseTestKey(t, resolver, "ryidleg.key")
+	walk := parseTestKey(t, resolver, "8twalk.key")
+
+	// 8twalk.key animates another 3do, with one of its tracks moved to rystr's hip it is kept
+	retargeted := parseTestKey(t, resolver, "8twalk.key")
+	retargeted.KeyframeNodes = append([]jktypes.KeyframeNode(nil), retargeted.KeyframeNodes...)
+	retargeted.KeyframeNodes[0].MeshName = "REHIP"
+
+	g, err := From3do2gltf(&object, "rystr", []Clip{
+		{Name: "0/stand", Key: &idle, SubModes: []string{"0/stand"}},
+		{Name: "8twalk", Key: &walk},
+		{Name: "hipwalk", Key: &retargeted},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc, bin := writeTestGLTF(t, g)
+	checkGLTFBuffers(t, "rystr", doc, bin)
+
+	// every hierarchy node is a child of its parent, the roots of the root
+	nodes := make(map[string]int)
+	parents := make(map[int]int)
+	for i, node := range doc.Nodes {
+		if node.Name != "" {
+			nodes[node.Name] = i
+		}
+		for _, child := range node.Children {
+			parents[child] = i
+		}
+	}
+	root := doc.Scenes[0].Nodes[0]
+	for _, node := range object.Hierarchy {
+		idx, ok := nodes[node.NodeName]
+		if !ok {
+			t.Errorf("no node %s", node.NodeName)
+			continue
+		}
+		want := root
+		if node.ParentID >= 0 {
+			want = nodes[object.Hierarchy[node.ParentID].NodeName]
+		}
+		if parent, ok := parents[idx]; !ok || parent != want {
+			t.Errorf("node %s has parent %s, expected %s", node.NodeName, doc.Nodes[parent].Name, doc.Nodes[want].Name)
+		}
+	}
+
+	if len(doc.Animations) != 2 || doc.Animations[0].Name != "0/stand" || doc.Animations[1].Name != "hipwalk" {
+		var names []string
+		for _, anim := range doc.Animations {
+			names = append(names, anim.Name)
+		}
+		t.Fatalf("got clips %v, expected 0/stand and hipwalk", names)
+	}
+
+	for i, key := range []*jktypes.Key{&idle, &retargeted} {
+		anim := doc.Animations[i]
+		input := anim.Samplers[0].Input
+		times := gltfFloats(doc, bin, input)
+		if len(times) != int(key.Header.Frames) {
+			t.Errorf("%s: %d sampled times, expected a frame each of %d", anim.Name, len(times), key.Header.Frames)
+		}
+		for f, time := range times {
+			if want := float64(f) / float64(key.Header.FPS); math.Abs(float64(time)-want) > 1e-5 {
+				t.Errorf("%s: frame %d at %v, expected %v", anim.Name, f, time, want)
+				break
+			}
+		}
+		for _, sampler := range anim.Samplers {
+			if sampler.Input != input || sampler.Interpolation != "LINEAR" {
+				t.Errorf("%s: sampler %+v, expected LINEAR over the times of %d", anim.Name, sampler, input)
+			}
+		}
+
+		markers, _ := anim.Extras["markers"].([]interface{})
+		if len(markers) != len(key.Markers) {
+			t.Errorf("%s: %d markers, expected %d", anim.Name, len(markers), len(key.Markers))
+			continue
+		}
+		for j, marker := range key.Markers {
+			got, _ := markers[j].(map[string]interface{})
+			if got["frame"] != float64(marker.Frame) || got["type"] != float64(marker.Type) ||
+				math.Abs(got["time"].(float64)-float64(marker.Frame)/float64(key.Header.FPS)) > 1e-5 {
+				t.Errorf("%s: marker %d is %v, expected %+v", anim.Name, j, got, marker)
+			}
+		}
+	}
+
+	// the idle animates every node it has a track for, hipwalk only the hip
+	stand, hipwalk := doc.Animations[0], doc.Animations[1]
+	if len(stand.Channels) != 2*len(idle.KeyframeNodes) {
+		t.Errorf("0/stand has %d channels, expected a translation and a rotation for %d nodes", len(stand.Channels), len(idle.KeyframeNodes))
+	}
+	if len(hipwalk.Channels) != 2 || hipwalk.Channels[0].Target.Node != nodes["rehip"] {
+		t.Errorf("hipwalk has channels %+v, expected the hip's only", hipwalk.Channels)
+	}
+	if submodes, _ := stand.Extras["submodes"].([]interface{}); len(submodes) != 1 || submodes[0] != "0/stand" {
+		t.Errorf("0/stand has submodes %v", stand.Extras["submodes"])
+	}
+
+	// the first translation of a track is its first entry
+	var checked bool
+	for _, channel := range stand.Channels {
+		if channel.Target.Node != nodes["relcalf"] || channel.Target.Path != "translation" {
+			continue
+		}
+		checked = true
+		got := gltfFloats(doc, bin, stand.Samplers[channel.Sampler].Output)[:3]
+		want := idle.KeyframeNodes[1].Entries[0].Offset
+		for j := range got {
+			if math.Abs(float64(got[j]-want[j])) > 1e-6 {
+				t.Errorf("relcalf starts at %v, expected %v", got, want)
+				break
+			}
+		}
+	}
+	if !checked {
+		t.Error("0/stand has no translation of relcalf")
+	}
+}
@@ -0,0 +1,62 @@
+package convert
+
+import (
+	"encoding/binary"
+	"fmt"
+	"github.com/joelhays/go-jk/jk/jktypes"
+	"image"
+	"io"
+)
+
+const (
+	bmVersion         = 0x1E
+	bmPaletteIncluded = 2
+)
+
+// NewBM makes an 8 bit BM of the images quantized to palette, which is stored
+// in the BM. Index 0 is the transparent color.
+func NewBM(images []image.Image, palette [256]jktypes.Vec3Byte) (jktypes.BMFile, error) {
+	bm := jktypes.BMFile{Palette: jktypes.TPalette{Palette: palette}}
+	copy(bm.Header.FileType[:], "BM ")
+	bm.Header.Ver = bmVersion
+	bm.Header.PaletteIncluded = bmPaletteIncluded
+	bm.Header.NumImages = int32(len(images))
+	bm.Header.NumBits = 8
+
+	for i, img := range images {
+		size := img.Bounds().Size()
+		if size.X < 1 || size.Y < 1 {
+			return jktypes.BMFile{}, fmt.Errorf("image %d is empty", i)
+		}
+		pixels, _ := Quantize(img, palette)
+		bm.Images = append(bm.Images, jktypes.TImage{SizeX: int32(size.X), SizeY: int32(size.Y), Data: pixels})
+	}
+	return bm, nil
+}
+
+// WriteBM writes a BM: the header, the size and pixels of every image and the
+// palette when the header says it is included.
+func WriteBM(w io.Writer, bm *jktypes.BMFile) error {
+	header := bm.Header
+	header.NumImages = int32(len(bm.Images))
+	if err := binary.Write(w, binary.LittleEndian, &header); err != nil {
+		return err
+	}
+
+	for i, img := range bm.Images {
+		if len(img.Data) != int(img.SizeX)*int(img.SizeY)*bm.BytesPerPixel() {
+			return fmt.Errorf("image %d has %d bytes, expected %dx%d pixels", i, len(img.Data), img.SizeX, img.SizeY)
+		}
+		if err := binary.Write(w, binary.LittleEndian, []int32{img.SizeX, img.SizeY}); err != nil {
+			return err
+		}
+		if _, err := w.Write(img.Data); err != nil {
+			return err
+		}
+	}
+
+	if header.PaletteIncluded == bmPaletteIncluded {
+		return binary.Write(w, binary.LittleEndian, &bm.Palette)
+	}
+	return nil
+}
@@ -0,0 +1,55 @@
+package convert
+
+import (
+	"bytes"
+	"github.com/joelhays/go-jk/jk/jkparsers"
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestBMRoundTrip(t *testing.T) {
+	palette := testPalette()
+	bm, err := NewBM([]image.Image{testQuadrants(6, 4), testQuadrants(3, 5)}, palette)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := WriteBM(&buf, &bm); err != nil {
+		t.Fatal(err)
+	}
+	read, err := jkparsers.NewBmParser(nil).ParseFromBytes(buf.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(read.Images) != 2 || read.Palette.Palette != palette {
+		t.Fatalf("read %d images and palette %v, expected 2 and the one written", len(read.Images), read.Palette.Palette[:6])
+	}
+	for i, size := range []image.Point{{6, 4}, {3, 5}} {
+		if read.Images[i].SizeX != int32(size.X) || read.Images[i].SizeY != int32(size.Y) || !bytes.Equal(read.Images[i].Data, bm.Images[i].Data) {
+			t.Errorf("image %d read back as %dx%d %v, expected %v %v", i, read.Images[i].SizeX, read.Images[i].SizeY,
+				read.Images[i].Data, size, bm.Images[i].Data)
+			continue
+		}
+
+		img, err := BMImage(&read, i)
+		if err != nil {
+			t.Fatal(err)
+		}
+		wantColors := []color.NRGBA{{255, 0, 0, 255}, {0, 255, 0, 255}, {0, 0, 255, 255}, {255, 255, 255, 255}}
+		for y := 0; y < size.Y; y++ {
+			for x := 0; x < size.X; x++ {
+				want := wantColors[testQuadrant(x, y, size.X, size.Y)]
+				if x < 2 && y < 2 {
+					// index 0 is see-through
+					want = color.NRGBA{R: 255, B: 255}
+				}
+				if c := img.NRGBAAt(x, y); c != want {
+					t.Errorf("image %d has %v at %d,%d, expected %v", i, c, x, y, want)
+				}
+			}
+		}
+	}
+}
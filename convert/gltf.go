@@ -0,0 +1,323 @@
+package convert
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/png"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	gltfFloat        = 5126
+	gltfUnsignedInt  = 5125
+	gltfArrayBuffer  = 34962
+	gltfElementArray = 34963
+	gltfNearest      = 9728
+	gltfRepeat       = 10497
+)
+
+// zUpToYUp turns the z up coordinates of the game into the y up ones of glTF,
+// as the rotation of the root node.
+var zUpToYUp = []float32{-float32(math.Sqrt2) / 2, 0, 0, float32(math.Sqrt2) / 2}
+
+// GLTF is a glTF 2.0 document with its binary buffer, holding geometry,
+// animations and the PNG images of the textures.
+type GLTF struct {
+	doc       gltfDocument
+	bin       bytes.Buffer
+	materials map[string]int
+}
+
+type gltfDocument struct {
+	Asset       gltfAsset       `json:"asset"`
+	Scene       int             `json:"scene"`
+	Scenes      []gltfScene     `json:"scenes"`
+	Nodes       []gltfNode      `json:"nodes,omitempty"`
+	Meshes      []gltfMesh      `json:"meshes,omitempty"`
+	Materials   []gltfMaterial  `json:"materials,omitempty"`
+	Textures    []gltfTexture   `json:"textures,omitempty"`
+	Images      []gltfImage     `json:"images,omitempty"`
+	Samplers    []gltfSampler   `json:"samplers,omitempty"`
+	Animations  []gltfAnimation `json:"animations,omitempty"`
+	Accessors   []gltfAccessor  `json:"accessors,omitempty"`
+	BufferViews []gltfView      `json:"bufferViews,omitempty"`
+	Buffers     []gltfBuffer    `json:"buffers,omitempty"`
+}
+
+type gltfAsset struct {
+	Version   string `json:"version"`
+	Generator string `json:"generator"`
+}
+
+type gltfScene struct {
+	Name  string `json:"name,omitempty"`
+	Nodes []int  `json:"nodes"`
+}
+
+type gltfNode struct {
+	Name        string                 `json:"name,omitempty"`
+	Mesh        *int                   `json:"mesh,omitempty"`
+	Children    []int                  `json:"children,omitempty"`
+	Translation []float32              `json:"translation,omitempty"`
+	Rotation    []float32              `json:"rotation,omitempty"`
+	Matrix      []float32              `json:"matrix,omitempty"`
+	Extras      map[string]interface{} `json:"extras,omitempty"`
+}
+
+type gltfMesh struct {
+	Name       string          `json:"name,omitempty"`
+	Primitives []gltfPrimitive `json:"primitives"`
+}
+
+type gltfPrimitive struct {
+	Attributes map[string]int `json:"attributes"`
+	Indices    int            `json:"indices"`
+	Material   *int           `json:"material,omitempty"`
+}
+
+type gltfMaterial struct {
+	Name        string   `json:"name,omitempty"`
+	PBR         gltfPBR  `json:"pbrMetallicRoughness"`
+	AlphaMode   string   `json:"alphaMode,omitempty"`
+	AlphaCutoff *float32 `json:"alphaCutoff,omitempty"`
+	DoubleSided bool     `json:"doubleSided,omitempty"`
+}
+
+type gltfPBR struct {
+	BaseColorFactor  []float32       `json:"baseColorFactor,omitempty"`
+	BaseColorTexture *gltfTextureRef `json:"baseColorTexture,omitempty"`
+	MetallicFactor   float32         `json:"metallicFactor"`
+	RoughnessFactor  float32         `json:"roughnessFactor"`
+}
+
+type gltfTextureRef struct {
+	Index int `json:"index"`
+}
+
+type gltfTexture struct {
+	Sampler int `json:"sampler"`
+	Source  int `json:"source"`
+}
+
+type gltfImage struct {
+	Name       string `json:"name,omitempty"`
+	BufferView int    `json:"bufferView"`
+	MimeType   string `json:"mimeType"`
+}
+
+type gltfSampler struct {
+	MagFilter int `json:"magFilter"`
+	MinFilter int `json:"minFilter"`
+	WrapS     int `json:"wrapS"`
+	WrapT     int `json:"wrapT"`
+}
+
+type gltfAnimation struct {
+	Name     string                 `json:"name,omitempty"`
+	Channels []gltfChannel          `json:"channels"`
+	Samplers []gltfAnimSampler      `json:"samplers"`
+	Extras   map[string]interface{} `json:"extras,omitempty"`
+}
+
+type gltfChannel struct {
+	Sampler int               `json:"sampler"`
+	Target  gltfChannelTarget `json:"target"`
+}
+
+type gltfChannelTarget struct {
+	Node int    `json:"node"`
+	Path string `json:"path"`
+}
+
+type gltfAnimSampler struct {
+	Input         int    `json:"input"`
+	Output        int    `json:"output"`
+	Interpolation string `json:"interpolation"`
+}
+
+type gltfAccessor struct {
+	BufferView    int       `json:"bufferView"`
+	ComponentType int       `json:"componentType"`
+	Count         int       `json:"count"`
+	Type          string    `json:"type"`
+	Min           []float32 `json:"min,omitempty"`
+	Max           []float32 `json:"max,omitempty"`
+}
+
+type gltfView struct {
+	Buffer     int `json:"buffer"`
+	ByteOffset int `json:"byteOffset"`
+	ByteLength int `json:"byteLength"`
+	Target     int `json:"target,omitempty"`
+}
+
+type gltfBuffer struct {
+	URI        string `json:"uri,omitempty"`
+	ByteLength int    `json:"byteLength"`
+}
+
+func newGLTF() *GLTF {
+	g := &GLTF{materials: make(map[string]int)}
+	g.doc.Asset = gltfAsset{Version: "2.0", Generator: "go-jk"}
+	g.doc.Scenes = []gltfScene{{Nodes: []int{}}}
+	return g
+}
+
+// addNode adds a node and returns its index.
+func (g *GLTF) addNode(node gltfNode) int {
+	g.doc.Nodes = append(g.doc.Nodes, node)
+	return len(g.doc.Nodes) - 1
+}
+
+// addView appends data to the binary buffer, aligned to 4 bytes, and returns its buffer view.
+func (g *GLTF) addView(data []byte, target int) int {
+	for g.bin.Len()%4 != 0 {
+		g.bin.WriteByte(0)
+	}
+	g.doc.BufferViews = append(g.doc.BufferViews, gltfView{ByteOffset: g.bin.Len(), ByteLength: len(data), Target: target})
+	g.bin.Write(data)
+	return len(g.doc.BufferViews) - 1
+}
+
+// addFloats adds an accessor of count elements of the given type, e.g. VEC3.
+func (g *GLTF) addFloats(values []float32, accessorType string, target int, bounds bool) int {
+	components := map[string]int{"SCALAR": 1, "VEC2": 2, "VEC3": 3, "VEC4": 4}[accessorType]
+	data := make([]byte, 4*len(values))
+	for i, v := range values {
+		binary.LittleEndian.PutUint32(data[i*4:], math.Float32bits(v))
+	}
+
+	accessor := gltfAccessor{BufferView: g.addView(data, target), ComponentType: gltfFloat, Count: len(values) / components, Type: accessorType}
+	if bounds && len(values) > 0 {
+		accessor.Min = append([]float32(nil), values[:components]...)
+		accessor.Max = append([]float32(nil), values[:components]...)
+		for i, v := range values {
+			c := i % components
+			accessor.Min[c] = float32(math.Min(float64(accessor.Min[c]), float64(v)))
+			accessor.Max[c] = float32(math.Max(float64(accessor.Max[c]), float64(v)))
+		}
+	}
+	g.doc.Accessors = append(g.doc.Accessors, accessor)
+	return len(g.doc.Accessors) - 1
+}
+
+func (g *GLTF) addIndices(indices []uint32) int {
+	data := make([]byte, 4*len(indices))
+	for i, index := range indices {
+		binary.LittleEndian.PutUint32(data[i*4:], index)
+	}
+	g.doc.Accessors = append(g.doc.Accessors, gltfAccessor{BufferView: g.addView(data, gltfElementArray), ComponentType: gltfUnsignedInt,
+		Count: len(indices), Type: "SCALAR"})
+	return len(g.doc.Accessors) - 1
+}
+
+// addImage stores img as a PNG in the binary buffer and returns its texture.
+func (g *GLTF) addImage(name string, img image.Image) (int, error) {
+	var data bytes.Buffer
+	if err := png.Encode(&data, img); err != nil {
+		return 0, err
+	}
+
+	if len(g.doc.Samplers) == 0 {
+		g.doc.Samplers = []gltfSampler{{MagFilter: gltfNearest, MinFilter: gltfNearest, WrapS: gltfRepeat, WrapT: gltfRepeat}}
+	}
+	g.doc.Images = append(g.doc.Images, gltfImage{Name: name, BufferView: g.addView(data.Bytes(), 0), MimeType: "image/png"})
+	g.doc.Textures = append(g.doc.Textures, gltfTexture{Source: len(g.doc.Images) - 1})
+	return len(g.doc.Textures) - 1, nil
+}
+
+// document returns the JSON document with the buffer at uri, or embedded when uri is empty.
+func (g *GLTF) document(uri string) ([]byte, error) {
+	doc := g.doc
+	doc.Buffers = nil
+	if g.bin.Len() > 0 {
+		doc.Buffers = []gltfBuffer{{URI: uri, ByteLength: g.bin.Len()}}
+	}
+	return json.Marshal(doc)
+}
+
+// WriteGLTF writes the JSON document, which refers to the binary buffer as binURI.
+func (g *GLTF) WriteGLTF(w io.Writer, binURI string) error {
+	data, err := g.document(binURI)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(data)
+	return err
+}
+
+// WriteBin writes the binary buffer of the document.
+func (g *GLTF) WriteBin(w io.Writer) error {
+	_, err := w.Write(g.bin.Bytes())
+	return err
+}
+
+// WriteGLB writes the document and its binary buffer as a single binary glTF.
+func (g *GLTF) WriteGLB(w io.Writer) error {
+	data, err := g.document("")
+	if err != nil {
+		return err
+	}
+	for len(data)%4 != 0 {
+		data = append(data, ' ')
+	}
+	bin := g.bin.Bytes()
+	for len(bin)%4 != 0 {
+		bin = append(bin, 0)
+	}
+
+	length := 12 + 8 + len(data)
+	if len(bin) > 0 {
+		length += 8 + len(bin)
+	}
+	header := []uint32{0x46546C67, 2, uint32(length), uint32(len(data)), 0x4E4F534A}
+	if err := binary.Write(w, binary.LittleEndian, header); err != nil {
+		return err
+	}
+	if _, err := w.Write(data); err != nil {
+		return err
+	}
+	if len(bin) == 0 {
+		return nil
+	}
+	if err := binary.Write(w, binary.LittleEndian, []uint32{uint32(len(bin)), 0x004E4942}); err != nil {
+		return err
+	}
+	_, err = w.Write(bin)
+	return err
+}
+
+// Save writes the document to path, as a binary glTF when it ends in .glb and
+// otherwise as JSON with the binary buffer next to it in a .bin file.
+func (g *GLTF) Save(path string) error {
+	if strings.EqualFold(filepath.Ext(path), ".glb") {
+		return writeFile(path, g.WriteGLB)
+	}
+
+	binPath := strings.TrimSuffix(path, filepath.Ext(path)) + ".bin"
+	if err := writeFile(binPath, g.WriteBin); err != nil {
+		return err
+	}
+	return writeFile(path, func(w io.Writer) error {
+		return g.WriteGLTF(w, filepath.Base(binPath))
+	})
+}
+
+func writeFile(path string, write func(w io.Writer) error) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := write(file); err != nil {
+		file.Close()
+		return fmt.Errorf("%s: %v", path, err)
+	}
+	return file.Close()
+}
@@ -0,0 +1,190 @@
+package convert
+
+import (
+	"fmt"
+	"github.com/go-gl/mathgl/mgl32"
+	"github.com/joelhays/go-jk/animation"
+	"github.com/joelhays/go-jk/jk/jktypes"
+	"sort"
+)
+
+type gltfVertex struct {
+	position mgl32.Vec3
+	normal   mgl32.Vec3
+	uv       mgl32.Vec2
+	light    float32
+}
+
+// gltfPrimitiveData collects the triangles of the faces sharing a material.
+type gltfPrimitiveData struct {
+	positions []float32
+	normals   []float32
+	uvs       []float32
+	colors    []float32
+	indices   []uint32
+}
+
+// addFan adds a face as a fan of triangles around its first vertex.
+func (p *gltfPrimitiveData) addFan(vertices []gltfVertex) {
+	first := uint32(len(p.positions) / 3)
+	for i, v := range vertices {
+		p.positions = append(p.positions, v.position[0], v.position[1], v.position[2])
+		p.normals = append(p.normals, v.normal[0], v.normal[1], v.normal[2])
+		p.uvs = append(p.uvs, v.uv[0], v.uv[1])
+		p.colors = append(p.colors, v.light, v.light, v.light)
+		if i >= 2 {
+			p.indices = append(p.indices, first, first+uint32(i-1), first+uint32(i))
+		}
+	}
+}
+
+// addMesh adds a mesh with a primitive per material, keyed by the index of the
+// glTF material or -1 for none. Vertex colors are only written when withColors is set.
+func (g *GLTF) addMesh(name string, primitives map[int]*gltfPrimitiveData, withColors bool) int {
+	var materials []int
+	for material, data := range primitives {
+		if len(data.indices) > 0 {
+			materials = append(materials, material)
+		}
+	}
+	sort.Ints(materials)
+
+	mesh := gltfMesh{Name: name}
+	for _, material := range materials {
+		data := primitives[material]
+		primitive := gltfPrimitive{Attributes: map[string]int{
+			"POSITION":   g.addFloats(data.positions, "VEC3", gltfArrayBuffer, true),
+			"NORMAL":     g.addFloats(data.normals, "VEC3", gltfArrayBuffer, false),
+			"TEXCOORD_0": g.addFloats(data.uvs, "VEC2", gltfArrayBuffer, false),
+		}}
+		if withColors {
+			primitive.Attributes["COLOR_0"] = g.addFloats(data.colors, "VEC3", gltfArrayBuffer, false)
+		}
+		primitive.Indices = g.addIndices(data.indices)
+		if material >= 0 {
+			m := material
+			primitive.Material = &m
+		}
+		mesh.Primitives = append(mesh.Primitives, primitive)
+	}
+	g.doc.Meshes = append(g.doc.Meshes, mesh)
+	return len(g.doc.Meshes) - 1
+}
+
+// addMaterial adds a material once per name, textured with its first cel in the
+// colors of palette, and returns its index.
+func (g *GLTF) addMaterial(material jktypes.Material, palette [256]jktypes.Vec3Byte) (int, error) {
+	if index, ok := g.materials[material.Name]; ok {
+		return index, nil
+	}
+
+	m := gltfMaterial{Name: material.Name, PBR: gltfPBR{MetallicFactor: 0, RoughnessFactor: 1}}
+	if len(material.Cels) > 0 {
+		texture, err := g.addImage(material.Name, CelImage(material.Cels[0], 0, palette))
+		if err != nil {
+			return 0, err
+		}
+		m.PBR.BaseColorTexture = &gltfTextureRef{Index: texture}
+		if material.Cels[0].Transparent {
+			cutoff := float32(0.5)
+			m.AlphaMode = "MASK"
+			m.AlphaCutoff = &cutoff
+		}
+	}
+
+	g.doc.Materials = append(g.doc.Materials, m)
+	g.materials[material.Name] = len(g.doc.Materials) - 1
+	return len(g.doc.Materials) - 1, nil
+}
+
+// textureUV scales texture vertices from texels to the texture size, like the renderers.
+func textureUV(uv mgl32.Vec2, material jktypes.Material) mgl32.Vec2 {
+	sizeX, sizeY := float32(material.SizeX), float32(material.SizeY)
+	if sizeX <= 0 || sizeY <= 0 {
+		sizeX, sizeY = 1, 1
+	}
+	return mgl32.Vec2{uv[0] / sizeX, -uv[1] / sizeY}
+}
+
+// gltfModel is a 3do added once, its meshes placed by the hierarchy in the rest pose.
+type gltfModel struct {
+	meshes   []int
+	nodes    []int // hierarchy node of every mesh, -1 when none
+	matrices []mgl32.Mat4
+}
+
+// add3do adds every mesh of a geoset of a 3do in its own coordinates.
+func (g *GLTF) add3do(name string, object *jktypes.Jk3doFile, lod int) (*gltfModel, error) {
+	model := &gltfModel{}
+	if lod < 0 || lod >= len(object.GeoSets) {
+		return model, nil
+	}
+
+	materials := make([]int, len(object.Materials))
+	for i, material := range object.Materials {
+		index, err := g.addMaterial(material, object.ColorMap.Palette)
+		if err != nil {
+			return nil, err
+		}
+		materials[i] = index
+	}
+
+	meshes := object.GeoSets[lod].Meshes
+	meshNodes := make([]int, len(meshes))
+	for i := range meshNodes {
+		meshNodes[i] = -1
+	}
+	for i, node := range object.Hierarchy {
+		if node.MeshID >= 0 && node.MeshID < int64(len(meshes)) {
+			meshNodes[node.MeshID] = i
+		}
+	}
+	nodeMatrices := animation.NodeMatrices(object, animation.RestPose(object))
+
+	for meshIdx, mesh := range meshes {
+		primitives := make(map[int]*gltfPrimitiveData)
+		for faceIdx, face := range mesh.Faces {
+			if face.GeometryMode == 0 {
+				continue
+			}
+
+			material := -1
+			var jkMaterial jktypes.Material
+			if face.MaterialID >= 0 && face.MaterialID < int64(len(materials)) {
+				material = materials[face.MaterialID]
+				jkMaterial = object.Materials[face.MaterialID]
+			}
+			if primitives[material] == nil {
+				primitives[material] = &gltfPrimitiveData{}
+			}
+
+			vertices := make([]gltfVertex, len(face.VertexIds))
+			for idx, id := range face.VertexIds {
+				v := gltfVertex{position: mesh.Vertices[id], normal: mesh.FaceNormals[faceIdx], light: 1}
+				if textureVertexID := face.TextureVertexIds[idx]; len(mesh.TextureVertices) > 0 && textureVertexID != -1 {
+					v.uv = textureUV(mesh.TextureVertices[textureVertexID], jkMaterial)
+				}
+				vertices[idx] = v
+			}
+			primitives[material].addFan(vertices)
+		}
+		if len(primitives) == 0 {
+			continue
+		}
+
+		matrix := mgl32.Ident4()
+		meshName := fmt.Sprintf("%s mesh %d", name, meshIdx)
+		if node := meshNodes[meshIdx]; node >= 0 {
+			matrix = nodeMatrices[node]
+			meshName = name + " " + object.Hierarchy[node].NodeName
+		}
+		model.meshes = append(model.meshes, g.addMesh(meshName, primitives, false))
+		model.nodes = append(model.nodes, meshNodes[meshIdx])
+		model.matrices = append(model.matrices, matrix)
+	}
+	return model, nil
+}
+
+func intRef(i int) *int {
+	return &i
+}
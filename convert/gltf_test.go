@@ -0,0 +1,289 @@
+package convert
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"github.com/joelhays/go-jk/jk"
+	"github.com/joelhays/go-jk/jk/jkparsers"
+	"github.com/joelhays/go-jk/jk/jktypes"
+	"image"
+	"image/color"
+	"image/png"
+	"io/ioutil"
+	"math"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// testResolver resolves from _testfiles. It has no MATs, so they are made up as
+// 4x4 cels of one color, with a transparent corner for the names in transparent.
+type testResolver struct {
+	files       *jk.MemoryResolver
+	transparent map[string]bool
+}
+
+func newTestResolver(t *testing.T, transparent ...string) *testResolver {
+	files := make(map[string][]byte)
+	root := "../_testfiles"
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		name, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		files[filepath.ToSlash(name)] = data
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := &testResolver{files: jk.NewMemoryResolver(files), transparent: make(map[string]bool)}
+	for _, name := range transparent {
+		r.transparent[strings.ToLower(name)] = true
+	}
+	return r
+}
+
+func (r *testResolver) ReadResource(name string) ([]byte, error) {
+	data, err := r.files.ReadResource(name)
+	if err == nil || !strings.EqualFold(path.Ext(name), ".mat") {
+		return data, err
+	}
+
+	var palette [256]jktypes.Vec3Byte
+	palette[1] = jktypes.Vec3Byte{R: 128, G: 128, B: 128}
+	cel := image.NewNRGBA(image.Rect(0, 0, 4, 4))
+	for i := 0; i < len(cel.Pix); i += 4 {
+		copy(cel.Pix[i:], []byte{128, 128, 128, 255})
+	}
+	base := strings.ToLower(path.Base(strings.Replace(name, "\\", "/", -1)))
+	if r.transparent[base] {
+		cel.SetNRGBA(0, 0, color.NRGBA{})
+	}
+
+	material, err := NewMaterial(base, []image.Image{cel}, palette, 1)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if err := WriteMAT(&buf, &material); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func parseTestLevel(t *testing.T, resolver jk.ResourceResolver, name string) jktypes.Jkl {
+	t.Helper()
+	data, err := resolver.ReadResource(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	parser := jkparsers.NewJklLineParser(resolver)
+	parser.SetFileName(name)
+	level, err := parser.ParseFromString(string(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return level
+}
+
+func parseTest3do(t *testing.T, resolver jk.ResourceResolver, name string) jktypes.Jk3doFile {
+	t.Helper()
+	data, err := resolver.ReadResource(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	parser := jkparsers.NewJk3doLineParser(resolver)
+	parser.SetFileName(name)
+	object, err := parser.ParseFromString(string(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return object
+}
+
+// writeTestGLTF writes a document and its buffer to memory and reads the document back.
+func writeTestGLTF(t *testing.T, g *GLTF) (gltfDocument, []byte) {
+	t.Helper()
+	var doc, bin bytes.Buffer
+	if err := g.WriteGLTF(&doc, "test.bin"); err != nil {
+		t.Fatal(err)
+	}
+	if err := g.WriteBin(&bin); err != nil {
+		t.Fatal(err)
+	}
+
+	var read gltfDocument
+	if err := json.Unmarshal(doc.Bytes(), &read); err != nil {
+		t.Fatal(err)
+	}
+	return read, bin.Bytes()
+}
+
+// checkGLTFBuffers checks that every accessor and image fits its buffer view and
+// every view the buffer.
+func checkGLTFBuffers(t *testing.T, name string, doc gltfDocument, bin []byte) {
+	t.Helper()
+	if len(doc.Buffers) != 1 || doc.Buffers[0].URI != "test.bin" || doc.Buffers[0].ByteLength != len(bin) {
+		t.Errorf("%s: buffers %+v, expected test.bin of %d bytes", name, doc.Buffers, len(bin))
+		return
+	}
+	for i, view := range doc.BufferViews {
+		if view.ByteOffset%4 != 0 || view.ByteOffset+view.ByteLength > len(bin) {
+			t.Errorf("%s: buffer view %d at %d of %d bytes is not aligned or past the %d of the buffer", name, i, view.ByteOffset, view.ByteLength, len(bin))
+			return
+		}
+	}
+
+	components := map[string]int{"SCALAR": 1, "VEC2": 2, "VEC3": 3, "VEC4": 4}
+	for i, accessor := range doc.Accessors {
+		if accessor.BufferView < 0 || accessor.BufferView >= len(doc.BufferViews) {
+			t.Errorf("%s: accessor %d refers to buffer view %d of %d", name, i, accessor.BufferView, len(doc.BufferViews))
+			continue
+		}
+		if want := accessor.Count * components[accessor.Type] * 4; doc.BufferViews[accessor.BufferView].ByteLength != want {
+			t.Errorf("%s: accessor %d of %d %s has %d bytes, expected %d", name, i, accessor.Count, accessor.Type,
+				doc.BufferViews[accessor.BufferView].ByteLength, want)
+		}
+	}
+
+	for i, img := range doc.Images {
+		if img.BufferView < 0 || img.BufferView >= len(doc.BufferViews) {
+			t.Errorf("%s: image %d refers to buffer view %d of %d", name, i, img.BufferView, len(doc.BufferViews))
+			continue
+		}
+		view := doc.BufferViews[img.BufferView]
+		if _, err := png.DecodeConfig(bytes.NewReader(bin[view.ByteOffset : view.ByteOffset+view.ByteLength])); err != nil || img.MimeType != "image/png" {
+			t.Errorf("%s: image %d is not a PNG: %v", name, i, err)
+		}
+	}
+}
+
+// gltfFloats returns the values of a float accessor.
+func gltfFloats(doc gltfDocument, bin []byte, accessor int) []float32 {
+	view := doc.BufferViews[doc.Accessors[accessor].BufferView]
+	values := make([]float32, view.ByteLength/4)
+	for i := range values {
+		values[i] = math.Float32frombits(binary.LittleEndian.Uint32(bin[view.ByteOffset+i*4:]))
+	}
+	return values
+}
+
+func TestJkl2gltf(t *testing.T) {
+	resolver := newTestResolver(t)
+	var allThingMeshes int
+	for _, name := range []string{"01narshadda", "08escape88", "m_boss15"} {
+		level := parseTestLevel(t, resolver, "jkl/"+name+".jkl")
+		g, err := FromJkl2gltf(&level, name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		doc, bin := writeTestGLTF(t, g)
+		checkGLTFBuffers(t, name, doc, bin)
+
+		// the root holds the sectors and the things, a node each
+		if len(doc.Scenes) != 1 || len(doc.Scenes[0].Nodes) != 1 {
+			t.Fatalf("%s: scenes %+v, expected one with the root node", name, doc.Scenes)
+		}
+		root := doc.Nodes[doc.Scenes[0].Nodes[0]]
+		if len(root.Children) != 2 {
+			t.Fatalf("%s: root has %d children, expected the sectors and the things", name, len(root.Children))
+		}
+		sectors, things := doc.Nodes[root.Children[0]], doc.Nodes[root.Children[1]]
+		if len(sectors.Children) != len(level.Sectors) || len(things.Children) != len(level.Things) {
+			t.Errorf("%s: %d sector and %d thing nodes, expected %d and %d", name,
+				len(sectors.Children), len(things.Children), len(level.Sectors), len(level.Things))
+		}
+		var thingMeshes int
+		for i, thing := range things.Children {
+			if i >= len(level.Things) {
+				break
+			}
+			object := level.Jk3dos[level.Jk3doTemplates[level.Things[i].TemplateName].Jk3doName]
+			if got, want := len(doc.Nodes[thing].Children), drawnMeshes(&object); got != want {
+				t.Errorf("%s: thing %d has %d mesh nodes, expected %d", name, i, got, want)
+			}
+			thingMeshes += len(doc.Nodes[thing].Children)
+		}
+		if want := 3 + len(level.Sectors) + len(level.Things) + thingMeshes; len(doc.Nodes) != want {
+			t.Errorf("%s: %d nodes, expected %d", name, len(doc.Nodes), want)
+		}
+		allThingMeshes += thingMeshes
+
+		// every material is textured with an image of its own
+		if len(doc.Materials) == 0 || len(doc.Images) != len(doc.Materials) || len(doc.Textures) != len(doc.Images) {
+			t.Errorf("%s: %d materials, %d textures and %d images, expected an image per material", name,
+				len(doc.Materials), len(doc.Textures), len(doc.Images))
+		}
+		for i, material := range doc.Materials {
+			texture := material.PBR.BaseColorTexture
+			if texture == nil || texture.Index >= len(doc.Textures) || doc.Textures[texture.Index].Source >= len(doc.Images) {
+				t.Errorf("%s: material %d %s refers to texture %+v of %d", name, i, material.Name, texture, len(doc.Textures))
+			}
+		}
+
+		// sectors are colored by their light, 3dos are not
+		sectorMeshes := make(map[int]bool)
+		for _, sector := range sectors.Children {
+			if mesh := doc.Nodes[sector].Mesh; mesh != nil {
+				sectorMeshes[*mesh] = true
+			}
+		}
+		for meshIdx, mesh := range doc.Meshes {
+			for _, primitive := range mesh.Primitives {
+				if primitive.Material != nil && *primitive.Material >= len(doc.Materials) {
+					t.Errorf("%s: mesh %s refers to material %d of %d", name, mesh.Name, *primitive.Material, len(doc.Materials))
+				}
+				colors, ok := primitive.Attributes["COLOR_0"]
+				if ok != sectorMeshes[meshIdx] {
+					t.Errorf("%s: mesh %s has vertex colors %v, expected them only on sectors", name, mesh.Name, ok)
+					continue
+				}
+				if !ok {
+					continue
+				}
+				positions := doc.Accessors[primitive.Attributes["POSITION"]]
+				if doc.Accessors[colors].Count != positions.Count || doc.Accessors[colors].Type != "VEC3" {
+					t.Errorf("%s: mesh %s has %d colors for %d vertices", name, mesh.Name, doc.Accessors[colors].Count, positions.Count)
+				}
+				for _, light := range gltfFloats(doc, bin, colors) {
+					if light < 0 || light > 1 {
+						t.Errorf("%s: mesh %s has a vertex color of %v", name, mesh.Name, light)
+						break
+					}
+				}
+			}
+		}
+	}
+	if allThingMeshes == 0 {
+		t.Error("no thing of any level has a mesh")
+	}
+}
+
+// drawnMeshes counts the meshes of the first geoset of a 3do with a face to draw.
+func drawnMeshes(object *jktypes.Jk3doFile) int {
+	if len(object.GeoSets) == 0 {
+		return 0
+	}
+	var count int
+	for _, mesh := range object.GeoSets[0].Meshes {
+		for _, face := range mesh.Faces {
+			if face.GeometryMode != 0 {
+				count++
+				break
+			}
+		}
+	}
+	return count
+}
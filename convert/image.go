@@ -0,0 +1,131 @@
+package convert
+
+import (
+	"github.com/joelhays/go-jk/jk/jktypes"
+	"image"
+	"image/color"
+)
+
+// CelImage returns a mipmap level of a material cel in the colors of palette.
+// Palette index 0 is see-through in transparent cels.
+func CelImage(cel jktypes.MaterialCel, level int, palette [256]jktypes.Vec3Byte) *image.NRGBA {
+	sizeX, sizeY := cel.MipMapSize(level)
+	img := image.NewNRGBA(image.Rect(0, 0, int(sizeX), int(sizeY)))
+	if level >= len(cel.MipMaps) {
+		return img
+	}
+
+	for i, index := range cel.MipMaps[level] {
+		c := palette[index]
+		alpha := byte(255)
+		if cel.Transparent && index == 0 {
+			alpha = 0
+		}
+		img.SetNRGBA(i%int(sizeX), i/int(sizeX), color.NRGBA{R: c.R, G: c.G, B: c.B, A: alpha})
+	}
+	return img
+}
+
+// MaterialImages returns every mipmap level of every cel of a material, indexed by cel and level.
+func MaterialImages(material *jktypes.Material, palette [256]jktypes.Vec3Byte) [][]*image.NRGBA {
+	images := make([][]*image.NRGBA, len(material.Cels))
+	for i, cel := range material.Cels {
+		for level := range cel.MipMaps {
+			images[i] = append(images[i], CelImage(cel, level, palette))
+		}
+	}
+	return images
+}
+
+// BMImage returns an image of a BM, decoded by BMFile.RGBA.
+func BMImage(bm *jktypes.BMFile, index int) (*image.NRGBA, error) {
+	rgba, err := bm.RGBA(index)
+	if err != nil {
+		return nil, err
+	}
+	img := image.NewNRGBA(image.Rect(0, 0, int(bm.Images[index].SizeX), int(bm.Images[index].SizeY)))
+	copy(img.Pix, rgba)
+	return img, nil
+}
+
+// SFTImage returns the sheet with every glyph of a font.
+func SFTImage(sft *jktypes.SFTFile) (*image.NRGBA, error) {
+	return BMImage(&sft.BMFile, 0)
+}
+
+// Quantize maps every pixel of img to the closest color of palette. Index 0 is
+// kept for pixels that are more than half transparent, transparent reports
+// whether there are any.
+func Quantize(img image.Image, palette [256]jktypes.Vec3Byte) (pixels []byte, transparent bool) {
+	bounds := img.Bounds()
+	pixels = make([]byte, 0, bounds.Dx()*bounds.Dy())
+	closest := make(map[jktypes.Vec3Byte]byte)
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			c := color.NRGBAModel.Convert(img.At(x, y)).(color.NRGBA)
+			if c.A < 128 {
+				pixels = append(pixels, 0)
+				transparent = true
+				continue
+			}
+
+			rgb := jktypes.Vec3Byte{R: c.R, G: c.G, B: c.B}
+			index, ok := closest[rgb]
+			if !ok {
+				index = closestColor(palette, rgb)
+				closest[rgb] = index
+			}
+			pixels = append(pixels, index)
+		}
+	}
+	return pixels, transparent
+}
+
+func closestColor(palette [256]jktypes.Vec3Byte, c jktypes.Vec3Byte) byte {
+	best, bestDistance := 1, -1
+	for i := 1; i < len(palette); i++ {
+		dr, dg, db := int(palette[i].R)-int(c.R), int(palette[i].G)-int(c.G), int(palette[i].B)-int(c.B)
+		distance := dr*dr + dg*dg + db*db
+		if bestDistance < 0 || distance < bestDistance {
+			best, bestDistance = i, distance
+		}
+	}
+	return byte(best)
+}
+
+// halfSize scales an image down to half its size, averaging every 2x2 block of
+// pixels. A block is transparent when most of it is.
+func halfSize(img image.Image) *image.NRGBA {
+	bounds := img.Bounds()
+	sizeX, sizeY := bounds.Dx()/2, bounds.Dy()/2
+	if sizeX < 1 {
+		sizeX = 1
+	}
+	if sizeY < 1 {
+		sizeY = 1
+	}
+
+	half := image.NewNRGBA(image.Rect(0, 0, sizeX, sizeY))
+	for y := 0; y < sizeY; y++ {
+		for x := 0; x < sizeX; x++ {
+			var r, g, b, opaque, n int
+			for _, p := range []image.Point{{0, 0}, {1, 0}, {0, 1}, {1, 1}} {
+				px, py := bounds.Min.X+x*2+p.X, bounds.Min.Y+y*2+p.Y
+				if px >= bounds.Max.X || py >= bounds.Max.Y {
+					continue
+				}
+				n++
+				c := color.NRGBAModel.Convert(img.At(px, py)).(color.NRGBA)
+				if c.A < 128 {
+					continue
+				}
+				r, g, b, opaque = r+int(c.R), g+int(c.G), b+int(c.B), opaque+1
+			}
+			if opaque*2 <= n {
+				continue
+			}
+			half.SetNRGBA(x, y, color.NRGBA{R: byte(r / opaque), G: byte(g / opaque), B: byte(b / opaque), A: 255})
+		}
+	}
+	return half
+}
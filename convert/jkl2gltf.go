@@ -0,0 +1,125 @@
+package convert
+
+import (
+	"fmt"
+	"github.com/go-gl/mathgl/mgl32"
+	"github.com/joelhays/go-jk/animation"
+	"github.com/joelhays/go-jk/jk/jktypes"
+)
+
+// FromJkl2gltf converts a level to glTF. Every sector becomes a node with the
+// surfaces it owns, colored by their light intensities, and every thing a node
+// placed like in the level with the meshes of its 3do, shared by all things
+// using it. Materials are textured with their first cel in the colors of the
+// first colormap of the level.
+func FromJkl2gltf(level *jktypes.Jkl, name string) (*GLTF, error) {
+	g := newGLTF()
+	g.doc.Scenes[0].Name = name
+
+	var sectors, things []int
+	if level.Model != nil {
+		var err error
+		if sectors, err = g.addSectors(level.Model, level.Sectors); err != nil {
+			return nil, err
+		}
+	}
+
+	models := make(map[string]*gltfModel)
+	for i, thing := range level.Things {
+		node := gltfNode{
+			Name:        fmt.Sprintf("thing %d %s", i, thing.TemplateName),
+			Translation: []float32{thing.Position[0], thing.Position[1], thing.Position[2]},
+			Rotation:    rotationQuat(mgl32.Vec3{float32(thing.Pitch), float32(thing.Yaw), float32(thing.Roll)}),
+			Extras:      map[string]interface{}{"template": thing.TemplateName, "sector": thing.Sector},
+		}
+
+		jk3doName := level.Jk3doTemplates[thing.TemplateName].Jk3doName
+		if object, ok := level.Jk3dos[jk3doName]; ok && len(object.GeoSets) > 0 {
+			model, ok := models[jk3doName]
+			if !ok {
+				var err error
+				if model, err = g.add3do(jk3doName, &object, 0); err != nil {
+					return nil, err
+				}
+				models[jk3doName] = model
+			}
+			for j, mesh := range model.meshes {
+				node.Children = append(node.Children, g.addNode(gltfNode{Mesh: intRef(mesh), Matrix: model.matrices[j][:]}))
+			}
+		}
+		things = append(things, g.addNode(node))
+	}
+
+	root := gltfNode{Name: name, Rotation: zUpToYUp}
+	root.Children = append(root.Children, g.addNode(gltfNode{Name: "sectors", Children: sectors}))
+	root.Children = append(root.Children, g.addNode(gltfNode{Name: "things", Children: things}))
+	g.doc.Scenes[0].Nodes = []int{g.addNode(root)}
+	return g, nil
+}
+
+// addSectors adds a node for every sector with a mesh of its surfaces and returns them.
+func (g *GLTF) addSectors(mesh *jktypes.JkMesh, sectors []jktypes.Sector) ([]int, error) {
+	var palette [256]jktypes.Vec3Byte
+	if len(mesh.ColorMaps) > 0 {
+		palette = mesh.ColorMaps[0].Palette
+	}
+	materials := make([]int, len(mesh.Materials))
+	for i, material := range mesh.Materials {
+		index, err := g.addMaterial(material, palette)
+		if err != nil {
+			return nil, err
+		}
+		materials[i] = index
+	}
+
+	var nodes []int
+	for sectorIdx, sector := range sectors {
+		primitives := make(map[int]*gltfPrimitiveData)
+		for i := sector.FirstSurface; i < sector.FirstSurface+sector.NumSurfaces && i < int64(len(mesh.Surfaces)); i++ {
+			surface := mesh.Surfaces[i]
+			if surface.Geo == 0 {
+				continue
+			}
+
+			material := -1
+			var jkMaterial jktypes.Material
+			if surface.MaterialID >= 0 && surface.MaterialID < int64(len(materials)) {
+				material = materials[surface.MaterialID]
+				jkMaterial = mesh.Materials[surface.MaterialID]
+			}
+			if primitives[material] == nil {
+				primitives[material] = &gltfPrimitiveData{}
+			}
+
+			// lit like the renderers: never darker than the ambient light of the
+			// sector, plus the extra light of both the sector and the surface
+			extraLight := float32(surface.ExtraLight + sector.ExtraLight)
+			vertices := make([]gltfVertex, len(surface.VertexIds))
+			for idx, id := range surface.VertexIds {
+				light := float32(surface.LightIntensities[idx])
+				if ambient := float32(sector.AmbientLight); light < ambient {
+					light = ambient
+				}
+				v := gltfVertex{position: mesh.Vertices[id], normal: surface.Normal, light: mgl32.Clamp(light+extraLight, 0, 1)}
+				if textureVertexID := surface.TextureVertexIds[idx]; textureVertexID != -1 {
+					v.uv = textureUV(mesh.TextureVertices[textureVertexID], jkMaterial)
+				}
+				vertices[idx] = v
+			}
+			primitives[material].addFan(vertices)
+		}
+
+		node := gltfNode{Name: fmt.Sprintf("sector %d", sectorIdx)}
+		if len(primitives) > 0 {
+			node.Mesh = intRef(g.addMesh(node.Name, primitives, true))
+		}
+		nodes = append(nodes, g.addNode(node))
+	}
+	return nodes, nil
+}
+
+// rotationQuat returns the glTF rotation of a pitch, yaw and roll in degrees.
+func rotationQuat(orientation mgl32.Vec3) []float32 {
+	q := mgl32.Mat4ToQuat(animation.RotationMatrix(orientation)).Normalize()
+	return []float32{q.V[0], q.V[1], q.V[2], q.W}
+}
@@ -0,0 +1,109 @@
+package convert
+
+import (
+	"encoding/binary"
+	"fmt"
+	"github.com/joelhays/go-jk/jk/jktypes"
+	"image"
+	"io"
+	"math"
+)
+
+const (
+	matVersion      = 0x32
+	matBitsPerPixel = 8
+	matTextureType  = 8
+	maxMatMipMaps   = 16
+)
+
+// NewMaterial makes a texture material of a cel per image, all of the same
+// size, quantized to palette with mipMaps mipmap levels each.
+func NewMaterial(name string, cels []image.Image, palette [256]jktypes.Vec3Byte, mipMaps int) (jktypes.Material, error) {
+	if len(cels) == 0 {
+		return jktypes.Material{}, fmt.Errorf("%s: no cels", name)
+	}
+	if mipMaps < 1 || mipMaps > maxMatMipMaps {
+		return jktypes.Material{}, fmt.Errorf("%s: %d mipmaps, expected 1 to %d", name, mipMaps, maxMatMipMaps)
+	}
+	size := cels[0].Bounds().Size()
+	if size.X < 1 || size.Y < 1 {
+		return jktypes.Material{}, fmt.Errorf("%s: empty image", name)
+	}
+
+	material := jktypes.Material{Name: name, Type: jktypes.MAT_TYPE_TEXTURE, SizeX: int32(size.X), SizeY: int32(size.Y)}
+	for i, img := range cels {
+		if img.Bounds().Size() != size {
+			return jktypes.Material{}, fmt.Errorf("%s: cel %d is %v, expected %v", name, i, img.Bounds().Size(), size)
+		}
+
+		cel := jktypes.MaterialCel{SizeX: int32(size.X), SizeY: int32(size.Y)}
+		for level := 0; level < mipMaps; level++ {
+			if level > 0 {
+				img = halfSize(img)
+			}
+			pixels, transparent := Quantize(img, palette)
+			cel.MipMaps = append(cel.MipMaps, pixels)
+			cel.Transparent = cel.Transparent || transparent
+		}
+		material.Cels = append(material.Cels, cel)
+	}
+
+	material.Texture = material.Cels[0].MipMaps[0]
+	material.Transparent = material.Cels[0].Transparent
+	return material, nil
+}
+
+// WriteMAT writes a material in the MAT format: a color header per cel of a
+// color material, or a texture header per cel followed by the mipmaps of every cel.
+func WriteMAT(w io.Writer, material *jktypes.Material) error {
+	numCels := int32(len(material.Cels))
+	header := jktypes.MtlHeader{Ver: matVersion, MatType: material.Type, NumTextures: numCels, Unk1: matBitsPerPixel}
+	copy(header.Name[:], "MAT ")
+	if material.Type == jktypes.MAT_TYPE_TEXTURE {
+		header.NumTextures1 = numCels
+	}
+	if err := binary.Write(w, binary.LittleEndian, &header); err != nil {
+		return err
+	}
+
+	// the unknown fields hold 1.0 as a float in the files of the game
+	one := int32(math.Float32bits(1))
+	switch material.Type {
+	case jktypes.MAT_TYPE_COLOR:
+		for _, cel := range material.Cels {
+			colHeader := jktypes.ColorHeader{ColorNum: cel.ColorIndex, Unk0: [4]int32{one, one, one, one}}
+			if err := binary.Write(w, binary.LittleEndian, &colHeader); err != nil {
+				return err
+			}
+		}
+		return nil
+
+	case jktypes.MAT_TYPE_TEXTURE:
+		for i, cel := range material.Cels {
+			texHeader := jktypes.TextureHeader{TexType: matTextureType, ColorNum: cel.ColorIndex, Unk0: [4]int32{one, one, one, one}, CurrentTXNum: int32(i)}
+			if err := binary.Write(w, binary.LittleEndian, &texHeader); err != nil {
+				return err
+			}
+		}
+		for i, cel := range material.Cels {
+			texData := jktypes.TextureData{SizeX: cel.SizeX, SizeY: cel.SizeY, NumMipMaps: int32(len(cel.MipMaps))}
+			if cel.Transparent {
+				texData.Pad[0] = 1
+			}
+			if err := binary.Write(w, binary.LittleEndian, &texData); err != nil {
+				return err
+			}
+			for level, pixels := range cel.MipMaps {
+				sizeX, sizeY := cel.MipMapSize(level)
+				if len(pixels) != int(sizeX)*int(sizeY) {
+					return fmt.Errorf("%s: cel %d mipmap %d has %d pixels, expected %dx%d", material.Name, i, level, len(pixels), sizeX, sizeY)
+				}
+				if _, err := w.Write(pixels); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+	return fmt.Errorf("%s: unknown material type %d", material.Name, material.Type)
+}
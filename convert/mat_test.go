@@ -0,0 +1,131 @@
+package convert
+
+import (
+	"bytes"
+	"github.com/joelhays/go-jk/jk/jkparsers"
+	"github.com/joelhays/go-jk/jk/jktypes"
+	"image"
+	"image/color"
+	"testing"
+)
+
+// testPalette has red, green, blue and white after black. Index 0 is magenta
+// so a pixel quantized to it by mistake stands out.
+func testPalette() [256]jktypes.Vec3Byte {
+	var palette [256]jktypes.Vec3Byte
+	palette[0] = jktypes.Vec3Byte{R: 255, B: 255}
+	palette[2] = jktypes.Vec3Byte{R: 255}
+	palette[3] = jktypes.Vec3Byte{G: 255}
+	palette[4] = jktypes.Vec3Byte{B: 255}
+	palette[5] = jktypes.Vec3Byte{R: 255, G: 255, B: 255}
+	return palette
+}
+
+// testQuadrants makes an image of nearly red, green, blue and white quadrants,
+// with the top left 2x2 pixels see-through.
+func testQuadrants(sizeX, sizeY int) *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, sizeX, sizeY))
+	colors := []color.NRGBA{{240, 10, 20, 255}, {5, 250, 0, 255}, {10, 0, 230, 200}, {250, 245, 255, 255}}
+	for y := 0; y < sizeY; y++ {
+		for x := 0; x < sizeX; x++ {
+			img.SetNRGBA(x, y, colors[testQuadrant(x, y, sizeX, sizeY)])
+		}
+	}
+	for y := 0; y < 2 && y < sizeY; y++ {
+		for x := 0; x < 2 && x < sizeX; x++ {
+			img.SetNRGBA(x, y, color.NRGBA{R: 240, A: 100})
+		}
+	}
+	return img
+}
+
+func testQuadrant(x, y, sizeX, sizeY int) int {
+	quadrant := 0
+	if x >= sizeX/2 {
+		quadrant++
+	}
+	if y >= sizeY/2 {
+		quadrant += 2
+	}
+	return quadrant
+}
+
+func TestQuantize(t *testing.T) {
+	pixels, transparent := Quantize(testQuadrants(4, 4), testPalette())
+	want := []byte{0, 0, 3, 3, 0, 0, 3, 3, 4, 4, 5, 5, 4, 4, 5, 5}
+	if !bytes.Equal(pixels, want) || !transparent {
+		t.Errorf("quantized to %v %v, expected %v with transparent pixels", pixels, transparent, want)
+	}
+}
+
+func TestMATRoundTrip(t *testing.T) {
+	palette := testPalette()
+	opaque := image.NewNRGBA(image.Rect(0, 0, 16, 8))
+	for i := range opaque.Pix {
+		opaque.Pix[i] = 255
+	}
+	material, err := NewMaterial("test.mat", []image.Image{testQuadrants(16, 8), opaque}, palette, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := WriteMAT(&buf, &material); err != nil {
+		t.Fatal(err)
+	}
+	read, err := jkparsers.NewMatParser().ParseFromBytes(buf.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if read.Type != jktypes.MAT_TYPE_TEXTURE || read.SizeX != 16 || read.SizeY != 8 || len(read.Cels) != 2 || !read.Transparent {
+		t.Fatalf("read a type %d %dx%d material of %d cels, transparent %v, expected a transparent 16x8 texture of 2",
+			read.Type, read.SizeX, read.SizeY, len(read.Cels), read.Transparent)
+	}
+	if !bytes.Equal(read.Texture, material.Cels[0].MipMaps[0]) {
+		t.Error("the texture is not the first mipmap of the first cel")
+	}
+
+	for i, cel := range read.Cels {
+		if cel.Transparent != (i == 0) || len(cel.MipMaps) != 3 {
+			t.Errorf("cel %d has %d mipmaps, transparent %v", i, len(cel.MipMaps), cel.Transparent)
+			continue
+		}
+		for level, pixels := range cel.MipMaps {
+			sizeX, sizeY := cel.MipMapSize(level)
+			if int(sizeX) != 16>>uint(level) || int(sizeY) != 8>>uint(level) || len(pixels) != int(sizeX*sizeY) {
+				t.Errorf("cel %d mipmap %d is %dx%d of %d pixels, expected %dx%d", i, level, sizeX, sizeY, len(pixels), 16>>uint(level), 8>>uint(level))
+				continue
+			}
+			if !bytes.Equal(pixels, material.Cels[i].MipMaps[level]) {
+				t.Errorf("cel %d mipmap %d read back as %v, expected %v", i, level, pixels, material.Cels[i].MipMaps[level])
+				continue
+			}
+
+			// the see-through 2x2 pixels are a single pixel a level down and
+			// outnumbered two levels down
+			for p, index := range pixels {
+				x, y := p%int(sizeX), p/int(sizeX)
+				want := byte(5)
+				if i == 0 {
+					want = byte(2 + testQuadrant(x, y, int(sizeX), int(sizeY)))
+					if x < 2>>uint(level) && y < 2>>uint(level) {
+						want = 0
+					}
+				}
+				if index != want {
+					t.Errorf("cel %d mipmap %d has %d at %d,%d, expected %d", i, level, index, x, y, want)
+					break
+				}
+			}
+		}
+	}
+
+	img := CelImage(read.Cels[0], 0, palette)
+	if c := img.NRGBAAt(1, 1); c.A != 0 {
+		t.Errorf("the see-through corner is %v", c)
+	}
+	if c := img.NRGBAAt(15, 7); c != (color.NRGBA{255, 255, 255, 255}) {
+		t.Errorf("the white quadrant is %v", c)
+	}
+}
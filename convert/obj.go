@@ -0,0 +1,295 @@
+package convert
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/go-gl/mathgl/mgl32"
+	"github.com/joelhays/go-jk/animation"
+	"github.com/joelhays/go-jk/jk/jktypes"
+	"image"
+	"image/png"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// OBJ is a Wavefront OBJ model in the z up coordinates of the game, with an MTL
+// material library and a PNG texture per material.
+type OBJ struct {
+	name        string
+	positions   []mgl32.Vec3
+	uvs         []mgl32.Vec2
+	normals     []mgl32.Vec3
+	groups      []objGroup
+	materials   []objMaterial
+	materialIDs map[string]int
+}
+
+type objGroup struct {
+	name  string
+	faces []objFace
+}
+
+type objFace struct {
+	material int      // index into OBJ.materials
+	vertices [][3]int // 1 based position, uv and normal, 0 when missing
+}
+
+type objMaterial struct {
+	name        string
+	image       *image.NRGBA // nil for untextured faces
+	transparent bool
+}
+
+func newOBJ(name string) *OBJ {
+	return &OBJ{name: name, materialIDs: make(map[string]int)}
+}
+
+// From3do2obj converts a geoset of a 3do to OBJ, every mesh a group placed by
+// the hierarchy in the rest pose.
+func From3do2obj(object *jktypes.Jk3doFile, name string, geoset int) (*OBJ, error) {
+	if geoset < 0 || geoset >= len(object.GeoSets) {
+		return nil, fmt.Errorf("%s: no geoset %d, it has %d", name, geoset, len(object.GeoSets))
+	}
+	o := newOBJ(name)
+
+	meshes := object.GeoSets[geoset].Meshes
+	matrices := make([]mgl32.Mat4, len(meshes))
+	names := make([]string, len(meshes))
+	for i := range meshes {
+		matrices[i] = mgl32.Ident4()
+		names[i] = fmt.Sprintf("mesh %d", i)
+	}
+	nodeMatrices := animation.NodeMatrices(object, animation.RestPose(object))
+	for i, node := range object.Hierarchy {
+		if node.MeshID >= 0 && node.MeshID < int64(len(meshes)) {
+			matrices[node.MeshID] = nodeMatrices[i]
+			names[node.MeshID] = node.NodeName
+		}
+	}
+
+	for meshIdx, mesh := range meshes {
+		matrix := matrices[meshIdx]
+		rotation := matrix.Mat3()
+
+		firstPosition := len(o.positions)
+		for _, v := range mesh.Vertices {
+			o.positions = append(o.positions, matrix.Mul4x1(v.Vec4(1)).Vec3())
+		}
+		firstNormal := len(o.normals)
+		for _, n := range mesh.VertexNormals {
+			o.normals = append(o.normals, rotation.Mul3x1(n).Normalize())
+		}
+		smooth := len(mesh.VertexNormals) == len(mesh.Vertices)
+
+		group := objGroup{name: names[meshIdx]}
+		for faceIdx, face := range mesh.Faces {
+			if face.GeometryMode == 0 {
+				continue
+			}
+			jkMaterial, material := o.faceMaterial(object.Materials, face.MaterialID, object.ColorMap.Palette)
+
+			flatNormal := 0
+			if !smooth && faceIdx < len(mesh.FaceNormals) {
+				o.normals = append(o.normals, rotation.Mul3x1(mesh.FaceNormals[faceIdx]).Normalize())
+				flatNormal = len(o.normals)
+			}
+
+			f := objFace{material: material}
+			for idx, id := range face.VertexIds {
+				vertex := [3]int{firstPosition + int(id) + 1, 0, flatNormal}
+				if smooth {
+					vertex[2] = firstNormal + int(id) + 1
+				}
+				if textureVertexID := face.TextureVertexIds[idx]; textureVertexID >= 0 && textureVertexID < int64(len(mesh.TextureVertices)) {
+					vertex[1] = o.addUV(mesh.TextureVertices[textureVertexID], jkMaterial)
+				}
+				f.vertices = append(f.vertices, vertex)
+			}
+			group.faces = append(group.faces, f)
+		}
+		o.groups = append(o.groups, group)
+	}
+	return o, nil
+}
+
+// FromJkMesh2obj converts the geometry of a level to OBJ, the surfaces of every
+// sector in a group. Every drawn geometry mode is exported, surfaces that are
+// not drawn, like most adjoins, are left out.
+func FromJkMesh2obj(mesh *jktypes.JkMesh, name string) *OBJ {
+	o := newOBJ(name)
+	o.positions = append(o.positions, mesh.Vertices...)
+
+	var palette [256]jktypes.Vec3Byte
+	if len(mesh.ColorMaps) > 0 {
+		palette = mesh.ColorMaps[0].Palette
+	}
+
+	sectors := make(map[int64]int)
+	for _, surface := range mesh.Surfaces {
+		if surface.Geo == 0 {
+			continue
+		}
+		group, ok := sectors[surface.Sector]
+		if !ok {
+			group = len(o.groups)
+			sectors[surface.Sector] = group
+			o.groups = append(o.groups, objGroup{name: fmt.Sprintf("sector %d", surface.Sector)})
+		}
+		jkMaterial, material := o.faceMaterial(mesh.Materials, surface.MaterialID, palette)
+
+		o.normals = append(o.normals, surface.Normal)
+		f := objFace{material: material}
+		for idx, id := range surface.VertexIds {
+			vertex := [3]int{int(id) + 1, 0, len(o.normals)}
+			if textureVertexID := surface.TextureVertexIds[idx]; textureVertexID >= 0 && textureVertexID < int64(len(mesh.TextureVertices)) {
+				vertex[1] = o.addUV(mesh.TextureVertices[textureVertexID], jkMaterial)
+			}
+			f.vertices = append(f.vertices, vertex)
+		}
+		o.groups[group].faces = append(o.groups[group].faces, f)
+	}
+	return o
+}
+
+// faceMaterial returns the material of a face and its index in the library,
+// adding it textured with its first cel the first time it is used.
+func (o *OBJ) faceMaterial(materials []jktypes.Material, materialID int64, palette [256]jktypes.Vec3Byte) (jktypes.Material, int) {
+	var material jktypes.Material
+	if materialID >= 0 && materialID < int64(len(materials)) {
+		material = materials[materialID]
+	}
+	name := strings.TrimSuffix(material.Name, filepath.Ext(material.Name))
+	if name == "" {
+		name = "none"
+	}
+	if index, ok := o.materialIDs[name]; ok {
+		return material, index
+	}
+
+	m := objMaterial{name: name}
+	if len(material.Cels) > 0 {
+		m.image = CelImage(material.Cels[0], 0, palette)
+		m.transparent = material.Cels[0].Transparent
+	}
+	o.materials = append(o.materials, m)
+	o.materialIDs[name] = len(o.materials) - 1
+	return material, len(o.materials) - 1
+}
+
+// addUV adds a texture vertex and returns its 1 based index. OBJ textures start
+// at the bottom, unlike the top down ones of the renderers.
+func (o *OBJ) addUV(uv mgl32.Vec2, material jktypes.Material) int {
+	uv = textureUV(uv, material)
+	o.uvs = append(o.uvs, mgl32.Vec2{uv[0], 1 - uv[1]})
+	return len(o.uvs)
+}
+
+// Textures returns the texture of every material by the file name the MTL refers to.
+func (o *OBJ) Textures() map[string]image.Image {
+	textures := make(map[string]image.Image)
+	for _, m := range o.materials {
+		if m.image != nil {
+			textures[m.name+".png"] = m.image
+		}
+	}
+	return textures
+}
+
+// WriteOBJ writes the geometry, which refers to the material library as mtlLib
+// unless it is empty.
+func (o *OBJ) WriteOBJ(w io.Writer, mtlLib string) error {
+	b := bufio.NewWriter(w)
+	fmt.Fprintf(b, "# %s\n", o.name)
+	if mtlLib != "" && len(o.materials) > 0 {
+		fmt.Fprintf(b, "mtllib %s\n", mtlLib)
+	}
+	fmt.Fprintf(b, "o %s\n", o.name)
+
+	for _, v := range o.positions {
+		fmt.Fprintf(b, "v %f %f %f\n", v[0], v[1], v[2])
+	}
+	for _, vt := range o.uvs {
+		fmt.Fprintf(b, "vt %f %f\n", vt[0], vt[1])
+	}
+	for _, vn := range o.normals {
+		fmt.Fprintf(b, "vn %f %f %f\n", vn[0], vn[1], vn[2])
+	}
+
+	for _, group := range o.groups {
+		if len(group.faces) == 0 {
+			continue
+		}
+		fmt.Fprintf(b, "g %s\n", strings.Replace(group.name, " ", "_", -1))
+		material := -1
+		for _, f := range group.faces {
+			if f.material != material {
+				material = f.material
+				fmt.Fprintf(b, "usemtl %s\n", o.materials[material].name)
+			}
+			b.WriteString("f")
+			for _, v := range f.vertices {
+				switch {
+				case v[1] == 0 && v[2] == 0:
+					fmt.Fprintf(b, " %d", v[0])
+				case v[1] == 0:
+					fmt.Fprintf(b, " %d//%d", v[0], v[2])
+				case v[2] == 0:
+					fmt.Fprintf(b, " %d/%d", v[0], v[1])
+				default:
+					fmt.Fprintf(b, " %d/%d/%d", v[0], v[1], v[2])
+				}
+			}
+			b.WriteString("\n")
+		}
+	}
+	return b.Flush()
+}
+
+// WriteMTL writes the material library. Textures are referred to by the names
+// Textures returns them with, transparent ones also as the alpha map.
+func (o *OBJ) WriteMTL(w io.Writer) error {
+	b := bufio.NewWriter(w)
+	for _, m := range o.materials {
+		fmt.Fprintf(b, "newmtl %s\n", m.name)
+		fmt.Fprintf(b, "Ka 0 0 0\nKd 1 1 1\nKs 0 0 0\nd 1\nillum 1\n")
+		if m.image != nil {
+			fmt.Fprintf(b, "map_Kd %s.png\n", m.name)
+			if m.transparent {
+				fmt.Fprintf(b, "map_d %s.png\n", m.name)
+			}
+		}
+		b.WriteString("\n")
+	}
+	return b.Flush()
+}
+
+// Save writes the model to dir as a .obj and a .mtl named after it, with the
+// textures next to them.
+func (o *OBJ) Save(dir string) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	for name, texture := range o.Textures() {
+		texture := texture
+		err := writeFile(filepath.Join(dir, name), func(w io.Writer) error {
+			return png.Encode(w, texture)
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	mtlLib := ""
+	if len(o.materials) > 0 {
+		mtlLib = o.name + ".mtl"
+		if err := writeFile(filepath.Join(dir, mtlLib), o.WriteMTL); err != nil {
+			return err
+		}
+	}
+	return writeFile(filepath.Join(dir, o.name+".obj"), func(w io.Writer) error {
+		return o.WriteOBJ(w, mtlLib)
+	})
+}
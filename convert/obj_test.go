@@ -0,0 +1,218 @@
+package convert
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/joelhays/go-jk/jk/jktypes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// objCounts counts the lines of an OBJ by their first word.
+func objCounts(obj string) map[string]int {
+	counts := make(map[string]int)
+	for _, line := range strings.Split(obj, "\n") {
+		if fields := strings.Fields(line); len(fields) > 0 {
+			counts[fields[0]]++
+		}
+	}
+	return counts
+}
+
+// objMaterials returns the materials used by every group in the order of the OBJ.
+func objMaterials(obj string) [][]string {
+	var groups [][]string
+	for _, line := range strings.Split(obj, "\n") {
+		fields := strings.Fields(line)
+		switch {
+		case len(fields) == 2 && fields[0] == "g":
+			groups = append(groups, nil)
+		case len(fields) == 2 && fields[0] == "usemtl" && len(groups) > 0:
+			groups[len(groups)-1] = append(groups[len(groups)-1], fields[1])
+		}
+	}
+	return groups
+}
+
+// mtlStatements returns the statements of every material of an MTL by its name.
+func mtlStatements(mtl string) map[string]map[string]string {
+	materials := make(map[string]map[string]string)
+	var current map[string]string
+	for _, line := range strings.Split(mtl, "\n") {
+		fields := strings.SplitN(line, " ", 2)
+		if len(fields) != 2 {
+			continue
+		}
+		if fields[0] == "newmtl" {
+			current = make(map[string]string)
+			materials[fields[1]] = current
+		} else if current != nil {
+			current[fields[0]] = fields[1]
+		}
+	}
+	return materials
+}
+
+func writeTestOBJ(t *testing.T, o *OBJ) (string, string) {
+	t.Helper()
+	var obj, mtl bytes.Buffer
+	if err := o.WriteOBJ(&obj, "test.mtl"); err != nil {
+		t.Fatal(err)
+	}
+	if err := o.WriteMTL(&mtl); err != nil {
+		t.Fatal(err)
+	}
+	return obj.String(), mtl.String()
+}
+
+func objMaterialName(materials []jktypes.Material, id int64) string {
+	if id < 0 || id >= int64(len(materials)) {
+		return "none"
+	}
+	return strings.TrimSuffix(materials[id].Name, filepath.Ext(materials[id].Name))
+}
+
+// appendMaterial appends a material used by a group unless it already uses it last.
+func appendMaterial(materials []string, name string) []string {
+	if len(materials) > 0 && materials[len(materials)-1] == name {
+		return materials
+	}
+	return append(materials, name)
+}
+
+func checkOBJMaterials(t *testing.T, name string, obj, mtl string, want [][]string, transparent map[string]bool) {
+	t.Helper()
+	if got := objMaterials(obj); fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("%s: groups use %v, expected %v", name, got, want)
+	}
+
+	materials := mtlStatements(mtl)
+	used := make(map[string]bool)
+	for _, group := range want {
+		for _, material := range group {
+			used[material] = true
+			statements, ok := materials[material]
+			if !ok {
+				t.Errorf("%s: no material %s in the library", name, material)
+				continue
+			}
+			if statements["d"] != "1" || statements["map_Kd"] != material+".png" {
+				t.Errorf("%s: material %s is %v, expected it opaque and textured with %s.png", name, material, statements, material)
+			}
+			if mapD, ok := statements["map_d"]; ok != transparent[material] || (ok && mapD != material+".png") {
+				t.Errorf("%s: material %s has the alpha map %q, expected one %v", name, material, mapD, transparent[material])
+			}
+		}
+	}
+	for material := range transparent {
+		if !used[material] {
+			t.Errorf("%s: transparent material %s is not used", name, material)
+		}
+	}
+}
+
+func Test3do2obj(t *testing.T) {
+	resolver := newTestResolver(t, "strvsite.mat")
+	object := parseTest3do(t, resolver, "3do/rystr.3do")
+	o, err := From3do2obj(&object, "rystr", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	obj, mtl := writeTestOBJ(t, o)
+
+	var want struct{ v, vt, vn, f, g int }
+	var materials [][]string
+	for _, mesh := range object.GeoSets[0].Meshes {
+		want.v += len(mesh.Vertices)
+		smooth := len(mesh.VertexNormals) == len(mesh.Vertices)
+		if smooth {
+			want.vn += len(mesh.VertexNormals)
+		}
+		var group []string
+		for _, face := range mesh.Faces {
+			if face.GeometryMode == 0 {
+				continue
+			}
+			want.f++
+			if !smooth {
+				want.vn++
+			}
+			for _, id := range face.TextureVertexIds {
+				if id >= 0 && id < int64(len(mesh.TextureVertices)) {
+					want.vt++
+				}
+			}
+			group = appendMaterial(group, objMaterialName(object.Materials, face.MaterialID))
+		}
+		if group != nil {
+			want.g++
+			materials = append(materials, group)
+		}
+	}
+
+	counts := objCounts(obj)
+	if got := (struct{ v, vt, vn, f, g int }{counts["v"], counts["vt"], counts["vn"], counts["f"], counts["g"]}); got != want {
+		t.Errorf("wrote %+v lines, expected %+v", got, want)
+	}
+	if counts["mtllib"] != 1 || !strings.Contains(obj, "mtllib test.mtl\n") {
+		t.Error("the OBJ does not refer to test.mtl")
+	}
+	checkOBJMaterials(t, "rystr", obj, mtl, materials, map[string]bool{"strvsite": true})
+
+	dir := t.TempDir()
+	if err := o.Save(dir); err != nil {
+		t.Fatal(err)
+	}
+	files := []string{"rystr.obj", "rystr.mtl"}
+	for name := range o.Textures() {
+		files = append(files, name)
+	}
+	for _, name := range files {
+		if _, err := os.Stat(filepath.Join(dir, name)); err != nil {
+			t.Error(err)
+		}
+	}
+	if len(files) != 2+len(object.Materials) {
+		t.Errorf("saved %d textures, expected one for each of the %d materials", len(files)-2, len(object.Materials))
+	}
+}
+
+func TestJkMesh2obj(t *testing.T) {
+	resolver := newTestResolver(t, "15wcone2.mat")
+	level := parseTestLevel(t, resolver, "jkl/m_boss15.jkl")
+	o := FromJkMesh2obj(level.Model, "m_boss15")
+	obj, mtl := writeTestOBJ(t, o)
+
+	var want struct{ v, vt, vn, f, g int }
+	want.v = len(level.Model.Vertices)
+	var materials [][]string
+	sectors := make(map[int64]int)
+	for _, surface := range level.Model.Surfaces {
+		if surface.Geo == 0 {
+			continue
+		}
+		want.f++
+		want.vn++
+		for _, id := range surface.TextureVertexIds {
+			if id >= 0 && id < int64(len(level.Model.TextureVertices)) {
+				want.vt++
+			}
+		}
+		group, ok := sectors[surface.Sector]
+		if !ok {
+			group = len(materials)
+			sectors[surface.Sector] = group
+			materials = append(materials, nil)
+		}
+		materials[group] = appendMaterial(materials[group], objMaterialName(level.Model.Materials, surface.MaterialID))
+	}
+	want.g = len(sectors)
+
+	counts := objCounts(obj)
+	if got := (struct{ v, vt, vn, f, g int }{counts["v"], counts["vt"], counts["vn"], counts["f"], counts["g"]}); got != want {
+		t.Errorf("wrote %+v lines, expected %+v", got, want)
+	}
+	checkOBJMaterials(t, "m_boss15", obj, mtl, materials, map[string]bool{"15wcone2": true})
+}
@@ -1,41 +1,50 @@
 package main
 
 import (
-	"github.com/go-gl/glfw/v3.2/glfw"
+	"github.com/joelhays/go-jk/backend"
 	"github.com/joelhays/go-jk/camera"
 	"github.com/joelhays/go-jk/scene"
 )
 
 var (
-	keys  = make(map[glfw.Key]bool)
+	keys  = make(map[backend.Key]bool)
 	lastX float64
 	lastY float64
 )
 
 type InputManager struct {
-	keys         map[glfw.Key]bool
+	keys         map[backend.Key]bool
 	lastX        float64
 	lastY        float64
 	sceneManager *scene.SceneManager
+	backend      backend.Backend
 }
 
-func NewInputManager(sceneManager *scene.SceneManager) *InputManager {
-	return &InputManager{keys: make(map[glfw.Key]bool), sceneManager: sceneManager}
+func NewInputManager(sceneManager *scene.SceneManager, b backend.Backend) *InputManager {
+	return &InputManager{keys: make(map[backend.Key]bool), sceneManager: sceneManager, backend: b}
 }
 
-func (m *InputManager) KeyCallback(window *glfw.Window, key glfw.Key, scancode int, action glfw.Action, mods glfw.ModifierKey) {
-	if key == glfw.KeyEscape && action == glfw.Press {
+func (m *InputManager) KeyCallback(key backend.Key, action backend.Action) {
+	if key == backend.KEY_ESCAPE && action == backend.ACTION_PRESS {
 		m.sceneManager.LoadScene("menu")
 	}
 
-	if action == glfw.Press {
+	if key == backend.KEY_L && action == backend.ACTION_PRESS {
+		if m.backend.GetShadingMode() == backend.SHADING_COLORMAP {
+			m.backend.SetShadingMode(backend.SHADING_PHONG)
+		} else {
+			m.backend.SetShadingMode(backend.SHADING_COLORMAP)
+		}
+	}
+
+	if action == backend.ACTION_PRESS {
 		keys[key] = true
-	} else if action == glfw.Release {
+	} else if action == backend.ACTION_RELEASE {
 		delete(keys, key)
 	}
 }
 
-func (m *InputManager) MouseCallback(window *glfw.Window, xpos float64, ypos float64) {
+func (m *InputManager) MouseCallback(xpos float64, ypos float64) {
 	xOffset := xpos - lastX
 	yOffset := lastY - ypos
 	lastX = xpos
@@ -46,44 +55,44 @@ func (m *InputManager) MouseCallback(window *glfw.Window, xpos float64, ypos flo
 
 func doMovement(deltaTime float64) {
 
-	if keyMinus := keys[glfw.KeyKPSubtract]; keyMinus {
+	if keyMinus := keys[backend.KEY_KP_SUBTRACT]; keyMinus {
 		cam.MovementSpeed = .75
 	}
 
-	if keyDecimal := keys[glfw.KeyKPDecimal]; keyDecimal {
+	if keyDecimal := keys[backend.KEY_KP_DECIMAL]; keyDecimal {
 		cam.MovementSpeed = 6
 	}
 
-	if keyPlus := keys[glfw.KeyKPAdd]; keyPlus {
+	if keyPlus := keys[backend.KEY_KP_ADD]; keyPlus {
 		cam.MovementSpeed = 12
 	}
 
-	if key := keys[glfw.KeyKP1]; key {
+	if key := keys[backend.KEY_KP_1]; key {
 		cam.MovementSpeed = 1
 	}
-	if key := keys[glfw.KeyKP2]; key {
+	if key := keys[backend.KEY_KP_2]; key {
 		cam.MovementSpeed = 2
 	}
-	if key := keys[glfw.KeyKP3]; key {
+	if key := keys[backend.KEY_KP_3]; key {
 		cam.MovementSpeed = 3
 	}
-	if key := keys[glfw.KeyKP4]; key {
+	if key := keys[backend.KEY_KP_4]; key {
 		cam.MovementSpeed = 4
 	}
 
-	if keyW, keyUp := keys[glfw.KeyW], keys[glfw.KeyUp]; keyW || keyUp {
+	if keyW, keyUp := keys[backend.KEY_W], keys[backend.KEY_UP]; keyW || keyUp {
 		cam.ProcessKeyboard(camera.CAMERA_FORWARD, deltaTime)
 	}
 
-	if keyS, keyDown := keys[glfw.KeyS], keys[glfw.KeyDown]; keyS || keyDown {
+	if keyS, keyDown := keys[backend.KEY_S], keys[backend.KEY_DOWN]; keyS || keyDown {
 		cam.ProcessKeyboard(camera.CAMERA_BACKWARD, deltaTime)
 	}
 
-	if keyA, keyLeft := keys[glfw.KeyA], keys[glfw.KeyLeft]; keyA || keyLeft {
+	if keyA, keyLeft := keys[backend.KEY_A], keys[backend.KEY_LEFT]; keyA || keyLeft {
 		cam.ProcessKeyboard(camera.CAMERA_LEFT, deltaTime)
 	}
 
-	if keyD, keyRight := keys[glfw.KeyD], keys[glfw.KeyRight]; keyD || keyRight {
+	if keyD, keyRight := keys[backend.KEY_D], keys[backend.KEY_RIGHT]; keyD || keyRight {
 		cam.ProcessKeyboard(camera.CAMERA_RIGHT, deltaTime)
 	}
 }
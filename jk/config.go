@@ -0,0 +1,81 @@
+package jk
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+const (
+	// InstallDirEnv names the environment variable that can hold the game install root.
+	InstallDirEnv  = "JK_INSTALL_DIR"
+	configDirName  = "go-jk"
+	configFileName = "config.json"
+)
+
+// Config describes where the game assets can be found.
+type Config struct {
+	InstallDir  string `json:"installDir"`
+	OverrideDir string `json:"overrideDir"` // loose files taking precedence over the GOBs
+}
+
+// LoadConfig resolves the game configuration from a config.json file in the
+// working directory or the user's go-jk config directory. The install root of
+// the file is replaced by the JK_INSTALL_DIR environment variable when it is
+// set, and by installDir when that is set.
+func LoadConfig(installDir string) (Config, error) {
+	cfg, err := loadConfigFile()
+	if err != nil {
+		return Config{}, err
+	}
+
+	if env := os.Getenv(InstallDirEnv); env != "" {
+		cfg.InstallDir = env
+	}
+	if installDir != "" {
+		cfg.InstallDir = installDir
+	}
+	return cfg, nil
+}
+
+// loadConfigFile reads the first config file that sets anything.
+func loadConfigFile() (Config, error) {
+	for _, path := range configFilePaths() {
+		bytes, err := ioutil.ReadFile(path)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return Config{}, err
+		}
+
+		var cfg Config
+		if err := json.Unmarshal(bytes, &cfg); err != nil {
+			return Config{}, err
+		}
+		if cfg != (Config{}) {
+			return cfg, nil
+		}
+	}
+
+	return Config{}, nil
+}
+
+// CacheDir returns the directory for files go-jk derives from the game assets,
+// below the user's cache directory.
+func CacheDir() (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, configDirName), nil
+}
+
+func configFilePaths() []string {
+	paths := []string{configFileName}
+	if dir, err := os.UserConfigDir(); err == nil {
+		paths = append(paths, filepath.Join(dir, configDirName, configFileName))
+	}
+	return paths
+}
@@ -0,0 +1,68 @@
+package jk
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// setenv sets an environment variable for the rest of the test.
+func setenv(t *testing.T, key string, value string) {
+	old, ok := os.LookupEnv(key)
+	if err := os.Setenv(key, value); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if ok {
+			os.Setenv(key, old)
+		} else {
+			os.Unsetenv(key)
+		}
+	})
+}
+
+// chdir changes the working directory for the rest of the test.
+func chdir(t *testing.T, dir string) {
+	old, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		os.Chdir(old)
+	})
+}
+
+func TestLoadConfigPrecedence(t *testing.T) {
+	dir := t.TempDir()
+	chdir(t, dir)
+	setenv(t, "XDG_CONFIG_HOME", filepath.Join(dir, "config"))
+	setenv(t, "HOME", dir)
+	if err := ioutil.WriteFile(configFileName, []byte(`{"installDir": "file", "overrideDir": "override"}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		env        string
+		installDir string
+		want       string
+	}{
+		{"", "", "file"},
+		{"env", "", "env"},
+		{"env", "flag", "flag"},
+		{"", "flag", "flag"},
+	}
+	for _, test := range tests {
+		setenv(t, InstallDirEnv, test.env)
+		cfg, err := LoadConfig(test.installDir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if cfg.InstallDir != test.want || cfg.OverrideDir != "override" {
+			t.Errorf("env %q and flag %q: got %+v, expected install dir %q and the override dir of the file", test.env, test.installDir, cfg, test.want)
+		}
+	}
+}
@@ -0,0 +1,303 @@
+package jk
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// FS is a read-only file system over GOBs and loose directories layered on top
+// of each other. Paths use / as separator and are matched case-insensitively,
+// as the engine does.
+type FS struct {
+	index *ResourceIndex
+	dirs  map[string]*fsDir
+}
+
+type fsDir struct {
+	name    string
+	entries map[string]fs.DirEntry
+}
+
+// NewFS creates a file system over the given GOB files and directories, earlier
+// layers hiding the files with the same path in later ones. The GOBs are kept
+// open until Close.
+func NewFS(layers ...string) (*FS, error) {
+	index, err := newLayeredIndex(layers)
+	if err != nil {
+		return nil, err
+	}
+	return newFS(index), nil
+}
+
+func newFS(index *ResourceIndex) *FS {
+	f := &FS{index: index, dirs: map[string]*fsDir{".": {name: ".", entries: make(map[string]fs.DirEntry)}}}
+	for _, key := range index.order {
+		entry := index.paths[key]
+		name := strings.Replace(strings.Replace(entry.Path, "\\", "/", -1), "//", "/", -1)
+		f.addFile(strings.Trim(name, "/"), entry)
+	}
+	return f
+}
+
+func (f *FS) addFile(name string, entry ResourceEntry) {
+	parent := f.mkdirAll(path.Dir(name))
+	base := path.Base(name)
+	key := strings.ToLower(base)
+	if _, ok := parent.entries[key]; !ok {
+		parent.entries[key] = dirEntry{fileInfo{name: base, size: entry.Size}}
+	}
+}
+
+func (f *FS) mkdirAll(name string) *fsDir {
+	key := strings.ToLower(name)
+	if dir, ok := f.dirs[key]; ok {
+		return dir
+	}
+
+	parent := f.mkdirAll(path.Dir(name))
+	base := path.Base(name)
+	if _, ok := parent.entries[strings.ToLower(base)]; !ok {
+		parent.entries[strings.ToLower(base)] = dirEntry{fileInfo{name: base, dir: true}}
+	}
+	dir := &fsDir{name: base, entries: make(map[string]fs.DirEntry)}
+	f.dirs[key] = dir
+	return dir
+}
+
+// Open opens the file or directory at name.
+func (f *FS) Open(name string) (fs.File, error) {
+	if !validPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+
+	if dir, ok := f.dirs[strings.ToLower(name)]; ok {
+		return &openDir{info: fileInfo{name: dir.name, dir: true}, entries: dir.sortedEntries()}, nil
+	}
+
+	entry, ok := f.index.paths[normalizeResourcePath(name)]
+	if !ok {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+	info := fileInfo{name: path.Base(name), size: entry.Size}
+	if entry.Loose {
+		file, err := os.Open(filepath.Join(entry.Archive, filepath.FromSlash(entry.Path)))
+		if err != nil {
+			return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+		}
+		return &openFile{info: info, ReadSeeker: file, closer: file}, nil
+	}
+	return &openFile{info: info, ReadSeeker: io.NewSectionReader(entry.source.file, entry.offset, entry.Size)}, nil
+}
+
+// ReadDir returns the entries of the directory at name sorted by name.
+func (f *FS) ReadDir(name string) ([]fs.DirEntry, error) {
+	if !validPath(name) {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrInvalid}
+	}
+	dir, ok := f.dirs[strings.ToLower(name)]
+	if !ok {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrNotExist}
+	}
+	return dir.sortedEntries(), nil
+}
+
+// Stat describes the file or directory at name.
+func (f *FS) Stat(name string) (fs.FileInfo, error) {
+	if !validPath(name) {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: fs.ErrInvalid}
+	}
+	if dir, ok := f.dirs[strings.ToLower(name)]; ok {
+		return fileInfo{name: dir.name, dir: true}, nil
+	}
+	entry, ok := f.index.paths[normalizeResourcePath(name)]
+	if !ok {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: fs.ErrNotExist}
+	}
+	return fileInfo{name: path.Base(name), size: entry.Size}, nil
+}
+
+// ReadFile returns the content of the file at name.
+func (f *FS) ReadFile(name string) ([]byte, error) {
+	if !validPath(name) {
+		return nil, &fs.PathError{Op: "read", Path: name, Err: fs.ErrInvalid}
+	}
+	entry, ok := f.index.paths[normalizeResourcePath(name)]
+	if !ok {
+		return nil, &fs.PathError{Op: "read", Path: name, Err: fs.ErrNotExist}
+	}
+	return f.index.Read(entry)
+}
+
+// Resolve finds the file a name refers to the way the engine does, see
+// ResourceIndex.Lookup, and returns its path in the file system.
+func (f *FS) Resolve(name string) (string, bool) {
+	entry, ok := f.index.Lookup(name)
+	if !ok {
+		return "", false
+	}
+	return strings.Trim(strings.Replace(entry.Path, "\\", "/", -1), "/"), true
+}
+
+// ReadResource reads a file found as by Resolve, which makes FS the
+// ResourceResolver of the game files.
+func (f *FS) ReadResource(name string) ([]byte, error) {
+	entry, ok := f.index.Lookup(name)
+	if !ok {
+		return nil, &fs.PathError{Op: "read", Path: name, Err: fs.ErrNotExist}
+	}
+	return f.index.Read(entry)
+}
+
+// Close closes the GOBs of the file system.
+func (f *FS) Close() error {
+	return f.index.Close()
+}
+
+// ReadResource reads a file by path, or by name from the search directories of
+// its type like the engine does, e.g. "dflt.cmp" from misc/cmp.
+func ReadResource(fsys fs.FS, name string) ([]byte, error) {
+	if f, ok := fsys.(*FS); ok {
+		return f.ReadResource(name)
+	}
+
+	var firstErr error
+	for _, key := range resourceKeys(name) {
+		data, err := fs.ReadFile(fsys, strings.Replace(key, "\\", "/", -1))
+		if !errors.Is(err, fs.ErrNotExist) {
+			return data, err
+		}
+		if firstErr == nil {
+			firstErr = err
+		}
+	}
+	return nil, firstErr
+}
+
+// validPath reports whether name is valid for Open, GOB paths use \ as separator
+// but the file system only accepts /.
+func validPath(name string) bool {
+	return fs.ValidPath(name) && !strings.Contains(name, "\\")
+}
+
+func (d *fsDir) sortedEntries() []fs.DirEntry {
+	entries := make([]fs.DirEntry, 0, len(d.entries))
+	for _, entry := range d.entries {
+		entries = append(entries, entry)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Name() < entries[j].Name()
+	})
+	return entries
+}
+
+type fileInfo struct {
+	name string
+	size int64
+	dir  bool
+}
+
+func (i fileInfo) Name() string {
+	return i.name
+}
+
+func (i fileInfo) Size() int64 {
+	return i.size
+}
+
+func (i fileInfo) Mode() fs.FileMode {
+	if i.dir {
+		return fs.ModeDir | 0555
+	}
+	return 0444
+}
+
+func (i fileInfo) ModTime() time.Time {
+	return time.Time{}
+}
+
+func (i fileInfo) IsDir() bool {
+	return i.dir
+}
+
+func (i fileInfo) Sys() interface{} {
+	return nil
+}
+
+// dirEntry lists a fileInfo in a directory.
+type dirEntry struct {
+	info fileInfo
+}
+
+func (e dirEntry) Name() string {
+	return e.info.name
+}
+
+func (e dirEntry) IsDir() bool {
+	return e.info.dir
+}
+
+func (e dirEntry) Type() fs.FileMode {
+	return e.info.Mode().Type()
+}
+
+func (e dirEntry) Info() (fs.FileInfo, error) {
+	return e.info, nil
+}
+
+type openFile struct {
+	info fileInfo
+	io.ReadSeeker
+	closer io.Closer
+}
+
+func (f *openFile) Stat() (fs.FileInfo, error) {
+	return f.info, nil
+}
+
+func (f *openFile) Close() error {
+	if f.closer == nil {
+		return nil
+	}
+	return f.closer.Close()
+}
+
+type openDir struct {
+	info    fileInfo
+	entries []fs.DirEntry
+	offset  int
+}
+
+func (d *openDir) Stat() (fs.FileInfo, error) {
+	return d.info, nil
+}
+
+func (d *openDir) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: d.info.name, Err: errors.New("is a directory")}
+}
+
+func (d *openDir) Close() error {
+	return nil
+}
+
+func (d *openDir) ReadDir(n int) ([]fs.DirEntry, error) {
+	remaining := d.entries[d.offset:]
+	if n <= 0 {
+		d.offset = len(d.entries)
+		return remaining, nil
+	}
+	if len(remaining) == 0 {
+		return nil, io.EOF
+	}
+	if n > len(remaining) {
+		n = len(remaining)
+	}
+	d.offset += n
+	return remaining[:n], nil
+}
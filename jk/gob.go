@@ -4,13 +4,16 @@ import (
 	"bufio"
 	"bytes"
 	"encoding/binary"
+	"fmt"
 	"io"
 	"os"
 	"strings"
+	"sync"
 	"unsafe"
 )
 
 type GOB struct {
+	Path   string
 	Header GOBHeader
 	Items  []GOBItem
 }
@@ -28,50 +31,111 @@ type GOBItem struct {
 	FileLength    uint32
 	FileName      string
 	UpperFileName string
+	rawFileName   [gobNameLength]byte
 }
 
 var (
+	// gobManifestCache is shared by every loader, so it is guarded by gobManifestMutex
 	gobManifestCache = make(map[string]GOB)
+	gobManifestMutex sync.Mutex
 )
 
-func loadGOBManifest(gobPath string) GOB {
-	if obj, ok := gobManifestCache[gobPath]; ok {
-		return obj
+// GOBError describes a GOB file that could not be read.
+type GOBError struct {
+	Path string
+	Err  error
+}
+
+func (e *GOBError) Error() string {
+	return fmt.Sprintf("%s: %v", e.Path, e.Err)
+}
+
+func (e *GOBError) Unwrap() error {
+	return e.Err
+}
+
+func loadGOBManifest(gobPath string) (GOB, error) {
+	gobManifestMutex.Lock()
+	obj, ok := gobManifestCache[gobPath]
+	gobManifestMutex.Unlock()
+	if ok {
+		return obj, nil
 	}
 
+	result, err := readGOBManifest(gobPath)
+	if err != nil {
+		return GOB{}, err
+	}
+	gobManifestMutex.Lock()
+	gobManifestCache[gobPath] = result
+	gobManifestMutex.Unlock()
+
+	return result, nil
+}
+
+// ReadGOB reads the header and directory of the GOB at gobPath.
+func ReadGOB(gobPath string) (GOB, error) {
+	return readGOBManifest(gobPath)
+}
+
+// Open opens an entry of the archive for reading.
+func (g GOB) Open(item GOBItem) (io.ReadCloser, error) {
+	file, err := os.Open(g.Path)
+	if err != nil {
+		return nil, &GOBError{Path: g.Path, Err: err}
+	}
+	return struct {
+		io.Reader
+		io.Closer
+	}{io.NewSectionReader(file, int64(item.FileOffset), int64(item.FileLength)), file}, nil
+}
+
+func readGOBManifest(gobPath string) (GOB, error) {
 	file, err := os.Open(gobPath)
 	if err != nil {
-		panic(err)
+		return GOB{}, &GOBError{Path: gobPath, Err: err}
 	}
 	defer file.Close()
 
-	result := GOB{}
+	result := GOB{Path: gobPath}
 
 	fr := bufio.NewReader(file)
 
 	var header GOBHeader
 	data := make([]byte, unsafe.Sizeof(header))
-	io.ReadFull(fr, data)
+	if _, err := io.ReadFull(fr, data); err != nil {
+		return GOB{}, &GOBError{Path: gobPath, Err: fmt.Errorf("reading header: %w", err)}
+	}
 	buf := bytes.NewBuffer(data)
 	binary.Read(buf, binary.LittleEndian, &header)
 
+	if string(header.FileType[:]) != "GOB" {
+		return GOB{}, &GOBError{Path: gobPath, Err: fmt.Errorf("not a GOB file")}
+	}
+	if header.NumItems < 0 {
+		return GOB{}, &GOBError{Path: gobPath, Err: fmt.Errorf("invalid item count %d", header.NumItems)}
+	}
+
 	result.Header = header
 
 	for i := int32(0); i < header.NumItems; i++ {
 		tempitem := struct {
 			FileOffset uint32
 			FileLength uint32
-			FileName   [128]byte
+			FileName   [gobNameLength]byte
 		}{}
 
 		data := make([]byte, unsafe.Sizeof(tempitem))
-		io.ReadFull(fr, data)
+		if _, err := io.ReadFull(fr, data); err != nil {
+			return GOB{}, &GOBError{Path: gobPath, Err: fmt.Errorf("reading item %d of %d: %w", i, header.NumItems, err)}
+		}
 		buf := bytes.NewBuffer(data)
 		binary.Read(buf, binary.LittleEndian, &tempitem)
 
 		var item GOBItem
 		item.FileOffset = tempitem.FileOffset
 		item.FileLength = tempitem.FileLength
+		item.rawFileName = tempitem.FileName
 
 		filenameBytes := bytes.Split(tempitem.FileName[:], []byte{byte('\x00')})[0]
 		item.FileName = string(filenameBytes)
@@ -80,31 +144,5 @@ func loadGOBManifest(gobPath string) GOB {
 		result.Items = append(result.Items, item)
 	}
 
-	gobManifestCache[gobPath] = result
-
-	return result
-}
-
-func loadFileFromGOB(gobPath string, fileName string) []byte {
-
-	gob := loadGOBManifest(gobPath)
-
-	file, err := os.Open(gobPath)
-	if err != nil {
-		panic(err)
-	}
-	defer file.Close()
-
-	fileName = strings.ToUpper(fileName)
-
-	for _, item := range gob.Items {
-		if strings.Contains(item.UpperFileName, fileName) {
-			file.Seek(int64(item.FileOffset), io.SeekStart)
-			contentBytes := make([]byte, item.FileLength)
-			file.Read(contentBytes)
-			return contentBytes
-		}
-	}
-
-	return nil
+	return result, nil
 }
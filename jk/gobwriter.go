@@ -0,0 +1,315 @@
+package jk
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const (
+	gobVersion         = 0x14
+	gobDirectoryOffset = 0x0c
+	gobHeaderSize      = 16
+	gobItemSize        = 136
+	gobNameLength      = 128
+)
+
+// GOBWriter builds a GOB 2.0 archive. Entries are written in the order they were
+// added, the directory comes right after the header, followed by the entry data.
+type GOBWriter struct {
+	entries []gobEntry
+	names   map[string]bool
+}
+
+type gobEntry struct {
+	name [gobNameLength]byte
+	size int64
+	open func() (io.ReadCloser, error)
+}
+
+func NewGOBWriter() *GOBWriter {
+	return &GOBWriter{names: make(map[string]bool)}
+}
+
+// Add adds an entry, name is the path inside the archive, e.g. mat\dflt.mat.
+func (w *GOBWriter) Add(name string, data []byte) error {
+	return w.AddReader(name, int64(len(data)), bytes.NewReader(data))
+}
+
+// AddReader adds an entry of size bytes read from data when the archive is written.
+func (w *GOBWriter) AddReader(name string, size int64, data io.Reader) error {
+	return w.add(name, size, func() (io.ReadCloser, error) {
+		return ioutil.NopCloser(data), nil
+	})
+}
+
+// AddFile adds the file at path, which is only opened when the archive is written.
+func (w *GOBWriter) AddFile(name string, path string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	return w.add(name, info.Size(), func() (io.ReadCloser, error) {
+		return os.Open(path)
+	})
+}
+
+func (w *GOBWriter) add(name string, size int64, open func() (io.ReadCloser, error)) error {
+	name = strings.Replace(name, "/", "\\", -1)
+	if name == "" || len(name) >= gobNameLength {
+		return fmt.Errorf("invalid GOB entry name %q", name)
+	}
+	if size < 0 || size > math.MaxUint32 {
+		return fmt.Errorf("%s: invalid size %d", name, size)
+	}
+
+	var rawName [gobNameLength]byte
+	copy(rawName[:], name)
+	return w.addRaw(rawName, size, open)
+}
+
+func (w *GOBWriter) addRaw(rawName [gobNameLength]byte, size int64, open func() (io.ReadCloser, error)) error {
+	name := strings.ToUpper(gobEntryName(rawName))
+	if w.names[name] {
+		return fmt.Errorf("duplicate GOB entry %s", gobEntryName(rawName))
+	}
+	w.names[name] = true
+	w.entries = append(w.entries, gobEntry{name: rawName, size: size, open: open})
+	return nil
+}
+
+// WriteTo writes the archive to out.
+func (w *GOBWriter) WriteTo(out io.Writer) (int64, error) {
+	offset := int64(gobHeaderSize + gobItemSize*len(w.entries))
+	for _, entry := range w.entries {
+		offset += entry.size
+	}
+	if offset > math.MaxUint32 {
+		return 0, fmt.Errorf("GOB archive too large, %d bytes", offset)
+	}
+
+	bw := bufio.NewWriter(out)
+	header := GOBHeader{
+		FileType:        [3]byte{'G', 'O', 'B'},
+		Version:         ' ',
+		FirstFileOffset: gobVersion,
+		NumItemsOffset:  gobDirectoryOffset,
+		NumItems:        int32(len(w.entries)),
+	}
+	if err := binary.Write(bw, binary.LittleEndian, header); err != nil {
+		return 0, err
+	}
+
+	offset = int64(gobHeaderSize + gobItemSize*len(w.entries))
+	for _, entry := range w.entries {
+		item := struct {
+			FileOffset uint32
+			FileLength uint32
+			FileName   [gobNameLength]byte
+		}{uint32(offset), uint32(entry.size), entry.name}
+		if err := binary.Write(bw, binary.LittleEndian, item); err != nil {
+			return 0, err
+		}
+		offset += entry.size
+	}
+
+	for _, entry := range w.entries {
+		if err := copyGOBEntry(bw, entry); err != nil {
+			return 0, err
+		}
+	}
+
+	return offset, bw.Flush()
+}
+
+func copyGOBEntry(out io.Writer, entry gobEntry) error {
+	data, err := entry.open()
+	if err != nil {
+		return err
+	}
+	defer data.Close()
+
+	n, err := io.CopyN(out, data, entry.size)
+	if err == io.EOF {
+		return fmt.Errorf("%s: got %d of %d bytes", gobEntryName(entry.name), n, entry.size)
+	}
+	return err
+}
+
+func gobEntryName(rawName [gobNameLength]byte) string {
+	return string(bytes.Split(rawName[:], []byte{0})[0])
+}
+
+// WriteGOB writes an archive with the given files, ordered by name.
+func WriteGOB(out io.Writer, files map[string][]byte) error {
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sortGOBNames(names)
+
+	w := NewGOBWriter()
+	for _, name := range names {
+		if err := w.Add(name, files[name]); err != nil {
+			return err
+		}
+	}
+	_, err := w.WriteTo(out)
+	return err
+}
+
+// WriteGOBDir writes an archive with every file below dir, ordered by name.
+// Entries are named by their path relative to dir. When out is a file in dir it
+// is left out of the archive.
+func WriteGOBDir(out io.Writer, dir string) error {
+	var outInfo os.FileInfo
+	if file, ok := out.(*os.File); ok {
+		outInfo, _ = file.Stat()
+	}
+
+	paths := make(map[string]string)
+	var names []string
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		if outInfo != nil && os.SameFile(info, outInfo) {
+			return nil
+		}
+		name, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		name = strings.Replace(filepath.ToSlash(name), "/", "\\", -1)
+		paths[name] = path
+		names = append(names, name)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	sortGOBNames(names)
+
+	w := NewGOBWriter()
+	for _, name := range names {
+		if err := w.AddFile(name, paths[name]); err != nil {
+			return err
+		}
+	}
+	_, err = w.WriteTo(out)
+	return err
+}
+
+func sortGOBNames(names []string) {
+	sort.Slice(names, func(i, j int) bool {
+		return strings.ToUpper(names[i]) < strings.ToUpper(names[j])
+	})
+}
+
+// GOBChanges are the edits made when repacking an archive. Put replaces the
+// entries with the same name, matched case-insensitively, and adds the others.
+type GOBChanges struct {
+	Put    map[string][]byte
+	Delete []string
+}
+
+// RepackGOB writes the archive at gobPath with changes applied to out. Replaced
+// entries keep their place, added entries follow the existing ones ordered by
+// name and unchanged entries are copied straight from the source archive.
+func RepackGOB(gobPath string, out io.Writer, changes GOBChanges) error {
+	gob, err := readGOBManifest(gobPath)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.Open(gobPath)
+	if err != nil {
+		return &GOBError{Path: gobPath, Err: err}
+	}
+	defer file.Close()
+
+	deletes := make(map[string]bool)
+	for _, name := range changes.Delete {
+		deletes[strings.ToUpper(strings.Replace(name, "/", "\\", -1))] = true
+	}
+	puts := make(map[string]string)
+	for name := range changes.Put {
+		puts[strings.ToUpper(strings.Replace(name, "/", "\\", -1))] = name
+	}
+
+	w := NewGOBWriter()
+	for _, item := range gob.Items {
+		item := item
+		if deletes[item.UpperFileName] {
+			delete(deletes, item.UpperFileName)
+			continue
+		}
+		if name, ok := puts[item.UpperFileName]; ok {
+			delete(puts, item.UpperFileName)
+			data := changes.Put[name]
+			err = w.addRaw(item.rawFileName, int64(len(data)), func() (io.ReadCloser, error) {
+				return ioutil.NopCloser(bytes.NewReader(data)), nil
+			})
+		} else {
+			err = w.addRaw(item.rawFileName, int64(item.FileLength), func() (io.ReadCloser, error) {
+				return ioutil.NopCloser(io.NewSectionReader(file, int64(item.FileOffset), int64(item.FileLength))), nil
+			})
+		}
+		if err != nil {
+			return &GOBError{Path: gobPath, Err: err}
+		}
+	}
+	for name := range deletes {
+		return &GOBError{Path: gobPath, Err: fmt.Errorf("no entry %s to delete", name)}
+	}
+
+	var added []string
+	for _, name := range puts {
+		added = append(added, name)
+	}
+	sortGOBNames(added)
+	for _, name := range added {
+		if err := w.Add(name, changes.Put[name]); err != nil {
+			return &GOBError{Path: gobPath, Err: err}
+		}
+	}
+
+	if _, err := w.WriteTo(out); err != nil {
+		return &GOBError{Path: gobPath, Err: err}
+	}
+	return nil
+}
+
+// RepackGOBFile applies changes to the archive at gobPath in place. The new
+// archive is written next to it and only replaces it once complete.
+func RepackGOBFile(gobPath string, changes GOBChanges) error {
+	temp, err := ioutil.TempFile(filepath.Dir(gobPath), filepath.Base(gobPath)+".*.tmp")
+	if err != nil {
+		return &GOBError{Path: gobPath, Err: err}
+	}
+	defer os.Remove(temp.Name())
+
+	err = RepackGOB(gobPath, temp, changes)
+	if closeErr := temp.Close(); err == nil && closeErr != nil {
+		err = &GOBError{Path: gobPath, Err: closeErr}
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := os.Rename(temp.Name(), gobPath); err != nil {
+		return &GOBError{Path: gobPath, Err: err}
+	}
+	gobManifestMutex.Lock()
+	delete(gobManifestCache, gobPath)
+	gobManifestMutex.Unlock()
+	return nil
+}
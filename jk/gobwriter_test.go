@@ -0,0 +1,167 @@
+package jk
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeTestGOB(t *testing.T, files map[string][]byte) string {
+	var archive bytes.Buffer
+	if err := WriteGOB(&archive, files); err != nil {
+		t.Fatal(err)
+	}
+	gobPath := filepath.Join(t.TempDir(), "test.gob")
+	if err := ioutil.WriteFile(gobPath, archive.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return gobPath
+}
+
+func TestRepackGOBRoundTrip(t *testing.T) {
+	files := map[string][]byte{
+		"b\\two.txt":        []byte("two"),
+		"a\\one.txt":        []byte("one"),
+		"c\\three.txt":      []byte("three"),
+		"3do\\mat\\x.mat":   bytes.Repeat([]byte{0xAB}, 1000),
+		"empty\\nothing.uk": {},
+	}
+	gobPath := writeTestGOB(t, files)
+	original, err := ioutil.ReadFile(gobPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var repacked bytes.Buffer
+	if err := RepackGOB(gobPath, &repacked, GOBChanges{}); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(original, repacked.Bytes()) {
+		t.Errorf("repacking without changes gave %d bytes that differ from the %d of the archive", repacked.Len(), len(original))
+	}
+
+	gob, err := ReadGOB(gobPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(gob.Items) != len(files) {
+		t.Fatalf("archive has %d entries, expected %d", len(gob.Items), len(files))
+	}
+	for _, item := range gob.Items {
+		reader, err := gob.Open(item)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := ioutil.ReadAll(reader)
+		reader.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(data, files[item.FileName]) {
+			t.Errorf("%s holds %d bytes, expected %d", item.FileName, len(data), len(files[item.FileName]))
+		}
+	}
+}
+
+func TestRepackGOBInstall(t *testing.T) {
+	dir := os.Getenv(InstallDirEnv)
+	if dir == "" {
+		t.Skipf("%s is not set", InstallDirEnv)
+	}
+	loader, err := NewLoader(Config{InstallDir: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer loader.Close()
+
+	gobFiles := append(append([]string{}, loader.ResourceGobFiles()...), loader.EpisodeGobFiles()...)
+	for _, gobPath := range gobFiles {
+		original, err := ioutil.ReadFile(gobPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var repacked bytes.Buffer
+		if err := RepackGOB(gobPath, &repacked, GOBChanges{}); err != nil {
+			t.Errorf("%s: %v", gobPath, err)
+			continue
+		}
+		if !bytes.Equal(original, repacked.Bytes()) {
+			t.Errorf("repacking %s without changes gave %d bytes that differ from the %d of the archive", gobPath, repacked.Len(), len(original))
+		}
+	}
+}
+
+func TestRepackGOBChanges(t *testing.T) {
+	gobPath := writeTestGOB(t, map[string][]byte{"b\\two.txt": []byte("two"), "a\\one.txt": []byte("one"), "c\\three.txt": []byte("three")})
+
+	changes := GOBChanges{
+		Put:    map[string][]byte{"A\\ONE.TXT": []byte("uno"), "d\\four.txt": []byte("four")},
+		Delete: []string{"b/two.txt"},
+	}
+	if err := RepackGOBFile(gobPath, changes); err != nil {
+		t.Fatal(err)
+	}
+
+	var want bytes.Buffer
+	if err := WriteGOB(&want, map[string][]byte{"a\\one.txt": []byte("uno"), "c\\three.txt": []byte("three"), "d\\four.txt": []byte("four")}); err != nil {
+		t.Fatal(err)
+	}
+	got, err := ioutil.ReadFile(gobPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want.Bytes()) {
+		t.Errorf("repacking with changes gave a different archive than writing the result")
+	}
+}
+
+func TestRepackGOBWhileLoading(t *testing.T) {
+	gobPath := writeTestGOB(t, map[string][]byte{"a\\one.txt": []byte("one")})
+
+	// with -race, loading the manifest while the archive is repacked must not race
+	done := make(chan error)
+	go func() {
+		for i := 0; i < 10; i++ {
+			if _, err := loadGOBManifest(gobPath); err != nil {
+				done <- err
+				return
+			}
+		}
+		done <- nil
+	}()
+	for i := 0; i < 10; i++ {
+		if err := RepackGOBFile(gobPath, GOBChanges{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestWriteGOBDirIntoDir(t *testing.T) {
+	dir := t.TempDir()
+	if err := ioutil.WriteFile(filepath.Join(dir, "one.txt"), []byte("one"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	gobPath := filepath.Join(dir, "packed.gob")
+	out, err := os.Create(gobPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = WriteGOBDir(out, dir)
+	out.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	gob, err := ReadGOB(gobPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(gob.Items) != 1 || gob.Items[0].FileName != "one.txt" {
+		t.Errorf("archive has entries %v, expected only one.txt", gob.Items)
+	}
+}
@@ -0,0 +1,230 @@
+package jk
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// resourceSearchDirs are the directories the engine looks in for each type of
+// file requested by name only, in search order.
+var resourceSearchDirs = map[string][]string{
+	"3do": {"3do"},
+	"mat": {"mat", "3do\\mat"},
+	"cmp": {"misc\\cmp"},
+	"key": {"3do\\key"},
+	"pup": {"misc\\pup"},
+	"snd": {"misc\\snd"},
+	"spr": {"misc\\spr"},
+	"par": {"misc\\par"},
+	"ai":  {"misc\\ai"},
+	"ai0": {"misc\\ai"},
+	"ai2": {"misc\\ai"},
+	"cog": {"cog"},
+	"wav": {"sound", "voice"},
+	"jkl": {"jkl"},
+	"bm":  {"ui\\bm"},
+	"sft": {"ui\\sft"},
+	"uni": {"misc"},
+	"dat": {"misc"},
+}
+
+// ResourceEntry is a file found by a ResourceIndex.
+type ResourceEntry struct {
+	Path    string // path inside the archive, or below the override directory
+	Archive string // GOB containing the file, or the override directory for loose files
+	Loose   bool
+	Size    int64
+	source  *resourceSource
+	offset  int64
+}
+
+type resourceSource struct {
+	path  string
+	file  *os.File
+	paths map[string]ResourceEntry
+}
+
+// ResourceIndex finds game files by path or by name the way the engine does:
+// a name without directory is looked up in the search directories of its type,
+// then anywhere. Loose files in the override directory come first, then the
+// episode GOBs and then the resource GOBs, each in the order given. Every layer
+// is searched completely before the next one.
+type ResourceIndex struct {
+	sources []*resourceSource
+	paths   map[string]ResourceEntry
+	names   map[string]ResourceEntry
+	order   []string
+}
+
+// NewResourceIndex indexes the files below overrideDir, which may be empty, and
+// the given GOBs. The GOBs are kept open until Close.
+func NewResourceIndex(overrideDir string, episodeGobs []string, resourceGobs []string) (*ResourceIndex, error) {
+	var layers []string
+	if overrideDir != "" {
+		layers = append(layers, overrideDir)
+	}
+	layers = append(layers, episodeGobs...)
+	layers = append(layers, resourceGobs...)
+	return newLayeredIndex(layers)
+}
+
+// newLayeredIndex indexes GOBs and loose directories, earlier layers taking
+// precedence over later ones.
+func newLayeredIndex(layers []string) (*ResourceIndex, error) {
+	idx := &ResourceIndex{paths: make(map[string]ResourceEntry), names: make(map[string]ResourceEntry)}
+
+	for _, layer := range layers {
+		info, err := os.Stat(layer)
+		if err == nil && info.IsDir() {
+			err = idx.addDir(layer)
+		} else if err == nil {
+			err = idx.addGOB(layer)
+		}
+		if err != nil {
+			idx.Close()
+			return nil, err
+		}
+	}
+
+	return idx, nil
+}
+
+func (idx *ResourceIndex) addDir(dir string) error {
+	source := &resourceSource{path: dir, paths: make(map[string]ResourceEntry)}
+	idx.sources = append(idx.sources, source)
+
+	return filepath.Walk(dir, func(filePath string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		name, err := filepath.Rel(dir, filePath)
+		if err != nil {
+			return err
+		}
+		idx.add(ResourceEntry{Path: filepath.ToSlash(name), Archive: dir, Loose: true, Size: info.Size(), source: source})
+		return nil
+	})
+}
+
+func (idx *ResourceIndex) addGOB(gobPath string) error {
+	gob, err := loadGOBManifest(gobPath)
+	if err != nil {
+		return err
+	}
+	file, err := os.Open(gobPath)
+	if err != nil {
+		return &GOBError{Path: gobPath, Err: err}
+	}
+
+	source := &resourceSource{path: gobPath, file: file, paths: make(map[string]ResourceEntry)}
+	idx.sources = append(idx.sources, source)
+	for _, item := range gob.Items {
+		idx.add(ResourceEntry{Path: item.FileName, Archive: gobPath, Size: int64(item.FileLength), source: source, offset: int64(item.FileOffset)})
+	}
+	return nil
+}
+
+// add keeps the first entry for each path and name, i.e. the one with the
+// highest precedence.
+func (idx *ResourceIndex) add(entry ResourceEntry) {
+	key := normalizeResourcePath(entry.Path)
+	if _, ok := entry.source.paths[key]; !ok {
+		entry.source.paths[key] = entry
+	}
+	if _, ok := idx.paths[key]; !ok {
+		idx.paths[key] = entry
+		idx.order = append(idx.order, key)
+	}
+	name := path.Base(strings.Replace(key, "\\", "/", -1))
+	if _, ok := idx.names[name]; !ok {
+		idx.names[name] = entry
+	}
+}
+
+// Lookup finds the file a name or path refers to.
+func (idx *ResourceIndex) Lookup(name string) (ResourceEntry, bool) {
+	keys := resourceKeys(name)
+	for _, source := range idx.sources {
+		for _, key := range keys {
+			if entry, ok := source.paths[key]; ok {
+				return entry, true
+			}
+		}
+	}
+	if strings.Contains(normalizeResourcePath(name), "\\") {
+		return ResourceEntry{}, false
+	}
+
+	entry, ok := idx.names[normalizeResourcePath(name)]
+	return entry, ok
+}
+
+// resourceKeys returns the normalized paths a name can refer to in search order:
+// the name itself, then for a name without directory the search directories of
+// its type.
+func resourceKeys(name string) []string {
+	key := normalizeResourcePath(name)
+	keys := []string{key}
+	if strings.Contains(key, "\\") {
+		return keys
+	}
+
+	ext := strings.TrimPrefix(path.Ext(key), ".")
+	for _, dir := range resourceSearchDirs[ext] {
+		keys = append(keys, dir+"\\"+key)
+	}
+	return keys
+}
+
+// Read returns the content of an entry.
+func (idx *ResourceIndex) Read(entry ResourceEntry) ([]byte, error) {
+	if entry.source == nil {
+		return nil, fmt.Errorf("%s: not an indexed file", entry.Path)
+	}
+	if entry.Loose {
+		return ioutil.ReadFile(filepath.Join(entry.Archive, filepath.FromSlash(entry.Path)))
+	}
+
+	contentBytes := make([]byte, entry.Size)
+	if _, err := entry.source.file.ReadAt(contentBytes, entry.offset); err != nil {
+		return nil, &GOBError{Path: entry.Archive, Err: fmt.Errorf("reading %s: %w", entry.Path, err)}
+	}
+	return contentBytes, nil
+}
+
+// Paths returns the path of every indexed file with the given extension, once
+// per path, in precedence order.
+func (idx *ResourceIndex) Paths(ext string) []string {
+	suffix := "." + strings.ToLower(ext)
+	var paths []string
+	for _, key := range idx.order {
+		if strings.HasSuffix(key, suffix) {
+			paths = append(paths, idx.paths[key].Path)
+		}
+	}
+	return paths
+}
+
+// Close closes the indexed GOBs.
+func (idx *ResourceIndex) Close() error {
+	var firstErr error
+	for _, source := range idx.sources {
+		if source.file == nil {
+			continue
+		}
+		if err := source.file.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// normalizeResourcePath lower cases a path and uses \ as separator like the GOBs do.
+func normalizeResourcePath(name string) string {
+	name = strings.ToLower(strings.Replace(name, "/", "\\", -1))
+	return strings.TrimLeft(name, "\\")
+}
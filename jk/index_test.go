@@ -0,0 +1,60 @@
+package jk
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestResourceIndexLayerOrder(t *testing.T) {
+	overrideDir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(overrideDir, "misc", "cmp"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(overrideDir, "misc", "cmp", "dflt.cmp"), []byte("override"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	episode := writeTestGOB(t, map[string][]byte{
+		"3do\\mat\\x.mat": []byte("episode"),
+		"misc\\dflt.cmp":  []byte("episode"),
+	})
+	resource := writeTestGOB(t, map[string][]byte{
+		"mat\\x.mat":          []byte("resource"),
+		"misc\\cmp\\y.cmp":    []byte("resource"),
+		"misc\\cmp\\dflt.cmp": []byte("resource"),
+	})
+
+	idx, err := NewResourceIndex(overrideDir, []string{episode}, []string{resource})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer idx.Close()
+
+	tests := map[string]string{
+		"x.mat":          "episode",  // a later search dir of the episode beats the first of the resources
+		"mat\\x.mat":     "resource", // paths only match themselves
+		"dflt.cmp":       "override",
+		"MISC/CMP/Y.CMP": "resource",
+		"misc\\dflt.cmp": "episode",
+	}
+	for name, want := range tests {
+		entry, ok := idx.Lookup(name)
+		if !ok {
+			t.Errorf("%s: not found", name)
+			continue
+		}
+		data, err := idx.Read(entry)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != want {
+			t.Errorf("%s: got the %s file %s, expected the %s one", name, data, entry.Path, want)
+		}
+	}
+
+	if _, ok := idx.Lookup("3do\\x.mat"); ok {
+		t.Errorf("3do\\x.mat: found a file that is not there")
+	}
+}
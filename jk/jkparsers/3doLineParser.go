@@ -6,6 +6,7 @@ import (
 	"github.com/go-gl/mathgl/mgl32"
 	"github.com/joelhays/go-jk/jk"
 	"github.com/joelhays/go-jk/jk/jktypes"
+	"io"
 	"io/ioutil"
 	"log"
 	"strconv"
@@ -13,64 +14,146 @@ import (
 )
 
 type Jk3doLineParser struct {
-	jk3do   jktypes.Jk3doFile
-	scanner *bufio.Scanner
-	line    string
-	done    bool
-	section string
+	parseContext
+	resolver jk.ResourceResolver
+	assets   *AssetLease
+	cache    *DiskCache
+	jk3do    jktypes.Jk3doFile
+	scanner  *bufio.Scanner
+	line     string
+	numLines int
+	done     bool
 }
 
-func NewJk3doLineParser() *Jk3doLineParser {
+func NewJk3doLineParser(resolver jk.ResourceResolver) *Jk3doLineParser {
 	return &Jk3doLineParser{
-		jk3do: jktypes.Jk3doFile{},
+		resolver: resolver,
+		jk3do:    jktypes.Jk3doFile{},
 	}
 }
 
-func (p *Jk3doLineParser) ParseFromFile(filePath string) jktypes.Jk3doFile {
+// SetAssets makes the parser share the colormaps and materials of lease instead
+// of parsing its own.
+func (p *Jk3doLineParser) SetAssets(lease *AssetLease) {
+	p.assets = lease
+}
+
+// SetDiskCache makes the parser keep the 3dos it parses in cache and load them
+// from it when their source did not change. The file name set with SetFileName
+// identifies the 3do in the cache.
+func (p *Jk3doLineParser) SetDiskCache(cache *DiskCache) {
+	p.cache = cache
+}
+
+func (p *Jk3doLineParser) ParseFromFile(filePath string) (jktypes.Jk3doFile, error) {
 	bytes, err := ioutil.ReadFile(filePath)
 	if err != nil {
-		log.Fatal(err)
+		return jktypes.Jk3doFile{}, err
 	}
 	data := string(bytes)
 
+	p.SetFileName(filePath)
 	return p.ParseFromString(data)
 }
 
-func (p *Jk3doLineParser) ParseFromString(objString string) jktypes.Jk3doFile {
+func (p *Jk3doLineParser) ParseFromString(objString string) (jktypes.Jk3doFile, error) {
 	p.jk3do = jktypes.Jk3doFile{}
 	p.scanner = bufio.NewScanner(strings.NewReader(objString))
 	p.line = ""
+	p.numLines = strings.Count(objString, "\n") + 1
 	p.done = false
+	p.reset()
 
-	p.getNextLine() // SECTION: HEADER
-	p.getNextLine() // 3DO 2.1
+	useCache := p.cache != nil && p.fileName != ""
+	if useCache && p.cache.load("3do", p.fileName, []byte(objString), &p.jk3do) {
+		if err := p.loadMaterials(); err != nil {
+			return jktypes.Jk3doFile{}, err
+		}
+	} else {
+		if err := p.parse(); err != nil {
+			return jktypes.Jk3doFile{}, err
+		}
+		if useCache {
+			cached := p.jk3do
+			cached.Materials = materialRefs(p.jk3do.Materials)
+			if err := p.cache.store("3do", p.fileName, []byte(objString), cached); err != nil {
+				log.Println(err)
+			}
+		}
+	}
 
-	p.getNextLine() // SECTION: MODELRESOURCE
-	p.getNextLine() // MATERIALS %d
-	p.parseMaterials()
+	cmp, err := p.loadColorMap("dflt.cmp")
+	if err != nil {
+		return jktypes.Jk3doFile{}, err
+	}
+	p.jk3do.ColorMap = cmp
 
-	p.getNextLine() // SECTION: GEOMETRYDEF
-	p.getNextLine() // RADIUS %f
-	p.getNextLine() // INSERT OFFSET %f %f %f
-	p.getNextLine() // GEOSETS %d
-	p.parseGeoSets()
+	return p.jk3do, nil
+}
 
-	p.getNextLine() // SECTION: HIERARCHYDEF
-	p.getNextLine() // HIERARCHY NODES %d
-	p.parseHierarchyNodes()
+func (p *Jk3doLineParser) loadColorMap(name string) (jktypes.ColorMap, error) {
+	if p.assets != nil {
+		return p.assets.ColorMap(name)
+	}
 
-	fileBytes := jk.GetLoader().LoadResource("dflt.cmp")
-	cmp := NewCmpParser().ParseFromBytes(fileBytes)
+	fileBytes := loadResource(p.resolver, name)
+	if fileBytes == nil {
+		return jktypes.ColorMap{}, nil
+	}
+	cmpParser := NewCmpParser()
+	cmpParser.SetFileName(name)
+	return cmpParser.ParseFromBytes(fileBytes)
+}
 
-	p.jk3do.ColorMap = cmp
+func (p *Jk3doLineParser) loadMaterial(name string) (jktypes.Material, error) {
+	if p.assets != nil {
+		return p.assets.Material(name)
+	}
 
-	return p.jk3do
+	var material jktypes.Material
+	fileBytes := loadResource(p.resolver, name)
+	if fileBytes != nil {
+		matParser := NewMatParser()
+		matParser.SetFileName(name)
+		var err error
+		material, err = matParser.ParseFromBytes(fileBytes)
+		if err != nil {
+			return jktypes.Material{}, err
+		}
+	}
+	material.Name = strings.ToLower(name)
+	material.XTile = 1.0
+	material.YTile = 1.0
+	return material, nil
 }
 
-func (p *Jk3doLineParser) checkError(err error) {
-	if err != nil {
-		log.Fatal(err)
+func (p *Jk3doLineParser) parse() error {
+	p.section = "header"
+	if err := p.skipLines(2); err != nil { // SECTION: HEADER, 3DO 2.1
+		return err
+	}
+
+	p.section = "modelresource"
+	if err := p.skipLines(1); err != nil { // SECTION: MODELRESOURCE
+		return err
+	}
+	if err := p.parseMaterials(); err != nil {
+		return err
 	}
+
+	p.section = "geometrydef"
+	if err := p.skipLines(3); err != nil { // SECTION: GEOMETRYDEF, RADIUS %f, INSERT OFFSET %f %f %f
+		return err
+	}
+	if err := p.parseGeoSets(); err != nil {
+		return err
+	}
+
+	p.section = "hierarchydef"
+	if err := p.skipLines(1); err != nil { // SECTION: HIERARCHYDEF
+		return err
+	}
+	return p.parseHierarchyNodes()
 }
 
 func (p *Jk3doLineParser) getNextLine() bool {
@@ -80,6 +163,7 @@ func (p *Jk3doLineParser) getNextLine() bool {
 			p.done = true
 			break
 		}
+		p.lineNum++
 		line := p.scanner.Text()
 		line = strings.TrimSpace(line)
 		line = strings.ToLower(line)
@@ -97,139 +181,229 @@ func (p *Jk3doLineParser) getNextLine() bool {
 	return false
 }
 
-func (p *Jk3doLineParser) parseMaterials() {
+func (p *Jk3doLineParser) nextLine() error {
+	if !p.getNextLine() {
+		return p.wrapError(io.ErrUnexpectedEOF)
+	}
+	return nil
+}
+
+func (p *Jk3doLineParser) skipLines(count int) error {
+	for i := 0; i < count; i++ {
+		if err := p.nextLine(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *Jk3doLineParser) expectLine(format string, a ...interface{}) error {
+	if err := p.nextLine(); err != nil {
+		return err
+	}
+	return p.scanLine(p.line, format, a...)
+}
+
+// expectCount reads a count line, which has to leave at least a line for every
+// item it counts.
+func (p *Jk3doLineParser) expectCount(format string, count *int) error {
+	if err := p.expectLine(format, count); err != nil {
+		return err
+	}
+	if *count < 0 || *count > p.numLines-p.lineNum {
+		return p.errorf("%w: invalid count %d, %d lines left", ErrMalformed, *count, p.numLines-p.lineNum)
+	}
+	return nil
+}
+
+func (p *Jk3doLineParser) parseMaterials() error {
 	var count int
-	_, err := fmt.Sscanf(p.line, "materials %d", &count)
-	p.checkError(err)
+	if err := p.expectCount("materials %d", &count); err != nil {
+		return err
+	}
 
 	p.jk3do.Materials = make([]jktypes.Material, count)
 
 	for i := 0; i < count; i++ {
-		p.getNextLine()
-
 		var id int32
 		var matName string
-		_, err := fmt.Sscanf(p.line, "%d:%s", &id, &matName)
-		p.checkError(err)
-
-		var material jktypes.Material
-		fileBytes := jk.GetLoader().LoadResource(matName)
-		if fileBytes != nil {
-			material = NewMatParser().ParseFromBytes(fileBytes)
+		if err := p.expectLine("%d:%s", &id, &matName); err != nil {
+			return err
 		}
-		material.XTile = 1.0
-		material.YTile = 1.0
 
+		p.jk3do.Materials[i] = jktypes.Material{Name: matName}
+	}
+
+	return p.loadMaterials()
+}
+
+func (p *Jk3doLineParser) loadMaterials() error {
+	for i, ref := range p.jk3do.Materials {
+		material, err := p.loadMaterial(ref.Name)
+		if err != nil {
+			return err
+		}
 		p.jk3do.Materials[i] = material
 	}
+	return nil
 }
 
-func (p *Jk3doLineParser) parseGeoSets() {
+func (p *Jk3doLineParser) parseGeoSets() error {
 	var count int
-	_, err := fmt.Sscanf(p.line, "geosets %d", &count)
-	p.checkError(err)
+	if err := p.expectCount("geosets %d", &count); err != nil {
+		return err
+	}
 
 	p.jk3do.GeoSets = make([]jktypes.GeoSet, count)
 
 	for i := 0; i < count; i++ {
 		geoset := &p.jk3do.GeoSets[i]
 
-		p.getNextLine() // GEOSET %d
-		p.getNextLine() // MESHES %d
-		p.parseMeshes(geoset)
+		if err := p.skipLines(1); err != nil { // GEOSET %d
+			return err
+		}
+		if err := p.parseMeshes(geoset); err != nil {
+			return err
+		}
 	}
+
+	return nil
 }
 
-func (p *Jk3doLineParser) parseMeshes(geoset *jktypes.GeoSet) {
+func (p *Jk3doLineParser) parseMeshes(geoset *jktypes.GeoSet) error {
 	var count int
-	_, err := fmt.Sscanf(p.line, "meshes %d", &count)
-	p.checkError(err)
+	if err := p.expectCount("meshes %d", &count); err != nil {
+		return err
+	}
 
 	geoset.Meshes = make([]jktypes.Mesh, count)
 
 	for i := 0; i < count; i++ {
 		mesh := &geoset.Meshes[i]
 
-		p.getNextLine() // MESH %d
-		p.getNextLine() // NAME %s
-		p.getNextLine() // RADIUS %f
-		p.getNextLine() // GEOMETRYMODE %d
-		p.getNextLine() // LIGHTINGMODE %d
-		p.getNextLine() // TEXTUREMODE %d
-		p.getNextLine() // VERTICES %d
-		p.parseVertices(mesh)
+		// MESH %d, NAME %s, RADIUS %f, GEOMETRYMODE %d, LIGHTINGMODE %d, TEXTUREMODE %d
+		if err := p.skipLines(6); err != nil {
+			return err
+		}
 
-		p.getNextLine() // TEXTURE VERTICES %d
-		p.parseTextureVertices(mesh)
+		if err := p.parseVertices(mesh); err != nil {
+			return err
+		}
+		if err := p.parseTextureVertices(mesh); err != nil {
+			return err
+		}
 
-		p.getNextLine() // VERTEX NORMALS
-		p.parseVertexNormals(mesh)
+		if err := p.skipLines(1); err != nil { // VERTEX NORMALS
+			return err
+		}
+		if err := p.parseVertexNormals(mesh); err != nil {
+			return err
+		}
 
-		p.getNextLine() // FACES %d
-		p.parseFaces(mesh)
+		if err := p.parseFaces(mesh); err != nil {
+			return err
+		}
 
-		p.getNextLine() // FACE NORMALS
-		p.parseFaceNormals(mesh)
+		if err := p.skipLines(1); err != nil { // FACE NORMALS
+			return err
+		}
+		if err := p.parseFaceNormals(mesh); err != nil {
+			return err
+		}
 	}
+
+	return nil
 }
 
-func (p *Jk3doLineParser) parseVertices(mesh *jktypes.Mesh) {
+func (p *Jk3doLineParser) parseVertices(mesh *jktypes.Mesh) error {
 	var count int
-	_, err := fmt.Sscanf(p.line, "vertices %d", &count)
-	p.checkError(err)
+	if err := p.expectCount("vertices %d", &count); err != nil {
+		return err
+	}
 
 	mesh.Vertices = make([]mgl32.Vec3, count)
 
 	for i := 0; i < count; i++ {
-		p.getNextLine()
+		if err := p.nextLine(); err != nil {
+			return err
+		}
 
-		_, v := parseVec3(p.line)
+		_, v, err := parseVec3(p.line)
+		if err != nil {
+			return p.wrapError(err)
+		}
 		mesh.Vertices[i] = v
 	}
+
+	return nil
 }
 
-func (p *Jk3doLineParser) parseTextureVertices(mesh *jktypes.Mesh) {
+func (p *Jk3doLineParser) parseTextureVertices(mesh *jktypes.Mesh) error {
 	var count int
-	_, err := fmt.Sscanf(p.line, "texture vertices %d", &count)
-	p.checkError(err)
+	if err := p.expectCount("texture vertices %d", &count); err != nil {
+		return err
+	}
 
 	mesh.TextureVertices = make([]mgl32.Vec2, count)
 
 	for i := 0; i < count; i++ {
-		p.getNextLine()
+		if err := p.nextLine(); err != nil {
+			return err
+		}
 
-		_, v := parseVec2(p.line)
+		_, v, err := parseVec2(p.line)
+		if err != nil {
+			return p.wrapError(err)
+		}
 		mesh.TextureVertices[i] = v
 	}
+
+	return nil
 }
 
-func (p *Jk3doLineParser) parseVertexNormals(mesh *jktypes.Mesh) {
+func (p *Jk3doLineParser) parseVertexNormals(mesh *jktypes.Mesh) error {
 	numVerts := len(mesh.Vertices)
 	mesh.VertexNormals = make([]mgl32.Vec3, numVerts)
 
 	for i := 0; i < numVerts; i++ {
-		p.getNextLine()
+		if err := p.nextLine(); err != nil {
+			return err
+		}
 
-		_, v := parseVec3(p.line)
+		_, v, err := parseVec3(p.line)
+		if err != nil {
+			return p.wrapError(err)
+		}
 		mesh.VertexNormals[i] = v
 	}
+
+	return nil
 }
 
-func (p *Jk3doLineParser) parseFaces(mesh *jktypes.Mesh) {
+func (p *Jk3doLineParser) parseFaces(mesh *jktypes.Mesh) error {
 	var count int
-	_, err := fmt.Sscanf(p.line, "faces %d", &count)
-	p.checkError(err)
+	if err := p.expectCount("faces %d", &count); err != nil {
+		return err
+	}
 
 	mesh.Faces = make([]jktypes.Face, count)
 
 	for i := 0; i < count; i++ {
-		p.getNextLine()
+		if err := p.nextLine(); err != nil {
+			return err
+		}
 
 		args := strings.Fields(strings.Replace(p.line, ",", " ", -1))
+		if err := requireArgs(args, 8); err != nil {
+			return p.wrapError(err)
+		}
 
 		surface := jktypes.Face{}
 
 		materialID, _ := strconv.ParseInt(args[1], 10, 32)
+		if materialID < -1 || materialID >= int64(len(p.jk3do.Materials)) {
+			return p.errorf("%w: material %d out of range", ErrMalformed, materialID)
+		}
 		surface.MaterialID = materialID
 
 		geoFlag, _ := strconv.ParseInt(args[3], 10, 32)
@@ -241,10 +415,16 @@ func (p *Jk3doLineParser) parseFaces(mesh *jktypes.Mesh) {
 		//}
 
 		numVertexIds, _ := strconv.ParseInt(args[7], 10, 32)
+		if err := requireArgs(args, 8+int(numVertexIds)*2); err != nil || numVertexIds < 0 {
+			return p.malformed(fmt.Sprintf("%d vertex pairs", numVertexIds), p.line)
+		}
 		vertexIds := args[8 : 8+(numVertexIds*2)]
 		for v := 0; v < int(numVertexIds*2); v += 2 {
 			vertexID, _ := strconv.ParseInt(strings.TrimRight(vertexIds[v], ","), 10, 32)
 			texVertexID, _ := strconv.ParseInt(vertexIds[v+1], 10, 32)
+			if vertexID < 0 || vertexID >= int64(len(mesh.Vertices)) {
+				return p.errorf("%w: vertex %d out of range", ErrMalformed, vertexID)
+			}
 			surface.VertexIds = append(surface.VertexIds, vertexID)
 			surface.TextureVertexIds = append(surface.TextureVertexIds, texVertexID)
 
@@ -254,38 +434,59 @@ func (p *Jk3doLineParser) parseFaces(mesh *jktypes.Mesh) {
 
 		mesh.Faces[i] = surface
 	}
+
+	return nil
 }
 
-func (p *Jk3doLineParser) parseFaceNormals(mesh *jktypes.Mesh) {
+func (p *Jk3doLineParser) parseFaceNormals(mesh *jktypes.Mesh) error {
 	numFaces := len(mesh.Faces)
 	mesh.FaceNormals = make([]mgl32.Vec3, numFaces)
 
 	for i := 0; i < numFaces; i++ {
-		p.getNextLine()
+		if err := p.nextLine(); err != nil {
+			return err
+		}
 
-		_, v := parseVec3(p.line)
+		_, v, err := parseVec3(p.line)
+		if err != nil {
+			return p.wrapError(err)
+		}
 		mesh.FaceNormals[i] = v
 	}
+
+	return nil
 }
 
-func (p *Jk3doLineParser) parseHierarchyNodes() {
+func (p *Jk3doLineParser) parseHierarchyNodes() error {
 	var count int
-	_, err := fmt.Sscanf(p.line, "hierarchy nodes %d", &count)
-	p.checkError(err)
+	if err := p.expectCount("hierarchy nodes %d", &count); err != nil {
+		return err
+	}
 
 	p.jk3do.Hierarchy = make([]jktypes.HierarchyDef, count)
 
 	for i := 0; i < count; i++ {
-		p.getNextLine()
+		if err := p.nextLine(); err != nil {
+			return err
+		}
 
 		args := strings.Fields(p.line)
+		if err := requireArgs(args, 18); err != nil {
+			return p.wrapError(err)
+		}
 
+		flags, _ := strconv.ParseInt(args[1], 0, 64)
+		nodeType, _ := strconv.ParseInt(args[2], 0, 64)
 		meshID, _ := strconv.ParseInt(args[3], 10, 32)
 		parentID, _ := strconv.ParseInt(args[4], 10, 32)
 		childID, _ := strconv.ParseInt(args[5], 10, 32)
 		siblingID, _ := strconv.ParseInt(args[6], 10, 32)
 		numChildren, _ := strconv.ParseInt(args[7], 10, 32)
 
+		if parentID < -1 || parentID >= int64(count) {
+			return p.errorf("%w: parent node %d out of range", ErrMalformed, parentID)
+		}
+
 		x, _ := strconv.ParseFloat(args[8], 32)
 		y, _ := strconv.ParseFloat(args[9], 32)
 		z, _ := strconv.ParseFloat(args[10], 32)
@@ -301,6 +502,8 @@ func (p *Jk3doLineParser) parseHierarchyNodes() {
 		nodeName := args[17]
 
 		def := jktypes.HierarchyDef{
+			Flags:       flags,
+			Type:        nodeType,
 			MeshID:      meshID,
 			ParentID:    parentID,
 			ChildID:     childID,
@@ -316,4 +519,6 @@ func (p *Jk3doLineParser) parseHierarchyNodes() {
 
 		p.jk3do.Hierarchy[i] = def
 	}
+
+	return nil
 }
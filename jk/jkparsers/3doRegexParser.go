@@ -2,10 +2,10 @@ package jkparsers
 
 import (
 	"bufio"
+	"fmt"
 	"github.com/joelhays/go-jk/jk"
 	"github.com/joelhays/go-jk/jk/jktypes"
 	"io/ioutil"
-	"log"
 	"regexp"
 	"strconv"
 	"strings"
@@ -15,27 +15,34 @@ import (
 )
 
 type Jk3doRegexParser struct {
+	parseContext
+	resolver jk.ResourceResolver
 }
 
-func NewJk3doRegexParser() *Jk3doRegexParser {
-	return &Jk3doRegexParser{}
+func NewJk3doRegexParser(resolver jk.ResourceResolver) *Jk3doRegexParser {
+	return &Jk3doRegexParser{resolver: resolver}
 }
 
-func (p *Jk3doRegexParser) Parse3doFromFile(filePath string) jktypes.Jk3doFile {
+func (p *Jk3doRegexParser) Parse3doFromFile(filePath string) (jktypes.Jk3doFile, error) {
 	bytes, err := ioutil.ReadFile(filePath)
 	if err != nil {
-		log.Fatal(err)
+		return jktypes.Jk3doFile{}, err
 	}
 	data := string(bytes)
 
+	p.SetFileName(filePath)
 	return p.Parse3doFromString(data)
 }
 
-func (p *Jk3doRegexParser) Parse3doFromString(data string) jktypes.Jk3doFile {
+func (p *Jk3doRegexParser) Parse3doFromString(data string) (jktypes.Jk3doFile, error) {
 	result := jktypes.Jk3doFile{}
 
-	p.parse3doFileMaterials(data, &result)
-	p.parse3doFileHierarchy(data, &result)
+	if err := p.parse3doFileMaterials(data, &result); err != nil {
+		return jktypes.Jk3doFile{}, err
+	}
+	if err := p.parse3doFileHierarchy(data, &result); err != nil {
+		return jktypes.Jk3doFile{}, err
+	}
 
 	geosetRegex := regexp.MustCompile(`(?s)GEOSET\s\d`)
 	geosetMatches := geosetRegex.Split(data, -1)[1:]
@@ -53,6 +60,8 @@ func (p *Jk3doRegexParser) Parse3doFromString(data string) jktypes.Jk3doFile {
 		var meshwg sync.WaitGroup
 		meshwg.Add(len(meshMatches))
 
+		meshErrors := make([]error, len(meshMatches))
+
 		for i := 0; i < len(meshMatches); i++ {
 			go func(idx int) {
 				defer meshwg.Done()
@@ -61,50 +70,86 @@ func (p *Jk3doRegexParser) Parse3doFromString(data string) jktypes.Jk3doFile {
 
 				mesh := &geoset.Meshes[idx]
 
-				p.parse3doFileVertices(meshData, mesh)
-				p.parse3doFileTextureVertices(meshData, mesh)
+				if err := p.parse3doFileVertices(meshData, mesh); err != nil {
+					meshErrors[idx] = err
+					return
+				}
+				if err := p.parse3doFileTextureVertices(meshData, mesh); err != nil {
+					meshErrors[idx] = err
+					return
+				}
 				//TODO: PARSE VERTEX NORMALS
-				p.parse3doFileSurfaces(meshData, mesh)
+				meshErrors[idx] = p.parse3doFileSurfaces(meshData, mesh)
 			}(i)
 		}
 
 		meshwg.Wait()
+
+		for _, err := range meshErrors {
+			if err != nil {
+				return jktypes.Jk3doFile{}, err
+			}
+		}
 	}
 
-	fileBytes := jk.GetLoader().LoadResource("dflt.cmp")
-	cmp := NewCmpParser().ParseFromBytes(fileBytes)
-	result.ColorMap = cmp
+	fileBytes := loadResource(p.resolver, "dflt.cmp")
+	if fileBytes != nil {
+		cmpParser := NewCmpParser()
+		cmpParser.SetFileName("dflt.cmp")
+		cmp, err := cmpParser.ParseFromBytes(fileBytes)
+		if err != nil {
+			return jktypes.Jk3doFile{}, err
+		}
+		result.ColorMap = cmp
+	}
 
-	return result
+	return result, nil
 }
 
-func (p *Jk3doRegexParser) parse3doFileMaterials(data string, obj *jktypes.Jk3doFile) {
-	p.parse3doFileSection(data, `(?s)MATERIALS.*?SECTION: GEOMETRYDEF`, "\\d+:.*",
-		func(components []string) {
+func (p *Jk3doRegexParser) parse3doFileMaterials(data string, obj *jktypes.Jk3doFile) error {
+	return p.parse3doFileSection(data, `(?s)MATERIALS.*?SECTION: GEOMETRYDEF`, "\\d+:.*",
+		func(components []string) error {
+			if err := requireArgs(components, 2); err != nil {
+				return err
+			}
+
 			matName := components[1]
 
 			var material jktypes.Material
-			fileBytes := jk.GetLoader().LoadResource(matName)
+			fileBytes := loadResource(p.resolver, matName)
 			if fileBytes != nil {
-				material = NewMatParser().ParseFromBytes(fileBytes)
+				matParser := NewMatParser()
+				matParser.SetFileName(matName)
+				var err error
+				material, err = matParser.ParseFromBytes(fileBytes)
+				if err != nil {
+					return err
+				}
 			}
 
+			material.Name = strings.ToLower(matName)
 			material.XTile = 1.0
 			material.YTile = 1.0
 
 			obj.Materials = append(obj.Materials, material)
+			return nil
 		})
 }
 
-func (p *Jk3doRegexParser) parse3doFileHierarchy(data string, obj *jktypes.Jk3doFile) {
-	p.parse3doFileSection(data, `(?s)SECTION: HIERARCHYDEF.*`, "\\d+:.*",
-		func(components []string) {
+func (p *Jk3doRegexParser) parse3doFileHierarchy(data string, obj *jktypes.Jk3doFile) error {
+	return p.parse3doFileSection(data, `(?s)SECTION: HIERARCHYDEF.*`, "\\d+:.*",
+		func(components []string) error {
+			if err := requireArgs(components, 18); err != nil {
+				return err
+			}
 
 			// id, _ := strconv.ParseInt(strings.TrimRight(components[0], ":"), 10, 32)
 			// if id == 0 {
 			// 	return
 			// }
 
+			flags, _ := strconv.ParseInt(components[1], 0, 64)
+			nodeType, _ := strconv.ParseInt(components[2], 0, 64)
 			meshID, _ := strconv.ParseInt(components[3], 10, 32)
 			parentID, _ := strconv.ParseInt(components[4], 10, 32)
 			childID, _ := strconv.ParseInt(components[5], 10, 32)
@@ -126,6 +171,8 @@ func (p *Jk3doRegexParser) parse3doFileHierarchy(data string, obj *jktypes.Jk3do
 			nodeName := components[17]
 
 			def := jktypes.HierarchyDef{
+				Flags:       flags,
+				Type:        nodeType,
 				MeshID:      meshID,
 				ParentID:    parentID,
 				ChildID:     childID,
@@ -140,20 +187,27 @@ func (p *Jk3doRegexParser) parse3doFileHierarchy(data string, obj *jktypes.Jk3do
 			}
 
 			obj.Hierarchy = append(obj.Hierarchy, def)
+			return nil
 		})
 }
 
-func (p *Jk3doRegexParser) parse3doFileSection(data string, regex string, componentRegex string, callback func(components []string)) {
+// parse3doFileSection is called concurrently for each mesh, so errors are
+// built here instead of through the shared parse context.
+func (p *Jk3doRegexParser) parse3doFileSection(data string, regex string, componentRegex string, callback func(components []string) error) error {
 	sectionRegex := regexp.MustCompile(regex)
 	sectionMatch := sectionRegex.FindAllString(data, -1)
 
 	if len(sectionMatch) == 0 {
-		callback([]string{})
-		return
+		if err := callback([]string{}); err != nil {
+			return &ParseError{File: p.fileName, Section: regex, Err: err}
+		}
+		return nil
 	}
 
+	lineNum := 0
 	scanner := bufio.NewScanner(strings.NewReader(sectionMatch[0]))
 	for scanner.Scan() {
+		lineNum++
 		match, _ := regexp.MatchString(componentRegex, scanner.Text())
 		if match != true {
 			continue
@@ -172,53 +226,67 @@ func (p *Jk3doRegexParser) parse3doFileSection(data string, regex string, compon
 			continue
 		}
 
-		callback(components)
+		if err := callback(components); err != nil {
+			return &ParseError{File: p.fileName, Line: lineNum, Section: regex, Err: err}
+		}
 	}
+
+	return nil
 }
 
-func (p *Jk3doRegexParser) parse3doFileVertices(data string, obj *jktypes.Mesh) {
-	p.parse3doFileSection(data, `(?s)VERTICES.*?TEXTURE VERTICES`, "\\d+:.*",
-		func(components []string) {
-			var err error
+func (p *Jk3doRegexParser) parse3doFileVertices(data string, obj *jktypes.Mesh) error {
+	return p.parse3doFileSection(data, `(?s)VERTICES.*?TEXTURE VERTICES`, "\\d+:.*",
+		func(components []string) error {
+			if err := requireArgs(components, 4); err != nil {
+				return err
+			}
 
 			x, err := strconv.ParseFloat(components[1], 32)
 			if err != nil {
-				log.Fatal(err)
+				return err
 			}
 			y, err := strconv.ParseFloat(components[2], 32)
 			if err != nil {
-				log.Fatal(err)
+				return err
 			}
 			z, err := strconv.ParseFloat(components[3], 32)
 			if err != nil {
-				log.Fatal(err)
+				return err
 			}
 
 			obj.Vertices = append(obj.Vertices, mgl32.Vec3{float32(x), float32(y), float32(z)})
+			return nil
 		})
 }
 
-func (p *Jk3doRegexParser) parse3doFileTextureVertices(data string, obj *jktypes.Mesh) {
-	p.parse3doFileSection(data, `(?s)TEXTURE VERTICES.*?VERTEX NORMALS`, "\\d+:.*",
-		func(components []string) {
-			var err error
+func (p *Jk3doRegexParser) parse3doFileTextureVertices(data string, obj *jktypes.Mesh) error {
+	return p.parse3doFileSection(data, `(?s)TEXTURE VERTICES.*?VERTEX NORMALS`, "\\d+:.*",
+		func(components []string) error {
+			if err := requireArgs(components, 3); err != nil {
+				return err
+			}
 
 			u, err := strconv.ParseFloat(components[1], 32)
 			if err != nil {
-				log.Fatal(err)
+				return err
 			}
 			v, err := strconv.ParseFloat(components[2], 32)
 			if err != nil {
-				log.Fatal(err)
+				return err
 			}
 
 			obj.TextureVertices = append(obj.TextureVertices, mgl32.Vec2{float32(u), float32(v)})
+			return nil
 		})
 }
 
-func (p *Jk3doRegexParser) parse3doFileSurfaces(data string, obj *jktypes.Mesh) {
-	p.parse3doFileSection(data, `(?s)FACES.*?FACE NORMALS`, "\\d+:.*",
-		func(components []string) {
+func (p *Jk3doRegexParser) parse3doFileSurfaces(data string, obj *jktypes.Mesh) error {
+	err := p.parse3doFileSection(data, `(?s)FACES.*?FACE NORMALS`, "\\d+:.*",
+		func(components []string) error {
+			if err := requireArgs(components, 8); err != nil {
+				return err
+			}
+
 			surface := jktypes.Face{}
 
 			materialID, _ := strconv.ParseInt(components[1], 10, 32)
@@ -233,6 +301,9 @@ func (p *Jk3doRegexParser) parse3doFileSurfaces(data string, obj *jktypes.Mesh)
 			//}
 
 			numVertexIds, _ := strconv.ParseInt(components[7], 10, 32)
+			if err := requireArgs(components, 8+int(numVertexIds)*2); err != nil || numVertexIds < 0 {
+				return fmt.Errorf("%w: expected %d vertex pairs", ErrMalformed, numVertexIds)
+			}
 			vertexIds := components[8 : 8+(numVertexIds*2)]
 			for i := 0; i < int(numVertexIds*2); i += 2 {
 				vertexID, _ := strconv.ParseInt(strings.TrimRight(vertexIds[i], ","), 10, 32)
@@ -244,21 +315,32 @@ func (p *Jk3doRegexParser) parse3doFileSurfaces(data string, obj *jktypes.Mesh)
 				surface.LightIntensities = append(surface.LightIntensities, lightIntensity)
 			}
 			obj.Faces = append(obj.Faces, surface)
+			return nil
 		})
+	if err != nil {
+		return err
+	}
 
 	obj.FaceNormals = make([]mgl32.Vec3, len(obj.Faces))
 
-	p.parse3doFileSection(data, `(?s)FACE NORMALS.*?(SECTION: HIERARCHYDEF|Mesh definition|Geometry Set definition)`, "\\d+:.*",
-		func(components []string) {
+	return p.parse3doFileSection(data, `(?s)FACE NORMALS.*?(SECTION: HIERARCHYDEF|Mesh definition|Geometry Set definition)`, "\\d+:.*",
+		func(components []string) error {
 			if len(obj.Faces) == 0 {
-				return
+				return nil
+			}
+			if err := requireArgs(components, 4); err != nil {
+				return err
 			}
 			surfaceID, _ := strconv.ParseInt(strings.TrimRight(components[0], ":"), 10, 32)
+			if surfaceID < 0 || surfaceID >= int64(len(obj.FaceNormals)) {
+				return fmt.Errorf("%w: face normal %d out of range", ErrMalformed, surfaceID)
+			}
 
 			x, _ := strconv.ParseFloat(components[1], 32)
 			y, _ := strconv.ParseFloat(components[2], 32)
 			z, _ := strconv.ParseFloat(components[3], 32)
 
 			obj.FaceNormals[surfaceID] = mgl32.Vec3{float32(x), float32(y), float32(z)}
+			return nil
 		})
 }
@@ -0,0 +1,337 @@
+package jkparsers
+
+import (
+	"fmt"
+	"github.com/joelhays/go-jk/jk"
+	"github.com/joelhays/go-jk/jk/jktypes"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const defaultRetainedAssets = 512
+
+type assetKind int
+
+const (
+	assetColorMap assetKind = iota
+	assetMaterial
+	assetModel
+)
+
+type assetKey struct {
+	kind     assetKind
+	name     string
+	colorMap string
+}
+
+type assetEntry struct {
+	refs     int
+	ready    chan struct{}
+	value    interface{}
+	err      error
+	deps     *AssetLease
+	lastUsed uint64
+}
+
+// AssetCache shares decoded colormaps, materials and models between the levels
+// and models loaded from the same resources. Assets stay in the cache while a
+// lease holds them, the assets no lease holds are kept for reuse up to a limit,
+// dropping the least recently used first. It is safe for concurrent use.
+type AssetCache struct {
+	resolver jk.ResourceResolver
+	disk     *DiskCache
+	workers  chan struct{}
+	mutex    sync.Mutex
+	entries  map[assetKey]*assetEntry
+	retain   int
+	clock    uint64
+}
+
+// NewAssetCache creates a cache loading from resolver with at most workers loads
+// running in parallel, or one per CPU when workers is 0.
+func NewAssetCache(resolver jk.ResourceResolver, workers int) *AssetCache {
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+	return &AssetCache{
+		resolver: resolver,
+		workers:  make(chan struct{}, workers),
+		entries:  make(map[assetKey]*assetEntry),
+		retain:   defaultRetainedAssets,
+	}
+}
+
+// SetDiskCache makes the cache load the models it parses from disk when their
+// source did not change.
+func (c *AssetCache) SetDiskCache(disk *DiskCache) {
+	c.disk = disk
+}
+
+// SetRetain sets how many assets no lease holds are kept for reuse.
+func (c *AssetCache) SetRetain(retain int) {
+	c.mutex.Lock()
+	c.retain = retain
+	evicted := c.trim()
+	c.mutex.Unlock()
+
+	for _, entry := range evicted {
+		entry.deps.Release()
+	}
+}
+
+// Len returns the number of cached assets.
+func (c *AssetCache) Len() int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return len(c.entries)
+}
+
+func (c *AssetCache) NewLease() *AssetLease {
+	return &AssetLease{cache: c}
+}
+
+// acquire returns the asset for key, loading it on the first request. Requests
+// for an asset being loaded wait for it. An asset that failed to load is dropped
+// once the waiting requests got the error, so the next request loads it again.
+func (c *AssetCache) acquire(key assetKey, load func(deps *AssetLease) (interface{}, error)) (interface{}, bool, error) {
+	c.mutex.Lock()
+	entry, cached := c.entries[key]
+	if !cached {
+		entry = &assetEntry{ready: make(chan struct{}), deps: c.NewLease()}
+		c.entries[key] = entry
+	}
+	entry.refs++
+	c.mutex.Unlock()
+
+	if cached {
+		<-entry.ready
+	} else {
+		entry.value, entry.err = load(entry.deps)
+		close(entry.ready)
+		if entry.err != nil {
+			c.mutex.Lock()
+			if c.entries[key] == entry {
+				delete(c.entries, key)
+			}
+			c.mutex.Unlock()
+			entry.deps.Release()
+		}
+	}
+	return entry.value, cached, entry.err
+}
+
+func (c *AssetCache) release(key assetKey) {
+	c.mutex.Lock()
+	entry, ok := c.entries[key]
+	if !ok || entry.refs == 0 {
+		c.mutex.Unlock()
+		return
+	}
+	entry.refs--
+	var evicted []*assetEntry
+	if entry.refs == 0 {
+		c.clock++
+		entry.lastUsed = c.clock
+		evicted = c.trim()
+	}
+	c.mutex.Unlock()
+
+	for _, entry := range evicted {
+		entry.deps.Release()
+	}
+}
+
+// trim drops the least recently used assets no lease holds above the retain
+// limit. The caller releases the assets the dropped ones hold.
+func (c *AssetCache) trim() []*assetEntry {
+	var unused []assetKey
+	for key, entry := range c.entries {
+		if entry.refs == 0 {
+			unused = append(unused, key)
+		}
+	}
+	if len(unused) <= c.retain {
+		return nil
+	}
+
+	sort.Slice(unused, func(i, j int) bool {
+		return c.entries[unused[i]].lastUsed < c.entries[unused[j]].lastUsed
+	})
+	var evicted []*assetEntry
+	for _, key := range unused[:len(unused)-c.retain] {
+		evicted = append(evicted, c.entries[key])
+		delete(c.entries, key)
+	}
+	return evicted
+}
+
+// parallel calls fn for 0 to n-1 on the workers of the cache and returns the
+// first error.
+func (c *AssetCache) parallel(n int, fn func(i int) error) error {
+	errs := make([]error, n)
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		c.workers <- struct{}{}
+		go func(i int) {
+			defer wg.Done()
+			defer func() { <-c.workers }()
+			errs[i] = fn(i)
+		}(i)
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// AssetStats counts the assets requested through a lease.
+type AssetStats struct {
+	ColorMaps int
+	Materials int
+	Models    int
+	Cached    int           // requests served by assets already in the cache
+	LoadTime  time.Duration // time spent loading and waiting for assets, summed over the workers
+}
+
+func (s AssetStats) String() string {
+	return fmt.Sprintf("%d colormaps, %d materials, %d models, %d from cache, %v loading",
+		s.ColorMaps, s.Materials, s.Models, s.Cached, s.LoadTime.Round(time.Millisecond))
+}
+
+// AssetLease holds the assets requested through it until Release, e.g. the
+// assets of a level while it is shown.
+type AssetLease struct {
+	cache *AssetCache
+	mutex sync.Mutex
+	keys  []assetKey
+	stats AssetStats
+}
+
+func (l *AssetLease) get(key assetKey, load func(deps *AssetLease) (interface{}, error)) (interface{}, error) {
+	start := time.Now()
+	value, cached, err := l.cache.acquire(key, load)
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if err == nil {
+		l.keys = append(l.keys, key)
+	}
+	switch key.kind {
+	case assetColorMap:
+		l.stats.ColorMaps++
+	case assetMaterial:
+		l.stats.Materials++
+	case assetModel:
+		l.stats.Models++
+	}
+	if cached {
+		l.stats.Cached++
+	}
+	l.stats.LoadTime += time.Since(start)
+	return value, err
+}
+
+// ColorMap returns a colormap, or an empty one when it cannot be found.
+func (l *AssetLease) ColorMap(name string) (jktypes.ColorMap, error) {
+	key := assetKey{kind: assetColorMap, name: strings.ToLower(name)}
+	value, err := l.get(key, func(deps *AssetLease) (interface{}, error) {
+		var colorMap jktypes.ColorMap
+		if fileBytes := loadResource(l.cache.resolver, name); fileBytes != nil {
+			parser := NewCmpParser()
+			parser.SetFileName(name)
+			var err error
+			if colorMap, err = parser.ParseFromBytes(fileBytes); err != nil {
+				return nil, err
+			}
+		}
+		return colorMap, nil
+	})
+	if err != nil {
+		return jktypes.ColorMap{}, err
+	}
+	return value.(jktypes.ColorMap), nil
+}
+
+// Material returns a material named by its lower case file name, without cels when
+// it cannot be found. The cels are shared with every other user of the material.
+func (l *AssetLease) Material(name string) (jktypes.Material, error) {
+	key := assetKey{kind: assetMaterial, name: strings.ToLower(name)}
+	value, err := l.get(key, func(deps *AssetLease) (interface{}, error) {
+		var material jktypes.Material
+		if fileBytes := loadResource(l.cache.resolver, name); fileBytes != nil {
+			parser := NewMatParser()
+			parser.SetFileName(name)
+			var err error
+			if material, err = parser.ParseFromBytes(fileBytes); err != nil {
+				return nil, err
+			}
+		}
+		material.Name = strings.ToLower(name)
+		material.XTile = 1.0
+		material.YTile = 1.0
+		return material, nil
+	})
+	if err != nil {
+		return jktypes.Material{}, err
+	}
+	return value.(jktypes.Material), nil
+}
+
+// Model returns a 3do shaded with colorMap, or with dflt.cmp when colorMap is
+// empty. The model is empty when it cannot be found. Its materials and geometry
+// are shared with every other user of the model.
+func (l *AssetLease) Model(name string, colorMap string) (jktypes.Jk3doFile, error) {
+	key := assetKey{kind: assetModel, name: strings.ToLower(name), colorMap: strings.ToLower(colorMap)}
+	value, err := l.get(key, func(deps *AssetLease) (interface{}, error) {
+		var jk3do jktypes.Jk3doFile
+		if fileBytes := loadResource(l.cache.resolver, name); fileBytes != nil {
+			parser := NewJk3doLineParser(l.cache.resolver)
+			parser.SetFileName(name)
+			parser.SetAssets(deps)
+			parser.SetDiskCache(l.cache.disk)
+			var err error
+			if jk3do, err = parser.ParseFromString(string(fileBytes)); err != nil {
+				return nil, err
+			}
+		}
+		if colorMap != "" {
+			cmp, err := deps.ColorMap(colorMap)
+			if err != nil {
+				return nil, err
+			}
+			jk3do.ColorMap = cmp
+		}
+		return jk3do, nil
+	})
+	if err != nil {
+		return jktypes.Jk3doFile{}, err
+	}
+	return value.(jktypes.Jk3doFile), nil
+}
+
+// Stats returns the assets requested so far.
+func (l *AssetLease) Stats() AssetStats {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	return l.stats
+}
+
+// Release gives back every asset requested through the lease.
+func (l *AssetLease) Release() {
+	l.mutex.Lock()
+	keys := l.keys
+	l.keys = nil
+	l.mutex.Unlock()
+
+	for _, key := range keys {
+		l.cache.release(key)
+	}
+}
@@ -0,0 +1,57 @@
+package jkparsers
+
+import (
+	"bytes"
+	"encoding/binary"
+	"github.com/joelhays/go-jk/jk"
+	"github.com/joelhays/go-jk/jk/jktypes"
+	"testing"
+)
+
+func colorMAT(t *testing.T, colorNum int32) []byte {
+	header := jktypes.MtlHeader{MatType: jktypes.MAT_TYPE_COLOR, NumTextures: 1}
+	copy(header.Name[:], "MAT ")
+	var buf bytes.Buffer
+	if err := binary.Write(&buf, binary.LittleEndian, &header); err != nil {
+		t.Fatal(err)
+	}
+	if err := binary.Write(&buf, binary.LittleEndian, &jktypes.ColorHeader{ColorNum: colorNum}); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestAssetCacheRetriesFailedLoads(t *testing.T) {
+	resolver := jk.NewMemoryResolver(map[string][]byte{"mat/wall.mat": []byte("not a material")})
+	cache := NewAssetCache(resolver, 1)
+
+	broken := cache.NewLease()
+	if _, err := broken.Material("wall.mat"); err == nil {
+		t.Fatal("loading a broken material gave no error")
+	}
+	if cache.Len() != 0 {
+		t.Errorf("%d assets cached after a failed load, expected none", cache.Len())
+	}
+
+	resolver.Add("mat/wall.mat", colorMAT(t, 5))
+	lease := cache.NewLease()
+	material, err := lease.Material("wall.mat")
+	if err != nil {
+		t.Fatalf("loading the fixed material: %v", err)
+	}
+	if len(material.Cels) != 1 || material.Cels[0].ColorIndex != 5 {
+		t.Errorf("got cels %+v, expected one of color 5", material.Cels)
+	}
+
+	// releasing the lease that failed must not release the asset loaded since
+	broken.Release()
+	again := cache.NewLease()
+	if _, err := again.Material("wall.mat"); err != nil {
+		t.Fatal(err)
+	}
+	if stats := again.Stats(); stats.Cached != 1 {
+		t.Errorf("the material was not served from the cache: %v", stats)
+	}
+	lease.Release()
+	again.Release()
+}
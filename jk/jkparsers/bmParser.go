@@ -1,29 +1,52 @@
 package jkparsers
 
 import (
+	"encoding/binary"
+	"fmt"
 	"github.com/joelhays/go-jk/jk"
 	"github.com/joelhays/go-jk/jk/jktypes"
+	"io"
 )
 
 type BmParser struct {
+	parseContext
+	resolver jk.ResourceResolver
 }
 
-func NewBmParser() *BmParser {
-	return &BmParser{}
+func NewBmParser(resolver jk.ResourceResolver) *BmParser {
+	return &BmParser{resolver: resolver}
 }
 
-func (p *BmParser) ParseFromBytes(data []byte) jktypes.BMFile {
+func (p *BmParser) ParseFromBytes(data []byte) (jktypes.BMFile, error) {
+	p.reset()
+
 	result := jktypes.BMFile{}
 
 	cursor := 0
+	p.section = "header"
 	var header jktypes.TBMHeader
-	cursor += readBytes(data, cursor, &header)
+	n, err := readBytes(data, cursor, &header)
+	if err != nil {
+		return result, p.wrapError(err)
+	}
+	cursor += n
+
+	if string(header.FileType[:]) != "BM " {
+		return result, p.errorf("%w: not a BM file", ErrMalformed)
+	}
+	// every image has at least its size
+	minImageSize := binary.Size(struct{ SizeX, SizeY int32 }{})
+	if header.NumImages < 0 || int(header.NumImages) > (len(data)-cursor)/minImageSize {
+		return result, p.errorf("%w: invalid image count %d", ErrMalformed, header.NumImages)
+	}
 
 	result.Header = header
 	result.Images = make([]jktypes.TImage, header.NumImages)
 
 	for i := int32(0); i < header.NumImages; i++ {
 		//fmt.Printf("reading image %d of %d\n", i+1, header.NumImages)
+		p.offset = cursor
+		p.section = fmt.Sprintf("image %d", i)
 
 		imageSize := struct {
 			SizeX int32
@@ -32,7 +55,11 @@ func (p *BmParser) ParseFromBytes(data []byte) jktypes.BMFile {
 			0,
 			0,
 		}
-		cursor += readBytes(data, cursor, &imageSize)
+		n, err := readBytes(data, cursor, &imageSize)
+		if err != nil {
+			return result, p.wrapError(err)
+		}
+		cursor += n
 
 		var image jktypes.TImage
 		image.SizeX = imageSize.SizeX
@@ -42,34 +69,45 @@ func (p *BmParser) ParseFromBytes(data []byte) jktypes.BMFile {
 			continue
 		}
 
-		if header.NumBits == 8 {
-			//fmt.Printf("8-bit image %d pixels %+v\n", image.SizeX*image.SizeY, image)
-			image.Data = make([]byte, image.SizeX*image.SizeY)
-		} else {
-			//fmt.Printf("16-bit image %d pixels %+v\n", image.SizeX*image.SizeY, image)
-			image.Data = make([]byte, image.SizeX*image.SizeY*2)
+		size := int(image.SizeX) * int(image.SizeY) * result.BytesPerPixel()
+		if size > len(data)-cursor {
+			return result, p.wrapError(fmt.Errorf("%dx%d image: %w", image.SizeX, image.SizeY, io.ErrUnexpectedEOF))
 		}
+		image.Data = make([]byte, size)
 
-		cursor += readBytes(data, cursor, &image.Data)
+		n, err = readBytes(data, cursor, &image.Data)
+		if err != nil {
+			return result, p.wrapError(err)
+		}
+		cursor += n
 
 		result.Images[i] = image
 	}
 
 	if header.PaletteIncluded == 2 {
+		p.offset = cursor
+		p.section = "palette"
 		var palette jktypes.TPalette
-		readBytes(data, cursor, &palette)
+		if _, err := readBytes(data, cursor, &palette); err != nil {
+			return result, p.wrapError(err)
+		}
 		result.Palette = palette
 	}
 
 	if header.PaletteIncluded != 2 {
 		var cmp jktypes.ColorMap
-		fileBytes := jk.GetLoader().LoadResource("dflt.cmp")
+		fileBytes := loadResource(p.resolver, "dflt.cmp")
 		if fileBytes != nil {
-			cmp = NewCmpParser().ParseFromBytes(fileBytes)
+			cmpParser := NewCmpParser()
+			cmpParser.SetFileName("dflt.cmp")
+			cmp, err = cmpParser.ParseFromBytes(fileBytes)
+			if err != nil {
+				return result, err
+			}
 		}
 
 		result.Palette.Palette = cmp.Palette
 	}
 
-	return result
+	return result, nil
 }
@@ -5,16 +5,40 @@ import (
 )
 
 type CmpParser struct {
+	parseContext
 }
 
 func NewCmpParser() *CmpParser {
 	return &CmpParser{}
 }
 
-func (p *CmpParser) ParseFromBytes(data []byte) jktypes.ColorMap {
-	cursor := 0
+func (p *CmpParser) ParseFromBytes(data []byte) (jktypes.ColorMap, error) {
+	p.reset()
+	p.section = "header"
+
 	var header jktypes.TCMPHeader
-	cursor += readBytes(data, cursor, &header)
+	cursor, err := readBytes(data, 0, &header)
+	if err != nil {
+		return jktypes.ColorMap{}, p.wrapError(err)
+	}
+
+	colorMap := jktypes.ColorMap{Palette: header.Palette}
+
+	p.section = "light levels"
+	colorMap.LightLevels = make([][256]byte, jktypes.ColorMapLightLevels)
+	n, err := readBytes(data, cursor, &colorMap.LightLevels)
+	if err != nil {
+		return jktypes.ColorMap{}, p.wrapError(err)
+	}
+	cursor += n
+
+	if header.Transparency != 0 {
+		p.section = "transparency"
+		colorMap.Transparency = make([][256]byte, jktypes.ColorMapTransparencyTable)
+		if _, err := readBytes(data, cursor, &colorMap.Transparency); err != nil {
+			return jktypes.ColorMap{}, p.wrapError(err)
+		}
+	}
 
-	return jktypes.ColorMap{Palette: header.Palette}
+	return colorMap, nil
 }
@@ -0,0 +1,169 @@
+package jkparsers
+
+import (
+	"fmt"
+	"github.com/joelhays/go-jk/jk/jktypes"
+	"strconv"
+	"strings"
+)
+
+// cogUnaryPrecedence binds tighter than every binary operator.
+const cogUnaryPrecedence = 10
+
+// FormatCog writes a COG back to source. Comments and layout are not kept, but
+// parsing the result gives the same symbols and code as the original.
+func FormatCog(cog *jktypes.Cog) string {
+	var sb strings.Builder
+
+	if cog.Flags != 0 {
+		fmt.Fprintf(&sb, "flags=%#x\n\n", cog.Flags)
+	}
+
+	sb.WriteString("symbols\n\n")
+	for _, symbol := range cog.Symbols {
+		sb.WriteString(formatCogSymbol(symbol))
+		sb.WriteString("\n")
+	}
+	sb.WriteString("\nend\n\n")
+
+	sb.WriteString("code\n")
+	for _, stmt := range cog.Code {
+		formatCogStmt(&sb, stmt, 1)
+	}
+	sb.WriteString("\nend\n")
+
+	return sb.String()
+}
+
+func formatCogSymbol(symbol jktypes.CogSymbol) string {
+	name := symbol.Name
+	if symbol.HasDefault {
+		name += "=" + symbol.Default
+	}
+	fields := []string{fmt.Sprintf("%-12s%-32s", symbol.Type.String(), name)}
+	if symbol.Local {
+		fields = append(fields, "local")
+	}
+	if symbol.NoLink {
+		fields = append(fields, "nolink")
+	}
+	if symbol.LinkID >= 0 {
+		fields = append(fields, fmt.Sprintf("linkid=%d", symbol.LinkID))
+	}
+	if symbol.HasMask {
+		fields = append(fields, fmt.Sprintf("mask=%#x", symbol.Mask))
+	}
+	if symbol.Desc != "" {
+		fields = append(fields, "desc="+symbol.Desc)
+	}
+	return strings.TrimSpace(strings.Join(fields, " "))
+}
+
+func writeCogIndent(sb *strings.Builder, depth int) {
+	sb.WriteString(strings.Repeat("   ", depth))
+}
+
+func formatCogStmt(sb *strings.Builder, stmt jktypes.CogStmt, depth int) {
+	switch s := stmt.(type) {
+	case *jktypes.CogLabelStmt:
+		fmt.Fprintf(sb, "\n%s:\n", s.Name)
+		return
+	case *jktypes.CogBlockStmt:
+		writeCogIndent(sb, depth-1)
+		sb.WriteString("{\n")
+		for _, child := range s.List {
+			formatCogStmt(sb, child, depth)
+		}
+		writeCogIndent(sb, depth-1)
+		sb.WriteString("}\n")
+		return
+	}
+
+	writeCogIndent(sb, depth)
+	switch s := stmt.(type) {
+	case *jktypes.CogExprStmt:
+		sb.WriteString(formatCogExpr(s.X, 0))
+		sb.WriteString(";\n")
+	case *jktypes.CogIfStmt:
+		fmt.Fprintf(sb, "if(%s)\n", formatCogExpr(s.Cond, 0))
+		formatCogStmt(sb, s.Then, depth+1)
+		if s.Else != nil {
+			writeCogIndent(sb, depth)
+			sb.WriteString("else\n")
+			formatCogStmt(sb, s.Else, depth+1)
+		}
+	case *jktypes.CogWhileStmt:
+		fmt.Fprintf(sb, "while(%s)\n", formatCogExpr(s.Cond, 0))
+		formatCogStmt(sb, s.Body, depth+1)
+	case *jktypes.CogDoStmt:
+		sb.WriteString("do\n")
+		formatCogStmt(sb, s.Body, depth+1)
+		writeCogIndent(sb, depth)
+		fmt.Fprintf(sb, "while(%s);\n", formatCogExpr(s.Cond, 0))
+	case *jktypes.CogForStmt:
+		fmt.Fprintf(sb, "for(%s; %s; %s)\n", formatCogExpr(s.Init, 0), formatCogExpr(s.Cond, 0),
+			formatCogExpr(s.Post, 0))
+		formatCogStmt(sb, s.Body, depth+1)
+	case *jktypes.CogCallStmt:
+		fmt.Fprintf(sb, "call %s;\n", s.Label)
+	case *jktypes.CogReturnStmt:
+		sb.WriteString("Return;\n")
+	case *jktypes.CogStopStmt:
+		sb.WriteString("Stop;\n")
+	case *jktypes.CogEmptyStmt:
+		sb.WriteString(";\n")
+	}
+}
+
+// formatCogExpr formats an expression, adding parentheses where the operands
+// bind less tightly than precedence.
+func formatCogExpr(expr jktypes.CogExpr, precedence int) string {
+	var s string
+	var exprPrecedence int
+
+	switch x := expr.(type) {
+	case nil:
+		return ""
+	case *jktypes.CogIdent:
+		return x.Name
+	case *jktypes.CogIndexExpr:
+		return fmt.Sprintf("%s[%s]", x.Name, formatCogExpr(x.Index, 0))
+	case *jktypes.CogIntLit:
+		if x.Raw != "" {
+			return x.Raw
+		}
+		return strconv.Itoa(int(x.Value))
+	case *jktypes.CogFloatLit:
+		if x.Raw != "" {
+			return x.Raw
+		}
+		return strconv.FormatFloat(float64(x.Value), 'f', -1, 32)
+	case *jktypes.CogStringLit:
+		return "\"" + x.Value + "\""
+	case *jktypes.CogVectorLit:
+		if x.Raw != "" {
+			return "'" + x.Raw + "'"
+		}
+		return fmt.Sprintf("'%g %g %g'", x.Value[0], x.Value[1], x.Value[2])
+	case *jktypes.CogCallExpr:
+		args := make([]string, len(x.Args))
+		for i, arg := range x.Args {
+			args[i] = formatCogExpr(arg, 0)
+		}
+		return fmt.Sprintf("%s(%s)", x.Verb, strings.Join(args, ", "))
+	case *jktypes.CogUnaryExpr:
+		exprPrecedence = cogUnaryPrecedence
+		s = x.Op + formatCogExpr(x.X, exprPrecedence)
+	case *jktypes.CogBinaryExpr:
+		exprPrecedence = cogBinaryPrecedence[x.Op]
+		s = fmt.Sprintf("%s %s %s", formatCogExpr(x.X, exprPrecedence), x.Op, formatCogExpr(x.Y, exprPrecedence+1))
+	case *jktypes.CogAssignExpr:
+		exprPrecedence = 0
+		s = fmt.Sprintf("%s = %s", formatCogExpr(x.Target, 0), formatCogExpr(x.Value, 0))
+	}
+
+	if exprPrecedence < precedence {
+		return "(" + s + ")"
+	}
+	return s
+}
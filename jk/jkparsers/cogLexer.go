@@ -0,0 +1,184 @@
+package jkparsers
+
+import (
+	"fmt"
+	"github.com/joelhays/go-jk/jk/jktypes"
+	"strings"
+)
+
+type cogTokenKind int
+
+const (
+	cogTokenEOF cogTokenKind = iota
+	cogTokenIdent
+	cogTokenInt
+	cogTokenFloat
+	cogTokenString
+	cogTokenVector
+	cogTokenPunct
+)
+
+type cogToken struct {
+	kind cogTokenKind
+	text string
+	pos  jktypes.CogPos
+}
+
+var cogPuncts = []string{"==", "!=", "<=", ">=", "&&", "||",
+	"=", "<", ">", "+", "-", "*", "/", "%", "!", "&", "|", "^", "(", ")", "{", "}", "[", "]", ",", ";", ":"}
+
+// cogLexer splits the code section of a COG into tokens. Comments start with
+// '#' or '//' and run to the end of the line.
+type cogLexer struct {
+	src    string
+	offset int
+	line   int
+	column int
+}
+
+func newCogLexer(src string, firstLine int) *cogLexer {
+	return &cogLexer{src: src, line: firstLine, column: 1}
+}
+
+func (l *cogLexer) tokens() ([]cogToken, error) {
+	var tokens []cogToken
+	for {
+		tok, err := l.next()
+		if err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, tok)
+		if tok.kind == cogTokenEOF {
+			return tokens, nil
+		}
+	}
+}
+
+func (l *cogLexer) advance(n int) {
+	for i := 0; i < n && l.offset < len(l.src); i++ {
+		if l.src[l.offset] == '\n' {
+			l.line++
+			l.column = 1
+		} else {
+			l.column++
+		}
+		l.offset++
+	}
+}
+
+func (l *cogLexer) skipSpaceAndComments() {
+	for l.offset < len(l.src) {
+		rest := l.src[l.offset:]
+		switch {
+		case rest[0] == ' ' || rest[0] == '\t' || rest[0] == '\r' || rest[0] == '\n':
+			l.advance(1)
+		case rest[0] == '#' || strings.HasPrefix(rest, "//"):
+			end := strings.IndexByte(rest, '\n')
+			if end < 0 {
+				end = len(rest)
+			}
+			l.advance(end)
+		default:
+			return
+		}
+	}
+}
+
+func (l *cogLexer) errorf(pos jktypes.CogPos, format string, a ...interface{}) error {
+	return &ParseError{Line: pos.Line, Column: pos.Column, Section: "code", Err: fmt.Errorf(format, a...)}
+}
+
+func (l *cogLexer) next() (cogToken, error) {
+	l.skipSpaceAndComments()
+
+	pos := jktypes.CogPos{Line: l.line, Column: l.column}
+	if l.offset >= len(l.src) {
+		return cogToken{kind: cogTokenEOF, pos: pos}, nil
+	}
+
+	rest := l.src[l.offset:]
+	c := rest[0]
+	switch {
+	case isCogIdentStart(c):
+		n := 1
+		for n < len(rest) && isCogIdentChar(rest[n]) {
+			n++
+		}
+		l.advance(n)
+		return cogToken{kind: cogTokenIdent, text: rest[:n], pos: pos}, nil
+	case isDigit(c) || (c == '.' && len(rest) > 1 && isDigit(rest[1])):
+		return l.number(rest, pos)
+	case c == '"' || c == '\'':
+		end := strings.IndexAny(rest[1:], string(c)+"\n")
+		if end < 0 || rest[1+end] != c {
+			return cogToken{}, l.errorf(pos, "%w: unterminated %c", ErrMalformed, c)
+		}
+		kind := cogTokenString
+		if c == '\'' {
+			kind = cogTokenVector
+		}
+		l.advance(end + 2)
+		return cogToken{kind: kind, text: rest[1 : end+1], pos: pos}, nil
+	}
+
+	for _, punct := range cogPuncts {
+		if strings.HasPrefix(rest, punct) {
+			l.advance(len(punct))
+			return cogToken{kind: cogTokenPunct, text: punct, pos: pos}, nil
+		}
+	}
+
+	return cogToken{}, l.errorf(pos, "%w: unexpected character %q", ErrMalformed, c)
+}
+
+func (l *cogLexer) number(rest string, pos jktypes.CogPos) (cogToken, error) {
+	n := 0
+	kind := cogTokenInt
+	if strings.HasPrefix(rest, "0x") || strings.HasPrefix(rest, "0X") {
+		n = 2
+		for n < len(rest) && isHexDigit(rest[n]) {
+			n++
+		}
+	} else {
+		for n < len(rest) && (isDigit(rest[n]) || rest[n] == '.') {
+			if rest[n] == '.' {
+				kind = cogTokenFloat
+			}
+			n++
+		}
+		if n < len(rest) && (rest[n] == 'e' || rest[n] == 'E') {
+			m := n + 1
+			if m < len(rest) && (rest[m] == '+' || rest[m] == '-') {
+				m++
+			}
+			if m < len(rest) && isDigit(rest[m]) {
+				for m < len(rest) && isDigit(rest[m]) {
+					m++
+				}
+				n = m
+				kind = cogTokenFloat
+			}
+		}
+	}
+	if n < len(rest) && isCogIdentChar(rest[n]) {
+		return cogToken{}, l.errorf(pos, "%w: bad number %q", ErrMalformed, rest[:n+1])
+	}
+	l.advance(n)
+	return cogToken{kind: kind, text: rest[:n], pos: pos}, nil
+}
+
+func isCogIdentStart(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isCogIdentChar(c byte) bool {
+	return isCogIdentStart(c) || isDigit(c)
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isHexDigit(c byte) bool {
+	return isDigit(c) || (c >= 'a' && c <= 'f') || (c >= 'A' && c <= 'F')
+}
@@ -0,0 +1,706 @@
+package jkparsers
+
+import (
+	"errors"
+	"fmt"
+	"github.com/go-gl/mathgl/mgl32"
+	"github.com/joelhays/go-jk/jk/jktypes"
+	"io"
+	"io/ioutil"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var cogBinaryPrecedence = map[string]int{
+	"||": 1,
+	"&&": 2,
+	"|":  3,
+	"^":  4,
+	"&":  5,
+	"==": 6, "!=": 6,
+	"<": 7, "<=": 7, ">": 7, ">=": 7,
+	"+": 8, "-": 8,
+	"*": 9, "/": 9, "%": 9,
+}
+
+// CogParser reads a COG script into its symbols and the AST of its code section.
+// Besides the error returned for malformed scripts, the parser collects
+// diagnostics for scripts that parse but reference undeclared symbols, unknown
+// verbs or missing labels.
+type CogParser struct {
+	parseContext
+	cog         jktypes.Cog
+	tokens      []cogToken
+	tokenIdx    int
+	diagnostics []*ParseError
+}
+
+func NewCogParser() *CogParser {
+	return &CogParser{}
+}
+
+func (p *CogParser) ParseFromFile(filePath string) (jktypes.Cog, error) {
+	bytes, err := ioutil.ReadFile(filePath)
+	if err != nil {
+		return jktypes.Cog{}, err
+	}
+
+	p.SetFileName(filePath)
+	return p.ParseFromString(string(bytes))
+}
+
+func (p *CogParser) ParseFromString(cogString string) (jktypes.Cog, error) {
+	p.cog = jktypes.Cog{}
+	p.tokens = nil
+	p.tokenIdx = 0
+	p.diagnostics = nil
+	p.reset()
+
+	lines := strings.Split(strings.ReplaceAll(cogString, "\r\n", "\n"), "\n")
+
+	codeLine, err := p.parseSymbols(lines)
+	if err != nil {
+		return jktypes.Cog{}, err
+	}
+	if codeLine < 0 {
+		return p.cog, nil
+	}
+
+	p.section = "code"
+	lexer := newCogLexer(strings.Join(lines[codeLine:], "\n"), codeLine+1)
+	p.tokens, err = lexer.tokens()
+	if err != nil {
+		return jktypes.Cog{}, p.wrapCodeError(err)
+	}
+	if err := p.parseCode(); err != nil {
+		return jktypes.Cog{}, p.wrapCodeError(err)
+	}
+
+	p.checkCode()
+
+	return p.cog, nil
+}
+
+// Diagnostics returns the problems found in the code section of the last
+// parsed COG, wrapping ErrUndeclaredSymbol, ErrUnknownVerb or ErrUndefinedLabel.
+func (p *CogParser) Diagnostics() []*ParseError {
+	return p.diagnostics
+}
+
+// parseSymbols reads the flags and the symbols section and returns the index of
+// the first line of the code section, or -1 if there is none.
+func (p *CogParser) parseSymbols(lines []string) (int, error) {
+	inSymbols := false
+	for i, line := range lines {
+		p.lineNum = i + 1
+		line = stripCogComment(line)
+		if line == "" {
+			continue
+		}
+
+		keyword := strings.ToLower(line)
+		if !inSymbols {
+			switch {
+			case keyword == "symbols":
+				inSymbols = true
+				p.section = "symbols"
+			case keyword == "code":
+				return i + 1, nil
+			case strings.HasPrefix(keyword, "flags"):
+				value := strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(line[len("flags"):]), "="))
+				flags, err := strconv.ParseInt(value, 0, 64)
+				if err != nil {
+					return -1, p.malformed("\"flags=<number>\"", line)
+				}
+				p.cog.Flags = flags
+			default:
+				return -1, p.malformed("symbols or code section", line)
+			}
+			continue
+		}
+
+		if keyword == "end" {
+			inSymbols = false
+			p.section = ""
+			continue
+		}
+
+		symbol, err := p.parseSymbol(line)
+		if err != nil {
+			return -1, err
+		}
+		p.cog.Symbols = append(p.cog.Symbols, symbol)
+	}
+
+	if inSymbols {
+		return -1, p.wrapError(fmt.Errorf("symbols section not closed: %w", io.ErrUnexpectedEOF))
+	}
+	return -1, nil
+}
+
+func (p *CogParser) parseSymbol(line string) (jktypes.CogSymbol, error) {
+	args := strings.Fields(line)
+	if err := requireArgs(args, 2); err != nil {
+		return jktypes.CogSymbol{}, p.wrapError(err)
+	}
+
+	symbolType, ok := jktypes.CogSymbolTypeFromName(args[0])
+	if !ok {
+		return jktypes.CogSymbol{}, p.errorf("%w: unknown symbol type %q", ErrMalformed, args[0])
+	}
+
+	symbol := jktypes.CogSymbol{
+		CogPos: jktypes.CogPos{Line: p.lineNum, Column: strings.Index(line, args[0]) + 1},
+		Type:   symbolType,
+		Name:   args[1],
+		LinkID: -1,
+	}
+	if idx := strings.Index(args[1], "="); idx >= 0 {
+		symbol.Name = args[1][:idx]
+		symbol.Default = args[1][idx+1:]
+		symbol.HasDefault = true
+	}
+	if symbol.Name == "" {
+		return jktypes.CogSymbol{}, p.malformed("symbol name", line)
+	}
+
+	for _, arg := range args[2:] {
+		key := strings.ToLower(arg)
+		value := ""
+		if idx := strings.Index(arg, "="); idx >= 0 {
+			key = strings.ToLower(arg[:idx])
+			value = arg[idx+1:]
+		}
+
+		switch key {
+		case "local":
+			symbol.Local = true
+		case "nolink":
+			symbol.NoLink = true
+		case "linkid", "mask":
+			number, err := strconv.ParseInt(value, 0, 64)
+			if err != nil {
+				return jktypes.CogSymbol{}, p.malformed(key+"=<number>", arg)
+			}
+			if key == "linkid" {
+				symbol.LinkID = number
+			} else {
+				symbol.Mask = number
+				symbol.HasMask = true
+			}
+		case "desc":
+			symbol.Desc = value
+		default:
+			p.diagnose(symbol.CogPos, fmt.Errorf("unknown extension %q of symbol %s", arg, symbol.Name))
+		}
+	}
+
+	return symbol, nil
+}
+
+func stripCogComment(line string) string {
+	if idx := strings.Index(line, "#"); idx >= 0 {
+		line = line[:idx]
+	}
+	if idx := strings.Index(line, "//"); idx >= 0 {
+		line = line[:idx]
+	}
+	return strings.TrimSpace(line)
+}
+
+func (p *CogParser) wrapCodeError(err error) error {
+	var parseErr *ParseError
+	if errors.As(err, &parseErr) && parseErr.File == "" {
+		parseErr.File = p.fileName
+	}
+	return err
+}
+
+func (p *CogParser) diagnose(pos jktypes.CogPos, err error) {
+	p.diagnostics = append(p.diagnostics, &ParseError{File: p.fileName, Line: pos.Line, Column: pos.Column,
+		Section: p.section, Err: err})
+}
+
+func (p *CogParser) errorAt(tok cogToken, format string, a ...interface{}) error {
+	return &ParseError{File: p.fileName, Line: tok.pos.Line, Column: tok.pos.Column, Section: "code",
+		Err: fmt.Errorf(format, a...)}
+}
+
+func (p *CogParser) unexpected(tok cogToken, what string) error {
+	found := tok.text
+	if tok.kind == cogTokenEOF {
+		found = "end of file"
+	}
+	return p.errorAt(tok, "%w: expected %s, got %q", ErrMalformed, what, found)
+}
+
+func (p *CogParser) peek() cogToken {
+	return p.tokens[p.tokenIdx]
+}
+
+func (p *CogParser) peekAt(n int) cogToken {
+	if p.tokenIdx+n >= len(p.tokens) {
+		return p.tokens[len(p.tokens)-1]
+	}
+	return p.tokens[p.tokenIdx+n]
+}
+
+func (p *CogParser) nextToken() cogToken {
+	tok := p.tokens[p.tokenIdx]
+	if tok.kind != cogTokenEOF {
+		p.tokenIdx++
+	}
+	return tok
+}
+
+func (p *CogParser) isPunct(text string) bool {
+	tok := p.peek()
+	return tok.kind == cogTokenPunct && tok.text == text
+}
+
+func (p *CogParser) isKeyword(keyword string) bool {
+	tok := p.peek()
+	return tok.kind == cogTokenIdent && strings.EqualFold(tok.text, keyword)
+}
+
+func (p *CogParser) expectPunct(text string) (cogToken, error) {
+	if !p.isPunct(text) {
+		return cogToken{}, p.unexpected(p.peek(), fmt.Sprintf("%q", text))
+	}
+	return p.nextToken(), nil
+}
+
+// parseCode reads statements up to the end keyword closing the code section.
+func (p *CogParser) parseCode() error {
+	for !p.isKeyword("end") {
+		if p.peek().kind == cogTokenEOF {
+			return p.errorAt(p.peek(), "code section not closed: %w", io.ErrUnexpectedEOF)
+		}
+		stmt, err := p.parseStmt()
+		if err != nil {
+			return err
+		}
+		p.cog.Code = append(p.cog.Code, stmt)
+	}
+	return nil
+}
+
+func (p *CogParser) parseStmt() (jktypes.CogStmt, error) {
+	tok := p.peek()
+
+	if tok.kind == cogTokenPunct {
+		switch tok.text {
+		case "{":
+			return p.parseBlock()
+		case ";":
+			p.nextToken()
+			return &jktypes.CogEmptyStmt{CogPos: tok.pos}, nil
+		}
+	}
+
+	if tok.kind == cogTokenIdent {
+		next := p.peekAt(1)
+		if next.kind == cogTokenPunct && next.text == ":" {
+			p.nextToken()
+			p.nextToken()
+			return &jktypes.CogLabelStmt{CogPos: tok.pos, Name: tok.text}, nil
+		}
+
+		switch strings.ToLower(tok.text) {
+		case "if":
+			return p.parseIf()
+		case "while":
+			return p.parseWhile()
+		case "do":
+			return p.parseDo()
+		case "for":
+			return p.parseFor()
+		case "call":
+			p.nextToken()
+			label := p.nextToken()
+			if label.kind != cogTokenIdent {
+				return nil, p.unexpected(label, "label")
+			}
+			if _, err := p.expectPunct(";"); err != nil {
+				return nil, err
+			}
+			return &jktypes.CogCallStmt{CogPos: tok.pos, Label: label.text}, nil
+		case "return":
+			p.nextToken()
+			if _, err := p.expectPunct(";"); err != nil {
+				return nil, err
+			}
+			return &jktypes.CogReturnStmt{CogPos: tok.pos}, nil
+		case "stop":
+			p.nextToken()
+			if _, err := p.expectPunct(";"); err != nil {
+				return nil, err
+			}
+			return &jktypes.CogStopStmt{CogPos: tok.pos}, nil
+		case "end", "else":
+			return nil, p.unexpected(tok, "statement")
+		}
+	}
+
+	x, err := p.parseExpr()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := p.expectPunct(";"); err != nil {
+		return nil, err
+	}
+	return &jktypes.CogExprStmt{CogPos: tok.pos, X: x}, nil
+}
+
+func (p *CogParser) parseBlock() (jktypes.CogStmt, error) {
+	open := p.nextToken()
+	block := &jktypes.CogBlockStmt{CogPos: open.pos}
+	for !p.isPunct("}") {
+		if p.peek().kind == cogTokenEOF {
+			return nil, p.unexpected(p.peek(), "\"}\"")
+		}
+		stmt, err := p.parseStmt()
+		if err != nil {
+			return nil, err
+		}
+		block.List = append(block.List, stmt)
+	}
+	p.nextToken()
+	return block, nil
+}
+
+func (p *CogParser) parseCondition() (jktypes.CogExpr, error) {
+	if _, err := p.expectPunct("("); err != nil {
+		return nil, err
+	}
+	cond, err := p.parseExpr()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := p.expectPunct(")"); err != nil {
+		return nil, err
+	}
+	return cond, nil
+}
+
+func (p *CogParser) parseIf() (jktypes.CogStmt, error) {
+	tok := p.nextToken()
+	cond, err := p.parseCondition()
+	if err != nil {
+		return nil, err
+	}
+	then, err := p.parseStmt()
+	if err != nil {
+		return nil, err
+	}
+	stmt := &jktypes.CogIfStmt{CogPos: tok.pos, Cond: cond, Then: then}
+	if p.isKeyword("else") {
+		p.nextToken()
+		if stmt.Else, err = p.parseStmt(); err != nil {
+			return nil, err
+		}
+	}
+	return stmt, nil
+}
+
+func (p *CogParser) parseWhile() (jktypes.CogStmt, error) {
+	tok := p.nextToken()
+	cond, err := p.parseCondition()
+	if err != nil {
+		return nil, err
+	}
+	body, err := p.parseStmt()
+	if err != nil {
+		return nil, err
+	}
+	return &jktypes.CogWhileStmt{CogPos: tok.pos, Cond: cond, Body: body}, nil
+}
+
+func (p *CogParser) parseDo() (jktypes.CogStmt, error) {
+	tok := p.nextToken()
+	body, err := p.parseStmt()
+	if err != nil {
+		return nil, err
+	}
+	if !p.isKeyword("while") {
+		return nil, p.unexpected(p.peek(), "\"while\"")
+	}
+	p.nextToken()
+	cond, err := p.parseCondition()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := p.expectPunct(";"); err != nil {
+		return nil, err
+	}
+	return &jktypes.CogDoStmt{CogPos: tok.pos, Body: body, Cond: cond}, nil
+}
+
+func (p *CogParser) parseFor() (jktypes.CogStmt, error) {
+	tok := p.nextToken()
+	if _, err := p.expectPunct("("); err != nil {
+		return nil, err
+	}
+
+	var clauses [3]jktypes.CogExpr
+	terminators := []string{";", ";", ")"}
+	for i, terminator := range terminators {
+		if !p.isPunct(terminator) {
+			x, err := p.parseExpr()
+			if err != nil {
+				return nil, err
+			}
+			clauses[i] = x
+		}
+		if _, err := p.expectPunct(terminator); err != nil {
+			return nil, err
+		}
+	}
+
+	body, err := p.parseStmt()
+	if err != nil {
+		return nil, err
+	}
+	return &jktypes.CogForStmt{CogPos: tok.pos, Init: clauses[0], Cond: clauses[1], Post: clauses[2], Body: body}, nil
+}
+
+func (p *CogParser) parseExpr() (jktypes.CogExpr, error) {
+	x, err := p.parseBinary(1)
+	if err != nil {
+		return nil, err
+	}
+
+	if !p.isPunct("=") {
+		return x, nil
+	}
+	tok := p.nextToken()
+	switch x.(type) {
+	case *jktypes.CogIdent, *jktypes.CogIndexExpr:
+	default:
+		return nil, p.errorAt(tok, "%w: cannot assign to expression", ErrMalformed)
+	}
+	value, err := p.parseExpr()
+	if err != nil {
+		return nil, err
+	}
+	return &jktypes.CogAssignExpr{CogPos: x.Pos(), Target: x, Value: value}, nil
+}
+
+func (p *CogParser) parseBinary(minPrecedence int) (jktypes.CogExpr, error) {
+	x, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		tok := p.peek()
+		precedence, ok := cogBinaryPrecedence[tok.text]
+		if tok.kind != cogTokenPunct || !ok || precedence < minPrecedence {
+			return x, nil
+		}
+		p.nextToken()
+		y, err := p.parseBinary(precedence + 1)
+		if err != nil {
+			return nil, err
+		}
+		x = &jktypes.CogBinaryExpr{CogPos: x.Pos(), Op: tok.text, X: x, Y: y}
+	}
+}
+
+func (p *CogParser) parseUnary() (jktypes.CogExpr, error) {
+	tok := p.peek()
+	if tok.kind == cogTokenPunct && (tok.text == "-" || tok.text == "!") {
+		p.nextToken()
+		x, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &jktypes.CogUnaryExpr{CogPos: tok.pos, Op: tok.text, X: x}, nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *CogParser) parsePrimary() (jktypes.CogExpr, error) {
+	tok := p.nextToken()
+	switch tok.kind {
+	case cogTokenInt:
+		base := 10
+		if strings.HasPrefix(tok.text, "0x") || strings.HasPrefix(tok.text, "0X") {
+			base = 0
+		}
+		value, err := strconv.ParseUint(tok.text, base, 32)
+		if err != nil {
+			return nil, p.errorAt(tok, "%w: bad integer %q", ErrMalformed, tok.text)
+		}
+		return &jktypes.CogIntLit{CogPos: tok.pos, Value: int32(value), Raw: tok.text}, nil
+	case cogTokenFloat:
+		value, err := strconv.ParseFloat(tok.text, 32)
+		if err != nil {
+			return nil, p.errorAt(tok, "%w: bad number %q", ErrMalformed, tok.text)
+		}
+		return &jktypes.CogFloatLit{CogPos: tok.pos, Value: float32(value), Raw: tok.text}, nil
+	case cogTokenString:
+		return &jktypes.CogStringLit{CogPos: tok.pos, Value: tok.text}, nil
+	case cogTokenVector:
+		var v mgl32.Vec3
+		fields := strings.Fields(tok.text)
+		if len(fields) != 3 {
+			return nil, p.errorAt(tok, "%w: expected 3 vector components, got %q", ErrMalformed, tok.text)
+		}
+		for i, field := range fields {
+			value, err := strconv.ParseFloat(field, 32)
+			if err != nil {
+				return nil, p.errorAt(tok, "%w: bad vector %q", ErrMalformed, tok.text)
+			}
+			v[i] = float32(value)
+		}
+		return &jktypes.CogVectorLit{CogPos: tok.pos, Value: v, Raw: tok.text}, nil
+	case cogTokenIdent:
+		if p.isPunct("(") {
+			return p.parseCall(tok)
+		}
+		if p.isPunct("[") {
+			p.nextToken()
+			index, err := p.parseExpr()
+			if err != nil {
+				return nil, err
+			}
+			if _, err := p.expectPunct("]"); err != nil {
+				return nil, err
+			}
+			return &jktypes.CogIndexExpr{CogPos: tok.pos, Name: tok.text, Index: index}, nil
+		}
+		return &jktypes.CogIdent{CogPos: tok.pos, Name: tok.text}, nil
+	case cogTokenPunct:
+		if tok.text == "(" {
+			x, err := p.parseExpr()
+			if err != nil {
+				return nil, err
+			}
+			if _, err := p.expectPunct(")"); err != nil {
+				return nil, err
+			}
+			return x, nil
+		}
+	}
+	return nil, p.unexpected(tok, "expression")
+}
+
+func (p *CogParser) parseCall(verb cogToken) (jktypes.CogExpr, error) {
+	p.nextToken()
+	call := &jktypes.CogCallExpr{CogPos: verb.pos, Verb: verb.text}
+	for !p.isPunct(")") {
+		if len(call.Args) > 0 {
+			if _, err := p.expectPunct(","); err != nil {
+				return nil, err
+			}
+		}
+		arg, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		call.Args = append(call.Args, arg)
+	}
+	p.nextToken()
+	return call, nil
+}
+
+// checkCode reports the names used by the code section that neither the symbols
+// section, the code labels nor the engine verbs define.
+func (p *CogParser) checkCode() {
+	labels := make(map[string]bool)
+	WalkCog(p.cog.Code, func(node interface{}) {
+		if label, ok := node.(*jktypes.CogLabelStmt); ok {
+			labels[strings.ToLower(label.Name)] = true
+		}
+	})
+
+	WalkCog(p.cog.Code, func(node interface{}) {
+		switch n := node.(type) {
+		case *jktypes.CogIdent:
+			if p.cog.FindSymbol(n.Name) < 0 {
+				p.diagnose(n.CogPos, fmt.Errorf("%w %s", ErrUndeclaredSymbol, n.Name))
+			}
+		case *jktypes.CogIndexExpr:
+			if p.cog.FindSymbol(n.Name) < 0 {
+				p.diagnose(n.CogPos, fmt.Errorf("%w %s", ErrUndeclaredSymbol, n.Name))
+			}
+		case *jktypes.CogCallExpr:
+			if !IsCogVerb(n.Verb) {
+				p.diagnose(n.CogPos, fmt.Errorf("%w %s", ErrUnknownVerb, n.Verb))
+			}
+		case *jktypes.CogCallStmt:
+			if !labels[strings.ToLower(n.Label)] {
+				p.diagnose(n.CogPos, fmt.Errorf("%w %s", ErrUndefinedLabel, n.Label))
+			}
+		}
+	})
+
+	sort.SliceStable(p.diagnostics, func(i, j int) bool {
+		a, b := p.diagnostics[i], p.diagnostics[j]
+		if a.Line != b.Line {
+			return a.Line < b.Line
+		}
+		return a.Column < b.Column
+	})
+}
+
+// WalkCog calls fn for every statement and expression of a COG code section,
+// parents before their children.
+func WalkCog(code []jktypes.CogStmt, fn func(node interface{})) {
+	for _, stmt := range code {
+		walkCogStmt(stmt, fn)
+	}
+}
+
+func walkCogStmt(stmt jktypes.CogStmt, fn func(node interface{})) {
+	if stmt == nil {
+		return
+	}
+	fn(stmt)
+	switch s := stmt.(type) {
+	case *jktypes.CogExprStmt:
+		walkCogExpr(s.X, fn)
+	case *jktypes.CogBlockStmt:
+		WalkCog(s.List, fn)
+	case *jktypes.CogIfStmt:
+		walkCogExpr(s.Cond, fn)
+		walkCogStmt(s.Then, fn)
+		walkCogStmt(s.Else, fn)
+	case *jktypes.CogWhileStmt:
+		walkCogExpr(s.Cond, fn)
+		walkCogStmt(s.Body, fn)
+	case *jktypes.CogDoStmt:
+		walkCogStmt(s.Body, fn)
+		walkCogExpr(s.Cond, fn)
+	case *jktypes.CogForStmt:
+		walkCogExpr(s.Init, fn)
+		walkCogExpr(s.Cond, fn)
+		walkCogExpr(s.Post, fn)
+		walkCogStmt(s.Body, fn)
+	}
+}
+
+func walkCogExpr(expr jktypes.CogExpr, fn func(node interface{})) {
+	if expr == nil {
+		return
+	}
+	fn(expr)
+	switch x := expr.(type) {
+	case *jktypes.CogIndexExpr:
+		walkCogExpr(x.Index, fn)
+	case *jktypes.CogUnaryExpr:
+		walkCogExpr(x.X, fn)
+	case *jktypes.CogBinaryExpr:
+		walkCogExpr(x.X, fn)
+		walkCogExpr(x.Y, fn)
+	case *jktypes.CogAssignExpr:
+		walkCogExpr(x.Target, fn)
+		walkCogExpr(x.Value, fn)
+	case *jktypes.CogCallExpr:
+		for _, arg := range x.Args {
+			walkCogExpr(arg, fn)
+		}
+	}
+}
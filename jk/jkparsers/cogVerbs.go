@@ -0,0 +1,535 @@
+package jkparsers
+
+import "strings"
+
+// cogVerbs lists the verbs provided by the engine, taken from the COG reference
+// in _jkspecs. Verb names are case insensitive.
+var cogVerbs = []string{
+	"ActivateBin",
+	"ActivateWeapon",
+	"AddDynamicAdd",
+	"AddDynamicTint",
+	"AddScoreToTeamMembers",
+	"AddThingVel",
+	"AIAddAlignmentPriority",
+	"AiClearMode",
+	"AiFlee",
+	"AIGetAlignment",
+	"AIGetInterest",
+	"AiGetMode",
+	"AiGetMovePos",
+	"AiJump",
+	"AIRemoveAlignmentPriority",
+	"AISetAlignment",
+	"AiSetClass",
+	"AISetDistractor",
+	"AiSetFireTarget",
+	"AISetInterest",
+	"AiSetLookFrame",
+	"AiSetLookPos",
+	"AiSetMode",
+	"AiSetMoveFrame",
+	"AiSetMovePos",
+	"AiSetMoveSpeed",
+	"AiSetMoveThing",
+	"AmputateJoint",
+	"ApplyForce",
+	"AssignWeapon",
+	"AttachThingtosurf",
+	"AttachThingtoThing",
+	"AttachThingtoThingEx",
+	"AutoSaveGame",
+	"AutoSelectWeapon",
+	"BitClear",
+	"BitSet",
+	"BitTest",
+	"CaptureThing",
+	"ChangeAllSectorslight",
+	"ChangeFireRate",
+	"ChangeInv",
+	"ChangeSoundPitch",
+	"ChangeSoundVol",
+	"ClearActorFlags",
+	"ClearAdjoinFlags",
+	"ClearCogFlags",
+	"ClearDebugModeFlags",
+	"ClearExplosionFlags",
+	"ClearFaceType",
+	"ClearGoalFlags",
+	"ClearItemFlags",
+	"ClearMapModeFlags",
+	"ClearMultiModeFlags",
+	"ClearParticleFlags",
+	"ClearPhysicsFlags",
+	"ClearSectorFlags",
+	"ClearSubModeFlags",
+	"ClearSurfaceFlags",
+	"ClearThingAttachFlags",
+	"ClearThingFlags",
+	"ClearTypeFlags",
+	"ClearWeaponFlags",
+	"CreateBackpack",
+	"CreateThing",
+	"CreateThingatPos",
+	"CreateThingatPosnr",
+	"CreateThingAtPosOld",
+	"CreateThingAtPosOwner",
+	"CreateThingLocal",
+	"CreateThingnr",
+	"CycleCamera",
+	"DamageThing",
+	"DeactivateBin",
+	"DeactivateWeapon",
+	"DestroyThing",
+	"DetachThing",
+	"DisableIrMode",
+	"EnableIrMode",
+	"FindSectoratPos",
+	"FireProjectile",
+	"FireProjectileData",
+	"FireProjectileLocal",
+	"FirstThingInCone",
+	"FirstThingInSector",
+	"FirstThingInView",
+	"FreeColorEffect",
+	"GetAbsoluteMaxPlayers",
+	"GetActionCog",
+	"GetActorFlags",
+	"GetActorHeadPYR",
+	"GetActorWeapon",
+	"GetActorWeapon2",
+	"GetAdjoinFlags",
+	"GetArmedMode",
+	"GetAutoPickup",
+	"GetAutoReload",
+	"GetAutoSwitch",
+	"GetCameraStateFlags",
+	"GetCeilingSkyOffset",
+	"GetCogFlags",
+	"GetCollideType",
+	"GetCurFrame",
+	"GetCurInvWeapon",
+	"GetCurInvWeapon2",
+	"GetCurrentCamera",
+	"GetCurWeapon",
+	"GetCurWeaponMode",
+	"GetDebugModeFlags",
+	"GetDifficulty",
+	"GetExplosionFlags",
+	"GetFaceGeoMode",
+	"GetFaceLightMode",
+	"GetFaceTexMode",
+	"GetFaceType",
+	"GetFlexGameTime",
+	"GetGameTime",
+	"GetGoalFlags",
+	"GetGoalFrame",
+	"GetGravity",
+	"GetGuidThing",
+	"GetHeadLightIntensity",
+	"GetHorizonSkyOffset",
+	"GetInv",
+	"GetInvCog",
+	"GetInvFlags",
+	"GetInvMax",
+	"GetInvMin",
+	"GetItemFlags",
+	"GetKeyLen",
+	"GetLevelTime",
+	"GetLocalPlayerThing",
+	"GetMajorMode",
+	"GetMapModeFlags",
+	"GetMasterCog",
+	"GetMaterialCel",
+	"GetMaxPlayers",
+	"GetMultiModeFlags",
+	"GetNumPlayers",
+	"GetNumPlayersInTeam",
+	"GetNumSectorSurfaces",
+	"GetNumSectorVertices",
+	"GetNumSurfaceVertices",
+	"GetParam",
+	"GetParticleFlags",
+	"GetParticleGrowthSpeed",
+	"GetParticleSize",
+	"GetParticleTimeOutRate",
+	"GetPhysicsFlags",
+	"GetPlayerKilled",
+	"GetPlayerKills",
+	"GetPlayerNum",
+	"GetPlayerScore",
+	"GetPlayerSuicides",
+	"GetPlayerTeam",
+	"GetPlayerThing",
+	"GetPrimaryFocus",
+	"GetRespawnMask",
+	"GetScoreLimit",
+	"GetSecondaryFocus",
+	"GetSectorAmbientLight",
+	"GetSectorCenter",
+	"GetSectorColormap",
+	"GetSectorCount",
+	"GetSectorFlags",
+	"GetSectorLight",
+	"GetSectorPlayerCount",
+	"GetSectorSurfaceRef",
+	"GetSectorThingCount",
+	"GetSectorThrust",
+	"GetSectorTint",
+	"GetSectorVertexPos",
+	"GetSelfCog",
+	"GetSenderId",
+	"GetSenderRef",
+	"GetSenderType",
+	"GetSithMode",
+	"GetSoundLen",
+	"GetSourceRef",
+	"GetSourceType",
+	"GetSubModeFlags",
+	"GetSurfaceAdjoin",
+	"GetSurfaceAnim",
+	"GetSurfaceCel",
+	"GetSurfaceCenter",
+	"GetSurfaceCount",
+	"GetSurfaceFlags",
+	"GetSurfaceLight",
+	"GetSurfaceMat",
+	"GetSurfaceNormal",
+	"GetSurfaceSector",
+	"GetSurfaceVertexLight",
+	"GetSurfaceVertexLightRGB",
+	"GetSurfaceVertexPos",
+	"GetSysDate",
+	"GetSysTime",
+	"GetTeamScore",
+	"GetThingAttachFlags",
+	"GetThingCaptureCog",
+	"GetThingClassCog",
+	"GetThingCollideSize",
+	"GetThingCount",
+	"GetThingCurGeoMode",
+	"GetThingCurLightMode",
+	"GetThingCurTexMode",
+	"GetThingFireOffset",
+	"GetThingFlags",
+	"GetThingGeoMode",
+	"GetThingGuid",
+	"GetThingHeadLVec",
+	"GetThingHealth",
+	"GetThingJointAngle",
+	"GetThinglight",
+	"GetThingLightMode",
+	"GetThingLVec",
+	"GetThingLvecPYR",
+	"GetThingMass",
+	"GetThingMaxAngularVelocity",
+	"GetThingMaxVelocity",
+	"GetThingModel",
+	"GetThingMoveSize",
+	"GetThingParent",
+	"GetThingPos",
+	"GetThingRespawn",
+	"GetThingRotVel",
+	"GetThingRVec",
+	"GetThingSector",
+	"GetThingSignature",
+	"GetThingTemplate",
+	"GetThingTemplateCount",
+	"GetThingTexMode",
+	"GetThingThrust",
+	"GetThingType",
+	"GetThingUserData",
+	"GetThingUVec",
+	"GetThingVel",
+	"GetTimeLimit",
+	"GetTypeFlags",
+	"GetWallCel",
+	"GetWeaponBin",
+	"GetWeaponFlags",
+	"GetWeaponPriority",
+	"HealThing",
+	"HeapFree",
+	"HeapGet",
+	"HeapNew",
+	"HeapSet",
+	"InterpolatePYR",
+	"IsAiTargetInSight",
+	"IsInvActivated",
+	"IsInvAvailable",
+	"IsMulti",
+	"IsServer",
+	"IsSphereInSector",
+	"IsThingCrouching",
+	"IsThingMoving",
+	"IsThingVisible",
+	"jkBeginCutscene",
+	"jkClearFlags",
+	"jkClearSuperFlags",
+	"jkCreateBubble",
+	"jkDestroyBubble",
+	"jkDisableSaber",
+	"jkEnableSaber",
+	"jkEndCutscene",
+	"jkEndLevel",
+	"jkEndTarGet",
+	"jkGetBubbleDistance",
+	"jkGetBubbleRadius",
+	"jkGetBubbleType",
+	"jkGetChoice",
+	"jkGetFirstBubble",
+	"jkGetFlags",
+	"jkGetMultiParamInsideLeia",
+	"jkGetNextBubble",
+	"jkGetOpenFrames",
+	"jkGetSaberCam",
+	"jkGetSaberSidemat",
+	"jkGetSuperFlags",
+	"jkPlayPovKey",
+	"jkPrintUniString",
+	"jkPrintUniVoice",
+	"jkScreenShot",
+	"jkSetBubbleRadius",
+	"jkSetBubbleType",
+	"jkSetFlags",
+	"jkSetPersuasionInfo",
+	"jkSetPovModel",
+	"jkSetSaberInfo",
+	"jkSetSuperFlags",
+	"jkSetTarGet",
+	"jkSetTarGetColors",
+	"jkSetWaggle",
+	"jkSetWeaponMesh",
+	"jkStartupCutscene",
+	"jkStopPovKey",
+	"jkStringClear",
+	"jkStringConcatAsciiString",
+	"jkStringConcatFlex",
+	"jkStringConcatFormattedFlex",
+	"jkStringConcatFormattedInt",
+	"jkStringConcatInt",
+	"jkStringConcatPlayerName",
+	"jkStringConcatSpace",
+	"jkStringConcatUniString",
+	"jkStringConcatVector",
+	"jkStringOutput",
+	"jkSyncForcePowers",
+	"jkThingInBubble",
+	"JumpToFrame",
+	"KillPlayerQuietly",
+	"KillTimerEx",
+	"MaterialAnim",
+	"ModifyColorEffect",
+	"MoveToFrame",
+	"NextThingInCone",
+	"NextThingInSector",
+	"NextThingInView",
+	"NthBackpackBin",
+	"NthBackpackValue",
+	"NumBackpackItems",
+	"ParseArg",
+	"PathMovePause",
+	"PathMoveResume",
+	"PickupBackpack",
+	"PlayKey",
+	"PlayMode",
+	"PlaySong",
+	"PlaySoundClass",
+	"PlaySoundGlobal",
+	"PlaySoundLocal",
+	"PlaySoundPos",
+	"PlaySoundPosLocal",
+	"PlaySoundThing",
+	"PlaySoundThingLocal",
+	"PlayVoiceGlobal",
+	"PlayVoiceLocal",
+	"PlayVoicePos",
+	"PlayVoiceThing",
+	"PrevThingInSector",
+	"Print",
+	"PrintFlex",
+	"PrintInt",
+	"PrintVector",
+	"RadiusReturnex",
+	"Rand",
+	"RandVec",
+	"ReleaseThing",
+	"ReturnEx",
+	"RotatePivot",
+	"SectorSound",
+	"SelectWeapon",
+	"SendMessage",
+	"SendMessageEx",
+	"SendMessageRadius",
+	"SendTrigger",
+	"SetActionCog",
+	"SetActorExtraSpeed",
+	"SetActorFlags",
+	"SetActorHeadPYR",
+	"SetActorWeapon",
+	"SetAdjoinFlags",
+	"SetArmedMode",
+	"SetAutoPickup",
+	"SetAutoReload",
+	"SetAutoSwitch",
+	"SetBinWait",
+	"SetBitTest",
+	"SetCameraFocus",
+	"SetCameraStateFlags",
+	"SetCameraZoom",
+	"SetCeilingSkyOffset",
+	"SetCogFlags",
+	"SetCollideType",
+	"SetCurInvWeapon",
+	"SetCurrentCamera",
+	"SetCurWeapon",
+	"SetDebugModeFlags",
+	"SetExplosionFlags",
+	"SetFaceGeoMode",
+	"SetFaceLightMode",
+	"SetFaceTexMode",
+	"SetFaceType",
+	"SetFireWait",
+	"SetGoalFlags",
+	"SetGravity",
+	"SetHeadLightIntensity",
+	"SetHorizonSkyOffset",
+	"SetInv",
+	"SetInvActivated",
+	"SetInvAvailable",
+	"SetInvChangeInv",
+	"SetInvFlags",
+	"SetItemFlags",
+	"SetMapModeFlags",
+	"SetMasterCog",
+	"SetMaterialCel",
+	"SetMountWait",
+	"SetMultiModeFlags",
+	"SetMusicVol",
+	"SetParam",
+	"SetParamWorldFlash",
+	"SetParticleFlags",
+	"SetParticleGrowthSpeed",
+	"SetParticleSize",
+	"SetParticleTimeOutRate",
+	"SetPhysicsFlags",
+	"SetPlayerKilled",
+	"SetPlayerKills",
+	"SetPlayerScore",
+	"SetPlayerSuicides",
+	"SetPlayerTeam",
+	"SetPovShake",
+	"SetPulse",
+	"SetRespawnMask",
+	"SetScoreLimit",
+	"SetSectorAdjoins",
+	"SetSectorAmbientLight",
+	"SetSectorColormap",
+	"SetSectorFlags",
+	"SetSectorLight",
+	"SetSectorThrust",
+	"SetSectorTint",
+	"SetSlideHorizonSky",
+	"SetSubModeFlags",
+	"SetSurfaceCel",
+	"SetSurfaceFlags",
+	"SetSurfaceLight",
+	"SetSurfaceMat",
+	"SetSurfaceVertexLight",
+	"SetSurfaceVertexLightrgb",
+	"SetTeamScore",
+	"SetThingAttachFlags",
+	"SetThingCaptureCog",
+	"SetThingClassCog",
+	"SetThingCollideSize",
+	"SetThingCurGeoMode",
+	"SetThingCurLightMode",
+	"SetThingCurTexMode",
+	"SetThingFireOffset",
+	"SetThingFlags",
+	"SetThingGeoMode",
+	"SetThingHealth",
+	"SetThingJointAngle",
+	"SetThingLight",
+	"SetThingLightMode",
+	"SetThingLook",
+	"SetThinglookPYR",
+	"SetThingMass",
+	"SetThingMaxAngularVelocity",
+	"SetThingMaxHeadPitch",
+	"SetThingMaxVelocity",
+	"SetThingMinHeadPitch",
+	"SetThingModel",
+	"SetThingMoveSize",
+	"SetThingParent",
+	"SetThingPos",
+	"SetThingPosex",
+	"SetThingPulse",
+	"SetThingRotVel",
+	"SetThingTexMode",
+	"SetThingThrust",
+	"SetThingTimer",
+	"SetThingType",
+	"SetThingUserData",
+	"SetThingVel",
+	"SetTimeLimit",
+	"SetTimer",
+	"SetTimerex",
+	"SetTypeFlags",
+	"SetVectorLen",
+	"SetWallCel",
+	"SetWeaponFlags",
+	"SetWeaponTarget",
+	"SkillTarget",
+	"SkipToFrame",
+	"Sleep",
+	"SleepPow",
+	"SlideCeilingSky",
+	"SlideHorizonSky",
+	"SlideSurface",
+	"SlideWall",
+	"StopAnim",
+	"StopKey",
+	"StopSound",
+	"StopSurfaceAnim",
+	"StopThing",
+	"SurfaceAnim",
+	"SurfaceLightAnim",
+	"SyncScores",
+	"SyncSector",
+	"SyncSurface",
+	"SyncThingAttachment",
+	"SyncThingPos",
+	"SyncThingState",
+	"TakeItem",
+	"TeleportThing",
+	"ThingLightAnim",
+	"ThingViewDot",
+	"VectorAdd",
+	"VectorCross",
+	"VectorDist",
+	"VectorDot",
+	"VectorEqual",
+	"VectorLen",
+	"VectorNorm",
+	"VectorScale",
+	"VectorSet",
+	"VectorSub",
+	"VectorX",
+	"VectorY",
+	"VectorZ",
+	"WaitForStop",
+	"Wakeup",
+}
+
+var cogVerbSet = make(map[string]bool)
+
+func init() {
+	for _, verb := range cogVerbs {
+		cogVerbSet[strings.ToLower(verb)] = true
+	}
+}
+
+// IsCogVerb reports whether name is a verb provided by the engine.
+func IsCogVerb(name string) bool {
+	return cogVerbSet[strings.ToLower(name)]
+}
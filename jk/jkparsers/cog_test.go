@@ -0,0 +1,111 @@
+package jkparsers
+
+import (
+	"github.com/joelhays/go-jk/jk"
+	"github.com/joelhays/go-jk/jk/jktypes"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+)
+
+// installLoader returns a loader for the game install JK_INSTALL_DIR points to,
+// skipping the test when it is not set.
+func installLoader(t *testing.T) *jk.Loader {
+	dir := os.Getenv(jk.InstallDirEnv)
+	if dir == "" {
+		t.Skipf("%s is not set", jk.InstallDirEnv)
+	}
+	loader, err := jk.NewLoader(jk.Config{InstallDir: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		loader.Close()
+	})
+	return loader
+}
+
+func TestCogRoundTrip(t *testing.T) {
+	source, err := ioutil.ReadFile("../../_testfiles/force_heal.cog")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p := NewCogParser()
+	cog, diagnostics := checkCogRoundTrip(t, p, "force_heal.cog", string(source))
+	for _, diagnostic := range diagnostics {
+		t.Errorf("diagnostic: %v", diagnostic)
+	}
+	if len(cog.Symbols) == 0 || len(cog.Code) == 0 {
+		t.Errorf("parsed %d symbols and %d statements", len(cog.Symbols), len(cog.Code))
+	}
+}
+
+func TestCogRoundTripInstall(t *testing.T) {
+	loader := installLoader(t)
+	manifest := loader.LoadManifest("cog")
+	if len(manifest) == 0 {
+		t.Fatal("the install has no cogs")
+	}
+
+	p := NewCogParser()
+	for _, name := range manifest {
+		fileBytes := loader.LoadResource(name)
+		if fileBytes == nil {
+			t.Errorf("%s could not be read", name)
+			continue
+		}
+		checkCogRoundTrip(t, p, name, string(fileBytes))
+	}
+}
+
+// checkCogRoundTrip parses source, formats it and parses that again, which has
+// to give the same tree. It returns the cog and diagnostics of the source.
+func checkCogRoundTrip(t *testing.T, p *CogParser, name string, source string) (jktypes.Cog, []*ParseError) {
+	t.Helper()
+	p.SetFileName(name)
+	cog, err := p.ParseFromString(source)
+	if err != nil {
+		t.Errorf("%s: %v", name, err)
+		return cog, nil
+	}
+	diagnostics := p.Diagnostics()
+
+	formatted := FormatCog(&cog)
+	p.SetFileName("formatted " + name)
+	reparsed, err := p.ParseFromString(formatted)
+	if err != nil {
+		t.Errorf("%s: %v\n%s", name, err, formatted)
+		return cog, diagnostics
+	}
+
+	// the formatted source puts everything on other lines
+	clearCogPositions(reflect.ValueOf(&cog))
+	clearCogPositions(reflect.ValueOf(&reparsed))
+	if !reflect.DeepEqual(cog, reparsed) {
+		t.Errorf("%s: the tree of the formatted cog differs from the tree of the source\n%s", name, formatted)
+	}
+	return cog, diagnostics
+}
+
+func clearCogPositions(v reflect.Value) {
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if !v.IsNil() {
+			clearCogPositions(v.Elem())
+		}
+	case reflect.Slice:
+		for i := 0; i < v.Len(); i++ {
+			clearCogPositions(v.Index(i))
+		}
+	case reflect.Struct:
+		if v.Type() == reflect.TypeOf(jktypes.CogPos{}) {
+			v.Set(reflect.Zero(v.Type()))
+			return
+		}
+		for i := 0; i < v.NumField(); i++ {
+			clearCogPositions(v.Field(i))
+		}
+	}
+}
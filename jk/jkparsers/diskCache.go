@@ -0,0 +1,129 @@
+package jkparsers
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/binary"
+	"encoding/gob"
+	"encoding/hex"
+	"github.com/joelhays/go-jk/jk/jktypes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// diskCacheVersion must be increased whenever the cached types or the way they
+// are parsed change, entries written by other versions are ignored.
+const diskCacheVersion = 1
+
+var diskCacheMagic = [4]byte{'J', 'K', 'P', 'C'}
+
+type diskCacheHeader struct {
+	Magic    [4]byte
+	Version  uint32
+	Checksum [sha1.Size]byte // of the source file the entry was parsed from
+}
+
+// DiskCache keeps parsed levels and models on disk so they can be loaded again
+// without parsing their text. There is one entry per file name holding the
+// checksum of the source it was parsed from, an entry whose source changed,
+// e.g. after the GOB was patched, is parsed again and replaced. Materials and
+// colormaps are not cached, they are binary and decoded through the asset cache.
+type DiskCache struct {
+	dir string
+}
+
+// NewDiskCache creates a cache storing its entries below dir.
+func NewDiskCache(dir string) (*DiskCache, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &DiskCache{dir: dir}, nil
+}
+
+// Clear removes every entry.
+func (c *DiskCache) Clear() error {
+	entries, err := ioutil.ReadDir(c.dir)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if err := os.RemoveAll(filepath.Join(c.dir, entry.Name())); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *DiskCache) path(kind string, name string) string {
+	sum := sha1.Sum([]byte(strings.ToLower(strings.Replace(name, "\\", "/", -1))))
+	return filepath.Join(c.dir, kind, hex.EncodeToString(sum[:]))
+}
+
+// load decodes the entry for name into value when it was parsed from source.
+func (c *DiskCache) load(kind string, name string, source []byte, value interface{}) bool {
+	file, err := os.Open(c.path(kind, name))
+	if err != nil {
+		return false
+	}
+	defer file.Close()
+
+	r := bufio.NewReader(file)
+	var header diskCacheHeader
+	if err := binary.Read(r, binary.LittleEndian, &header); err != nil {
+		return false
+	}
+	if header.Magic != diskCacheMagic || header.Version != diskCacheVersion || header.Checksum != sha1.Sum(source) {
+		return false
+	}
+	return gob.NewDecoder(r).Decode(value) == nil
+}
+
+// store replaces the entry for name. The entry is written next to the old one
+// and renamed over it, so readers never see a partial entry.
+func (c *DiskCache) store(kind string, name string, source []byte, value interface{}) error {
+	entryPath := c.path(kind, name)
+	if err := os.MkdirAll(filepath.Dir(entryPath), 0755); err != nil {
+		return err
+	}
+	temp, err := ioutil.TempFile(filepath.Dir(entryPath), filepath.Base(entryPath)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(temp.Name())
+
+	w := bufio.NewWriter(temp)
+	header := diskCacheHeader{Magic: diskCacheMagic, Version: diskCacheVersion, Checksum: sha1.Sum(source)}
+	err = binary.Write(w, binary.LittleEndian, header)
+	if err == nil {
+		err = gob.NewEncoder(w).Encode(value)
+	}
+	if err == nil {
+		err = w.Flush()
+	}
+	if closeErr := temp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(temp.Name(), entryPath)
+}
+
+// cachedLevel is a parsed level without the assets it loads: its materials only
+// keep their name and tiling, its colormaps and models are listed by name.
+type cachedLevel struct {
+	Level     jktypes.Jkl
+	ColorMaps []string
+	Models    []string
+}
+
+// materialRefs strips materials down to what the file using them sets.
+func materialRefs(materials []jktypes.Material) []jktypes.Material {
+	refs := make([]jktypes.Material, len(materials))
+	for i, material := range materials {
+		refs[i] = jktypes.Material{Name: material.Name, XTile: material.XTile, YTile: material.YTile}
+	}
+	return refs
+}
@@ -0,0 +1,115 @@
+package jkparsers
+
+import (
+	"encoding/binary"
+	"github.com/joelhays/go-jk/jk/jktypes"
+	"io/ioutil"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const diskCacheTestLevel = "jkl/m_boss15.jkl"
+
+func newTestDiskCache(t *testing.T) *DiskCache {
+	cache, err := NewDiskCache(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cache
+}
+
+func parseCachedLevel(t *testing.T, cache *DiskCache, source string) jktypes.Jkl {
+	t.Helper()
+	resolver, _ := testFilesResolver(t)
+	p := NewJklLineParser(resolver)
+	p.SetFileName(diskCacheTestLevel)
+	p.SetDiskCache(cache)
+	level, err := p.ParseFromString(source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return level
+}
+
+// storeMarkedLevel replaces the entry of the test level by one with a single
+// sector, so levels loaded from it are told apart from parsed ones.
+func storeMarkedLevel(t *testing.T, cache *DiskCache, source string) {
+	t.Helper()
+	cached := cachedLevel{Level: jktypes.Jkl{Model: &jktypes.JkMesh{}, Sectors: make([]jktypes.Sector, 1)}}
+	if err := cache.store("jkl", diskCacheTestLevel, []byte(source), cached); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDiskCacheWarmLoad(t *testing.T) {
+	_, files := testFilesResolver(t)
+	source := string(files[diskCacheTestLevel])
+	cache := newTestDiskCache(t)
+
+	parsed := parseCachedLevel(t, cache, source)
+	var cached cachedLevel
+	if !cache.load("jkl", diskCacheTestLevel, []byte(source), &cached) {
+		t.Fatal("parsing the level did not store it")
+	}
+
+	loaded := parseCachedLevel(t, cache, source)
+	if !reflect.DeepEqual(parsed.Sectors, loaded.Sectors) || !reflect.DeepEqual(parsed.Things, loaded.Things) ||
+		!reflect.DeepEqual(parsed.Model.Surfaces, loaded.Model.Surfaces) || !reflect.DeepEqual(parsed.Model.Materials, loaded.Model.Materials) {
+		t.Errorf("the level loaded from cache differs from the parsed one")
+	}
+	if !reflect.DeepEqual(parsed.Jk3dos, loaded.Jk3dos) {
+		t.Errorf("the level loaded from cache has other 3dos than the parsed one")
+	}
+
+	storeMarkedLevel(t, cache, source)
+	if level := parseCachedLevel(t, cache, source); len(level.Sectors) != 1 {
+		t.Errorf("got %d sectors, expected the level of the cache entry", len(level.Sectors))
+	}
+}
+
+func TestDiskCacheSourceChanged(t *testing.T) {
+	_, files := testFilesResolver(t)
+	source := string(files[diskCacheTestLevel])
+	cache := newTestDiskCache(t)
+	storeMarkedLevel(t, cache, source)
+
+	changed := strings.Replace(source, "AMBIENT LIGHT\t7.98", "AMBIENT LIGHT\t3.50", 1)
+	level := parseCachedLevel(t, cache, changed)
+	if len(level.Sectors) != 68 || level.Sectors[0].AmbientLight != 3.5 {
+		t.Errorf("got %d sectors after the source changed, expected the 68 parsed with the new light", len(level.Sectors))
+	}
+
+	var cached cachedLevel
+	if cache.load("jkl", diskCacheTestLevel, []byte(source), &cached) {
+		t.Errorf("the entry of the old source was not replaced")
+	}
+	if !cache.load("jkl", diskCacheTestLevel, []byte(changed), &cached) || len(cached.Level.Sectors) != 68 {
+		t.Errorf("the changed source was not stored")
+	}
+}
+
+func TestDiskCacheVersionMismatch(t *testing.T) {
+	_, files := testFilesResolver(t)
+	source := string(files[diskCacheTestLevel])
+	cache := newTestDiskCache(t)
+	storeMarkedLevel(t, cache, source)
+
+	entryPath := cache.path("jkl", diskCacheTestLevel)
+	entry, err := ioutil.ReadFile(entryPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	binary.LittleEndian.PutUint32(entry[len(diskCacheMagic):], diskCacheVersion+1)
+	if err := ioutil.WriteFile(entryPath, entry, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var cached cachedLevel
+	if cache.load("jkl", diskCacheTestLevel, []byte(source), &cached) {
+		t.Errorf("an entry of another version was loaded")
+	}
+	if level := parseCachedLevel(t, cache, source); len(level.Sectors) != 68 {
+		t.Errorf("got %d sectors, expected the 68 parsed instead of the entry of another version", len(level.Sectors))
+	}
+}
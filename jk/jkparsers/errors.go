@@ -0,0 +1,114 @@
+package jkparsers
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrMalformed is wrapped by errors describing input that doesn't match the expected format.
+var ErrMalformed = errors.New("malformed input")
+
+var (
+	// ErrUndeclaredSymbol is wrapped by COG diagnostics for names missing from the symbols section.
+	ErrUndeclaredSymbol = errors.New("undeclared symbol")
+	// ErrUnknownVerb is wrapped by COG diagnostics for calls to verbs the engine doesn't provide.
+	ErrUnknownVerb = errors.New("unknown verb")
+	// ErrUndefinedLabel is wrapped by COG diagnostics for calls to labels missing from the code section.
+	ErrUndefinedLabel = errors.New("undefined label")
+)
+
+// ParseError describes malformed input found while parsing an asset. Text
+// formats report the 1-based line number, binary formats the byte offset.
+// Column is only set by parsers that track it.
+type ParseError struct {
+	File    string
+	Line    int
+	Column  int
+	Offset  int
+	Section string
+	Err     error
+}
+
+func (e *ParseError) Error() string {
+	var sb strings.Builder
+
+	if e.File != "" {
+		sb.WriteString(e.File)
+	} else {
+		sb.WriteString("<input>")
+	}
+
+	if e.Line > 0 {
+		fmt.Fprintf(&sb, ":%d", e.Line)
+		if e.Column > 0 {
+			fmt.Fprintf(&sb, ":%d", e.Column)
+		}
+	} else {
+		fmt.Fprintf(&sb, "@%#x", e.Offset)
+	}
+
+	if e.Section != "" {
+		fmt.Fprintf(&sb, " [%s]", e.Section)
+	}
+
+	fmt.Fprintf(&sb, ": %v", e.Err)
+
+	return sb.String()
+}
+
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
+
+// parseContext tracks the position within the input so errors can report where they occurred.
+type parseContext struct {
+	fileName string
+	lineNum  int
+	offset   int
+	section  string
+}
+
+// SetFileName sets the file name reported by parse errors.
+func (c *parseContext) SetFileName(fileName string) {
+	c.fileName = fileName
+}
+
+func (c *parseContext) reset() {
+	c.lineNum = 0
+	c.offset = 0
+	c.section = ""
+}
+
+func (c *parseContext) errorf(format string, a ...interface{}) error {
+	return c.wrapError(fmt.Errorf(format, a...))
+}
+
+func (c *parseContext) malformed(what string, line string) error {
+	return c.wrapError(fmt.Errorf("%w: expected %s, got %q", ErrMalformed, what, line))
+}
+
+func (c *parseContext) wrapError(err error) error {
+	if err == nil {
+		return nil
+	}
+	var parseErr *ParseError
+	if errors.As(err, &parseErr) {
+		return err
+	}
+	return &ParseError{File: c.fileName, Line: c.lineNum, Offset: c.offset, Section: c.section, Err: err}
+}
+
+func requireArgs(args []string, count int) error {
+	if len(args) < count {
+		return fmt.Errorf("%w: expected at least %d fields, got %d", ErrMalformed, count, len(args))
+	}
+	return nil
+}
+
+func (c *parseContext) scanLine(line string, format string, a ...interface{}) error {
+	if _, err := fmt.Sscanf(line, format, a...); err != nil {
+		return c.malformed(fmt.Sprintf("%q", format), line)
+	}
+	return nil
+}
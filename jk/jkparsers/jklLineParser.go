@@ -13,32 +13,63 @@ import (
 )
 
 type JklLineParser struct {
-	jkl     jktypes.Jkl
-	scanner *bufio.Scanner
-	line    string
-	done    bool
-	section string
+	parseContext
+	resolver  jk.ResourceResolver
+	assets    *AssetLease
+	cache     *DiskCache
+	lease     *AssetLease
+	jkl       jktypes.Jkl
+	templates map[string]jktypes.Template
+	colorMaps []string
+	materials []string
+	models    []string
+	scanner   *bufio.Scanner
+	line      string
+	done      bool
 }
 
-func NewJklLineParser() *JklLineParser {
-	p := &JklLineParser{}
+func NewJklLineParser(resolver jk.ResourceResolver) *JklLineParser {
+	p := &JklLineParser{resolver: resolver}
 	p.init("")
 	return p
 }
 
-func (p *JklLineParser) ParseFromFile(filePath string) jktypes.Jkl {
+// SetAssets makes the parser load the colormaps, materials and models of levels
+// through lease, sharing them with whatever else uses its cache. Without it each
+// level gets its own cache.
+func (p *JklLineParser) SetAssets(lease *AssetLease) {
+	p.assets = lease
+}
+
+// SetDiskCache makes the parser keep the levels it parses in cache and load them
+// from it when their source did not change. The file name set with SetFileName
+// identifies the level in the cache.
+func (p *JklLineParser) SetDiskCache(cache *DiskCache) {
+	p.cache = cache
+}
+
+func (p *JklLineParser) ParseFromFile(filePath string) (jktypes.Jkl, error) {
 	bytes, err := ioutil.ReadFile(filePath)
 	if err != nil {
-		log.Fatal(err)
+		return jktypes.Jkl{}, err
 	}
 	data := string(bytes)
 
+	p.SetFileName(filePath)
 	return p.ParseFromString(data)
 }
 
-func (p *JklLineParser) ParseFromString(jklString string) jktypes.Jkl {
+func (p *JklLineParser) ParseFromString(jklString string) (jktypes.Jkl, error) {
 	p.init(jklString)
 
+	useCache := p.cache != nil && p.fileName != ""
+	if useCache {
+		var cached cachedLevel
+		if p.cache.load("jkl", p.fileName, []byte(jklString), &cached) {
+			return p.loadCached(cached)
+		}
+	}
+
 	p.scanner.Text()
 	for {
 		section, ok := p.advanceToNextSection()
@@ -46,26 +77,90 @@ func (p *JklLineParser) ParseFromString(jklString string) jktypes.Jkl {
 			break
 		}
 
+		var err error
 		switch section {
 		case "jk":
 		case "copyright":
 		case "header":
 		case "sounds":
 		case "materials":
-			p.parseMaterials()
+			err = p.parseMaterials()
 		case "georesource":
-			p.parseGeoResource()
+			err = p.parseGeoResource()
 		case "sectors":
+			err = p.parseSectors()
 		case "models":
-			p.parseModels()
+			err = p.parseModels()
 		case "templates":
-			p.parseTemplates()
+			err = p.parseTemplates()
 		case "things":
-			p.parseThings()
+			err = p.parseThings()
+		case "cogs":
+			err = p.parseCogs()
+		}
+		if err != nil {
+			return jktypes.Jkl{}, err
 		}
 	}
 
-	return p.jkl
+	if err := p.linkSectors(); err != nil {
+		return jktypes.Jkl{}, err
+	}
+
+	if useCache {
+		if err := p.cache.store("jkl", p.fileName, []byte(jklString), p.cachedLevel()); err != nil {
+			log.Println(err)
+		}
+	}
+
+	return p.jkl, nil
+}
+
+func (p *JklLineParser) cachedLevel() cachedLevel {
+	cached := cachedLevel{Level: p.jkl, ColorMaps: p.colorMaps}
+	model := *p.jkl.Model
+	model.Materials = materialRefs(model.Materials)
+	model.ColorMaps = nil
+	cached.Level.Model = &model
+	cached.Level.Jk3dos = nil
+	for name := range p.jkl.Jk3dos {
+		cached.Models = append(cached.Models, name)
+	}
+	return cached
+}
+
+// loadCached loads the assets of a level read from the disk cache.
+func (p *JklLineParser) loadCached(cached cachedLevel) (jktypes.Jkl, error) {
+	p.jkl = cached.Level
+	if p.jkl.Model == nil {
+		p.jkl.Model = &jktypes.JkMesh{}
+	}
+	p.jkl.Jk3dos = make(map[string]jktypes.Jk3doFile)
+	if p.jkl.Jk3doTemplates == nil {
+		p.jkl.Jk3doTemplates = make(map[string]jktypes.Template)
+	}
+
+	for _, name := range cached.ColorMaps {
+		colorMap, err := p.lease.ColorMap(name)
+		if err != nil {
+			return jktypes.Jkl{}, err
+		}
+		p.colorMaps = append(p.colorMaps, name)
+		p.jkl.Model.ColorMaps = append(p.jkl.Model.ColorMaps, colorMap)
+	}
+
+	for _, material := range p.jkl.Model.Materials {
+		p.materials = append(p.materials, material.Name)
+	}
+	if err := p.loadMaterials(); err != nil {
+		return jktypes.Jkl{}, err
+	}
+
+	p.models = cached.Models
+	if err := p.loadModels(); err != nil {
+		return jktypes.Jkl{}, err
+	}
+	return p.jkl, nil
 }
 
 func (p *JklLineParser) init(jklString string) {
@@ -75,16 +170,18 @@ func (p *JklLineParser) init(jklString string) {
 		Jk3doTemplates: make(map[string]jktypes.Template),
 		Things:         nil,
 	}
+	p.templates = make(map[string]jktypes.Template)
+	p.lease = p.assets
+	if p.lease == nil {
+		p.lease = NewAssetCache(p.resolver, 0).NewLease()
+	}
+	p.colorMaps = nil
+	p.materials = nil
+	p.models = nil
 	p.scanner = bufio.NewScanner(strings.NewReader(jklString))
 	p.line = ""
 	p.done = false
-	p.section = ""
-}
-
-func (p *JklLineParser) checkError(err error) {
-	if err != nil {
-		log.Fatal(err)
-	}
+	p.reset()
 }
 
 func (p *JklLineParser) atEndOfSection() bool {
@@ -139,6 +236,7 @@ func (p *JklLineParser) getNextLine() (string, bool) {
 			p.done = true
 			break
 		}
+		p.lineNum++
 		line := p.scanner.Text()
 		line = strings.TrimSpace(line)
 		line = strings.ToLower(line)
@@ -167,13 +265,13 @@ func (p *JklLineParser) getLineArgsWithoutPrefix(line string, ignore string) []s
 	return strings.Fields(line)
 }
 
-func (p *JklLineParser) processSection(callback func(string)) {
-	p.processNLines(-1, callback)
+func (p *JklLineParser) processSection(callback func(string) error) error {
+	return p.processNLines(-1, callback)
 }
 
-func (p *JklLineParser) processNLines(numToProcess int, callback func(string)) {
+func (p *JklLineParser) processNLines(numToProcess int, callback func(string) error) error {
 	if numToProcess == 0 {
-		return
+		return nil
 	}
 
 	numProcessed := 0
@@ -191,201 +289,441 @@ func (p *JklLineParser) processNLines(numToProcess int, callback func(string)) {
 			break
 		}
 
-		callback(line)
+		if err := callback(line); err != nil {
+			return p.wrapError(err)
+		}
 
 		numProcessed++
 	}
+
+	return nil
 }
 
-func (p *JklLineParser) parseGeoResource() {
-	p.processSection(func(line string) {
+func (p *JklLineParser) parseGeoResource() error {
+	return p.processSection(func(line string) error {
 		var count int
 		var args int
 		if args, _ = fmt.Sscanf(line, "world colormaps %d", &count); args == 1 {
-			p.processNLines(count, p.parseGeoResourceWorldColormap)
+			return p.processNLines(count, p.parseGeoResourceWorldColormap)
 		} else if args, _ = fmt.Sscanf(line, "world vertices %d", &count); args == 1 {
-			p.processNLines(count, func(l string) {
-				_, v := parseVec3(l)
+			return p.processNLines(count, func(l string) error {
+				_, v, err := parseVec3(l)
+				if err != nil {
+					return err
+				}
 				p.jkl.Model.Vertices = append(p.jkl.Model.Vertices, v)
+				return nil
 			})
 		} else if args, _ = fmt.Sscanf(line, "world texture vertices %d", &count); args == 1 {
-			p.processNLines(count, func(l string) {
-				_, v := parseVec2(l)
+			return p.processNLines(count, func(l string) error {
+				_, v, err := parseVec2(l)
+				if err != nil {
+					return err
+				}
 				p.jkl.Model.TextureVertices = append(p.jkl.Model.TextureVertices, v)
+				return nil
 			})
+		} else if args, _ = fmt.Sscanf(line, "world adjoins %d", &count); args == 1 {
+			return p.processNLines(count, p.parseGeoResourceWorldAdjoin)
 		} else if args, _ = fmt.Sscanf(line, "world surfaces %d", &count); args == 1 {
-			p.processNLines(count, p.parseGeoResourceWorldSurface)
-			p.processNLines(count, func(l string) {
-				id, v := parseVec3(l)
+			if err := p.processNLines(count, p.parseGeoResourceWorldSurface); err != nil {
+				return err
+			}
+			return p.processNLines(count, func(l string) error {
+				id, v, err := parseVec3(l)
+				if err != nil {
+					return err
+				}
+				if id < 0 || int(id) >= len(p.jkl.Model.Surfaces) {
+					return fmt.Errorf("%w: surface normal %d out of range", ErrMalformed, id)
+				}
 				p.jkl.Model.Surfaces[id].Normal = v
+				return nil
 			})
 		}
+		return nil
 	})
 }
 
-func (p *JklLineParser) parseGeoResourceWorldColormap(line string) {
+func (p *JklLineParser) parseGeoResourceWorldColormap(line string) error {
 	var id int32
 	var cmpName string
 	n, err := fmt.Sscanf(line, "%d: %s", &id, &cmpName)
-	p.checkError(err)
-	if n != 2 {
-		panic("Unable to get colormap information")
+	if err != nil || n != 2 {
+		return p.malformed("colormap", line)
 	}
 
-	var colorMap jktypes.ColorMap
-	fileBytes := jk.GetLoader().LoadResource(cmpName)
-	if fileBytes != nil {
-		colorMap = NewCmpParser().ParseFromBytes(fileBytes)
+	colorMap, err := p.lease.ColorMap(cmpName)
+	if err != nil {
+		return err
 	}
 
+	p.colorMaps = append(p.colorMaps, cmpName)
 	p.jkl.Model.ColorMaps = append(p.jkl.Model.ColorMaps, colorMap)
+	return nil
+}
+
+func (p *JklLineParser) parseGeoResourceWorldAdjoin(line string) error {
+	var id int32
+	var flags string
+	adjoin := jktypes.Adjoin{Surface: -1, Sector: -1}
+	n, err := fmt.Sscanf(line, "%d: %s %d %f", &id, &flags, &adjoin.Mirror, &adjoin.Distance)
+	if err != nil || n != 4 {
+		return p.malformed("world adjoin", line)
+	}
+	if adjoin.Flags, err = strconv.ParseInt(flags, 0, 64); err != nil {
+		return p.malformed("adjoin flags", line)
+	}
+
+	p.jkl.Model.Adjoins = append(p.jkl.Model.Adjoins, adjoin)
+	return nil
 }
 
-func (p *JklLineParser) parseGeoResourceWorldSurface(line string) {
+func (p *JklLineParser) parseGeoResourceWorldSurface(line string) error {
 	args := p.getLineArgs(line)
+	if err := requireArgs(args, 10); err != nil {
+		return err
+	}
 
 	surface := jktypes.Surface{}
 
-	materialID, _ := strconv.ParseInt(args[1], 10, 32)
-	surface.MaterialID = materialID
+	// the first argument that is not a number fails the surface
+	var argErr error
+	parseInt := func(arg string, base int) int64 {
+		value, err := strconv.ParseInt(arg, base, 64)
+		if err != nil && argErr == nil {
+			argErr = p.malformed("integer", arg)
+		}
+		return value
+	}
+	parseFloat := func(arg string) float64 {
+		value, err := strconv.ParseFloat(arg, 64)
+		if err != nil && argErr == nil {
+			argErr = p.malformed("number", arg)
+		}
+		return value
+	}
+
+	materialID := parseInt(args[1], 10)
+	surface.SurfaceFlags = parseInt(args[2], 0)
+	surface.FaceFlags = parseInt(args[3], 0)
+	surface.Geo = parseInt(args[4], 10)
+	surface.Light = parseInt(args[5], 10)
+	surface.Tex = parseInt(args[6], 10)
+	adjoinID := parseInt(args[7], 10)
+	surface.ExtraLight = parseFloat(args[8])
+	numVertexIds := parseInt(args[9], 10)
+	if argErr != nil {
+		return argErr
+	}
 
-	geoFlag, _ := strconv.ParseInt(args[4], 10, 32)
-	surface.Geo = geoFlag
+	if materialID < -1 || materialID >= int64(len(p.jkl.Model.Materials)) {
+		return fmt.Errorf("%w: material %d out of range", ErrMalformed, materialID)
+	}
+	surface.MaterialID = materialID
 
-	// TODO: WHAT DOES THIS VALUE MEAN?
-	//if args[5] != "3" {
-	//	fmt.Println("light != 3", args[5])
-	//}
+	if adjoinID < -1 || adjoinID >= int64(len(p.jkl.Model.Adjoins)) {
+		return fmt.Errorf("%w: adjoin %d out of range", ErrMalformed, adjoinID)
+	}
+	if adjoinID >= 0 {
+		p.jkl.Model.Adjoins[adjoinID].Surface = int64(len(p.jkl.Model.Surfaces))
+	}
+	surface.Adjoin = adjoinID
+	surface.Sector = -1
 
-	numVertexIds, _ := strconv.ParseInt(args[9], 10, 32)
+	if numVertexIds < 0 || numVertexIds > int64(len(args)) || requireArgs(args, 10+int(numVertexIds)*2) != nil {
+		return p.malformed(fmt.Sprintf("%d vertices and intensities", numVertexIds), line)
+	}
 	vertexIds := args[10 : 10+numVertexIds]
 	for idx, vertexIDPair := range vertexIds {
 		splitVertexIDPair := strings.Split(vertexIDPair, ",")
-		vertexID, _ := strconv.ParseInt(splitVertexIDPair[0], 10, 64)
-		texVertexID, _ := strconv.ParseInt(splitVertexIDPair[1], 10, 64)
+		if len(splitVertexIDPair) != 2 {
+			return p.malformed("vertex,texture vertex pair", vertexIDPair)
+		}
+		vertexID := parseInt(splitVertexIDPair[0], 10)
+		texVertexID := parseInt(splitVertexIDPair[1], 10)
+		lightIntensity := parseFloat(args[10+numVertexIds:][idx])
+		if argErr != nil {
+			return argErr
+		}
+		if vertexID < 0 || vertexID >= int64(len(p.jkl.Model.Vertices)) || texVertexID < -1 || texVertexID >= int64(len(p.jkl.Model.TextureVertices)) {
+			return fmt.Errorf("%w: vertex %d/%d out of range", ErrMalformed, vertexID, texVertexID)
+		}
 		surface.VertexIds = append(surface.VertexIds, vertexID)
 		surface.TextureVertexIds = append(surface.TextureVertexIds, texVertexID)
-
-		lightIntensity, _ := strconv.ParseFloat(args[10+numVertexIds:][idx], 64)
 		surface.LightIntensities = append(surface.LightIntensities, lightIntensity)
 	}
 
 	p.jkl.Model.Surfaces = append(p.jkl.Model.Surfaces, surface)
+	return nil
 }
 
-func (p *JklLineParser) parseMaterials() {
-	p.processSection(func(line string) {
+func (p *JklLineParser) parseSectors() error {
+	var sector *jktypes.Sector
+	return p.processSection(func(line string) error {
+		args := p.getLineArgs(line)
+		if len(args) == 0 {
+			return nil
+		}
+
+		if args[0] == "sector" {
+			if err := requireArgs(args, 2); err != nil {
+				return err
+			}
+			p.jkl.Sectors = append(p.jkl.Sectors, jktypes.Sector{})
+			sector = &p.jkl.Sectors[len(p.jkl.Sectors)-1]
+			return nil
+		}
+		if args[0] == "world" {
+			return nil
+		}
+		if sector == nil {
+			return p.malformed("sector", line)
+		}
+
+		var err error
+		switch args[0] {
+		case "flags":
+			if err = requireArgs(args, 2); err == nil {
+				sector.Flags, err = strconv.ParseInt(args[1], 0, 64)
+			}
+		case "ambient":
+			_, err = fmt.Sscanf(line, "ambient light %f", &sector.AmbientLight)
+		case "extra":
+			_, err = fmt.Sscanf(line, "extra light %f", &sector.ExtraLight)
+		case "colormap":
+			_, err = fmt.Sscanf(line, "colormap %d", &sector.ColorMap)
+		case "tint":
+			_, err = fmt.Sscanf(line, "tint %f %f %f", &sector.Tint[0], &sector.Tint[1], &sector.Tint[2])
+		case "boundbox":
+			sector.BoundBox, err = p.parseBoundingBox(line, "boundbox")
+		case "collidebox":
+			sector.CollideBox, err = p.parseBoundingBox(line, "collidebox")
+			sector.HasCollideBox = true
+		case "sound":
+			_, err = fmt.Sscanf(line, "sound %s %f", &sector.Sound, &sector.SoundVolume)
+		case "center":
+			_, err = fmt.Sscanf(line, "center %f %f %f", &sector.Center[0], &sector.Center[1], &sector.Center[2])
+		case "radius":
+			_, err = fmt.Sscanf(line, "radius %f", &sector.Radius)
+		case "vertices":
+			var count int
+			if _, err = fmt.Sscanf(line, "vertices %d", &count); err == nil {
+				return p.processNLines(count, func(l string) error {
+					var id int32
+					var vertexID int64
+					if n, err := fmt.Sscanf(l, "%d: %d", &id, &vertexID); err != nil || n != 2 {
+						return p.malformed("sector vertex", l)
+					}
+					if vertexID < 0 || vertexID >= int64(len(p.jkl.Model.Vertices)) {
+						return fmt.Errorf("%w: sector vertex %d out of range", ErrMalformed, vertexID)
+					}
+					sector.VertexIds = append(sector.VertexIds, vertexID)
+					return nil
+				})
+			}
+		case "surfaces":
+			_, err = fmt.Sscanf(line, "surfaces %d %d", &sector.FirstSurface, &sector.NumSurfaces)
+		}
+		if err != nil {
+			return p.malformed(args[0], line)
+		}
+		return nil
+	})
+}
+
+func (p *JklLineParser) parseBoundingBox(line string, prefix string) (jktypes.BoundingBox, error) {
+	var box jktypes.BoundingBox
+	_, err := fmt.Sscanf(line, prefix+" %f %f %f %f %f %f",
+		&box.Min[0], &box.Min[1], &box.Min[2], &box.Max[0], &box.Max[1], &box.Max[2])
+	return box, err
+}
+
+// linkSectors assigns every surface to its sector and resolves the sector on
+// the far side of each adjoin.
+func (p *JklLineParser) linkSectors() error {
+	surfaces := p.jkl.Model.Surfaces
+	for sectorID, sector := range p.jkl.Sectors {
+		if sector.FirstSurface < 0 || sector.NumSurfaces < 0 || sector.FirstSurface+sector.NumSurfaces > int64(len(surfaces)) {
+			return p.errorf("%w: sector %d surfaces %d-%d out of range", ErrMalformed, sectorID, sector.FirstSurface, sector.FirstSurface+sector.NumSurfaces)
+		}
+		for i := sector.FirstSurface; i < sector.FirstSurface+sector.NumSurfaces; i++ {
+			surfaces[i].Sector = int64(sectorID)
+		}
+	}
+
+	adjoins := p.jkl.Model.Adjoins
+	for i := range adjoins {
+		if adjoins[i].Mirror < 0 || adjoins[i].Mirror >= int64(len(adjoins)) {
+			return p.errorf("%w: adjoin %d mirror %d out of range", ErrMalformed, i, adjoins[i].Mirror)
+		}
+		if mirrorSurface := adjoins[adjoins[i].Mirror].Surface; mirrorSurface >= 0 {
+			adjoins[i].Sector = surfaces[mirrorSurface].Sector
+		}
+	}
+
+	return nil
+}
+
+func (p *JklLineParser) parseMaterials() error {
+	return p.processSection(func(line string) error {
 		var count int
 		var args int
 		if args, _ = fmt.Sscanf(line, "world materials %d", &count); args == 1 {
-			p.processNLines(count, p.parseMaterialsWorldMaterial)
+			if err := p.processNLines(count, p.parseMaterialsWorldMaterial); err != nil {
+				return err
+			}
+			return p.loadMaterials()
 		}
+		return nil
 	})
 }
 
-func (p *JklLineParser) parseMaterialsWorldMaterial(line string) {
+func (p *JklLineParser) parseMaterialsWorldMaterial(line string) error {
 	var id int32
 	var matName string
 	var xTile float32
 	var yTile float32
 	n, err := fmt.Sscanf(line, "%d: %s %f %f", &id, &matName, &xTile, &yTile)
-	p.checkError(err)
-	if n != 4 {
-		panic("Unable to get world material information")
+	if err != nil || n != 4 {
+		return p.malformed("world material", line)
 	}
 
-	var material jktypes.Material
-	fileBytes := jk.GetLoader().LoadResource(matName)
-	if fileBytes != nil {
-		material = NewMatParser().ParseFromBytes(fileBytes)
-	}
-
-	material.XTile = xTile
-	material.YTile = yTile
-
+	material := jktypes.Material{Name: strings.ToLower(matName), XTile: xTile, YTile: yTile}
+	p.materials = append(p.materials, matName)
 	p.jkl.Model.Materials = append(p.jkl.Model.Materials, material)
+	return nil
+}
+
+// loadMaterials loads the materials listed so far in parallel, keeping the
+// tiling of the level.
+func (p *JklLineParser) loadMaterials() error {
+	materials := p.jkl.Model.Materials[len(p.jkl.Model.Materials)-len(p.materials):]
+	err := p.lease.cache.parallel(len(p.materials), func(i int) error {
+		material, err := p.lease.Material(p.materials[i])
+		if err != nil {
+			return err
+		}
+		material.XTile = materials[i].XTile
+		material.YTile = materials[i].YTile
+		materials[i] = material
+		return nil
+	})
+	p.materials = nil
+	return err
 }
 
-func (p *JklLineParser) parseModels() {
-	p.processSection(func(line string) {
+func (p *JklLineParser) parseModels() error {
+	return p.processSection(func(line string) error {
 		var count int
 		var args int
 		if args, _ = fmt.Sscanf(line, "world models %d", &count); args == 1 {
-			p.processNLines(count, p.parseModelsWorldModel)
+			if err := p.processNLines(count, p.parseModelsWorldModel); err != nil {
+				return err
+			}
+			return p.loadModels()
 		}
+		return nil
 	})
 }
 
-func (p *JklLineParser) parseModelsWorldModel(line string) {
+func (p *JklLineParser) parseModelsWorldModel(line string) error {
 	var id int32
 	var jk3doName string
 	n, err := fmt.Sscanf(line, "%d: %s", &id, &jk3doName)
-	p.checkError(err)
-	if n != 2 {
-		panic("Unable to get world model information")
+	if err != nil || n != 2 {
+		return p.malformed("world model", line)
+	}
+
+	p.models = append(p.models, jk3doName)
+	return nil
+}
+
+// loadModels loads the models listed so far in parallel, shaded with the first
+// colormap of the level.
+func (p *JklLineParser) loadModels() error {
+	var colorMap string
+	if len(p.colorMaps) > 0 {
+		colorMap = p.colorMaps[0]
 	}
 
-	var jk3do jktypes.Jk3doFile
-	fileBytes := jk.GetLoader().LoadResource(jk3doName)
-	if fileBytes != nil {
-		jk3do = NewJk3doLineParser().ParseFromString(string(fileBytes))
+	models := make([]jktypes.Jk3doFile, len(p.models))
+	err := p.lease.cache.parallel(len(p.models), func(i int) error {
+		var err error
+		models[i], err = p.lease.Model(p.models[i], colorMap)
+		return err
+	})
+	if err != nil {
+		return err
 	}
 
-	if len(p.jkl.Model.ColorMaps) > 0 {
-		jk3do.ColorMap = p.jkl.Model.ColorMaps[0]
+	for i, name := range p.models {
+		p.jkl.Jk3dos[name] = models[i]
 	}
-	p.jkl.Jk3dos[jk3doName] = jk3do
+	p.models = nil
+	return nil
 }
 
-func (p *JklLineParser) parseTemplates() {
-	p.processSection(func(line string) {
+func (p *JklLineParser) parseTemplates() error {
+	return p.processSection(func(line string) error {
 		var count int
 		var args int
-		var err error
-		if args, err = fmt.Sscanf(line, "world templates %d", &count); args == 1 {
-			p.processNLines(count, p.parseTemplatesWorldTemplate)
+		if args, _ = fmt.Sscanf(line, "world templates %d", &count); args == 1 {
+			return p.processNLines(count, p.parseTemplatesWorldTemplate)
 		}
-		p.checkError(err)
+		return nil
 	})
 }
 
-func (p *JklLineParser) parseTemplatesWorldTemplate(line string) {
+func (p *JklLineParser) parseTemplatesWorldTemplate(line string) error {
 	args := p.getLineArgs(line)
+	if err := requireArgs(args, 2); err != nil {
+		return err
+	}
 
-	name := args[0]
-	var modelName string
-	size := 1.0
-	for i := 0; i < len(args); i++ {
+	// templates start out as a copy of the template they are based on
+	tmp, ok := p.templates[args[1]]
+	if !ok {
+		tmp = jktypes.Template{Size: 1.0}
+	}
+	tmp.Name = args[0]
+
+	for i := 2; i < len(args); i++ {
 		if strings.HasPrefix(args[i], "size=") {
-			size, _ = strconv.ParseFloat(strings.TrimPrefix(args[i], "size="), 32)
+			tmp.Size, _ = strconv.ParseFloat(strings.TrimPrefix(args[i], "size="), 32)
 		}
 		if strings.HasPrefix(args[i], "model3d=") {
-			modelName = strings.TrimPrefix(args[i], "model3d=")
+			tmp.Jk3doName = strings.TrimPrefix(args[i], "model3d=")
+		}
+		if strings.HasPrefix(args[i], "puppet=") {
+			tmp.PuppetName = strings.TrimPrefix(args[i], "puppet=")
 		}
 	}
 
-	if modelName != "" {
-		tmp := jktypes.Template{}
-		tmp.Name = name
-		tmp.Jk3doName = modelName
-		tmp.Size = size
-
+	p.templates[tmp.Name] = tmp
+	if tmp.Jk3doName != "" {
 		p.jkl.Jk3doTemplates[tmp.Name] = tmp
 	}
+
+	return nil
 }
 
-func (p *JklLineParser) parseThings() {
-	p.processSection(func(line string) {
+func (p *JklLineParser) parseThings() error {
+	return p.processSection(func(line string) error {
 		var count int
 		var args int
 		if args, _ = fmt.Sscanf(line, "world things %d", &count); args == 1 {
-			p.processNLines(count, p.parseThingsWorldThing)
+			return p.processNLines(count, p.parseThingsWorldThing)
 		}
+		return nil
 	})
 }
 
-func (p *JklLineParser) parseThingsWorldThing(line string) {
+func (p *JklLineParser) parseThingsWorldThing(line string) error {
 	args := p.getLineArgs(line)
+	if err := requireArgs(args, 9); err != nil {
+		return err
+	}
 
 	templateName := args[1]
 
@@ -404,5 +742,60 @@ func (p *JklLineParser) parseThingsWorldThing(line string) {
 	t.Yaw = yaw
 	t.Roll = Roll
 
+	t.Sector = -1
+	if len(args) > 9 {
+		t.Sector, _ = strconv.ParseInt(args[9], 10, 32)
+	}
+
+	for _, arg := range args[9:] {
+		if !strings.HasPrefix(arg, "frame=") {
+			continue
+		}
+		frame, err := p.parseThingFrame(arg)
+		if err != nil {
+			return err
+		}
+		t.Frames = append(t.Frames, frame)
+	}
+
 	p.jkl.Things = append(p.jkl.Things, t)
+	return nil
+}
+
+// parseThingFrame parses "frame=(x/y/z:pitch/yaw/roll)", the orientation is optional.
+func (p *JklLineParser) parseThingFrame(arg string) (jktypes.ThingFrame, error) {
+	var frame jktypes.ThingFrame
+	value := strings.TrimSuffix(strings.TrimPrefix(arg, "frame=("), ")")
+	parts := strings.SplitN(value, ":", 2)
+	if err := p.scanLine(parts[0], "%f/%f/%f", &frame.Position[0], &frame.Position[1], &frame.Position[2]); err != nil {
+		return frame, err
+	}
+	if len(parts) == 2 {
+		if err := p.scanLine(parts[1], "%f/%f/%f", &frame.Orientation[0], &frame.Orientation[1],
+			&frame.Orientation[2]); err != nil {
+			return frame, err
+		}
+	}
+	return frame, nil
+}
+
+func (p *JklLineParser) parseCogs() error {
+	return p.processSection(func(line string) error {
+		var count int
+		var args int
+		if args, _ = fmt.Sscanf(line, "world cogs %d", &count); args == 1 {
+			return p.processNLines(count, p.parseCogsWorldCog)
+		}
+		return nil
+	})
+}
+
+func (p *JklLineParser) parseCogsWorldCog(line string) error {
+	args := p.getLineArgs(line)
+	if err := requireArgs(args, 2); err != nil {
+		return err
+	}
+
+	p.jkl.Cogs = append(p.jkl.Cogs, jktypes.LevelCog{Script: args[1], Values: args[2:]})
+	return nil
 }
@@ -2,10 +2,10 @@ package jkparsers
 
 import (
 	"bufio"
+	"fmt"
 	"github.com/joelhays/go-jk/jk"
 	"github.com/joelhays/go-jk/jk/jktypes"
 	"io/ioutil"
-	"log"
 	"regexp"
 	"strconv"
 	"strings"
@@ -14,14 +14,17 @@ import (
 )
 
 type JklRegexParser struct {
-	jkl     jktypes.Jkl
-	scanner *bufio.Scanner
-	line    string
-	done    bool
+	parseContext
+	resolver jk.ResourceResolver
+	jkl      jktypes.Jkl
+	scanner  *bufio.Scanner
+	line     string
+	done     bool
 }
 
-func NewJklRegexParser() *JklRegexParser {
+func NewJklRegexParser(resolver jk.ResourceResolver) *JklRegexParser {
 	return &JklRegexParser{
+		resolver: resolver,
 		jkl: jktypes.Jkl{
 			Model:          &jktypes.JkMesh{},
 			Jk3dos:         make(map[string]jktypes.Jk3doFile),
@@ -32,18 +35,19 @@ func NewJklRegexParser() *JklRegexParser {
 }
 
 // ReadJKLFromFile will read a .jkl file and return a struct containing all necessary information
-func (p *JklRegexParser) ParseJKLFromFile(filePath string) jktypes.Jkl {
+func (p *JklRegexParser) ParseJKLFromFile(filePath string) (jktypes.Jkl, error) {
 	bytes, err := ioutil.ReadFile(filePath)
 	if err != nil {
-		log.Fatal(err)
+		return jktypes.Jkl{}, err
 	}
 	data := string(bytes)
 
+	p.SetFileName(filePath)
 	return p.ParseJKLFromString(data)
 }
 
 // ReadJKLFromString will parse a string as a .jkl file
-func (p *JklRegexParser) ParseJKLFromString(jklString string) jktypes.Jkl {
+func (p *JklRegexParser) ParseJKLFromString(jklString string) (jktypes.Jkl, error) {
 	data := jklString
 
 	jklResult := jktypes.Jkl{}
@@ -52,30 +56,41 @@ func (p *JklRegexParser) ParseJKLFromString(jklString string) jktypes.Jkl {
 	jklResult.Jk3dos = make(map[string]jktypes.Jk3doFile)
 	jklResult.Jk3doTemplates = make(map[string]jktypes.Template)
 
-	p.parseVertices(data, &jklResult)
-	p.parseTextureVertices(data, &jklResult)
-	p.parseMaterials(data, &jklResult)
-	p.parseColormaps(data, &jklResult)
-	p.parseSurfaces(data, &jklResult)
-
-	p.parse3dos(data, &jklResult)
-	p.parse3doTemplates(data, &jklResult)
-	p.parseThings(data, &jklResult)
+	p.reset()
+
+	sections := []func(string, *jktypes.Jkl) error{
+		p.parseVertices,
+		p.parseTextureVertices,
+		p.parseMaterials,
+		p.parseColormaps,
+		p.parseSurfaces,
+		p.parse3dos,
+		p.parse3doTemplates,
+		p.parseThings,
+	}
+	for _, parseSection := range sections {
+		if err := parseSection(data, &jklResult); err != nil {
+			return jktypes.Jkl{}, err
+		}
+	}
 
-	return jklResult
+	return jklResult, nil
 }
 
-func (p *JklRegexParser) parseSection(data string, regex string, componentRegex string, callback func(components []string)) {
+func (p *JklRegexParser) parseSection(data string, regex string, componentRegex string, callback func(components []string) error) error {
 	sectionRegex := regexp.MustCompile(regex)
 	sectionMatch := sectionRegex.FindAllString(data, -1)
 
+	p.section = regex
+	p.lineNum = 0
+
 	if len(sectionMatch) == 0 {
-		callback([]string{})
-		return
+		return p.wrapError(callback([]string{}))
 	}
 
 	scanner := bufio.NewScanner(strings.NewReader(sectionMatch[0]))
 	for scanner.Scan() {
+		p.lineNum++
 		match, _ := regexp.MatchString(componentRegex, scanner.Text())
 		if match != true {
 			continue
@@ -83,103 +98,135 @@ func (p *JklRegexParser) parseSection(data string, regex string, componentRegex
 
 		components := strings.Fields(scanner.Text())
 
-		callback(components)
+		if err := callback(components); err != nil {
+			return p.wrapError(err)
+		}
 	}
+
+	return nil
 }
 
-func (p *JklRegexParser) parseVertices(data string, jklResult *jktypes.Jkl) {
-	p.parseSection(data, `(?s)World vertices.*World texture vertices`, "\\d+:.*",
-		func(components []string) {
-			var err error
+func (p *JklRegexParser) parseVertices(data string, jklResult *jktypes.Jkl) error {
+	return p.parseSection(data, `(?s)World vertices.*World texture vertices`, "\\d+:.*",
+		func(components []string) error {
+			if err := requireArgs(components, 4); err != nil {
+				return err
+			}
 
 			x, err := strconv.ParseFloat(components[1], 64)
 			if err != nil {
-				log.Fatal(err)
+				return err
 			}
 			y, err := strconv.ParseFloat(components[2], 64)
 			if err != nil {
-				log.Fatal(err)
+				return err
 			}
 			z, err := strconv.ParseFloat(components[3], 64)
 			if err != nil {
-				log.Fatal(err)
+				return err
 			}
 
 			jklResult.Model.Vertices = append(jklResult.Model.Vertices, mgl32.Vec3{float32(x), float32(y), float32(z)})
+			return nil
 		})
 }
 
-func (p *JklRegexParser) parseTextureVertices(data string, jklResult *jktypes.Jkl) {
-	p.parseSection(data, `(?s)World texture vertices.*World adjoins`, "\\d+:.*",
-		func(components []string) {
-			var err error
+func (p *JklRegexParser) parseTextureVertices(data string, jklResult *jktypes.Jkl) error {
+	return p.parseSection(data, `(?s)World texture vertices.*World adjoins`, "\\d+:.*",
+		func(components []string) error {
+			if err := requireArgs(components, 3); err != nil {
+				return err
+			}
 
 			u, err := strconv.ParseFloat(components[1], 64)
 			if err != nil {
-				log.Fatal(err)
+				return err
 			}
 			v, err := strconv.ParseFloat(components[2], 64)
 			if err != nil {
-				log.Fatal(err)
+				return err
 			}
 
 			jklResult.Model.TextureVertices = append(jklResult.Model.TextureVertices, mgl32.Vec2{float32(u), float32(v)})
+			return nil
 		})
 }
 
-func (p *JklRegexParser) parseMaterials(data string, jklResult *jktypes.Jkl) {
-	p.parseSection(data, `(?s)World materials.*SECTION: GEORESOURCE`, "\\d+:.*",
-		func(components []string) {
-			var err error
+func (p *JklRegexParser) parseMaterials(data string, jklResult *jktypes.Jkl) error {
+	return p.parseSection(data, `(?s)World materials.*SECTION: GEORESOURCE`, "\\d+:.*",
+		func(components []string) error {
+			if err := requireArgs(components, 4); err != nil {
+				return err
+			}
 
 			matName := components[1]
 
 			xTile, err := strconv.ParseFloat(components[2], 64)
 			if err != nil {
-				log.Fatal(err)
+				return err
 			}
 
 			yTile, err := strconv.ParseFloat(components[3], 64)
 			if err != nil {
-				log.Fatal(err)
+				return err
 			}
 
 			var material jktypes.Material
-			fileBytes := jk.GetLoader().LoadResource(matName)
+			fileBytes := loadResource(p.resolver, matName)
 			if fileBytes != nil {
-				material = NewMatParser().ParseFromBytes(fileBytes)
+				matParser := NewMatParser()
+				matParser.SetFileName(matName)
+				material, err = matParser.ParseFromBytes(fileBytes)
+				if err != nil {
+					return err
+				}
 			}
 
+			material.Name = strings.ToLower(matName)
 			material.XTile = float32(xTile)
 			material.YTile = float32(yTile)
 
 			jklResult.Model.Materials = append(jklResult.Model.Materials, material)
+			return nil
 		})
 }
 
-func (p *JklRegexParser) parseColormaps(data string, jklResult *jktypes.Jkl) {
-	p.parseSection(data, `(?s)World Colormaps.*World vertices`, "\\d+:.*",
-		func(components []string) {
+func (p *JklRegexParser) parseColormaps(data string, jklResult *jktypes.Jkl) error {
+	return p.parseSection(data, `(?s)World Colormaps.*World vertices`, "\\d+:.*",
+		func(components []string) error {
 			var cmpName string
 			if len(components) == 0 {
 				cmpName = "dflt.cmp"
+			} else if len(components) < 2 {
+				return requireArgs(components, 2)
 			} else {
 				cmpName = components[1]
 			}
 
 			var colorMap jktypes.ColorMap
-			fileBytes := jk.GetLoader().LoadResource(cmpName)
+			fileBytes := loadResource(p.resolver, cmpName)
 			if fileBytes != nil {
-				colorMap = NewCmpParser().ParseFromBytes(fileBytes)
+				cmpParser := NewCmpParser()
+				cmpParser.SetFileName(cmpName)
+				var err error
+				colorMap, err = cmpParser.ParseFromBytes(fileBytes)
+				if err != nil {
+					return err
+				}
 			}
 
 			jklResult.Model.ColorMaps = append(jklResult.Model.ColorMaps, colorMap)
+			return nil
 		})
 }
 
-func (p *JklRegexParser) parseSurfaces(data string, jklResult *jktypes.Jkl) {
-	p.parseSection(data, `(?s)World surfaces.*\#--- Surface normals ---`, "\\d+:.*",
-		func(components []string) {
+func (p *JklRegexParser) parseSurfaces(data string, jklResult *jktypes.Jkl) error {
+	err := p.parseSection(data, `(?s)World surfaces.*\#--- Surface normals ---`, "\\d+:.*",
+		func(components []string) error {
+			if err := requireArgs(components, 10); err != nil {
+				return err
+			}
+
 			surface := jktypes.Surface{}
 
 			materialID, _ := strconv.ParseInt(components[1], 10, 32)
@@ -194,9 +241,15 @@ func (p *JklRegexParser) parseSurfaces(data string, jklResult *jktypes.Jkl) {
 			//}
 
 			numVertexIds, _ := strconv.ParseInt(components[9], 10, 32)
+			if err := requireArgs(components, 10+int(numVertexIds)*2); err != nil || numVertexIds < 0 {
+				return fmt.Errorf("%w: expected %d vertices and intensities", ErrMalformed, numVertexIds)
+			}
 			vertexIds := components[10 : 10+numVertexIds]
 			for idx, vertexIDPair := range vertexIds {
 				splitVertexIDPair := strings.Split(vertexIDPair, ",")
+				if len(splitVertexIDPair) != 2 {
+					return fmt.Errorf("%w: expected vertex,texture vertex pair, got %q", ErrMalformed, vertexIDPair)
+				}
 				vertexID, _ := strconv.ParseInt(splitVertexIDPair[0], 10, 64)
 				texVertexID, _ := strconv.ParseInt(splitVertexIDPair[1], 10, 64)
 				surface.VertexIds = append(surface.VertexIds, vertexID)
@@ -207,43 +260,66 @@ func (p *JklRegexParser) parseSurfaces(data string, jklResult *jktypes.Jkl) {
 			}
 
 			jklResult.Model.Surfaces = append(jklResult.Model.Surfaces, surface)
+			return nil
 		})
+	if err != nil {
+		return err
+	}
+
+	return p.parseSection(data, `(?s)\#--- Surface normals ---.*Section: SECTORS`, "\\d+:.*",
+		func(components []string) error {
+			if err := requireArgs(components, 4); err != nil {
+				return err
+			}
 
-	p.parseSection(data, `(?s)\#--- Surface normals ---.*Section: SECTORS`, "\\d+:.*",
-		func(components []string) {
 			surfaceID, _ := strconv.ParseInt(strings.TrimRight(components[0], ":"), 10, 32)
+			if surfaceID < 0 || surfaceID >= int64(len(jklResult.Model.Surfaces)) {
+				return fmt.Errorf("%w: surface normal %d out of range", ErrMalformed, surfaceID)
+			}
 
 			x, _ := strconv.ParseFloat(components[1], 64)
 			y, _ := strconv.ParseFloat(components[2], 64)
 			z, _ := strconv.ParseFloat(components[3], 64)
 
 			jklResult.Model.Surfaces[surfaceID].Normal = mgl32.Vec3{float32(x), float32(y), float32(z)}
+			return nil
 		})
 }
 
-func (p *JklRegexParser) parse3dos(data string, jklResult *jktypes.Jkl) {
-	p.parseSection(data, `(?s)World models.*Section: SPRITES`, "\\d+:.*",
-		func(components []string) {
+func (p *JklRegexParser) parse3dos(data string, jklResult *jktypes.Jkl) error {
+	return p.parseSection(data, `(?s)World models.*Section: SPRITES`, "\\d+:.*",
+		func(components []string) error {
+			if err := requireArgs(components, 2); err != nil {
+				return err
+			}
+
 			jk3doName := components[1]
 
 			var jk3do jktypes.Jk3doFile
-			fileBytes := jk.GetLoader().LoadResource(jk3doName)
+			fileBytes := loadResource(p.resolver, jk3doName)
 			if fileBytes != nil {
-				jk3do = NewJk3doLineParser().ParseFromString(string(fileBytes))
+				jk3doParser := NewJk3doLineParser(p.resolver)
+				jk3doParser.SetFileName(jk3doName)
+				var err error
+				jk3do, err = jk3doParser.ParseFromString(string(fileBytes))
+				if err != nil {
+					return err
+				}
 			}
 
 			if len(jklResult.Model.ColorMaps) > 0 {
 				jk3do.ColorMap = jklResult.Model.ColorMaps[0]
 			}
 			jklResult.Jk3dos[jk3doName] = jk3do
+			return nil
 		})
 }
 
-func (p *JklRegexParser) parse3doTemplates(data string, jklResult *jktypes.Jkl) {
-	p.parseSection(data, `(?s)World templates.*Section: Things`, ".*",
-		func(components []string) {
+func (p *JklRegexParser) parse3doTemplates(data string, jklResult *jktypes.Jkl) error {
+	return p.parseSection(data, `(?s)World templates.*Section: Things`, ".*",
+		func(components []string) error {
 			if len(components) < 3 {
-				return
+				return nil
 			}
 
 			name := components[0]
@@ -266,12 +342,17 @@ func (p *JklRegexParser) parse3doTemplates(data string, jklResult *jktypes.Jkl)
 
 				jklResult.Jk3doTemplates[tmp.Name] = tmp
 			}
+			return nil
 		})
 }
 
-func (p *JklRegexParser) parseThings(data string, jklResult *jktypes.Jkl) {
-	p.parseSection(data, `(?s)World things.*end`, "\\d+:.*",
-		func(components []string) {
+func (p *JklRegexParser) parseThings(data string, jklResult *jktypes.Jkl) error {
+	return p.parseSection(data, `(?s)World things.*end`, "\\d+:.*",
+		func(components []string) error {
+			if err := requireArgs(components, 9); err != nil {
+				return err
+			}
+
 			templateName := components[1]
 
 			x, _ := strconv.ParseFloat(components[3], 64)
@@ -290,5 +371,6 @@ func (p *JklRegexParser) parseThings(data string, jklResult *jktypes.Jkl) {
 			t.Roll = Roll
 
 			jklResult.Things = append(jklResult.Things, t)
+			return nil
 		})
 }
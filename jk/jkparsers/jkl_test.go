@@ -0,0 +1,91 @@
+package jkparsers
+
+import (
+	"github.com/joelhays/go-jk/jk"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// testFilesResolver resolves from the files in _testfiles only, without any GOB.
+func testFilesResolver(t *testing.T) (*jk.MemoryResolver, map[string][]byte) {
+	files := make(map[string][]byte)
+	root := "../../_testfiles"
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		name, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		files[filepath.ToSlash(name)] = data
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return jk.NewMemoryResolver(files), files
+}
+
+func TestJklLevelLoading(t *testing.T) {
+	resolver, files := testFilesResolver(t)
+
+	tests := []struct {
+		name     string
+		sectors  int
+		surfaces int
+		things   int
+		jk3dos   []string // the 3dos of the level found in _testfiles
+	}{
+		{"01narshadda", 462, 4595, 352, []string{"bryv.3do", "conv.3do", "rystr.3do"}},
+		{"08escape88", 457, 4885, 206, []string{"bryv.3do", "conv.3do"}},
+		{"m_boss15", 68, 782, 113, []string{"bryv.3do", "conv.3do"}},
+	}
+	for _, test := range tests {
+		name := "jkl/" + test.name + ".jkl"
+		p := NewJklLineParser(resolver)
+		p.SetFileName(name)
+		level, err := p.ParseFromString(string(files[name]))
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+
+		if len(level.Sectors) != test.sectors || len(level.Model.Surfaces) != test.surfaces || len(level.Things) != test.things {
+			t.Errorf("%s: %d sectors, %d surfaces and %d things, expected %d, %d and %d", name,
+				len(level.Sectors), len(level.Model.Surfaces), len(level.Things), test.sectors, test.surfaces, test.things)
+		}
+
+		// the sectors own every surface once, in order
+		var next int64
+		for i, sector := range level.Sectors {
+			if sector.FirstSurface != next || sector.NumSurfaces < 0 {
+				t.Errorf("%s: sector %d has surfaces %d to %d, expected to start at %d", name, i,
+					sector.FirstSurface, sector.FirstSurface+sector.NumSurfaces, next)
+				break
+			}
+			next += sector.NumSurfaces
+		}
+		if next != int64(len(level.Model.Surfaces)) {
+			t.Errorf("%s: the sectors have %d surfaces, the level %d", name, next, len(level.Model.Surfaces))
+		}
+
+		for _, jk3doName := range test.jk3dos {
+			if jk3do, ok := level.Jk3dos[jk3doName]; !ok || len(jk3do.GeoSets) == 0 {
+				t.Errorf("%s: 3do %s not loaded", name, jk3doName)
+			}
+		}
+		for jk3doName, jk3do := range level.Jk3dos {
+			_, found := files["3do/"+jk3doName]
+			if found != (len(jk3do.GeoSets) > 0) {
+				t.Errorf("%s: 3do %s found %v but has %d geosets", name, jk3doName, found, len(jk3do.GeoSets))
+			}
+		}
+	}
+}
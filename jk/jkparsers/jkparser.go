@@ -3,26 +3,26 @@ package jkparsers
 import "github.com/joelhays/go-jk/jk/jktypes"
 
 type JkParser interface {
-	ParseFromFile(data string) interface{}
-	ParseFromString(data string) interface{}
+	ParseFromFile(data string) (interface{}, error)
+	ParseFromString(data string) (interface{}, error)
 }
 
 type Jk3doParser interface {
-	ParseFromFile(data string) jktypes.Jk3doFile
-	ParseFromString(data string) jktypes.Jk3doFile
+	ParseFromFile(data string) (jktypes.Jk3doFile, error)
+	ParseFromString(data string) (jktypes.Jk3doFile, error)
 }
 
 type JklParser interface {
-	ParseFromFile(filePath string) jktypes.Jkl
-	ParseFromString(jklString string) jktypes.Jkl
+	ParseFromFile(filePath string) (jktypes.Jkl, error)
+	ParseFromString(jklString string) (jktypes.Jkl, error)
 }
 
 type KeyParser interface {
-	ParseFromFile(filePath string) jktypes.Key
-	ParseFromString(jklString string) jktypes.Key
+	ParseFromFile(filePath string) (jktypes.Key, error)
+	ParseFromString(jklString string) (jktypes.Key, error)
 }
 
 type PupParser interface {
-	ParseFromFile(filePath string) jktypes.Pup
-	ParseFromString(jklString string) jktypes.Pup
+	ParseFromFile(filePath string) (jktypes.Pup, error)
+	ParseFromString(jklString string) (jktypes.Pup, error)
 }
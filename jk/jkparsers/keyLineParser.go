@@ -2,14 +2,14 @@ package jkparsers
 
 import (
 	"bufio"
-	"fmt"
 	"github.com/joelhays/go-jk/jk/jktypes"
+	"io"
 	"io/ioutil"
-	"log"
 	"strings"
 )
 
 type KeyLineParser struct {
+	parseContext
 	key     jktypes.Key
 	scanner *bufio.Scanner
 	line    string
@@ -20,64 +20,73 @@ func NewKeyLineParser() *KeyLineParser {
 	return &KeyLineParser{}
 }
 
-func (p *KeyLineParser) ParseFromFile(filePath string) jktypes.Key {
+func (p *KeyLineParser) ParseFromFile(filePath string) (jktypes.Key, error) {
 	bytes, err := ioutil.ReadFile(filePath)
 	if err != nil {
-		log.Fatal(err)
+		return jktypes.Key{}, err
 	}
 	data := string(bytes)
 
+	p.SetFileName(filePath)
 	return p.ParseFromString(data)
 }
 
-func (p *KeyLineParser) ParseFromString(objString string) jktypes.Key {
+func (p *KeyLineParser) ParseFromString(objString string) (jktypes.Key, error) {
 	p.key = jktypes.Key{}
 	p.scanner = bufio.NewScanner(strings.NewReader(objString))
 	p.line = ""
 	p.done = false
+	p.reset()
 
-	var err error
-
-	p.getNextLine() // SECTION: HEADER
-
-	p.getNextLine() // FLAGS  %#x
-	_, err = fmt.Sscanf(p.line, "flags %v", &p.key.Header.Flags)
-	p.checkError(err)
-
-	p.getNextLine() // TYPE   %#x
-	_, err = fmt.Sscanf(p.line, "type %v", &p.key.Header.Type)
-	p.checkError(err)
+	if err := p.parse(); err != nil {
+		return jktypes.Key{}, err
+	}
 
-	p.getNextLine() // FRAMES %d
-	_, err = fmt.Sscanf(p.line, "frames %v", &p.key.Header.Frames)
-	p.checkError(err)
+	return p.key, nil
+}
 
-	p.getNextLine() // FPS %f
-	_, err = fmt.Sscanf(p.line, "fps %v", &p.key.Header.FPS)
-	p.checkError(err)
+func (p *KeyLineParser) parse() error {
+	p.section = "header"
+	if err := p.expectLine("section: header"); err != nil {
+		return err
+	}
 
-	p.getNextLine() // JOINTS %d
-	_, err = fmt.Sscanf(p.line, "joints %v", &p.key.Header.Joints)
-	p.checkError(err)
+	if err := p.expectLine("flags %v", &p.key.Header.Flags); err != nil {
+		return err
+	}
+	if err := p.expectLine("type %v", &p.key.Header.Type); err != nil {
+		return err
+	}
+	if err := p.expectLine("frames %v", &p.key.Header.Frames); err != nil {
+		return err
+	}
+	if err := p.expectLine("fps %v", &p.key.Header.FPS); err != nil {
+		return err
+	}
+	if err := p.expectLine("joints %v", &p.key.Header.Joints); err != nil {
+		return err
+	}
 
-	p.getNextLine() // SECTION: MARKERS (optional) or SECTION: KEYFRAME NODES
+	// SECTION: MARKERS (optional) or SECTION: KEYFRAME NODES
+	if err := p.nextLine(); err != nil {
+		return err
+	}
 	if p.line == "section: markers" {
-		p.getNextLine() // MARKERS %d
-		p.parseMarkers()
-		p.getNextLine() // SECTION: KEYFRAME NODES
+		p.section = "markers"
+		if err := p.parseMarkers(); err != nil {
+			return err
+		}
+		if err := p.nextLine(); err != nil {
+			return err
+		}
 	}
 
-	// SECTION: KEYFRAME NODES
-	p.getNextLine() // NODES %d
-	p.parseNodes()
-
-	return p.key
-}
-
-func (p *KeyLineParser) checkError(err error) {
-	if err != nil {
-		log.Fatal(err)
+	p.section = "keyframe nodes"
+	if p.line != "section: keyframe nodes" {
+		return p.malformed("section: keyframe nodes", p.line)
 	}
+
+	return p.parseNodes()
 }
 
 func (p *KeyLineParser) getNextLine() bool {
@@ -87,6 +96,7 @@ func (p *KeyLineParser) getNextLine() bool {
 			p.done = true
 			break
 		}
+		p.lineNum++
 		line := p.scanner.Text()
 		line = strings.TrimSpace(line)
 		line = strings.ToLower(line)
@@ -104,58 +114,89 @@ func (p *KeyLineParser) getNextLine() bool {
 	return false
 }
 
-func (p *KeyLineParser) parseMarkers() {
+func (p *KeyLineParser) nextLine() error {
+	if !p.getNextLine() {
+		return p.wrapError(io.ErrUnexpectedEOF)
+	}
+	return nil
+}
+
+func (p *KeyLineParser) expectLine(format string, a ...interface{}) error {
+	if err := p.nextLine(); err != nil {
+		return err
+	}
+	return p.scanLine(p.line, format, a...)
+}
+
+func (p *KeyLineParser) parseMarkers() error {
 	var count int
-	_, err := fmt.Sscanf(p.line, "markers %d", &count)
-	p.checkError(err)
+	if err := p.expectLine("markers %d", &count); err != nil {
+		return err
+	}
 
 	for i := 0; i < count; i++ {
-		// todo: what are markers used for? skip for now
-		p.getNextLine() // %f %d
+		var marker jktypes.KeyMarker
+		if err := p.expectLine("%f %d", &marker.Frame, &marker.Type); err != nil {
+			return err
+		}
+		p.key.Markers = append(p.key.Markers, marker)
 	}
+
+	return nil
 }
 
-func (p *KeyLineParser) parseNodes() {
+func (p *KeyLineParser) parseNodes() error {
 	var count int
-	_, err := fmt.Sscanf(p.line, "nodes %d", &count)
-	p.checkError(err)
+	if err := p.expectLine("nodes %d", &count); err != nil {
+		return err
+	}
 
 	for i := 0; i < count; i++ {
 		node := jktypes.KeyframeNode{}
 
-		p.getNextLine() // NODE %d
-		p.getNextLine() // MESH NAME %s
-		_, err = fmt.Sscanf(p.line, "mesh name %s", &node.MeshName)
-		p.checkError(err)
+		if err := p.expectLine("node %d", &node.Number); err != nil {
+			return err
+		}
+		if err := p.expectLine("mesh name %s", &node.MeshName); err != nil {
+			return err
+		}
 
-		p.getNextLine() // ENTRIES %d
-		p.parseNodeEntries(&node)
+		if err := p.parseNodeEntries(&node); err != nil {
+			return err
+		}
 
 		p.key.KeyframeNodes = append(p.key.KeyframeNodes, node)
 	}
+
+	return nil
 }
 
-func (p *KeyLineParser) parseNodeEntries(node *jktypes.KeyframeNode) {
+func (p *KeyLineParser) parseNodeEntries(node *jktypes.KeyframeNode) error {
 	var count int
-	_, err := fmt.Sscanf(p.line, "entries %d", &count)
-	p.checkError(err)
+	if err := p.expectLine("entries %d", &count); err != nil {
+		return err
+	}
 
 	for i := 0; i < count; i++ {
 		entry := jktypes.KeyframeNodeEntry{}
 
 		var id int32
-		p.getNextLine()
-		_, err = fmt.Sscanf(p.line, "%d: %d %v %f %f %f %f %f %f", &id, &entry.Frame, &entry.Flags,
+		err := p.expectLine("%d: %d %v %f %f %f %f %f %f", &id, &entry.Frame, &entry.Flags,
 			&entry.Offset[0], &entry.Offset[1], &entry.Offset[2],
 			&entry.Orientation[0], &entry.Orientation[1], &entry.Orientation[2])
-		p.checkError(err)
+		if err != nil {
+			return err
+		}
 
-		p.getNextLine()
-		_, err = fmt.Sscanf(p.line, "%f %f %f %f %f %f",
+		err = p.expectLine("%f %f %f %f %f %f",
 			&entry.DeltaOffset[0], &entry.DeltaOffset[1], &entry.DeltaOffset[2],
 			&entry.DeltaOrientation[0], &entry.DeltaOrientation[1], &entry.DeltaOrientation[2])
-		p.checkError(err)
+		if err != nil {
+			return err
+		}
 
 		node.Entries = append(node.Entries, entry)
 	}
+
+	return nil
 }
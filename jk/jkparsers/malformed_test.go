@@ -0,0 +1,107 @@
+package jkparsers
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"github.com/joelhays/go-jk/jk"
+	"github.com/joelhays/go-jk/jk/jktypes"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func TestMalformed3doCounts(t *testing.T) {
+	data, err := ioutil.ReadFile("../../_testfiles/3do/statpole.3do")
+	if err != nil {
+		t.Fatal(err)
+	}
+	source := string(data)
+
+	tests := map[string][2]string{
+		"negative materials": {"MATERIALS 4", "MATERIALS -1"},
+		"huge vertices":      {"VERTICES 59", "VERTICES 2000000000"},
+		"negative faces":     {"FACES 97", "FACES -5"},
+		"material below -1":  {"0:         0  0x0000", "0:        -2  0x0000"},
+	}
+	for name, replace := range tests {
+		mutated := strings.Replace(source, replace[0], replace[1], 1)
+		if mutated == source {
+			t.Fatalf("%s: %q not found", name, replace[0])
+		}
+
+		parser := NewJk3doLineParser(jk.NewMemoryResolver(nil))
+		_, err := parser.ParseFromString(mutated)
+		var parseErr *ParseError
+		if !errors.As(err, &parseErr) || !errors.Is(err, ErrMalformed) {
+			t.Errorf("%s: got %v, expected a ParseError wrapping ErrMalformed", name, err)
+		}
+	}
+}
+
+func TestMalformedJklSurfaces(t *testing.T) {
+	data, err := ioutil.ReadFile("../../_testfiles/jkl/m_boss15.jkl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	source := string(data)
+
+	tests := map[string][2]string{
+		"material below -1": {"0:\t185\t0x24", "0:\t-5\t0x24"},
+		"material not int":  {"0:\t185\t0x24", "0:\tx\t0x24"},
+		"flags not int":     {"0:\t185\t0x24", "0:\t185\t0xZZ"},
+		"adjoin not int":    {"1\t0\t0.00\t\t8\t3,-1", "1\tq\t0.00\t\t8\t3,-1"},
+		"vertex not int":    {"8\t3,-1\t0,-1", "8\t3,-1\ta,-1"},
+	}
+	for name, replace := range tests {
+		mutated := strings.Replace(source, replace[0], replace[1], 1)
+		if mutated == source {
+			t.Fatalf("%s: %q not found", name, replace[0])
+		}
+
+		parser := NewJklLineParser(jk.NewMemoryResolver(nil))
+		_, err := parser.ParseFromString(mutated)
+		var parseErr *ParseError
+		if !errors.As(err, &parseErr) || !errors.Is(err, ErrMalformed) {
+			t.Errorf("%s: got %v, expected a ParseError wrapping ErrMalformed", name, err)
+		}
+	}
+}
+
+func TestMalformedSftTableCount(t *testing.T) {
+	header := jktypes.TSFTHeader{NumTables: 1 << 30}
+	copy(header.FileType[:], "SFNT")
+	var buf bytes.Buffer
+	if err := binary.Write(&buf, binary.LittleEndian, &header); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := NewSftParser(jk.NewMemoryResolver(nil)).ParseFromBytes(buf.Bytes())
+	if !errors.Is(err, ErrMalformed) {
+		t.Errorf("got %v, expected ErrMalformed", err)
+	}
+}
+
+func TestMalformedBmImageCount(t *testing.T) {
+	// found by fuzzing, the header claims 808464432 images
+	data := append([]byte("BM 00000000000000000"), bytes.Repeat([]byte{0xdb}, 256)...)
+
+	_, err := NewBmParser(jk.NewMemoryResolver(nil)).ParseFromBytes(data)
+	if !errors.Is(err, ErrMalformed) {
+		t.Errorf("got %v, expected ErrMalformed", err)
+	}
+}
+
+func TestMalformedMatType(t *testing.T) {
+	header := jktypes.MtlHeader{MatType: 1}
+	copy(header.Name[:], "MAT ")
+	var buf bytes.Buffer
+	if err := binary.Write(&buf, binary.LittleEndian, &header); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := NewMatParser().ParseFromBytes(buf.Bytes())
+	if !errors.Is(err, ErrMalformed) {
+		t.Errorf("got %v, expected ErrMalformed", err)
+	}
+}
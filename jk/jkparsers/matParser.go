@@ -1,52 +1,137 @@
 package jkparsers
 
 import (
-	"encoding/binary"
+	"fmt"
 	"github.com/joelhays/go-jk/jk/jktypes"
+	"io"
 )
 
-type MatParser struct{}
+const (
+	maxMatCels    = 1024
+	maxMatMipMaps = 16
+)
+
+type MatParser struct {
+	parseContext
+}
 
 func NewMatParser() *MatParser {
 	return &MatParser{}
 }
 
-func (p *MatParser) ParseFromBytes(data []byte) jktypes.Material {
+func (p *MatParser) ParseFromBytes(data []byte) (jktypes.Material, error) {
+	p.reset()
+
 	cursor := 0
+	p.section = "header"
 	var header jktypes.MtlHeader
-	cursor += readBytes(data, cursor, &header)
+	n, err := readBytes(data, cursor, &header)
+	if err != nil {
+		return jktypes.Material{}, p.wrapError(err)
+	}
+	cursor += n
 
-	if header.MatType == 0 {
-		// TODO: handle color-only materials
-		var colHeader jktypes.ColorHeader
-		cursor += readBytes(data, cursor, &colHeader)
+	if string(header.Name[:3]) != "MAT" {
+		return jktypes.Material{}, p.errorf("%w: not a MAT file", ErrMalformed)
+	}
 
-		texture := make([]byte, 4)
-		binary.LittleEndian.PutUint32(texture, uint32(colHeader.ColorNum))
+	if header.NumTextures < 0 || header.NumTextures > maxMatCels {
+		return jktypes.Material{}, p.errorf("%w: invalid cel count %d", ErrMalformed, header.NumTextures)
+	}
 
-		return jktypes.Material{Texture: texture, SizeX: 1, SizeY: 1, Transparent: false}
+	var material jktypes.Material
+	switch header.MatType {
+	case jktypes.MAT_TYPE_COLOR:
+		material.Cels, err = p.parseColorCels(data, cursor, int(header.NumTextures))
+	case jktypes.MAT_TYPE_TEXTURE:
+		material.Cels, err = p.parseTextureCels(data, cursor, int(header.NumTextures))
+	default:
+		return jktypes.Material{}, p.errorf("%w: unknown material type %d", ErrMalformed, header.MatType)
+	}
+	if err != nil {
+		return jktypes.Material{}, err
 	}
 
-	if header.MatType == 2 {
-		// get the first texture header (full-sized image)
-		var texHeader jktypes.TextureHeader
-		cursor += readBytes(data, cursor, &texHeader) * int(header.NumTextures)
+	material.Type = header.MatType
+	if len(material.Cels) > 0 {
+		cel := material.Cels[0]
+		material.Texture = cel.MipMaps[0]
+		material.SizeX = cel.SizeX
+		material.SizeY = cel.SizeY
+		material.Transparent = cel.Transparent
+	}
 
+	return material, nil
+}
+
+func (p *MatParser) parseColorCels(data []byte, cursor int, numCels int) ([]jktypes.MaterialCel, error) {
+	p.section = "color header"
+	cels := make([]jktypes.MaterialCel, numCels)
+	for i := range cels {
+		p.offset = cursor
+		var colHeader jktypes.ColorHeader
+		n, err := readBytes(data, cursor, &colHeader)
+		if err != nil {
+			return nil, p.wrapError(err)
+		}
+		cursor += n
+
+		cels[i] = jktypes.MaterialCel{
+			SizeX:      1,
+			SizeY:      1,
+			ColorIndex: colHeader.ColorNum,
+			MipMaps:    [][]byte{{byte(colHeader.ColorNum)}},
+		}
+	}
+	return cels, nil
+}
+
+func (p *MatParser) parseTextureCels(data []byte, cursor int, numCels int) ([]jktypes.MaterialCel, error) {
+	// every cel has a texture header, followed by the texture data of all cels
+	p.offset = cursor
+	p.section = "texture header"
+	texHeaders := make([]jktypes.TextureHeader, numCels)
+	n, err := readBytes(data, cursor, &texHeaders)
+	if err != nil {
+		return nil, p.wrapError(err)
+	}
+	cursor += n
+
+	cels := make([]jktypes.MaterialCel, numCels)
+	for i := range cels {
+		p.offset = cursor
+		p.section = "texture data"
 		var texData jktypes.TextureData
-		cursor += readBytes(data, cursor, &texData)
+		n, err := readBytes(data, cursor, &texData)
+		if err != nil {
+			return nil, p.wrapError(err)
+		}
+		cursor += n
+
+		if texData.SizeX <= 0 || texData.SizeY <= 0 || texData.NumMipMaps <= 0 || texData.NumMipMaps > maxMatMipMaps {
+			return nil, p.errorf("%w: cel %d is %dx%d with %d mipmaps", ErrMalformed, i, texData.SizeX, texData.SizeY, texData.NumMipMaps)
+		}
 
-		textureBytes := data[cursor : cursor+int(texData.SizeX*texData.SizeY)]
+		cel := jktypes.MaterialCel{SizeX: texData.SizeX, SizeY: texData.SizeY, ColorIndex: texHeaders[i].ColorNum}
+		p.section = "mipmap"
+		for level := 0; level < int(texData.NumMipMaps); level++ {
+			sizeX, sizeY := cel.MipMapSize(level)
+			size := int(sizeX) * int(sizeY)
+			if cursor+size > len(data) {
+				return nil, p.wrapError(fmt.Errorf("cel %d mipmap %d: %w", i, level, io.ErrUnexpectedEOF))
+			}
+			cel.MipMaps = append(cel.MipMaps, data[cursor:cursor+size])
+			cursor += size
+		}
 
-		var transparent bool
-		for i := 0; i < len(textureBytes); i++ {
-			if textureBytes[i] == 0 {
-				transparent = true
+		for _, index := range cel.MipMaps[0] {
+			if index == 0 {
+				cel.Transparent = true
 				break
 			}
 		}
 
-		return jktypes.Material{Texture: textureBytes, SizeX: texData.SizeX, SizeY: texData.SizeY, Transparent: transparent}
+		cels[i] = cel
 	}
-
-	return jktypes.Material{}
+	return cels, nil
 }
@@ -4,12 +4,13 @@ import (
 	"bufio"
 	"fmt"
 	"github.com/joelhays/go-jk/jk/jktypes"
+	"io"
 	"io/ioutil"
-	"log"
 	"strings"
 )
 
 type PupLineParser struct {
+	parseContext
 	pup     jktypes.Pup
 	scanner *bufio.Scanner
 	line    string
@@ -22,20 +23,22 @@ func NewPupLineParser() *PupLineParser {
 	}
 }
 
-func (p *PupLineParser) ParseFromFile(filePath string) jktypes.Pup {
+func (p *PupLineParser) ParseFromFile(filePath string) (jktypes.Pup, error) {
 	bytes, err := ioutil.ReadFile(filePath)
 	if err != nil {
-		log.Fatal(err)
+		return jktypes.Pup{}, err
 	}
 	data := string(bytes)
 
+	p.SetFileName(filePath)
 	return p.ParseFromString(data)
 }
 
-func (p *PupLineParser) ParseFromString(objString string) jktypes.Pup {
+func (p *PupLineParser) ParseFromString(objString string) (jktypes.Pup, error) {
 	p.pup = jktypes.Pup{}
 	p.scanner = bufio.NewScanner(strings.NewReader(objString))
 	p.done = false
+	p.reset()
 
 	var mode *jktypes.PupMode
 	for {
@@ -49,7 +52,12 @@ func (p *PupLineParser) ParseFromString(objString string) jktypes.Pup {
 			var modeNum int32
 			var basedon int32
 			args, _ = fmt.Sscanf(p.line, "mode=%d, basedon=%d colormaps %d", &modeNum, &basedon)
+			if args == 0 {
+				return jktypes.Pup{}, p.malformed("\"mode=%d\"", p.line)
+			}
+			p.section = fmt.Sprintf("mode %d", modeNum)
 			p.pup.Modes = append(p.pup.Modes, jktypes.PupMode{
+				Number:      modeNum,
 				SubModes:    make([]jktypes.PupSubMode, 0),
 				BasedOn:     basedon,
 				IsInherited: args == 2,
@@ -57,27 +65,35 @@ func (p *PupLineParser) ParseFromString(objString string) jktypes.Pup {
 			mode = &p.pup.Modes[len(p.pup.Modes)-1]
 			continue
 		} else if p.line == "joints" {
+			p.section = "joints"
 			for {
-				p.getNextLine()
+				if !p.getNextLine() {
+					return jktypes.Pup{}, p.wrapError(io.ErrUnexpectedEOF)
+				}
 				if p.line == "end" {
 					break
 				}
 				joint := jktypes.PupJoint{}
-				_, _ = fmt.Sscanf(p.line, "%d=%d", &joint.Joint, &joint.Node)
+				if err := p.scanLine(p.line, "%d=%d", &joint.Joint, &joint.Node); err != nil {
+					return jktypes.Pup{}, err
+				}
 				p.pup.Joints = append(p.pup.Joints, joint)
 			}
 		} else {
 			if mode == nil {
-				panic("Processing submode without a mode")
+				return jktypes.Pup{}, p.errorf("%w: submode %q without a mode", ErrMalformed, p.line)
 			}
 			subMode := jktypes.PupSubMode{}
-			_, _ = fmt.Sscanf(p.line, "%s %s %v %d %d", &subMode.Name, &subMode.Keyframe, &subMode.Flags,
+			n, _ := fmt.Sscanf(p.line, "%s %s %v %d %d", &subMode.Name, &subMode.Keyframe, &subMode.Flags,
 				&subMode.LoPri, &subMode.HiPri)
+			if n < 2 {
+				return jktypes.Pup{}, p.malformed("submode name and keyframe", p.line)
+			}
 			mode.SubModes = append(mode.SubModes, subMode)
 		}
 	}
 
-	return p.pup
+	return p.pup, nil
 }
 
 func (p *PupLineParser) getNextLine() bool {
@@ -87,6 +103,7 @@ func (p *PupLineParser) getNextLine() bool {
 			p.done = true
 			break
 		}
+		p.lineNum++
 		line := p.scanner.Text()
 		line = strings.TrimSpace(line)
 		line = strings.ToLower(line)
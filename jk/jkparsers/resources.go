@@ -0,0 +1,27 @@
+package jkparsers
+
+import (
+	"errors"
+	"github.com/joelhays/go-jk/jk"
+	"io/fs"
+	"log"
+)
+
+// loadResource reads a file referenced by the file being parsed, e.g. a MAT used
+// by a level. Missing files are logged and give nil, parsers go on without them.
+func loadResource(resolver jk.ResourceResolver, name string) []byte {
+	if resolver == nil {
+		log.Printf("unable to find %s", name)
+		return nil
+	}
+	fileBytes, err := resolver.ReadResource(name)
+	if errors.Is(err, fs.ErrNotExist) {
+		log.Printf("unable to find %s", name)
+		return nil
+	}
+	if err != nil {
+		log.Println(err)
+		return nil
+	}
+	return fileBytes
+}
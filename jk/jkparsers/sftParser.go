@@ -1,31 +1,51 @@
 package jkparsers
 
 import (
+	"encoding/binary"
+	"fmt"
 	"github.com/joelhays/go-jk/jk"
 	"github.com/joelhays/go-jk/jk/jktypes"
 )
 
 type SftParser struct {
+	parseContext
+	resolver jk.ResourceResolver
 }
 
-func NewSftParser() *SftParser {
-	return &SftParser{}
+func NewSftParser(resolver jk.ResourceResolver) *SftParser {
+	return &SftParser{resolver: resolver}
 }
 
-func (p *SftParser) ParseFromBytes(data []byte) jktypes.SFTFile {
+func (p *SftParser) ParseFromBytes(data []byte) (jktypes.SFTFile, error) {
+	p.reset()
+
 	result := jktypes.SFTFile{}
 
 	cursor := 0
+	p.section = "header"
 	var header jktypes.TSFTHeader
-	cursor += readBytes(data, cursor, &header)
+	n, err := readBytes(data, cursor, &header)
+	if err != nil {
+		return result, p.wrapError(err)
+	}
+	cursor += n
+
+	// every table has a character range and at least one character
+	minTableSize := binary.Size(struct{ FirstChar, LastChar int16 }{}) + binary.Size(jktypes.TCharDef{})
+	if header.NumTables < 0 || int(header.NumTables) > (len(data)-cursor)/minTableSize {
+		return result, p.errorf("%w: invalid table count %d", ErrMalformed, header.NumTables)
+	}
 
 	result.Header = header
 	result.CharacterTables = make([]jktypes.TCharacterTable, header.NumTables)
 
-	bmParser := NewBmParser()
+	bmParser := NewBmParser(p.resolver)
+	bmParser.SetFileName(p.fileName)
 
 	for i := int32(0); i < header.NumTables; i++ {
 		//fmt.Println("reading table", i+1, "of", header.NumTables)
+		p.offset = cursor
+		p.section = fmt.Sprintf("character table %d", i)
 
 		tableInfo := struct {
 			FirstChar int16
@@ -34,33 +54,53 @@ func (p *SftParser) ParseFromBytes(data []byte) jktypes.SFTFile {
 			0,
 			0,
 		}
-		cursor += readBytes(data, cursor, &tableInfo)
+		n, err := readBytes(data, cursor, &tableInfo)
+		if err != nil {
+			return result, p.wrapError(err)
+		}
+		cursor += n
+
+		if tableInfo.LastChar < tableInfo.FirstChar {
+			return result, p.errorf("%w: invalid character range %d-%d", ErrMalformed, tableInfo.FirstChar, tableInfo.LastChar)
+		}
 
 		var table jktypes.TCharacterTable
 		table.FirstChar = tableInfo.FirstChar
 		table.LastChar = tableInfo.LastChar
-		table.CharDefs = make([]jktypes.TCharDef, table.LastChar-table.FirstChar+1)
+		table.CharDefs = make([]jktypes.TCharDef, int(table.LastChar)-int(table.FirstChar)+1)
 
 		for j := 0; j < len(table.CharDefs); j++ {
 			var def jktypes.TCharDef
-			cursor += readBytes(data, cursor, &def)
+			n, err := readBytes(data, cursor, &def)
+			if err != nil {
+				return result, p.wrapError(err)
+			}
+			cursor += n
 			table.CharDefs[j] = def
 		}
 
 		result.CharacterTables[i] = table
 	}
 
-	bm := bmParser.ParseFromBytes(data[cursor:])
+	bm, err := bmParser.ParseFromBytes(data[cursor:])
+	if err != nil {
+		return result, err
+	}
 	if bm.Header.PaletteIncluded != 2 {
 		var cmp jktypes.ColorMap
-		fileBytes := jk.GetLoader().LoadResource("uicolormap.cmp")
+		fileBytes := loadResource(p.resolver, "uicolormap.cmp")
 		if fileBytes != nil {
-			cmp = NewCmpParser().ParseFromBytes(fileBytes)
+			cmpParser := NewCmpParser()
+			cmpParser.SetFileName("uicolormap.cmp")
+			cmp, err = cmpParser.ParseFromBytes(fileBytes)
+			if err != nil {
+				return result, err
+			}
 		}
 		bm.Palette.Palette = cmp.Palette
 	}
 
 	result.BMFile = bm
 
-	return result
+	return result, nil
 }
@@ -5,47 +5,42 @@ import (
 	"encoding/binary"
 	"fmt"
 	"github.com/go-gl/mathgl/mgl32"
-	"log"
-	"reflect"
+	"io"
 )
 
-func readBytes(data []byte, cursor int, object interface{}) int {
-	value := reflect.Indirect(reflect.ValueOf(object))
-	var sizeInBytes int
-	if value.Kind() == reflect.Slice {
-		sizeInBytes = value.Len()
-	} else {
-		sizeInBytes = int(value.Type().Size())
+func readBytes(data []byte, cursor int, object interface{}) (int, error) {
+	sizeInBytes := binary.Size(object)
+	if sizeInBytes < 0 {
+		return 0, fmt.Errorf("unable to read %T", object)
+	}
+	if cursor < 0 || cursor+sizeInBytes > len(data) {
+		return 0, fmt.Errorf("reading %d bytes at offset %#x of %d: %w", sizeInBytes, cursor, len(data), io.ErrUnexpectedEOF)
 	}
 	buf := bytes.NewBuffer(data[cursor : cursor+sizeInBytes])
-	binary.Read(buf, binary.LittleEndian, object)
-	return sizeInBytes
+	if err := binary.Read(buf, binary.LittleEndian, object); err != nil {
+		return 0, err
+	}
+	return sizeInBytes, nil
 }
 
-func parseVec3(line string) (int32, mgl32.Vec3) {
+func parseVec3(line string) (int32, mgl32.Vec3, error) {
 	var id int32
 	v := mgl32.Vec3{}
 	n, err := fmt.Sscanf(line, "%d: %f %f %f", &id, &v[0], &v[1], &v[2])
-	if err != nil {
-		log.Fatal(err)
-	}
-	if n != 4 {
-		panic("Unable to get vec3 from line: " + line)
+	if err != nil || n != 4 {
+		return 0, v, fmt.Errorf("%w: unable to get vec3 from line %q", ErrMalformed, line)
 	}
 
-	return id, v
+	return id, v, nil
 }
 
-func parseVec2(line string) (int32, mgl32.Vec2) {
+func parseVec2(line string) (int32, mgl32.Vec2, error) {
 	var id int32
 	v := mgl32.Vec2{}
 	n, err := fmt.Sscanf(line, "%d: %f %f", &id, &v[0], &v[1])
-	if err != nil {
-		log.Fatal(err)
-	}
-	if n != 3 {
-		panic("Unable to get vec2 from line: " + line)
+	if err != nil || n != 3 {
+		return 0, v, fmt.Errorf("%w: unable to get vec2 from line %q", ErrMalformed, line)
 	}
 
-	return id, v
+	return id, v, nil
 }
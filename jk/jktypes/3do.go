@@ -33,6 +33,8 @@ type Face struct {
 }
 
 type HierarchyDef struct {
+	Flags       int64
+	Type        int64
 	MeshID      int64
 	ParentID    int64
 	ChildID     int64
@@ -1,5 +1,10 @@
 package jktypes
 
+import (
+	"encoding/binary"
+	"fmt"
+)
+
 type BMFile struct {
 	Header  TBMHeader
 	Images  []TImage
@@ -39,3 +44,63 @@ type TImage struct {
 type TPalette struct {
 	Palette [256]Vec3Byte
 }
+
+// Image returns the image at index, false when the BM has no such image.
+func (bm *BMFile) Image(index int) (TImage, bool) {
+	if index < 0 || index >= len(bm.Images) {
+		return TImage{}, false
+	}
+	return bm.Images[index], true
+}
+
+// BytesPerPixel returns the size of a pixel of Data, 1 for paletted images and 2 otherwise.
+func (bm *BMFile) BytesPerPixel() int {
+	if bm.Header.NumBits != 8 {
+		return 2
+	}
+	return 1
+}
+
+// RGBA decodes the image at index to 4 bytes per pixel, in the order of Data.
+// 8 bit images are in the colors of the palette, 16 bit ones are laid out by
+// the bit counts of the header with red in the high bits, 565 when there are
+// none. Pixels of the transparent color of the header are see-through.
+func (bm *BMFile) RGBA(index int) ([]byte, error) {
+	img, ok := bm.Image(index)
+	if !ok {
+		return nil, fmt.Errorf("no image %d, the BM has %d", index, len(bm.Images))
+	}
+	numPixels := int(img.SizeX) * int(img.SizeY)
+	if img.SizeX < 0 || img.SizeY < 0 || len(img.Data) < numPixels*bm.BytesPerPixel() {
+		return nil, fmt.Errorf("image %d: %dx%d with %d bytes of data", index, img.SizeX, img.SizeY, len(img.Data))
+	}
+
+	redBits, greenBits, blueBits := uint(bm.Header.RedBits), uint(bm.Header.GreenBits), uint(bm.Header.BlueBits)
+	if redBits == 0 || greenBits == 0 || blueBits == 0 || redBits+greenBits+blueBits > 16 {
+		redBits, greenBits, blueBits = 5, 6, 5
+	}
+	channel := func(v uint16, shift uint, bits uint) byte {
+		max := uint16(1)<<bits - 1
+		return byte(uint32(v>>shift&max) * 255 / uint32(max))
+	}
+
+	rgba := make([]byte, numPixels*4)
+	for i := 0; i < numPixels; i++ {
+		var value int32
+		if bm.BytesPerPixel() == 1 {
+			value = int32(img.Data[i])
+			c := bm.Palette.Palette[img.Data[i]]
+			rgba[i*4], rgba[i*4+1], rgba[i*4+2] = c.R, c.G, c.B
+		} else {
+			v := binary.LittleEndian.Uint16(img.Data[i*2:])
+			value = int32(v)
+			rgba[i*4] = channel(v, greenBits+blueBits, redBits)
+			rgba[i*4+1] = channel(v, blueBits, greenBits)
+			rgba[i*4+2] = channel(v, 0, blueBits)
+		}
+		if value != bm.Header.Transparent {
+			rgba[i*4+3] = 255
+		}
+	}
+	return rgba, nil
+}
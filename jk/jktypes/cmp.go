@@ -14,6 +14,17 @@ type Vec3Byte struct {
 	B byte
 }
 
+const (
+	ColorMapLightLevels       = 64
+	ColorMapTransparencyTable = 256
+)
+
 type ColorMap struct {
 	Palette [256]Vec3Byte
+	// LightLevels maps a palette index to the index to draw at each of the 64
+	// light levels, from darkest to fully lit.
+	LightLevels [][256]byte
+	// Transparency maps a foreground and background palette index to the
+	// blended index. It is empty when the colormap has no transparency tables.
+	Transparency [][256]byte
 }
@@ -0,0 +1,276 @@
+package jktypes
+
+import (
+	"github.com/go-gl/mathgl/mgl32"
+	"strings"
+)
+
+const (
+	COG_FLAG_LOCAL  = 0x40
+	COG_FLAG_SERVER = 0x80
+	COG_FLAG_GLOBAL = 0x100
+	COG_FLAG_NOSYNC = 0x200
+)
+
+type CogSymbolType int
+
+const (
+	COG_SYMBOL_AI CogSymbolType = iota
+	COG_SYMBOL_COG
+	COG_SYMBOL_FLEX
+	COG_SYMBOL_FLOAT
+	COG_SYMBOL_INT
+	COG_SYMBOL_KEYFRAME
+	COG_SYMBOL_MATERIAL
+	COG_SYMBOL_MESSAGE
+	COG_SYMBOL_MODEL
+	COG_SYMBOL_SECTOR
+	COG_SYMBOL_SOUND
+	COG_SYMBOL_SURFACE
+	COG_SYMBOL_TEMPLATE
+	COG_SYMBOL_THING
+	COG_SYMBOL_VECTOR
+)
+
+var cogSymbolTypeNames = []string{"ai", "cog", "flex", "float", "int", "keyframe", "material", "message", "model",
+	"sector", "sound", "surface", "template", "thing", "vector"}
+
+func (t CogSymbolType) String() string {
+	if t < 0 || int(t) >= len(cogSymbolTypeNames) {
+		return "unknown"
+	}
+	return cogSymbolTypeNames[t]
+}
+
+// CogSymbolTypeFromName returns the symbol type for a type name of the symbols section.
+func CogSymbolTypeFromName(name string) (CogSymbolType, bool) {
+	for i, typeName := range cogSymbolTypeNames {
+		if strings.EqualFold(typeName, name) {
+			return CogSymbolType(i), true
+		}
+	}
+	return 0, false
+}
+
+// CogPos is the 1-based line and column of a symbol or AST node in the COG source.
+type CogPos struct {
+	Line   int
+	Column int
+}
+
+func (p CogPos) Pos() CogPos {
+	return p
+}
+
+type Cog struct {
+	Flags   int64
+	Symbols []CogSymbol
+	Code    []CogStmt
+}
+
+// CogSymbol is a line of the symbols section. LinkID is -1 for symbols without
+// a linkid, Default is the unparsed value following the '='.
+type CogSymbol struct {
+	CogPos
+	Type       CogSymbolType
+	Name       string
+	Default    string
+	HasDefault bool
+	Local      bool
+	NoLink     bool
+	LinkID     int64
+	Mask       int64
+	HasMask    bool
+	Desc       string
+}
+
+// FindSymbol returns the index of the symbol with the given name, or -1. COG
+// names are case insensitive.
+func (c *Cog) FindSymbol(name string) int {
+	for i := range c.Symbols {
+		if strings.EqualFold(c.Symbols[i].Name, name) {
+			return i
+		}
+	}
+	return -1
+}
+
+// Messages returns the names of the declared messages.
+func (c *Cog) Messages() []string {
+	var messages []string
+	for _, symbol := range c.Symbols {
+		if symbol.Type == COG_SYMBOL_MESSAGE {
+			messages = append(messages, symbol.Name)
+		}
+	}
+	return messages
+}
+
+// Labels returns the index into Code of every top level label, keyed by the
+// lower case label name.
+func (c *Cog) Labels() map[string]int {
+	labels := make(map[string]int)
+	for i, stmt := range c.Code {
+		if label, ok := stmt.(*CogLabelStmt); ok {
+			labels[strings.ToLower(label.Name)] = i
+		}
+	}
+	return labels
+}
+
+type CogStmt interface {
+	Pos() CogPos
+	cogStmt()
+}
+
+type CogExpr interface {
+	Pos() CogPos
+	cogExpr()
+}
+
+type CogLabelStmt struct {
+	CogPos
+	Name string
+}
+
+type CogExprStmt struct {
+	CogPos
+	X CogExpr
+}
+
+type CogBlockStmt struct {
+	CogPos
+	List []CogStmt
+}
+
+// CogIfStmt is an if statement, Else is nil without an else branch.
+type CogIfStmt struct {
+	CogPos
+	Cond CogExpr
+	Then CogStmt
+	Else CogStmt
+}
+
+type CogWhileStmt struct {
+	CogPos
+	Cond CogExpr
+	Body CogStmt
+}
+
+type CogDoStmt struct {
+	CogPos
+	Body CogStmt
+	Cond CogExpr
+}
+
+// CogForStmt is a for loop, Init, Cond and Post are nil when left empty.
+type CogForStmt struct {
+	CogPos
+	Init CogExpr
+	Cond CogExpr
+	Post CogExpr
+	Body CogStmt
+}
+
+// CogCallStmt runs the code at a label until it returns.
+type CogCallStmt struct {
+	CogPos
+	Label string
+}
+
+type CogReturnStmt struct {
+	CogPos
+}
+
+type CogStopStmt struct {
+	CogPos
+}
+
+type CogEmptyStmt struct {
+	CogPos
+}
+
+func (*CogLabelStmt) cogStmt()  {}
+func (*CogExprStmt) cogStmt()   {}
+func (*CogBlockStmt) cogStmt()  {}
+func (*CogIfStmt) cogStmt()     {}
+func (*CogWhileStmt) cogStmt()  {}
+func (*CogDoStmt) cogStmt()     {}
+func (*CogForStmt) cogStmt()    {}
+func (*CogCallStmt) cogStmt()   {}
+func (*CogReturnStmt) cogStmt() {}
+func (*CogStopStmt) cogStmt()   {}
+func (*CogEmptyStmt) cogStmt()  {}
+
+type CogIdent struct {
+	CogPos
+	Name string
+}
+
+// CogIndexExpr addresses the symbol Index places after the named symbol.
+type CogIndexExpr struct {
+	CogPos
+	Name  string
+	Index CogExpr
+}
+
+// CogIntLit is an integer constant, Raw keeps the spelling, e.g. hex flags.
+type CogIntLit struct {
+	CogPos
+	Value int32
+	Raw   string
+}
+
+type CogFloatLit struct {
+	CogPos
+	Value float32
+	Raw   string
+}
+
+type CogStringLit struct {
+	CogPos
+	Value string
+}
+
+type CogVectorLit struct {
+	CogPos
+	Value mgl32.Vec3
+	Raw   string
+}
+
+type CogUnaryExpr struct {
+	CogPos
+	Op string
+	X  CogExpr
+}
+
+type CogBinaryExpr struct {
+	CogPos
+	Op string
+	X  CogExpr
+	Y  CogExpr
+}
+
+// CogAssignExpr assigns to a CogIdent or CogIndexExpr.
+type CogAssignExpr struct {
+	CogPos
+	Target CogExpr
+	Value  CogExpr
+}
+
+type CogCallExpr struct {
+	CogPos
+	Verb string
+	Args []CogExpr
+}
+
+func (*CogIdent) cogExpr()      {}
+func (*CogIndexExpr) cogExpr()  {}
+func (*CogIntLit) cogExpr()     {}
+func (*CogFloatLit) cogExpr()   {}
+func (*CogStringLit) cogExpr()  {}
+func (*CogVectorLit) cogExpr()  {}
+func (*CogUnaryExpr) cogExpr()  {}
+func (*CogBinaryExpr) cogExpr() {}
+func (*CogAssignExpr) cogExpr() {}
+func (*CogCallExpr) cogExpr()   {}
@@ -10,6 +10,15 @@ type Jkl struct {
 	Jk3dos         map[string]Jk3doFile
 	Jk3doTemplates map[string]Template
 	Things         []Thing
+	Sectors        []Sector
+	Cogs           []LevelCog
+}
+
+// LevelCog places a COG script in the level, Values are assigned to the symbols
+// of the script that are neither local nor messages, in order.
+type LevelCog struct {
+	Script string
+	Values []string
 }
 
 type Surface struct {
@@ -19,12 +28,52 @@ type Surface struct {
 	Normal           mgl32.Vec3
 	Geo              int64
 	MaterialID       int64
+	SurfaceFlags     int64
+	FaceFlags        int64
+	Light            int64
+	Tex              int64
+	Adjoin           int64 // index into JkMesh.Adjoins, -1 when the surface is solid
+	ExtraLight       float64
+	Sector           int64 // owning sector, derived from the sector surface ranges
+}
+
+// Adjoin links a surface to the matching surface of the neighbouring sector.
+type Adjoin struct {
+	Flags    int64
+	Mirror   int64 // index of the adjoin on the other side
+	Distance float64
+	Surface  int64 // surface owning this adjoin, -1 when unused
+	Sector   int64 // sector on the other side of the adjoin, -1 when unknown
+}
+
+type BoundingBox struct {
+	Min mgl32.Vec3
+	Max mgl32.Vec3
+}
+
+type Sector struct {
+	Flags         int64
+	AmbientLight  float64
+	ExtraLight    float64
+	ColorMap      int64
+	Tint          mgl32.Vec3
+	BoundBox      BoundingBox
+	CollideBox    BoundingBox
+	HasCollideBox bool
+	Sound         string
+	SoundVolume   float64
+	Center        mgl32.Vec3
+	Radius        float64
+	VertexIds     []int64
+	FirstSurface  int64
+	NumSurfaces   int64
 }
 
 type Template struct {
-	Name      string
-	Jk3doName string
-	Size      float64
+	Name       string
+	Jk3doName  string
+	PuppetName string
+	Size       float64
 }
 
 type Thing struct {
@@ -33,6 +82,14 @@ type Thing struct {
 	Pitch        float64
 	Yaw          float64
 	Roll         float64
+	Sector       int64
+	Frames       []ThingFrame
+}
+
+// ThingFrame is a position a thing can be moved to, e.g. the open position of a door.
+type ThingFrame struct {
+	Position    mgl32.Vec3
+	Orientation mgl32.Vec3 // pitch, yaw, roll
 }
 
 type JkMesh struct {
@@ -41,6 +98,7 @@ type JkMesh struct {
 	TextureVertices []mgl32.Vec2
 	VertexNormals   []mgl32.Vec3
 	Surfaces        []Surface
+	Adjoins         []Adjoin
 	Materials       []Material
 	ColorMaps       []ColorMap
 }
@@ -10,9 +10,16 @@ const (
 
 type Key struct {
 	Header        KeyHeader
+	Markers       []KeyMarker
 	KeyframeNodes []KeyframeNode
 }
 
+// KeyMarker tags a frame with an event, e.g. a footstep or the moment of an attack.
+type KeyMarker struct {
+	Frame float32
+	Type  int32
+}
+
 type KeyHeader struct {
 	Flags  byte
 	Type   int32
@@ -22,6 +29,7 @@ type KeyHeader struct {
 }
 
 type KeyframeNode struct {
+	Number   int32
 	MeshName string
 	Entries  []KeyframeNodeEntry
 }
@@ -1,5 +1,10 @@
 package jktypes
 
+const (
+	MAT_TYPE_COLOR   = 0
+	MAT_TYPE_TEXTURE = 2
+)
+
 type MtlHeader struct {
 	Name         [4]byte
 	Ver          int32
@@ -33,7 +38,12 @@ type TextureData struct {
 	NumMipMaps int32
 }
 
+// Material holds every cel of a MAT file. Texture, SizeX, SizeY and Transparent
+// describe the full sized image of the first cel.
 type Material struct {
+	Name        string
+	Type        int32
+	Cels        []MaterialCel
 	Texture     []byte
 	SizeX       int32
 	SizeY       int32
@@ -41,3 +51,27 @@ type Material struct {
 	YTile       float32
 	Transparent bool
 }
+
+// MaterialCel is a single animation frame of a material. MipMaps[0] is the full
+// sized image and every following level is half the size of the previous one.
+// A color cel is a single texel of palette index ColorIndex.
+type MaterialCel struct {
+	SizeX       int32
+	SizeY       int32
+	ColorIndex  int32
+	Transparent bool
+	MipMaps     [][]byte
+}
+
+// MipMapSize returns the dimensions of a mipmap level.
+func (c MaterialCel) MipMapSize(level int) (int32, int32) {
+	sizeX := c.SizeX >> uint(level)
+	sizeY := c.SizeY >> uint(level)
+	if sizeX < 1 {
+		sizeX = 1
+	}
+	if sizeY < 1 {
+		sizeY = 1
+	}
+	return sizeX, sizeY
+}
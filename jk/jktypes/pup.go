@@ -6,6 +6,7 @@ type Pup struct {
 }
 
 type PupMode struct {
+	Number      int32
 	SubModes    []PupSubMode
 	BasedOn     int32
 	IsInherited bool
@@ -2,67 +2,235 @@ package jk
 
 import (
 	"fmt"
+	"io/ioutil"
 	"log"
+	"path/filepath"
+	"sort"
 	"strings"
 	"sync"
 )
 
 var (
-	instance         *Loader
-	once             sync.Once
-	resourceGobFiles = []string{"J:\\Resource\\Res2.gob", "J:\\Resource\\Res1hi.gob"}
-	episodeGobFiles  = []string{"J:\\Episode\\JK1.GOB", "J:\\Episode\\JK1CTF.GOB", "J:\\Episode\\JK1MP.GOB"}
+	instance *Loader
+	mutex    sync.Mutex
+
+	// gob files in the order they should be searched
+	gobFilePatterns = []string{"res2.gob", "res1hi.gob", "jk1*.gob"}
+	gobSubDirs      = []string{"", "resource", "episode"}
 )
 
 type Loader struct {
+	resourceGobFiles []string
+	episodeGobFiles  []string
+	index            *ResourceIndex
+	fsys             *FS
+}
+
+// GobNotFoundError is returned when no GOB files could be found under the install root.
+type GobNotFoundError struct {
+	InstallDir string
+	Tried      []string
+}
+
+func (e *GobNotFoundError) Error() string {
+	return fmt.Sprintf("no GOB files found in %q, tried:\n\t%s", e.InstallDir, strings.Join(e.Tried, "\n\t"))
+}
+
+// InitLoader creates the shared Loader from the given configuration.
+func InitLoader(cfg Config) error {
+	loader, err := NewLoader(cfg)
+	if err != nil {
+		return err
+	}
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	instance = loader
+
+	return nil
 }
 
+// GetLoader returns the shared Loader. Without a call to InitLoader the
+// returned Loader has no GOB files and every lookup fails.
 func GetLoader() *Loader {
-	once.Do(func() {
+	mutex.Lock()
+	defer mutex.Unlock()
+	if instance == nil {
 		instance = &Loader{}
-	})
+	}
 	return instance
 }
 
-func (l *Loader) getGobFiles(gobFiles []string, suffix string) []string {
-	var files []string
+// NewLoader searches the install root and its Resource and Episode directories
+// for the game GOB files. Directory and file names are matched case-insensitively.
+// A GOB containing an episode.jk entry is treated as an episode GOB, all
+// others are treated as resource GOBs.
+func NewLoader(cfg Config) (*Loader, error) {
+	if cfg.InstallDir == "" {
+		return nil, fmt.Errorf("no install directory configured, use -installdir, %s or %s", InstallDirEnv, configFileName)
+	}
+
+	gobFiles, tried := findGobFiles(cfg.InstallDir)
+	if len(gobFiles) == 0 {
+		return nil, &GobNotFoundError{InstallDir: cfg.InstallDir, Tried: tried}
+	}
+
+	l := &Loader{}
 	for _, gob := range gobFiles {
-		for _, gobData := range loadGOBManifest(gob).Items {
-			if strings.HasSuffix(gobData.FileName, suffix) {
-				files = append(files, gobData.FileName)
+		episode, err := isEpisodeGob(gob)
+		if err != nil {
+			log.Println(err)
+			continue
+		}
+		if episode {
+			l.episodeGobFiles = append(l.episodeGobFiles, gob)
+		} else {
+			l.resourceGobFiles = append(l.resourceGobFiles, gob)
+		}
+	}
+
+	if len(l.resourceGobFiles) == 0 && len(l.episodeGobFiles) == 0 {
+		return nil, fmt.Errorf("none of the GOB files found in %q could be read", cfg.InstallDir)
+	}
+
+	index, err := NewResourceIndex(cfg.OverrideDir, l.episodeGobFiles, l.resourceGobFiles)
+	if err != nil {
+		return nil, err
+	}
+	l.index = index
+	l.fsys = newFS(index)
+
+	return l, nil
+}
+
+func findGobFiles(installDir string) ([]string, []string) {
+	var tried []string
+	var found []string
+
+	for _, subDir := range gobSubDirs {
+		dir := installDir
+		if subDir != "" {
+			dir = findFileInDir(installDir, subDir)
+			if dir == "" {
+				for _, pattern := range gobFilePatterns {
+					tried = append(tried, filepath.Join(installDir, subDir, pattern))
+				}
+				continue
+			}
+		}
+
+		entries, _ := ioutil.ReadDir(dir)
+
+		for _, pattern := range gobFilePatterns {
+			tried = append(tried, filepath.Join(dir, pattern))
+
+			var matches []string
+			for _, entry := range entries {
+				if entry.IsDir() {
+					continue
+				}
+				if ok, _ := filepath.Match(pattern, strings.ToLower(entry.Name())); ok {
+					matches = append(matches, filepath.Join(dir, entry.Name()))
+				}
 			}
+			sort.Strings(matches)
+			found = append(found, matches...)
+		}
+	}
+
+	return found, tried
+}
+
+func findFileInDir(dir string, name string) string {
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return ""
+	}
+	for _, entry := range entries {
+		if strings.EqualFold(entry.Name(), name) {
+			return filepath.Join(dir, entry.Name())
+		}
+	}
+	return ""
+}
+
+func isEpisodeGob(gobPath string) (bool, error) {
+	gob, err := loadGOBManifest(gobPath)
+	if err != nil {
+		return false, err
+	}
+	for _, item := range gob.Items {
+		if item.UpperFileName == "EPISODE.JK" {
+			return true, nil
 		}
 	}
+	return false, nil
+}
+
+// ResourceGobFiles returns the paths of the resource GOBs in search order.
+func (l *Loader) ResourceGobFiles() []string {
+	return l.resourceGobFiles
+}
+
+// EpisodeGobFiles returns the paths of the episode GOBs in search order.
+func (l *Loader) EpisodeGobFiles() []string {
+	return l.episodeGobFiles
+}
+
+// Resolve finds the file a name or path refers to, e.g. "rystr.3do" or
+// "3do\\rystr.3do". The entry tells which archive or directory provides it.
+func (l *Loader) Resolve(filename string) (ResourceEntry, bool) {
+	if l.index == nil {
+		return ResourceEntry{}, false
+	}
+	return l.index.Lookup(filename)
+}
 
-	return files
+// FS returns the files of the loader as a file system, the override directory
+// taking precedence over the episode GOBs and those over the resource GOBs. It
+// stays usable until the loader is closed.
+func (l *Loader) FS() *FS {
+	if l.fsys == nil {
+		l.fsys = newFS(&ResourceIndex{paths: make(map[string]ResourceEntry), names: make(map[string]ResourceEntry)})
+	}
+	return l.fsys
 }
 
+// LoadManifest returns the path of every file with the given extension.
 func (l *Loader) LoadManifest(resourceType string) []string {
-	return l.getGobFiles(resourceGobFiles, "."+resourceType)
+	if l.index == nil {
+		return nil
+	}
+	return l.index.Paths(resourceType)
 }
 
+// LoadResource returns the content of a file, looked up as by Resolve, or nil
+// when it cannot be found or read.
 func (l *Loader) LoadResource(filename string) []byte {
-	for _, gob := range resourceGobFiles {
-		fileBytes := loadFileFromGOB(gob, filename)
-		if fileBytes == nil {
-			continue
-		}
-		return fileBytes
+	entry, ok := l.Resolve(filename)
+	if !ok {
+		log.Println(fmt.Errorf("unable to find %s", filename))
+		return nil
 	}
 
-	log.Println(fmt.Errorf("unable to find %s", filename))
-	return nil
+	fileBytes, err := l.index.Read(entry)
+	if err != nil {
+		log.Println(err)
+		return nil
+	}
+	return fileBytes
 }
 
+// LoadEpisode returns the content of an episode file. Episode and resource files
+// are looked up the same way, the episode GOBs taking precedence.
 func (l *Loader) LoadEpisode(filename string) []byte {
-	for _, gob := range episodeGobFiles {
-		fileBytes := loadFileFromGOB(gob, filename)
-		if fileBytes == nil {
-			continue
-		}
-		return fileBytes
-	}
+	return l.LoadResource(filename)
+}
 
-	log.Println(fmt.Errorf("unable to find %s", filename))
-	return nil
+// Close closes the GOB files opened by the loader.
+func (l *Loader) Close() error {
+	if l.index == nil {
+		return nil
+	}
+	return l.index.Close()
 }
@@ -0,0 +1,70 @@
+package jk
+
+import (
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+)
+
+// ResourceResolver provides the files referenced by a file being parsed, e.g.
+// the MATs and 3DOs of a level. Names are looked up like the engine does, by
+// path or by name in the directories used for their type. FS resolves from the
+// game GOBs.
+type ResourceResolver interface {
+	ReadResource(name string) ([]byte, error)
+}
+
+// FSResolver resolves from any file system, e.g. os.DirFS or fstest.MapFS.
+type FSResolver struct {
+	FS fs.FS
+}
+
+func (r FSResolver) ReadResource(name string) ([]byte, error) {
+	return ReadResource(r.FS, name)
+}
+
+// MemoryResolver resolves from files held in memory. A name without directory
+// that is not in the search directories of its type matches the file with that
+// name in the first path in sorted order.
+type MemoryResolver struct {
+	paths map[string][]byte
+	names map[string]string
+}
+
+// NewMemoryResolver creates a resolver over files, keyed by path.
+func NewMemoryResolver(files map[string][]byte) *MemoryResolver {
+	r := &MemoryResolver{paths: make(map[string][]byte), names: make(map[string]string)}
+
+	keys := make([]string, 0, len(files))
+	for name := range files {
+		keys = append(keys, name)
+	}
+	sort.Strings(keys)
+	for _, name := range keys {
+		r.Add(name, files[name])
+	}
+	return r
+}
+
+// Add adds or replaces a file.
+func (r *MemoryResolver) Add(name string, data []byte) {
+	key := normalizeResourcePath(name)
+	r.paths[key] = data
+	base := path.Base(strings.Replace(key, "\\", "/", -1))
+	if _, ok := r.names[base]; !ok {
+		r.names[base] = key
+	}
+}
+
+func (r *MemoryResolver) ReadResource(name string) ([]byte, error) {
+	for _, key := range resourceKeys(name) {
+		if data, ok := r.paths[key]; ok {
+			return data, nil
+		}
+	}
+	if key, ok := r.names[normalizeResourcePath(name)]; ok {
+		return r.paths[key], nil
+	}
+	return nil, &fs.PathError{Op: "read", Path: name, Err: fs.ErrNotExist}
+}
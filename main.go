@@ -1,15 +1,17 @@
 package main
 
 import (
-	"github.com/go-gl/gl/v3.2-core/gl"
-	"github.com/go-gl/glfw/v3.2/glfw"
+	"flag"
 	"github.com/go-gl/mathgl/mgl32"
+	"github.com/joelhays/go-jk/backend"
 	"github.com/joelhays/go-jk/camera"
 	"github.com/joelhays/go-jk/jk"
+	"github.com/joelhays/go-jk/jk/jkparsers"
 	"github.com/joelhays/go-jk/opengl"
 	"github.com/joelhays/go-jk/scene"
 	"log"
 	"os"
+	"path/filepath"
 	"runtime"
 	"runtime/pprof"
 )
@@ -17,16 +19,49 @@ import (
 var (
 	cam          camera.Camera
 	previousTime float64
-	cpuprofile   = "go-jk.prof"
+	cpuprofile   = flag.String("cpuprofile", "", "write a CPU profile to this file")
+	useCache     = flag.Bool("cache", false, "keep parsed levels and models in the user cache directory to load them faster")
+	installDir   = flag.String("installdir", "", "path to the Jedi Knight install directory (overrides "+jk.InstallDirEnv+")")
+	overrideDir  = flag.String("overridedir", "", "directory of loose files taking precedence over the GOB files")
+	showStats    = flag.Bool("stats", false, "show the visible sectors, surfaces and things in the window title")
 )
 
 func main() {
-	f, err := os.Create(cpuprofile)
+	flag.Parse()
+
+	cfg, err := jk.LoadConfig(*installDir)
 	if err != nil {
 		log.Fatal(err)
 	}
-	pprof.StartCPUProfile(f)
-	defer pprof.StopCPUProfile()
+	if *overrideDir != "" {
+		cfg.OverrideDir = *overrideDir
+	}
+	if err := jk.InitLoader(cfg); err != nil {
+		log.Fatal(err)
+	}
+	defer jk.GetLoader().Close()
+
+	if *cpuprofile != "" {
+		f, err := os.Create(*cpuprofile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		pprof.StartCPUProfile(f)
+		defer pprof.StopCPUProfile()
+	}
+
+	if *useCache {
+		dir, err := jk.CacheDir()
+		if err != nil {
+			log.Fatal(err)
+		}
+		diskCache, err := jkparsers.NewDiskCache(filepath.Join(dir, "parsed"))
+		if err != nil {
+			log.Fatal(err)
+		}
+		scene.SetDiskCache(diskCache)
+	}
+	scene.SetShowStats(*showStats)
 
 	runtime.LockOSThread()
 	defer runtime.UnlockOSThread()
@@ -37,14 +72,8 @@ func main() {
 	//test3doParser()
 	//return
 
-	sceneManager := scene.NewSceneManager()
-	defer sceneManager.Unload()
-	inputManager := NewInputManager(sceneManager)
-
-	window := opengl.InitGlfw(1024, 768, inputManager.KeyCallback, inputManager.MouseCallback)
-	defer glfw.Terminate()
-
-	opengl.InitOpenGL()
+	window := opengl.NewWindow(1024, 768)
+	defer window.Terminate()
 
 	shaderProgram := opengl.NewShaderProgram("./shaders/vertex.glsl", "./shaders/fragment.glsl")
 	defer shaderProgram.Cleanup()
@@ -52,35 +81,49 @@ func main() {
 	guiShaderProgram := opengl.NewShaderProgram("./shaders/gui_vertex.glsl", "./shaders/gui_fragment.glsl")
 	defer guiShaderProgram.Cleanup()
 
+	run(opengl.NewBackend(window, shaderProgram, guiShaderProgram), window)
+}
+
+// run adds every scene and shows the menu until the window is closed.
+func run(b backend.Backend, window backend.Window) {
+	sceneManager := scene.NewSceneManager()
+	defer sceneManager.Unload()
+	inputManager := NewInputManager(sceneManager, b)
+	window.SetKeyCallback(inputManager.KeyCallback)
+	window.SetCursorCallback(inputManager.MouseCallback)
+
 	cam = camera.NewCamera(mgl32.Vec3{0, 0, 1}, mgl32.Vec3{0, 0, 1}, 0, -90)
 	cam.MovementSpeed = 2
 
-	for _, gobFileName := range jk.GetLoader().LoadManifest("jkl") {
-		sceneManager.Add(gobFileName, scene.NewJklScene(gobFileName, window, &cam, shaderProgram))
-	}
-	for _, gobFileName := range jk.GetLoader().LoadManifest("3do") {
-		sceneManager.Add(gobFileName, scene.NewJk3doScene(gobFileName, window, &cam, shaderProgram))
-	}
-	for _, gobFileName := range jk.GetLoader().LoadManifest("bm") {
-		sceneManager.Add(gobFileName, scene.NewBMScene(gobFileName, window, &cam, guiShaderProgram))
-	}
-	sceneManager.Add("3do", scene.NewJk3doScene("rystr.3do", window, &cam, shaderProgram))
-	sceneManager.Add("menu", scene.NewMainMenuScene(window, sceneManager))
-	sceneManager.Add("sft", scene.NewSFTScene("large0.sft", window, &cam, guiShaderProgram))
-	sceneManager.Add("bm", scene.NewBMScene("bkdialog.bm", window, &cam, guiShaderProgram))
+	addScenes(sceneManager, b, window)
 	sceneManager.LoadScene("menu")
 
 	for !window.ShouldClose() {
-		gl.Clear(gl.COLOR_BUFFER_BIT | gl.DEPTH_BUFFER_BIT)
-
-		deltaTime := glfw.GetTime() - previousTime
-		previousTime = glfw.GetTime()
+		deltaTime := window.GetTime() - previousTime
+		previousTime = window.GetTime()
 
 		doMovement(deltaTime)
 
+		b.BeginFrame(&cam)
 		sceneManager.Update()
+		b.EndFrame()
 
-		glfw.PollEvents()
-		window.SwapBuffers()
+		window.PollEvents()
+	}
+}
+
+func addScenes(sceneManager *scene.SceneManager, b backend.Backend, window backend.Window) {
+	for _, gobFileName := range jk.GetLoader().LoadManifest("jkl") {
+		sceneManager.Add(gobFileName, scene.NewJklScene(gobFileName, b, window, &cam))
+	}
+	for _, gobFileName := range jk.GetLoader().LoadManifest("3do") {
+		sceneManager.Add(gobFileName, scene.NewJk3doScene(gobFileName, "", b, window, &cam))
+	}
+	for _, gobFileName := range jk.GetLoader().LoadManifest("bm") {
+		sceneManager.Add(gobFileName, scene.NewBMScene(gobFileName, b, window, &cam))
 	}
+	sceneManager.Add("3do", scene.NewJk3doScene("rystr.3do", "ryidleg.key", b, window, &cam))
+	sceneManager.Add("menu", scene.NewMainMenuScene(b, window, sceneManager))
+	sceneManager.Add("sft", scene.NewSFTScene("large0.sft", b, window, &cam))
+	sceneManager.Add("bm", scene.NewBMScene("bkdialog.bm", b, window, &cam))
 }
@@ -3,6 +3,7 @@ package opengl
 import (
 	"fmt"
 	"github.com/go-gl/mathgl/mgl32"
+	"github.com/joelhays/go-jk/animation"
 	"github.com/joelhays/go-jk/jk/jktypes"
 
 	"github.com/go-gl/gl/v3.2-core/gl"
@@ -12,17 +13,31 @@ type OpenGl3doRenderer struct {
 	thing    *jktypes.Thing
 	template *jktypes.Template
 	object   *jktypes.Jk3doFile
+	sector   *jktypes.Sector
 	program  *ShaderProgram
 	vao      uint32
-	textures []uint32
+	vbo      uint32
+	animator *animation.CelAnimator
+	textures [][]uint32
 	lod      int32
+
+	poseSource  animation.PoseSource
+	meshOffsets []int32
+
+	indexTextures   [][]uint32
+	colormapTexture uint32
 }
 
-func NewOpenGl3doRenderer(thing *jktypes.Thing, template *jktypes.Template, object *jktypes.Jk3doFile, program *ShaderProgram) Renderer {
+// NewOpenGl3doRenderer creates a renderer for a 3do placed by thing. The object is
+// lit by the ambient and extra light of sector, or fully lit when sector is nil.
+// Animated materials show the cel picked by animator, or their first cel when it is nil.
+func NewOpenGl3doRenderer(thing *jktypes.Thing, template *jktypes.Template, object *jktypes.Jk3doFile, sector *jktypes.Sector,
+	animator *animation.CelAnimator, program *ShaderProgram) *OpenGl3doRenderer {
 	if thing == nil {
 		panic("Thing is nil!")
 	}
-	r := &OpenGl3doRenderer{thing: thing, template: template, object: object, program: program}
+	r := &OpenGl3doRenderer{thing: thing, template: template, object: object, sector: sector, animator: animator,
+		program: program}
 
 	r.lod = 0
 
@@ -37,6 +52,15 @@ func NewOpenGl3doRenderer(thing *jktypes.Thing, template *jktypes.Template, obje
 }
 
 func (r *OpenGl3doRenderer) Render() {
+	pose := animation.RestPose(r.object)
+	if r.poseSource != nil {
+		pose = r.poseSource.Pose()
+	}
+	r.render(r.thing, r.sector, r.colormapTexture, pose)
+}
+
+// render draws the object placed by thing, lit by sector and shaded through colormap.
+func (r *OpenGl3doRenderer) render(thing *jktypes.Thing, sector *jktypes.Sector, colormap uint32, pose []animation.NodePose) {
 	gl.Enable(gl.DEPTH_TEST)
 	gl.Enable(gl.CULL_FACE)
 
@@ -46,73 +70,80 @@ func (r *OpenGl3doRenderer) Render() {
 	gl.BindVertexArray(r.vao)
 	defer gl.BindVertexArray(0)
 
-	var offset int32
-	// render the main mesh if it has vertices
-	// render all child meshes with parent transform
-
-	for meshIdx, mesh := range r.object.GeoSets[r.lod].Meshes {
+	gl.ActiveTexture(gl.TEXTURE1)
+	gl.BindTexture(gl.TEXTURE_2D, colormap)
+	r.ShaderProgram().SetIntegerUniform("colormapTexture", 1)
+	defer func() {
+		gl.ActiveTexture(gl.TEXTURE1)
+		gl.BindTexture(gl.TEXTURE_2D, 0)
+	}()
+
+	ambientLight := float32(1)
+	var extraLight float32
+	if sector != nil {
+		ambientLight = float32(sector.AmbientLight)
+		extraLight = float32(sector.ExtraLight)
+	}
+	r.ShaderProgram().SetFloatUniform("ambientLight", ambientLight)
+	r.ShaderProgram().SetFloatUniform("extraLight", extraLight)
 
-		if len(mesh.Vertices) == 0 {
-			continue
-		}
+	nodeMatrices := animation.NodeMatrices(r.object, pose)
 
-		_ = meshIdx
-		model := mgl32.Ident4()
+	thingTranslate := mgl32.Translate3D(thing.Position.X(), thing.Position.Y(), thing.Position.Z())
+	thingRotation := animation.RotationMatrix(mgl32.Vec3{float32(thing.Pitch), float32(thing.Yaw), float32(thing.Roll)})
+	thingMatrix := thingTranslate.Mul4(thingRotation)
 
-		var hierarchy jktypes.HierarchyDef
-		for i := 0; i < len(r.object.Hierarchy); i++ {
-			h := r.object.Hierarchy[i]
-			if h.MeshID == int64(meshIdx) {
-				hierarchy = h
-				break
-			}
+	// meshes are placed by the hierarchy node they are attached to
+	meshes := r.object.GeoSets[r.lod].Meshes
+	meshMatrices := make([]mgl32.Mat4, len(meshes))
+	for i := range meshMatrices {
+		meshMatrices[i] = thingMatrix
+	}
+	for i, node := range r.object.Hierarchy {
+		if node.MeshID >= 0 && node.MeshID < int64(len(meshes)) {
+			meshMatrices[node.MeshID] = thingMatrix.Mul4(nodeMatrices[i])
 		}
+	}
 
-		meshRotateValues := mgl32.Vec3{float32(hierarchy.Pitch), float32(hierarchy.Roll), float32(hierarchy.Yaw)}
-		meshTranslateValues := hierarchy.Position
-
-		parentID := hierarchy.ParentID
-		for parentID != -1 {
-			parent := r.object.Hierarchy[parentID]
-
-			parentRotateValues := mgl32.Vec3{float32(parent.Pitch), float32(parent.Roll), float32(parent.Yaw)}
-			meshRotateValues = meshRotateValues.Add(parentRotateValues)
-
-			meshTranslateValues = meshTranslateValues.Add(parent.Position)
+	for meshIdx, mesh := range meshes {
 
-			parentID = parent.ParentID
+		if len(mesh.Vertices) == 0 {
+			continue
 		}
 
-		meshRotateX := mgl32.HomogRotate3DX(mgl32.DegToRad(meshRotateValues.X()))
-		meshRotateY := mgl32.HomogRotate3DY(mgl32.DegToRad(meshRotateValues.Y()))
-		meshRotateZ := mgl32.HomogRotate3DZ(mgl32.DegToRad(meshRotateValues.Z()))
-		meshRotation := meshRotateX.Mul4(meshRotateY.Mul4(meshRotateZ))
-		meshTranslation := mgl32.Translate3D(meshTranslateValues.X(), meshTranslateValues.Y(), meshTranslateValues.Z())
-		meshPivot := mgl32.Translate3D(hierarchy.Pivot.X(), hierarchy.Pivot.Y(), hierarchy.Pivot.Z())
-
-		thingTranslate := mgl32.Translate3D(r.thing.Position.X(), r.thing.Position.Y(), r.thing.Position.Z())
-		thingRotateX := mgl32.HomogRotate3DX(mgl32.DegToRad(float32(r.thing.Pitch)))
-		thingRotateY := mgl32.HomogRotate3DY(mgl32.DegToRad(float32(r.thing.Roll)))
-		thingRotateZ := mgl32.HomogRotate3DZ(mgl32.DegToRad(float32(r.thing.Yaw)))
-		thingRotation := thingRotateX.Mul4(thingRotateY.Mul4(thingRotateZ))
-
-		model = thingTranslate.Mul4(thingRotation).Mul4(meshTranslation).Mul4(meshRotation).Mul4(meshPivot)
-
-		r.ShaderProgram().SetMatrixUniform("model", model)
+		r.ShaderProgram().SetMatrixUniform("model", meshMatrices[meshIdx])
 
+		offset := r.meshOffsets[meshIdx]
 		for _, surface := range mesh.Faces {
 			numVerts := int32(len(surface.VertexIds))
 
 			if surface.GeometryMode != 0 {
 
+				material := &r.object.Materials[surface.MaterialID]
+				var cel int
+				if r.animator != nil {
+					cel = r.animator.MaterialCel(material)
+				}
+
 				gl.ActiveTexture(gl.TEXTURE0)
-				gl.BindTexture(gl.TEXTURE_2D, r.textures[surface.MaterialID])
+				gl.BindTexture(gl.TEXTURE_2D, celTexture(r.textures[surface.MaterialID], cel))
+				gl.ActiveTexture(gl.TEXTURE2)
+				gl.BindTexture(gl.TEXTURE_2D, celTexture(r.indexTextures[surface.MaterialID], cel))
+
+				var transparent int32
+				if cel < len(material.Cels) && material.Cels[cel].Transparent {
+					transparent = 1
+				}
 
 				r.ShaderProgram().SetIntegerUniform("objectTexture", 0)
+				r.ShaderProgram().SetIntegerUniform("indexTexture", 2)
+				r.ShaderProgram().SetIntegerUniform("transparent", transparent)
 
 				gl.DrawArrays(gl.TRIANGLE_FAN, offset, int32(len(surface.VertexIds)))
 
 				gl.BindTexture(gl.TEXTURE_2D, 0)
+				gl.ActiveTexture(gl.TEXTURE0)
+				gl.BindTexture(gl.TEXTURE_2D, 0)
 			}
 
 			offset = offset + numVerts
@@ -120,20 +151,36 @@ func (r *OpenGl3doRenderer) Render() {
 	}
 }
 
+// SetPoseSource poses the hierarchy with a KEY animation or puppet, or with the rest pose when it is nil.
+func (r *OpenGl3doRenderer) SetPoseSource(poseSource animation.PoseSource) {
+	r.poseSource = poseSource
+}
+
 func (r *OpenGl3doRenderer) ShaderProgram() *ShaderProgram {
 	return r.program
 }
 
+// Cleanup deletes the vertex array and textures.
+func (r *OpenGl3doRenderer) Cleanup() {
+	deleteVAO(r.vao, r.vbo)
+	deleteTextures(r.textures)
+	deleteTextures(r.indexTextures)
+	gl.DeleteTextures(1, &r.colormapTexture)
+}
+
 func (r *OpenGl3doRenderer) setupMesh() {
 	points := r.makePoints()
-	r.vao = loadToVAO(points)
+	r.vao, r.vbo = loadToVAO(points)
 	r.makeTextures()
 }
 
 func (r *OpenGl3doRenderer) makePoints() []float32 {
 	var points []float32
+	var offset int32
 
-	for _, mesh := range r.object.GeoSets[r.lod].Meshes {
+	r.meshOffsets = make([]int32, len(r.object.GeoSets[r.lod].Meshes))
+	for meshIdx, mesh := range r.object.GeoSets[r.lod].Meshes {
+		r.meshOffsets[meshIdx] = offset
 		for surfaceIdx, surface := range mesh.Faces {
 			var mat jktypes.Material
 			if surface.MaterialID != -1 {
@@ -161,50 +208,24 @@ func (r *OpenGl3doRenderer) makePoints() []float32 {
 				lightIntensity := surface.LightIntensities[idx]
 				points = append(points, float32(lightIntensity))
 			}
+			offset += int32(len(surface.VertexIds))
 		}
 	}
 	return points
 }
 
 func (r *OpenGl3doRenderer) makeTextures() {
-	numTextures := int32(len(r.object.Materials))
-
-	r.textures = make([]uint32, numTextures)
+	r.colormapTexture = makeColormapTexture(r.object.ColorMap)
 
-	gl.GenTextures(numTextures, &r.textures[0])
+	r.textures = make([][]uint32, len(r.object.Materials))
+	r.indexTextures = make([][]uint32, len(r.object.Materials))
 
-	for i := int32(0); i < numTextures; i++ {
-		textureID := r.textures[i]
-		material := r.object.Materials[i]
-
-		if len(r.object.Materials[i].Texture) == 0 {
+	for i, material := range r.object.Materials {
+		if len(material.Cels) == 0 {
 			fmt.Println("empty material")
 			continue
 		}
 
-		var finalTexture []byte
-		if material.Transparent {
-			finalTexture = make([]byte, material.SizeX*material.SizeY*4)
-			for j := 0; j < int(material.SizeX*material.SizeY); j++ {
-				finalTexture[j*4] = r.object.ColorMap.Palette[material.Texture[j]].R
-				finalTexture[j*4+1] = r.object.ColorMap.Palette[material.Texture[j]].G
-				finalTexture[j*4+2] = r.object.ColorMap.Palette[material.Texture[j]].B
-
-				if material.Texture[j] == 0 {
-					finalTexture[j*4+3] = 0
-				} else {
-					finalTexture[j*4+3] = 255
-				}
-			}
-		} else {
-			finalTexture = make([]byte, material.SizeX*material.SizeY*3)
-			for j := 0; j < int(material.SizeX*material.SizeY); j++ {
-				finalTexture[j*3] = r.object.ColorMap.Palette[material.Texture[j]].R
-				finalTexture[j*3+1] = r.object.ColorMap.Palette[material.Texture[j]].G
-				finalTexture[j*3+2] = r.object.ColorMap.Palette[material.Texture[j]].B
-			}
-		}
-
-		loadToTexture(textureID, material.SizeX, material.SizeY, &finalTexture, material.Transparent)
+		r.textures[i], r.indexTextures[i] = makeMaterialTextures(material, r.object.ColorMap.Palette)
 	}
 }
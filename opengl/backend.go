@@ -0,0 +1,210 @@
+package opengl
+
+import (
+	"github.com/go-gl/gl/v3.2-core/gl"
+	"github.com/go-gl/mathgl/mgl32"
+	"github.com/joelhays/go-jk/animation"
+	"github.com/joelhays/go-jk/backend"
+	"github.com/joelhays/go-jk/camera"
+	"github.com/joelhays/go-jk/jk/jktypes"
+	"sync"
+)
+
+// Backend implements backend.Backend with the OpenGL renderers, drawing levels
+// and 3dos with program and images with guiProgram. 3dos drawn in a sector after
+// a level are shaded with the colormap of that sector. Released resources are
+// deleted at the next BeginFrame, on the thread owning the context.
+type Backend struct {
+	window     *Window
+	program    *ShaderProgram
+	guiProgram *ShaderProgram
+	cam        *camera.Camera
+	menu       *menuUI
+	level      *OpenGlLevelRenderer // drawn last in the frame
+
+	mutex      sync.Mutex
+	nextHandle int32
+	levels     map[backend.MeshHandle]*OpenGlLevelRenderer
+	models     map[backend.MeshHandle]*OpenGl3doRenderer
+	images     map[backend.TextureHandle]*OpenGlBmRenderer
+	released   []func()
+}
+
+func NewBackend(window *Window, program *ShaderProgram, guiProgram *ShaderProgram) *Backend {
+	return &Backend{
+		window:     window,
+		program:    program,
+		guiProgram: guiProgram,
+		levels:     make(map[backend.MeshHandle]*OpenGlLevelRenderer),
+		models:     make(map[backend.MeshHandle]*OpenGl3doRenderer),
+		images:     make(map[backend.TextureHandle]*OpenGlBmRenderer),
+	}
+}
+
+func (b *Backend) handle() int32 {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.nextHandle++
+	return b.nextHandle
+}
+
+func (b *Backend) UploadLevel(mesh *jktypes.JkMesh, sectors []jktypes.Sector, animator *animation.CelAnimator) backend.MeshHandle {
+	r := NewOpenGlLevelRenderer(nil, nil, mesh, sectors, nil, animator, b.program).(*OpenGlLevelRenderer)
+	handle := backend.MeshHandle(b.handle())
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.levels[handle] = r
+	return handle
+}
+
+func (b *Backend) Upload3do(object *jktypes.Jk3doFile, animator *animation.CelAnimator) backend.MeshHandle {
+	r := NewOpenGl3doRenderer(&jktypes.Thing{}, nil, object, nil, animator, b.program)
+	handle := backend.MeshHandle(b.handle())
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.models[handle] = r
+	return handle
+}
+
+func (b *Backend) UploadImage(bm *jktypes.BMFile) backend.TextureHandle {
+	r := NewOpenGlBmRenderer(bm, mgl32.Vec2{1, 1}, b.guiProgram).(*OpenGlBmRenderer)
+	handle := backend.TextureHandle(b.handle())
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.images[handle] = r
+	return handle
+}
+
+func (b *Backend) ReleaseMesh(mesh backend.MeshHandle) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if r, ok := b.levels[mesh]; ok {
+		b.released = append(b.released, r.Cleanup)
+		delete(b.levels, mesh)
+	}
+	if r, ok := b.models[mesh]; ok {
+		b.released = append(b.released, r.Cleanup)
+		delete(b.models, mesh)
+	}
+}
+
+func (b *Backend) ReleaseTexture(texture backend.TextureHandle) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if r, ok := b.images[texture]; ok {
+		b.released = append(b.released, r.Cleanup)
+		delete(b.images, texture)
+	}
+}
+
+func (b *Backend) BeginFrame(cam *camera.Camera) {
+	b.mutex.Lock()
+	released := b.released
+	b.released = nil
+	b.mutex.Unlock()
+	for _, cleanup := range released {
+		cleanup()
+	}
+
+	b.cam = cam
+	b.level = nil
+	gl.Clear(gl.COLOR_BUFFER_BIT | gl.DEPTH_BUFFER_BIT)
+}
+
+// start starts program configured for the camera of the frame.
+func (b *Backend) start(program *ShaderProgram) {
+	width, height := b.window.GetSize()
+	program.Start()
+	configureProgram(program, b.cam, width, height)
+}
+
+func (b *Backend) DrawLevel(mesh backend.MeshHandle, sectors []int64) {
+	b.mutex.Lock()
+	r := b.levels[mesh]
+	b.mutex.Unlock()
+	if r == nil {
+		return
+	}
+
+	b.level = r
+	b.start(r.program)
+	r.renderSectors(sectors)
+	r.program.Stop()
+}
+
+func (b *Backend) Draw3do(mesh backend.MeshHandle, thing *jktypes.Thing, sector *jktypes.Sector, pose []animation.NodePose) {
+	b.mutex.Lock()
+	r := b.models[mesh]
+	b.mutex.Unlock()
+	if r == nil {
+		return
+	}
+
+	if pose == nil {
+		pose = animation.RestPose(r.object)
+	}
+	colormap := r.colormapTexture
+	if sector != nil && b.level != nil {
+		if texture := b.level.sectorColormapTexture(sector.ColorMap); texture != 0 {
+			colormap = texture
+		}
+	}
+	b.start(r.program)
+	r.render(thing, sector, colormap, pose)
+	r.program.Stop()
+}
+
+func (b *Backend) DrawImage(texture backend.TextureHandle, image int, scale mgl32.Vec2) {
+	b.mutex.Lock()
+	r := b.images[texture]
+	b.mutex.Unlock()
+	if r == nil {
+		return
+	}
+
+	b.start(r.program)
+	r.render(image, scale)
+	r.program.Stop()
+}
+
+func (b *Backend) DrawQuads(texture backend.TextureHandle, image int, quads []backend.Quad) {
+	b.mutex.Lock()
+	r := b.images[texture]
+	b.mutex.Unlock()
+	if r == nil || len(quads) == 0 {
+		return
+	}
+
+	width, height := b.window.GetSize()
+	b.start(r.program)
+	r.renderQuads(image, quads, width, height)
+	r.program.Stop()
+}
+
+func (b *Backend) DrawMenu(menu backend.MenuView) backend.MenuEvent {
+	if b.menu == nil {
+		b.menu = newMenuUI(b.window)
+	}
+
+	var background uint32
+	b.mutex.Lock()
+	if r, ok := b.images[menu.Background]; ok {
+		background = r.GetTextureID()
+	}
+	b.mutex.Unlock()
+
+	width, height := b.window.GetSize()
+	return b.menu.draw(menu, background, width, height)
+}
+
+func (b *Backend) EndFrame() {
+	b.window.window.SwapBuffers()
+}
+
+func (b *Backend) SetShadingMode(mode backend.ShadingMode) {
+	SetShadingMode(ShadingMode(mode))
+}
+
+func (b *Backend) GetShadingMode() backend.ShadingMode {
+	return backend.ShadingMode(GetShadingMode())
+}
@@ -2,6 +2,7 @@ package opengl
 
 import (
 	"fmt"
+	"github.com/joelhays/go-jk/backend"
 	"github.com/joelhays/go-jk/jk/jktypes"
 
 	"github.com/go-gl/mathgl/mgl32"
@@ -13,8 +14,11 @@ type OpenGlBmRenderer struct {
 	bm       *jktypes.BMFile
 	program  *ShaderProgram
 	vao      uint32
+	vbo      uint32
 	textures []uint32
 	scale    mgl32.Vec2
+	quadVAO  uint32 // batch of quads drawn by renderQuads, made on first use
+	quadVBO  uint32
 }
 
 func NewOpenGlBmRenderer(bm *jktypes.BMFile, scale mgl32.Vec2, program *ShaderProgram) Renderer {
@@ -25,16 +29,24 @@ func NewOpenGlBmRenderer(bm *jktypes.BMFile, scale mgl32.Vec2, program *ShaderPr
 }
 
 func (r *OpenGlBmRenderer) Render() {
+	r.render(0, r.scale)
+}
+
+func (r *OpenGlBmRenderer) render(image int, scale mgl32.Vec2) {
+	if image < 0 || image >= len(r.textures) || r.textures[image] == 0 {
+		return
+	}
+
 	gl.BindVertexArray(r.vao)
 	defer gl.BindVertexArray(0)
 
 	var offset int32 = 0
 	model := mgl32.Ident4()
-	model = mgl32.Scale3D(r.scale.X(), r.scale.Y(), 1)
+	model = mgl32.Scale3D(scale.X(), scale.Y(), 1)
 	r.ShaderProgram().SetMatrixUniform("model", model)
 
 	gl.ActiveTexture(gl.TEXTURE0)
-	gl.BindTexture(gl.TEXTURE_2D, r.textures[0])
+	gl.BindTexture(gl.TEXTURE_2D, r.textures[image])
 
 	r.ShaderProgram().SetIntegerUniform("objectTexture", 0)
 
@@ -47,9 +59,66 @@ func (r *OpenGlBmRenderer) ShaderProgram() *ShaderProgram {
 	return r.program
 }
 
+// renderQuads draws parts of an image in screen space, in pixels of a width by
+// height frame, over everything drawn before.
+func (r *OpenGlBmRenderer) renderQuads(image int, quads []backend.Quad, width int, height int) {
+	if image < 0 || image >= len(r.textures) || r.textures[image] == 0 {
+		return
+	}
+	sizeX, sizeY := float32(r.bm.Images[image].SizeX), float32(r.bm.Images[image].SizeY)
+
+	// VERTICES (3), NORMALS (3), UV (2), LIGHT (1), the shader flips v
+	points := make([]float32, 0, len(quads)*6*9)
+	for _, q := range quads {
+		left, right := q.X/float32(width)*2-1, (q.X+q.Width)/float32(width)*2-1
+		top, bottom := 1-q.Y/float32(height)*2, 1-(q.Y+q.Height)/float32(height)*2
+		u0, u1 := q.SrcX/sizeX, (q.SrcX+q.SrcWidth)/sizeX
+		v0, v1 := 1-(q.SrcY+q.SrcHeight)/sizeY, 1-q.SrcY/sizeY
+		points = append(points,
+			left, bottom, 0, 0, 1, 0, u0, v0, 1,
+			right, bottom, 0, 0, 1, 0, u1, v0, 1,
+			right, top, 0, 0, 1, 0, u1, v1, 1,
+			left, bottom, 0, 0, 1, 0, u0, v0, 1,
+			right, top, 0, 0, 1, 0, u1, v1, 1,
+			left, top, 0, 0, 1, 0, u0, v1, 1,
+		)
+	}
+
+	if r.quadVAO == 0 {
+		r.quadVAO, r.quadVBO = loadToVAO(points)
+	} else {
+		gl.BindBuffer(gl.ARRAY_BUFFER, r.quadVBO)
+		gl.BufferData(gl.ARRAY_BUFFER, 4*len(points), gl.Ptr(points), gl.DYNAMIC_DRAW)
+		gl.BindBuffer(gl.ARRAY_BUFFER, 0)
+	}
+
+	gl.Disable(gl.DEPTH_TEST)
+	defer gl.Enable(gl.DEPTH_TEST)
+	gl.BindVertexArray(r.quadVAO)
+	defer gl.BindVertexArray(0)
+
+	r.ShaderProgram().SetMatrixUniform("model", mgl32.Ident4())
+	gl.ActiveTexture(gl.TEXTURE0)
+	gl.BindTexture(gl.TEXTURE_2D, r.textures[image])
+	r.ShaderProgram().SetIntegerUniform("objectTexture", 0)
+
+	gl.DrawArrays(gl.TRIANGLES, 0, int32(len(quads)*6))
+
+	gl.BindTexture(gl.TEXTURE_2D, 0)
+}
+
+// Cleanup deletes the vertex arrays and textures.
+func (r *OpenGlBmRenderer) Cleanup() {
+	deleteVAO(r.vao, r.vbo)
+	if r.quadVAO != 0 {
+		deleteVAO(r.quadVAO, r.quadVBO)
+	}
+	deleteTextures([][]uint32{r.textures})
+}
+
 func (r *OpenGlBmRenderer) setupMesh() {
 	points := r.makePoints()
-	r.vao = loadToVAO(points)
+	r.vao, r.vbo = loadToVAO(points)
 	r.makeTextures()
 }
 
@@ -79,25 +148,21 @@ func (r *OpenGlBmRenderer) makeTextures() {
 	gl.GenTextures(numTextures, &r.textures[0])
 
 	for i := int32(0); i < numTextures; i++ {
-		textureID := r.textures[i]
-		material := r.bm.Images[i]
-
-		if len(r.bm.Images) == 0 {
-			fmt.Println("empty material")
+		image := r.bm.Images[i]
+		finalTexture, err := r.bm.RGBA(int(i))
+		if err != nil {
+			fmt.Println(err)
+			gl.DeleteTextures(1, &r.textures[i])
+			r.textures[i] = 0
 			continue
 		}
-
-		var finalTexture []byte
-		finalTexture = make([]byte, material.SizeX*material.SizeY*3)
-		for j := 0; j < int(material.SizeX*material.SizeY); j++ {
-			finalTexture[j*3] = r.bm.Palette.Palette[material.Data[j]].R
-			finalTexture[j*3+1] = r.bm.Palette.Palette[material.Data[j]].G
-			finalTexture[j*3+2] = r.bm.Palette.Palette[material.Data[j]].B
-		}
-		loadToTexture(textureID, material.SizeX, material.SizeY, &finalTexture, false)
+		loadToTexture(r.textures[i], image.SizeX, image.SizeY, &finalTexture, true)
 	}
 }
 
 func (r *OpenGlBmRenderer) GetTextureID() uint32 {
+	if len(r.textures) == 0 {
+		return 0
+	}
 	return r.textures[0]
 }
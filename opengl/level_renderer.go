@@ -3,7 +3,9 @@ package opengl
 import (
 	"fmt"
 	"github.com/go-gl/mathgl/mgl32"
+	"github.com/joelhays/go-jk/animation"
 	"github.com/joelhays/go-jk/jk/jktypes"
+	"github.com/joelhays/go-jk/visibility"
 
 	"github.com/go-gl/gl/v3.2-core/gl"
 )
@@ -12,18 +14,40 @@ type OpenGlLevelRenderer struct {
 	thing    *jktypes.Thing
 	template *jktypes.Template
 	object   *jktypes.JkMesh
+	sectors  []jktypes.Sector
+	culler   *visibility.Culler
 	program  *ShaderProgram
 	vao      uint32
-	textures []uint32
+	vbo      uint32
+	animator *animation.CelAnimator
+	textures [][]uint32
+	offsets  []int32
+
+	indexTextures    [][]uint32
+	colormapTextures []uint32
 }
 
-func NewOpenGlLevelRenderer(thing *jktypes.Thing, template *jktypes.Template, object *jktypes.JkMesh, program *ShaderProgram) Renderer {
-	r := &OpenGlLevelRenderer{thing: thing, template: template, object: object, program: program}
+// NewOpenGlLevelRenderer creates a renderer for the level geometry. When a culler
+// is given only the sectors it found visible are drawn, otherwise the whole level is.
+// Animated materials show the cel picked by animator, or their first cel when it is nil.
+func NewOpenGlLevelRenderer(thing *jktypes.Thing, template *jktypes.Template, object *jktypes.JkMesh, sectors []jktypes.Sector,
+	culler *visibility.Culler, animator *animation.CelAnimator, program *ShaderProgram) Renderer {
+	r := &OpenGlLevelRenderer{thing: thing, template: template, object: object, sectors: sectors, culler: culler, animator: animator,
+		program: program}
 	r.setupMesh()
 	return r
 }
 
 func (r *OpenGlLevelRenderer) Render() {
+	if r.culler == nil {
+		r.renderSectors(nil)
+		return
+	}
+	r.renderSectors(r.culler.VisibleSectors())
+}
+
+// renderSectors draws the surfaces of the given sectors, or all of them when sectors is nil.
+func (r *OpenGlLevelRenderer) renderSectors(sectors []int64) {
 	gl.Enable(gl.DEPTH_TEST)
 	gl.Enable(gl.CULL_FACE)
 
@@ -33,42 +57,125 @@ func (r *OpenGlLevelRenderer) Render() {
 	gl.BindVertexArray(r.vao)
 	defer gl.BindVertexArray(0)
 
-	var offset int32
 	model := mgl32.Ident4()
 	r.ShaderProgram().SetMatrixUniform("model", model)
 
-	for _, surface := range r.object.Surfaces {
-		numVerts := int32(len(surface.VertexIds))
+	r.ShaderProgram().SetIntegerUniform("colormapTexture", 1)
+	defer func() {
+		gl.ActiveTexture(gl.TEXTURE1)
+		gl.BindTexture(gl.TEXTURE_2D, 0)
+	}()
+
+	if sectors == nil {
+		r.renderSurfaces(0, int64(len(r.object.Surfaces)))
+		return
+	}
+
+	for _, sectorID := range sectors {
+		sector := r.sectors[sectorID]
+		r.renderSurfaces(sector.FirstSurface, sector.FirstSurface+sector.NumSurfaces)
+	}
+}
+
+func (r *OpenGlLevelRenderer) renderSurfaces(first int64, last int64) {
+	for i := first; i < last; i++ {
+		surface := r.object.Surfaces[i]
 
 		if surface.Geo != 0 {
+			material := &r.object.Materials[surface.MaterialID]
+			var cel int
+			if r.animator != nil {
+				cel = r.animator.SurfaceCel(i, material)
+			}
 
+			gl.ActiveTexture(gl.TEXTURE1)
+			gl.BindTexture(gl.TEXTURE_2D, r.colormapTexture(surface))
 			gl.ActiveTexture(gl.TEXTURE0)
-			gl.BindTexture(gl.TEXTURE_2D, r.textures[surface.MaterialID])
+			gl.BindTexture(gl.TEXTURE_2D, celTexture(r.textures[surface.MaterialID], cel))
+			gl.ActiveTexture(gl.TEXTURE2)
+			gl.BindTexture(gl.TEXTURE_2D, celTexture(r.indexTextures[surface.MaterialID], cel))
+
+			var transparent int32
+			if cel < len(material.Cels) && material.Cels[cel].Transparent {
+				transparent = 1
+			}
 
 			r.ShaderProgram().SetIntegerUniform("objectTexture", 0)
+			r.ShaderProgram().SetIntegerUniform("indexTexture", 2)
+			r.ShaderProgram().SetIntegerUniform("transparent", transparent)
+			r.setLightUniforms(surface)
 
-			gl.DrawArrays(gl.TRIANGLE_FAN, offset, int32(len(surface.VertexIds)))
+			gl.DrawArrays(gl.TRIANGLE_FAN, r.offsets[i], int32(len(surface.VertexIds)))
 
 			gl.BindTexture(gl.TEXTURE_2D, 0)
+			gl.ActiveTexture(gl.TEXTURE0)
+			gl.BindTexture(gl.TEXTURE_2D, 0)
 		}
+	}
+}
 
-		offset = offset + numVerts
+// setLightUniforms sets the light used by the colormap shading. Surfaces are lit by
+// their vertex intensities, never darker than the ambient light of their sector,
+// plus the extra light of both the sector and the surface.
+func (r *OpenGlLevelRenderer) setLightUniforms(surface jktypes.Surface) {
+	var ambientLight float64
+	extraLight := surface.ExtraLight
+	if surface.Sector >= 0 && surface.Sector < int64(len(r.sectors)) {
+		sector := r.sectors[surface.Sector]
+		ambientLight = sector.AmbientLight
+		extraLight += sector.ExtraLight
 	}
+
+	r.ShaderProgram().SetFloatUniform("ambientLight", float32(ambientLight))
+	r.ShaderProgram().SetFloatUniform("extraLight", float32(extraLight))
+}
+
+// colormapTexture returns the colormap texture of the sector of a surface.
+func (r *OpenGlLevelRenderer) colormapTexture(surface jktypes.Surface) uint32 {
+	if surface.Sector >= 0 && surface.Sector < int64(len(r.sectors)) {
+		return r.sectorColormapTexture(r.sectors[surface.Sector].ColorMap)
+	}
+	return r.sectorColormapTexture(-1)
+}
+
+// sectorColormapTexture returns the texture of the colormap of a sector, the
+// first colormap of the level when the sector has none, or 0 when the level has none.
+func (r *OpenGlLevelRenderer) sectorColormapTexture(colorMap int64) uint32 {
+	if len(r.colormapTextures) == 0 {
+		return 0
+	}
+	if colorMap >= 0 && colorMap < int64(len(r.colormapTextures)) {
+		return r.colormapTextures[colorMap]
+	}
+	return r.colormapTextures[0]
 }
 
 func (r *OpenGlLevelRenderer) ShaderProgram() *ShaderProgram {
 	return r.program
 }
 
+// Cleanup deletes the vertex array and textures.
+func (r *OpenGlLevelRenderer) Cleanup() {
+	deleteVAO(r.vao, r.vbo)
+	deleteTextures(r.textures)
+	deleteTextures(r.indexTextures)
+	deleteTextures([][]uint32{r.colormapTextures})
+}
+
 func (r *OpenGlLevelRenderer) setupMesh() {
 	points := r.makePoints()
-	r.vao = loadToVAO(points)
+	r.vao, r.vbo = loadToVAO(points)
 	r.makeTextures()
 }
 
 func (r *OpenGlLevelRenderer) makePoints() []float32 {
 	var points []float32
-	for _, surface := range r.object.Surfaces {
+	var offset int32
+	r.offsets = make([]int32, len(r.object.Surfaces))
+	for surfaceIdx, surface := range r.object.Surfaces {
+		r.offsets[surfaceIdx] = offset
+		offset += int32(len(surface.VertexIds))
+
 		var mat jktypes.Material
 		if surface.MaterialID != -1 {
 			mat = r.object.Materials[surface.MaterialID]
@@ -100,45 +207,24 @@ func (r *OpenGlLevelRenderer) makePoints() []float32 {
 }
 
 func (r *OpenGlLevelRenderer) makeTextures() {
+	var palette [256]jktypes.Vec3Byte
+	if len(r.object.ColorMaps) > 0 {
+		palette = r.object.ColorMaps[0].Palette
+	}
+	r.colormapTextures = make([]uint32, len(r.object.ColorMaps))
+	for i, colorMap := range r.object.ColorMaps {
+		r.colormapTextures[i] = makeColormapTexture(colorMap)
+	}
 
-	numTextures := int32(len(r.object.Materials))
-
-	r.textures = make([]uint32, numTextures)
-
-	gl.GenTextures(numTextures, &r.textures[0])
-
-	for i := int32(0); i < numTextures; i++ {
-		textureID := r.textures[i]
-		material := r.object.Materials[i]
+	r.textures = make([][]uint32, len(r.object.Materials))
+	r.indexTextures = make([][]uint32, len(r.object.Materials))
 
-		if len(r.object.Materials[i].Texture) == 0 {
+	for i, material := range r.object.Materials {
+		if len(material.Cels) == 0 {
 			fmt.Println("empty material")
 			continue
 		}
 
-		var finalTexture []byte
-		if material.Transparent {
-			finalTexture = make([]byte, material.SizeX*material.SizeY*4)
-			for j := 0; j < int(material.SizeX*material.SizeY); j++ {
-				finalTexture[j*4] = r.object.ColorMaps[0].Palette[material.Texture[j]].R
-				finalTexture[j*4+1] = r.object.ColorMaps[0].Palette[material.Texture[j]].G
-				finalTexture[j*4+2] = r.object.ColorMaps[0].Palette[material.Texture[j]].B
-
-				if material.Texture[j] == 0 {
-					finalTexture[j*4+3] = 0
-				} else {
-					finalTexture[j*4+3] = 255
-				}
-			}
-		} else {
-			finalTexture = make([]byte, material.SizeX*material.SizeY*3)
-			for j := 0; j < int(material.SizeX*material.SizeY); j++ {
-				finalTexture[j*3] = r.object.ColorMaps[0].Palette[material.Texture[j]].R
-				finalTexture[j*3+1] = r.object.ColorMaps[0].Palette[material.Texture[j]].G
-				finalTexture[j*3+2] = r.object.ColorMaps[0].Palette[material.Texture[j]].B
-			}
-		}
-
-		loadToTexture(textureID, material.SizeX, material.SizeY, &finalTexture, material.Transparent)
+		r.textures[i], r.indexTextures[i] = makeMaterialTextures(material, palette)
 	}
 }
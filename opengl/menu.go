@@ -0,0 +1,109 @@
+package opengl
+
+import (
+	"github.com/golang-ui/nuklear/nk"
+	"github.com/joelhays/go-jk/backend"
+	"github.com/joelhays/go-jk/menu"
+)
+
+// menuUI draws the main menu with nuklear.
+type menuUI struct {
+	context    *nk.Context
+	fontAtlas  *nk.FontAtlas
+	font       *nk.Font
+	fontHandle *nk.UserFont
+}
+
+func newMenuUI(window *Window) *menuUI {
+	m := &menuUI{}
+	m.context = nk.NkPlatformInit(window.window, nk.PlatformInstallCallbacks)
+	m.fontAtlas = nk.NewFontAtlas()
+	nk.NkFontStashBegin(&m.fontAtlas)
+	m.font = nk.NkFontAtlasAddFromBytes(m.fontAtlas, menu.MustAsset("assets/FreeSans.ttf"), 24, nil)
+	nk.NkFontStashEnd()
+	if m.font != nil {
+		m.fontHandle = m.font.Handle()
+		nk.NkStyleSetFont(m.context, m.fontHandle)
+	}
+	return m
+}
+
+func (m *menuUI) draw(view backend.MenuView, background uint32, width int, height int) backend.MenuEvent {
+	event := backend.NoMenuEvent
+
+	nk.NkPlatformNewFrame()
+
+	// Layout
+	*m.context.GetStyle().GetWindow().GetFixedBackground() = nk.NkStyleItemImage(nk.NkSubimageId(int32(background), uint16(width), uint16(height), nk.NkRect(0, 0, float32(width), float32(height))))
+
+	bounds := nk.NkRect(0, 0, float32(width), float32(height))
+	update := nk.NkBegin(m.context, "Demo", bounds, nk.WindowBackground)
+
+	*m.context.GetStyle().GetWindow().GetFixedBackground() = nk.NkStyleItemHide()
+
+	if update > 0 {
+
+		nk.NkLayoutRowDynamic(m.context, 250, 1)
+		{
+		}
+
+		nk.NkLayoutRowStatic(m.context, 30, int32(width/3), 3)
+		{
+			nk.NkSpacing(m.context, 1)
+			nk.NkLabel(m.context, view.Title, nk.TextCentered)
+		}
+
+		nk.NkLayoutRowStatic(m.context, 30, int32(width/5), 5)
+		{
+			nk.NkSpacing(m.context, 1)
+			for i, tab := range view.Tabs {
+				if nk.NkButtonLabel(m.context, tab) > 0 {
+					event.Tab = i
+				}
+			}
+		}
+
+		nk.NkLayoutRowDynamic(m.context, 30, 1)
+		{
+		}
+
+		nk.NkLayoutRowStatic(m.context, 30*10, int32(width/3), 3)
+		{
+			nk.NkSpacing(m.context, 1)
+			var list nk.ListView
+			nk.NkListViewBegin(m.context, &list, "level", nk.WindowBackground, 35, int32(len(view.Items)-1))
+			{
+				for l := list.Begin(); l < list.End(); l++ {
+					item := view.Items[l]
+					nk.NkLayoutRowDynamic(m.context, 30, 1)
+					{
+						if nk.NkButtonLabel(m.context, item) > 0 {
+							event.Item = item
+						}
+					}
+				}
+			}
+			nk.NkListViewEnd(&list)
+		}
+
+		nk.NkLayoutRowDynamic(m.context, 30, 1)
+		{
+		}
+
+		nk.NkLayoutRowStatic(m.context, 30, int32(width/3), 3)
+		{
+			nk.NkSpacing(m.context, 1)
+			if nk.NkButtonLabel(m.context, "Quit") > 0 {
+				event.Quit = true
+			}
+		}
+
+	}
+	nk.NkEnd(m.context)
+
+	maxVertexBuffer := 512 * 1024
+	maxElementBuffer := 128 * 1024
+	nk.NkPlatformRender(nk.AntiAliasingOn, maxVertexBuffer, maxElementBuffer)
+
+	return event
+}
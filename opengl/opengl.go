@@ -9,6 +9,25 @@ import (
 	"github.com/go-gl/mathgl/mgl32"
 )
 
+type ShadingMode int32
+
+const (
+	// SHADING_PHONG lights everything with a light placed at the camera
+	SHADING_PHONG ShadingMode = 0
+	// SHADING_COLORMAP shades texels through the colormap light levels like the original game
+	SHADING_COLORMAP ShadingMode = 1
+)
+
+var shadingMode = SHADING_PHONG
+
+func SetShadingMode(mode ShadingMode) {
+	shadingMode = mode
+}
+
+func GetShadingMode() ShadingMode {
+	return shadingMode
+}
+
 // InitGlfw initializes glfw and returns a Window to use.
 func InitGlfw(windowWidth int, windowHeight int, keyCallback func(*glfw.Window, glfw.Key, int, glfw.Action, glfw.ModifierKey),
 	mouseCallback func(*glfw.Window, float64, float64)) *glfw.Window {
@@ -50,9 +69,8 @@ func InitOpenGL() {
 	gl.BlendFunc(gl.SRC_ALPHA, gl.ONE_MINUS_SRC_ALPHA)
 }
 
-func Draw(window *glfw.Window, camera *camera.Camera, renderers []Renderer) {
-	width, height := window.GetSize()
-
+// Draw draws renderers from camera into a width by height frame.
+func Draw(width int, height int, camera *camera.Camera, renderers []Renderer) {
 	for _, renderer := range renderers {
 		program := renderer.ShaderProgram()
 		program.Start()
@@ -62,9 +80,14 @@ func Draw(window *glfw.Window, camera *camera.Camera, renderers []Renderer) {
 	}
 }
 
+// ProjectionMatrix returns the perspective projection used when drawing with the camera.
+func ProjectionMatrix(camera *camera.Camera, width int, height int) mgl32.Mat4 {
+	return camera.ProjectionMatrix(width, height)
+}
+
 func configureProgram(program *ShaderProgram, camera *camera.Camera, width int, height int) {
 	// vertex shader uniforms
-	projection := mgl32.Perspective(mgl32.DegToRad(float32(camera.Zoom)), float32(width)/float32(height), 0.01, 1000.0)
+	projection := ProjectionMatrix(camera, width, height)
 	program.SetMatrixUniform("projection", projection)
 	program.SetMatrixUniform("view", camera.GetViewMatrix())
 
@@ -73,4 +96,5 @@ func configureProgram(program *ShaderProgram, camera *camera.Camera, width int,
 	program.SetVectorUniform("lightColor", mgl32.Vec3{1, 1, 1})
 	program.SetVectorUniform("lightPos", camera.Position)
 	program.SetVectorUniform("viewPos", camera.Position)
+	program.SetIntegerUniform("shadingMode", int32(shadingMode))
 }
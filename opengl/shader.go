@@ -60,6 +60,11 @@ func (p *ShaderProgram) SetVectorUniform(uniformName string, vec mgl32.Vec3) {
 	gl.Uniform3fv(uniform, 1, &vec[0])
 }
 
+func (p *ShaderProgram) SetFloatUniform(uniformName string, value float32) {
+	uniform := gl.GetUniformLocation(p.programID, gl.Str(uniformName+"\x00"))
+	gl.Uniform1f(uniform, value)
+}
+
 func (p *ShaderProgram) SetIntegerUniform(uniformName string, value int32) {
 	uniform := gl.GetUniformLocation(p.programID, gl.Str(uniformName+"\x00"))
 	gl.Uniform1i(uniform, value)
@@ -2,6 +2,7 @@ package opengl
 
 import (
 	"github.com/go-gl/gl/v3.2-core/gl"
+	"github.com/joelhays/go-jk/jk/jktypes"
 )
 
 func loadToTexture(textureID uint32, sizeX int32, sizeY int32, data *[]byte, useAlpha bool) {
@@ -23,3 +24,133 @@ func loadToTexture(textureID uint32, sizeX int32, sizeY int32, data *[]byte, use
 
 	gl.BindTexture(gl.TEXTURE_2D, 0)
 }
+
+// makeColormapTexture creates a 256x64 RGB texture holding the palette color of
+// every palette index at every light level of the colormap.
+func makeColormapTexture(colorMap jktypes.ColorMap) uint32 {
+	data := make([]byte, 256*jktypes.ColorMapLightLevels*3)
+	for level := 0; level < jktypes.ColorMapLightLevels; level++ {
+		for i := 0; i < 256; i++ {
+			var color jktypes.Vec3Byte
+			if level < len(colorMap.LightLevels) {
+				color = colorMap.Palette[colorMap.LightLevels[level][i]]
+			} else {
+				// no light tables, fade the palette to black instead
+				scale := float32(level) / float32(jktypes.ColorMapLightLevels-1)
+				color = colorMap.Palette[i]
+				color.R = byte(float32(color.R) * scale)
+				color.G = byte(float32(color.G) * scale)
+				color.B = byte(float32(color.B) * scale)
+			}
+			offset := (level*256 + i) * 3
+			data[offset] = color.R
+			data[offset+1] = color.G
+			data[offset+2] = color.B
+		}
+	}
+
+	var textureID uint32
+	gl.GenTextures(1, &textureID)
+	gl.BindTexture(gl.TEXTURE_2D, textureID)
+
+	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_WRAP_S, gl.CLAMP_TO_EDGE)
+	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_WRAP_T, gl.CLAMP_TO_EDGE)
+
+	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_MIN_FILTER, gl.NEAREST)
+	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_MAG_FILTER, gl.NEAREST)
+
+	gl.TexImage2D(gl.TEXTURE_2D, 0, gl.RGB, 256, jktypes.ColorMapLightLevels, 0, gl.RGB, gl.UNSIGNED_BYTE, gl.Ptr(data))
+
+	gl.BindTexture(gl.TEXTURE_2D, 0)
+	return textureID
+}
+
+// makeMaterialTextures uploads every cel of a material with its mipmaps, once with
+// the palette colors and once as palette indices for the colormap shading.
+func makeMaterialTextures(material jktypes.Material, palette [256]jktypes.Vec3Byte) ([]uint32, []uint32) {
+	numCels := int32(len(material.Cels))
+	if numCels == 0 {
+		return nil, nil
+	}
+
+	textures := make([]uint32, numCels)
+	indexTextures := make([]uint32, numCels)
+	gl.GenTextures(numCels, &textures[0])
+	gl.GenTextures(numCels, &indexTextures[0])
+
+	for i, cel := range material.Cels {
+		colorLevels := make([][]byte, len(cel.MipMaps))
+		for level, indices := range cel.MipMaps {
+			colorLevels[level] = paletteToColors(indices, palette, cel.Transparent)
+		}
+
+		if cel.Transparent {
+			loadToMipmappedTexture(textures[i], cel, colorLevels, gl.RGBA, gl.RGBA, gl.LINEAR_MIPMAP_LINEAR, gl.LINEAR)
+		} else {
+			loadToMipmappedTexture(textures[i], cel, colorLevels, gl.RGB, gl.RGB, gl.LINEAR_MIPMAP_LINEAR, gl.LINEAR)
+		}
+		loadToMipmappedTexture(indexTextures[i], cel, cel.MipMaps, gl.R8, gl.RED, gl.NEAREST_MIPMAP_NEAREST, gl.NEAREST)
+	}
+
+	return textures, indexTextures
+}
+
+func paletteToColors(indices []byte, palette [256]jktypes.Vec3Byte, useAlpha bool) []byte {
+	channels := 3
+	if useAlpha {
+		channels = 4
+	}
+
+	colors := make([]byte, len(indices)*channels)
+	for j, index := range indices {
+		colors[j*channels] = palette[index].R
+		colors[j*channels+1] = palette[index].G
+		colors[j*channels+2] = palette[index].B
+		if useAlpha && index != 0 {
+			colors[j*channels+3] = 255
+		}
+	}
+	return colors
+}
+
+// loadToMipmappedTexture uploads the mipmaps stored in the material instead of
+// letting OpenGL generate them.
+func loadToMipmappedTexture(textureID uint32, cel jktypes.MaterialCel, levels [][]byte, internalFormat int32, format uint32,
+	minFilter int32, magFilter int32) {
+	gl.BindTexture(gl.TEXTURE_2D, textureID)
+	gl.PixelStorei(gl.UNPACK_ALIGNMENT, 1)
+
+	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_WRAP_S, gl.REPEAT)
+	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_WRAP_T, gl.REPEAT)
+
+	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_MIN_FILTER, minFilter)
+	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_MAG_FILTER, magFilter)
+
+	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_BASE_LEVEL, 0)
+	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_MAX_LEVEL, int32(len(levels)-1))
+
+	for level, data := range levels {
+		sizeX, sizeY := cel.MipMapSize(level)
+		gl.TexImage2D(gl.TEXTURE_2D, int32(level), internalFormat, sizeX, sizeY, 0, format, gl.UNSIGNED_BYTE, gl.Ptr(data))
+	}
+
+	gl.PixelStorei(gl.UNPACK_ALIGNMENT, 4)
+	gl.BindTexture(gl.TEXTURE_2D, 0)
+}
+
+// celTexture returns the texture of a cel, or 0 when the material has no such cel.
+func celTexture(textures []uint32, cel int) uint32 {
+	if cel < 0 || cel >= len(textures) {
+		return 0
+	}
+	return textures[cel]
+}
+
+// deleteTextures deletes every texture of every material.
+func deleteTextures(textures [][]uint32) {
+	for _, ids := range textures {
+		if len(ids) > 0 {
+			gl.DeleteTextures(int32(len(ids)), &ids[0])
+		}
+	}
+}
@@ -4,7 +4,7 @@ import (
 	"github.com/go-gl/gl/v3.2-core/gl"
 )
 
-func loadToVAO(data []float32) uint32 {
+func loadToVAO(data []float32) (uint32, uint32) {
 	var vbo uint32
 	gl.GenBuffers(1, &vbo)
 	gl.BindBuffer(gl.ARRAY_BUFFER, vbo)
@@ -29,7 +29,12 @@ func loadToVAO(data []float32) uint32 {
 
 	/* light intensity */
 	gl.EnableVertexAttribArray(3)
-	gl.VertexAttribPointer(3, 1, gl.FLOAT, false, 9*4, gl.PtrOffset(7*4))
+	gl.VertexAttribPointer(3, 1, gl.FLOAT, false, 9*4, gl.PtrOffset(8*4))
 
-	return vao
+	return vao, vbo
+}
+
+func deleteVAO(vao uint32, vbo uint32) {
+	gl.DeleteVertexArrays(1, &vao)
+	gl.DeleteBuffers(1, &vbo)
 }
@@ -0,0 +1,98 @@
+package opengl
+
+import (
+	"github.com/go-gl/glfw/v3.2/glfw"
+	"github.com/joelhays/go-jk/backend"
+)
+
+var glfwKeys = map[glfw.Key]backend.Key{
+	glfw.KeyEscape:     backend.KEY_ESCAPE,
+	glfw.KeyL:          backend.KEY_L,
+	glfw.KeyW:          backend.KEY_W,
+	glfw.KeyA:          backend.KEY_A,
+	glfw.KeyS:          backend.KEY_S,
+	glfw.KeyD:          backend.KEY_D,
+	glfw.KeyUp:         backend.KEY_UP,
+	glfw.KeyDown:       backend.KEY_DOWN,
+	glfw.KeyLeft:       backend.KEY_LEFT,
+	glfw.KeyRight:      backend.KEY_RIGHT,
+	glfw.KeyKPSubtract: backend.KEY_KP_SUBTRACT,
+	glfw.KeyKPDecimal:  backend.KEY_KP_DECIMAL,
+	glfw.KeyKPAdd:      backend.KEY_KP_ADD,
+	glfw.KeyKP1:        backend.KEY_KP_1,
+	glfw.KeyKP2:        backend.KEY_KP_2,
+	glfw.KeyKP3:        backend.KEY_KP_3,
+	glfw.KeyKP4:        backend.KEY_KP_4,
+}
+
+// Window implements backend.Window with a GLFW window and its OpenGL context.
+type Window struct {
+	window         *glfw.Window
+	keyCallback    func(key backend.Key, action backend.Action)
+	cursorCallback func(x float64, y float64)
+}
+
+// NewWindow initializes glfw and OpenGL and opens a window. Call Terminate when done.
+func NewWindow(width int, height int) *Window {
+	w := &Window{}
+	w.window = InitGlfw(width, height, w.onKey, w.onCursor)
+	InitOpenGL()
+	return w
+}
+
+// Terminate closes the window and releases glfw.
+func (w *Window) Terminate() {
+	glfw.Terminate()
+}
+
+func (w *Window) onKey(window *glfw.Window, key glfw.Key, scancode int, action glfw.Action, mods glfw.ModifierKey) {
+	if w.keyCallback != nil {
+		w.keyCallback(glfwKeys[key], backend.Action(action))
+	}
+}
+
+func (w *Window) onCursor(window *glfw.Window, x float64, y float64) {
+	if w.cursorCallback != nil {
+		w.cursorCallback(x, y)
+	}
+}
+
+func (w *Window) GetSize() (int, int) {
+	return w.window.GetSize()
+}
+
+func (w *Window) GetTime() float64 {
+	return glfw.GetTime()
+}
+
+func (w *Window) SetTitle(title string) {
+	w.window.SetTitle(title)
+}
+
+func (w *Window) SetCursorCaptured(captured bool) {
+	if captured {
+		w.window.SetInputMode(glfw.CursorMode, glfw.CursorDisabled)
+	} else {
+		w.window.SetInputMode(glfw.CursorMode, glfw.CursorNormal)
+	}
+}
+
+func (w *Window) SetKeyCallback(callback func(key backend.Key, action backend.Action)) {
+	w.keyCallback = callback
+}
+
+func (w *Window) SetCursorCallback(callback func(x float64, y float64)) {
+	w.cursorCallback = callback
+}
+
+func (w *Window) PollEvents() {
+	glfw.PollEvents()
+}
+
+func (w *Window) ShouldClose() bool {
+	return w.window.ShouldClose()
+}
+
+func (w *Window) SetShouldClose(close bool) {
+	w.window.SetShouldClose(close)
+}
@@ -0,0 +1,120 @@
+package raster
+
+import (
+	"github.com/go-gl/mathgl/mgl32"
+	"github.com/joelhays/go-jk/animation"
+	"github.com/joelhays/go-jk/jk/jktypes"
+)
+
+type Jk3doRenderer struct {
+	thing      *jktypes.Thing
+	object     *jktypes.Jk3doFile
+	sector     *jktypes.Sector
+	animator   *animation.CelAnimator
+	poseSource animation.PoseSource
+	colors     *colorTable
+	lod        int
+}
+
+// NewJk3doRenderer creates a renderer for a 3do placed by thing. The object is
+// lit by the ambient and extra light of sector, or fully lit when sector is nil.
+// Animated materials show the cel picked by animator, or their first cel when it is nil.
+func NewJk3doRenderer(thing *jktypes.Thing, object *jktypes.Jk3doFile, sector *jktypes.Sector, animator *animation.CelAnimator) *Jk3doRenderer {
+	return &Jk3doRenderer{thing: thing, object: object, sector: sector, animator: animator, colors: newColorTable(object.ColorMap)}
+}
+
+// SetPoseSource poses the hierarchy with a KEY animation or puppet, or with the rest pose when it is nil.
+func (r *Jk3doRenderer) SetPoseSource(poseSource animation.PoseSource) {
+	r.poseSource = poseSource
+}
+
+func (r *Jk3doRenderer) Render(fb *Framebuffer) {
+	r.render(fb, r.thing, r.sector, r.pose())
+}
+
+func (r *Jk3doRenderer) pose() []animation.NodePose {
+	if r.poseSource != nil {
+		return r.poseSource.Pose()
+	}
+	return animation.RestPose(r.object)
+}
+
+func (r *Jk3doRenderer) render(fb *Framebuffer, thing *jktypes.Thing, sector *jktypes.Sector, pose []animation.NodePose) {
+	if r.lod >= len(r.object.GeoSets) {
+		return
+	}
+
+	ambientLight := float32(1)
+	var extraLight float32
+	if sector != nil {
+		ambientLight = float32(sector.AmbientLight)
+		extraLight = float32(sector.ExtraLight)
+	}
+
+	meshes := r.object.GeoSets[r.lod].Meshes
+	meshMatrices := r.meshMatrices(thing, pose)
+	for meshIdx, mesh := range meshes {
+		matrix := meshMatrices[meshIdx]
+		for faceIdx, face := range mesh.Faces {
+			if face.GeometryMode == 0 {
+				continue
+			}
+
+			p := polygon{normal: matrix.Mul4x1(mesh.FaceNormals[faceIdx].Vec4(0)).Vec3(), ambientLight: ambientLight, extraLight: extraLight}
+			if face.MaterialID >= 0 && face.MaterialID < int64(len(r.object.Materials)) {
+				p.material = &r.object.Materials[face.MaterialID]
+				if r.animator != nil {
+					p.cel = r.animator.MaterialCel(p.material)
+				}
+			}
+
+			p.vertices = make([]vertex, len(face.VertexIds))
+			for idx, id := range face.VertexIds {
+				v := vertex{position: mgl32.TransformCoordinate(mesh.Vertices[id], matrix), light: float32(face.LightIntensities[idx])}
+				if textureVertexID := face.TextureVertexIds[idx]; len(mesh.TextureVertices) > 0 && textureVertexID != -1 {
+					v.uv = mesh.TextureVertices[textureVertexID]
+				}
+				p.vertices[idx] = v
+			}
+
+			fb.drawPolygon(p, r.colors)
+		}
+	}
+}
+
+// meshMatrices places every mesh by the hierarchy node it is attached to.
+func (r *Jk3doRenderer) meshMatrices(thing *jktypes.Thing, pose []animation.NodePose) []mgl32.Mat4 {
+	nodeMatrices := animation.NodeMatrices(r.object, pose)
+
+	thingTranslate := mgl32.Translate3D(thing.Position.X(), thing.Position.Y(), thing.Position.Z())
+	thingRotation := animation.RotationMatrix(mgl32.Vec3{float32(thing.Pitch), float32(thing.Yaw), float32(thing.Roll)})
+	thingMatrix := thingTranslate.Mul4(thingRotation)
+
+	meshes := r.object.GeoSets[r.lod].Meshes
+	meshMatrices := make([]mgl32.Mat4, len(meshes))
+	for i := range meshMatrices {
+		meshMatrices[i] = thingMatrix
+	}
+	for i, node := range r.object.Hierarchy {
+		if node.MeshID >= 0 && node.MeshID < int64(len(meshes)) {
+			meshMatrices[node.MeshID] = thingMatrix.Mul4(nodeMatrices[i])
+		}
+	}
+	return meshMatrices
+}
+
+// Bounds returns the corners of the box around the posed 3do.
+func (r *Jk3doRenderer) Bounds() (mgl32.Vec3, mgl32.Vec3) {
+	if r.lod >= len(r.object.GeoSets) {
+		return r.thing.Position, r.thing.Position
+	}
+
+	var vertices []mgl32.Vec3
+	meshMatrices := r.meshMatrices(r.thing, r.pose())
+	for meshIdx, mesh := range r.object.GeoSets[r.lod].Meshes {
+		for _, v := range mesh.Vertices {
+			vertices = append(vertices, mgl32.TransformCoordinate(v, meshMatrices[meshIdx]))
+		}
+	}
+	return bounds(vertices)
+}
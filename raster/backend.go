@@ -0,0 +1,226 @@
+package raster
+
+import (
+	"github.com/go-gl/mathgl/mgl32"
+	"github.com/joelhays/go-jk/animation"
+	"github.com/joelhays/go-jk/backend"
+	"github.com/joelhays/go-jk/camera"
+	"github.com/joelhays/go-jk/jk/jktypes"
+	"image/color"
+	"sync"
+)
+
+// Backend implements backend.Backend by drawing into a Framebuffer, so scenes
+// can run without a display. The menu only shows its background and is never clicked.
+type Backend struct {
+	fb         *Framebuffer
+	mutex      sync.Mutex
+	nextHandle int32
+	levels     map[backend.MeshHandle]*LevelRenderer
+	models     map[backend.MeshHandle]*Jk3doRenderer
+	images     map[backend.TextureHandle][]rgbaImage
+}
+
+func NewBackend(fb *Framebuffer) *Backend {
+	return &Backend{
+		fb:     fb,
+		levels: make(map[backend.MeshHandle]*LevelRenderer),
+		models: make(map[backend.MeshHandle]*Jk3doRenderer),
+		images: make(map[backend.TextureHandle][]rgbaImage),
+	}
+}
+
+// Framebuffer returns the framebuffer drawn into.
+func (b *Backend) Framebuffer() *Framebuffer {
+	return b.fb
+}
+
+func (b *Backend) handle() int32 {
+	b.nextHandle++
+	return b.nextHandle
+}
+
+func (b *Backend) UploadLevel(mesh *jktypes.JkMesh, sectors []jktypes.Sector, animator *animation.CelAnimator) backend.MeshHandle {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	handle := backend.MeshHandle(b.handle())
+	b.levels[handle] = NewLevelRenderer(mesh, sectors, nil, animator)
+	return handle
+}
+
+func (b *Backend) Upload3do(object *jktypes.Jk3doFile, animator *animation.CelAnimator) backend.MeshHandle {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	handle := backend.MeshHandle(b.handle())
+	b.models[handle] = NewJk3doRenderer(&jktypes.Thing{}, object, nil, animator)
+	return handle
+}
+
+func (b *Backend) UploadImage(bm *jktypes.BMFile) backend.TextureHandle {
+	images := make([]rgbaImage, len(bm.Images))
+	for i, img := range bm.Images {
+		// images that fail to decode stay empty and are not drawn
+		if rgba, err := bm.RGBA(i); err == nil {
+			images[i] = rgbaImage{sizeX: int(img.SizeX), sizeY: int(img.SizeY), pix: rgba}
+		}
+	}
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	handle := backend.TextureHandle(b.handle())
+	b.images[handle] = images
+	return handle
+}
+
+func (b *Backend) ReleaseMesh(mesh backend.MeshHandle) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	delete(b.levels, mesh)
+	delete(b.models, mesh)
+}
+
+func (b *Backend) ReleaseTexture(texture backend.TextureHandle) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	delete(b.images, texture)
+}
+
+func (b *Backend) BeginFrame(cam *camera.Camera) {
+	b.fb.Clear(color.RGBA{A: 255})
+	b.fb.SetCamera(cam)
+}
+
+func (b *Backend) DrawLevel(mesh backend.MeshHandle, sectors []int64) {
+	b.mutex.Lock()
+	r := b.levels[mesh]
+	b.mutex.Unlock()
+	if r != nil {
+		r.RenderSectors(b.fb, sectors)
+	}
+}
+
+func (b *Backend) Draw3do(mesh backend.MeshHandle, thing *jktypes.Thing, sector *jktypes.Sector, pose []animation.NodePose) {
+	b.mutex.Lock()
+	r := b.models[mesh]
+	b.mutex.Unlock()
+	if r == nil {
+		return
+	}
+	if pose == nil {
+		pose = animation.RestPose(r.object)
+	}
+	r.render(b.fb, thing, sector, pose)
+}
+
+func (b *Backend) DrawImage(texture backend.TextureHandle, image int, scale mgl32.Vec2) {
+	b.mutex.Lock()
+	images := b.images[texture]
+	b.mutex.Unlock()
+	if image >= 0 && image < len(images) {
+		b.fb.drawImage(images[image], scale)
+	}
+}
+
+func (b *Backend) DrawQuads(texture backend.TextureHandle, image int, quads []backend.Quad) {
+	b.mutex.Lock()
+	images := b.images[texture]
+	b.mutex.Unlock()
+	if image >= 0 && image < len(images) {
+		for _, quad := range quads {
+			b.fb.drawQuad(images[image], quad)
+		}
+	}
+}
+
+func (b *Backend) DrawMenu(menu backend.MenuView) backend.MenuEvent {
+	b.DrawImage(menu.Background, 0, mgl32.Vec2{1, 1})
+	return backend.NoMenuEvent
+}
+
+func (b *Backend) EndFrame() {
+}
+
+func (b *Backend) SetShadingMode(mode backend.ShadingMode) {
+	b.fb.Shading = ShadingMode(mode)
+}
+
+func (b *Backend) GetShadingMode() backend.ShadingMode {
+	return backend.ShadingMode(b.fb.Shading)
+}
+
+// rgbaImage is an image of a BM decoded to 4 bytes per pixel.
+type rgbaImage struct {
+	sizeX, sizeY int
+	pix          []byte
+}
+
+// drawImage draws img over everything, centered and covering scale of the
+// framebuffer. Transparent pixels are left out.
+func (fb *Framebuffer) drawImage(img rgbaImage, scale mgl32.Vec2) {
+	if img.sizeX <= 0 || img.sizeY <= 0 {
+		return
+	}
+
+	w := int(float32(fb.width) * scale.X())
+	h := int(float32(fb.height) * scale.Y())
+	left := (fb.width - w) / 2
+	top := (fb.height - h) / 2
+	for y := 0; y < h; y++ {
+		py := top + y
+		if py < 0 || py >= fb.height {
+			continue
+		}
+		row := y * img.sizeY / h
+		for x := 0; x < w; x++ {
+			px := left + x
+			if px < 0 || px >= fb.width {
+				continue
+			}
+			texel := img.pix[(row*img.sizeX+x*img.sizeX/w)*4:]
+			if texel[3] == 0 {
+				continue
+			}
+			offset := (py*fb.width + px) * 4
+			fb.color.Pix[offset] = texel[0]
+			fb.color.Pix[offset+1] = texel[1]
+			fb.color.Pix[offset+2] = texel[2]
+			fb.color.Pix[offset+3] = 255
+		}
+	}
+}
+
+// drawQuad draws a part of img over everything, sampling the nearest pixel.
+// Transparent pixels are left out.
+func (fb *Framebuffer) drawQuad(img rgbaImage, quad backend.Quad) {
+	if quad.Width <= 0 || quad.Height <= 0 {
+		return
+	}
+
+	for py := int(quad.Y); py < int(quad.Y+quad.Height); py++ {
+		if py < 0 || py >= fb.height {
+			continue
+		}
+		row := int(quad.SrcY + (float32(py)-quad.Y+0.5)*quad.SrcHeight/quad.Height)
+		if row < 0 || row >= img.sizeY {
+			continue
+		}
+		for px := int(quad.X); px < int(quad.X+quad.Width); px++ {
+			if px < 0 || px >= fb.width {
+				continue
+			}
+			column := int(quad.SrcX + (float32(px)-quad.X+0.5)*quad.SrcWidth/quad.Width)
+			if column < 0 || column >= img.sizeX {
+				continue
+			}
+			texel := img.pix[(row*img.sizeX+column)*4:]
+			if texel[3] == 0 {
+				continue
+			}
+			offset := (py*fb.width + px) * 4
+			fb.color.Pix[offset] = texel[0]
+			fb.color.Pix[offset+1] = texel[1]
+			fb.color.Pix[offset+2] = texel[2]
+			fb.color.Pix[offset+3] = 255
+		}
+	}
+}
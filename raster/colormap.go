@@ -0,0 +1,33 @@
+package raster
+
+import (
+	"github.com/joelhays/go-jk/jk/jktypes"
+)
+
+// colorTable holds the palette color of every palette index at every light
+// level of a colormap, like the colormap texture of the opengl renderers.
+type colorTable struct {
+	palette [256]jktypes.Vec3Byte
+	levels  [jktypes.ColorMapLightLevels][256]jktypes.Vec3Byte
+}
+
+func newColorTable(colorMap jktypes.ColorMap) *colorTable {
+	t := &colorTable{palette: colorMap.Palette}
+	for level := 0; level < jktypes.ColorMapLightLevels; level++ {
+		for i := 0; i < 256; i++ {
+			if level < len(colorMap.LightLevels) {
+				t.levels[level][i] = colorMap.Palette[colorMap.LightLevels[level][i]]
+				continue
+			}
+
+			// no light tables, fade the palette to black instead
+			scale := float32(level) / float32(jktypes.ColorMapLightLevels-1)
+			color := colorMap.Palette[i]
+			color.R = byte(float32(color.R) * scale)
+			color.G = byte(float32(color.G) * scale)
+			color.B = byte(float32(color.B) * scale)
+			t.levels[level][i] = color
+		}
+	}
+	return t
+}
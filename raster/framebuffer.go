@@ -0,0 +1,141 @@
+// Package raster draws levels and models in software, without a window or GPU,
+// e.g. to take screenshots on machines without a display. It mirrors what the
+// opengl renderers and shaders draw: textured triangle fans with depth testing
+// and back face culling, shaded by a light at the camera or through the colormap.
+package raster
+
+import (
+	"github.com/go-gl/mathgl/mgl32"
+	"github.com/joelhays/go-jk/camera"
+	"image"
+	"image/color"
+	"math"
+)
+
+type ShadingMode int32
+
+const (
+	// SHADING_PHONG lights everything with a light placed at the camera
+	SHADING_PHONG ShadingMode = 0
+	// SHADING_COLORMAP shades texels through the colormap light levels like the original game
+	SHADING_COLORMAP ShadingMode = 1
+)
+
+// Renderer draws into a Framebuffer.
+type Renderer interface {
+	Render(fb *Framebuffer)
+}
+
+// Framebuffer holds the color and depth of every pixel drawn so far and the
+// camera they are drawn from.
+type Framebuffer struct {
+	Shading ShadingMode
+
+	color          *image.RGBA
+	depth          []float32
+	width          int
+	height         int
+	viewProjection mgl32.Mat4
+	viewPos        mgl32.Vec3
+}
+
+func NewFramebuffer(width int, height int) *Framebuffer {
+	fb := &Framebuffer{
+		color:  image.NewRGBA(image.Rect(0, 0, width, height)),
+		depth:  make([]float32, width*height),
+		width:  width,
+		height: height,
+	}
+	fb.Clear(color.RGBA{A: 255})
+	return fb
+}
+
+// Clear fills the framebuffer with c and resets the depth of every pixel.
+func (fb *Framebuffer) Clear(c color.RGBA) {
+	for i := range fb.depth {
+		fb.depth[i] = 1
+		fb.color.Pix[i*4] = c.R
+		fb.color.Pix[i*4+1] = c.G
+		fb.color.Pix[i*4+2] = c.B
+		fb.color.Pix[i*4+3] = c.A
+	}
+}
+
+// Image returns the pixels drawn so far. The image is reused by later draws.
+func (fb *Framebuffer) Image() *image.RGBA {
+	return fb.color
+}
+
+// SetCamera sets the camera the following renderers draw from.
+func (fb *Framebuffer) SetCamera(camera *camera.Camera) {
+	fb.viewProjection = ProjectionMatrix(camera, fb.width, fb.height).Mul4(camera.GetViewMatrix())
+	fb.viewPos = camera.Position
+}
+
+// ViewProjection returns the matrix projecting world positions for the current
+// camera, e.g. to update a visibility.Culler.
+func (fb *Framebuffer) ViewProjection() mgl32.Mat4 {
+	return fb.viewProjection
+}
+
+// Draw draws renderers from camera, like opengl.Draw.
+func Draw(fb *Framebuffer, camera *camera.Camera, renderers []Renderer) {
+	fb.SetCamera(camera)
+	for _, renderer := range renderers {
+		renderer.Render(fb)
+	}
+}
+
+// ProjectionMatrix returns the perspective projection used when drawing with the
+// camera, the same as opengl.ProjectionMatrix.
+func ProjectionMatrix(camera *camera.Camera, width int, height int) mgl32.Mat4 {
+	return camera.ProjectionMatrix(width, height)
+}
+
+// Diff counts the pixels of a and b whose channels differ by more than
+// tolerance. Images of different sizes differ in every pixel.
+func Diff(a image.Image, b image.Image, tolerance int) int {
+	bounds := a.Bounds()
+	if bounds.Size() != b.Bounds().Size() {
+		return bounds.Dx() * bounds.Dy()
+	}
+
+	offset := b.Bounds().Min.Sub(bounds.Min)
+	var count int
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			r1, g1, b1, a1 := a.At(x, y).RGBA()
+			r2, g2, b2, a2 := b.At(x+offset.X, y+offset.Y).RGBA()
+			if channelDiff(r1, r2) > tolerance || channelDiff(g1, g2) > tolerance ||
+				channelDiff(b1, b2) > tolerance || channelDiff(a1, a2) > tolerance {
+				count++
+			}
+		}
+	}
+	return count
+}
+
+func channelDiff(a uint32, b uint32) int {
+	d := int(a>>8) - int(b>>8)
+	if d < 0 {
+		return -d
+	}
+	return d
+}
+
+// FrameBounds places camera in front of the box between min and max, looking
+// along -y like the 3do scene, far enough for the whole box to be in view.
+func FrameBounds(camera *camera.Camera, min mgl32.Vec3, max mgl32.Vec3) {
+	center := min.Add(max).Mul(0.5)
+	radius := max.Sub(min).Len() / 2
+	if radius == 0 {
+		radius = 0.1
+	}
+	distance := radius / float32(math.Sin(float64(mgl32.DegToRad(float32(camera.Zoom))/2)))
+
+	camera.Position = center.Add(mgl32.Vec3{0, distance, 0})
+	camera.WorldUp = mgl32.Vec3{0, 0, 1}
+	camera.Yaw = 90
+	camera.Pitch = 0
+	camera.UpdateCameraVectors()
+}
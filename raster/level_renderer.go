@@ -0,0 +1,161 @@
+package raster
+
+import (
+	"github.com/go-gl/mathgl/mgl32"
+	"github.com/joelhays/go-jk/animation"
+	"github.com/joelhays/go-jk/jk/jktypes"
+	"github.com/joelhays/go-jk/visibility"
+)
+
+type LevelRenderer struct {
+	object   *jktypes.JkMesh
+	sectors  []jktypes.Sector
+	culler   *visibility.Culler
+	animator *animation.CelAnimator
+	colors   []*colorTable
+}
+
+// NewLevelRenderer creates a renderer for the level geometry. When a culler is
+// given only the sectors it found visible are drawn, otherwise the whole level is.
+// Animated materials show the cel picked by animator, or their first cel when it is nil.
+func NewLevelRenderer(object *jktypes.JkMesh, sectors []jktypes.Sector, culler *visibility.Culler, animator *animation.CelAnimator) *LevelRenderer {
+	r := &LevelRenderer{object: object, sectors: sectors, culler: culler, animator: animator}
+	for _, colorMap := range object.ColorMaps {
+		r.colors = append(r.colors, newColorTable(colorMap))
+	}
+	if len(r.colors) == 0 {
+		r.colors = append(r.colors, newColorTable(jktypes.ColorMap{}))
+	}
+	return r
+}
+
+func (r *LevelRenderer) Render(fb *Framebuffer) {
+	if r.culler == nil {
+		r.RenderSectors(fb, nil)
+		return
+	}
+	r.RenderSectors(fb, r.culler.VisibleSectors())
+}
+
+// RenderSectors draws the surfaces of the given sectors, or all of them when sectors is nil.
+func (r *LevelRenderer) RenderSectors(fb *Framebuffer, sectors []int64) {
+	if sectors == nil {
+		r.renderSurfaces(fb, 0, int64(len(r.object.Surfaces)))
+		return
+	}
+
+	for _, sectorID := range sectors {
+		sector := r.sectors[sectorID]
+		r.renderSurfaces(fb, sector.FirstSurface, sector.FirstSurface+sector.NumSurfaces)
+	}
+}
+
+func (r *LevelRenderer) renderSurfaces(fb *Framebuffer, first int64, last int64) {
+	for i := first; i < last; i++ {
+		surface := r.object.Surfaces[i]
+		if surface.Geo == 0 {
+			continue
+		}
+
+		p := polygon{normal: surface.Normal}
+		if surface.MaterialID >= 0 && surface.MaterialID < int64(len(r.object.Materials)) {
+			p.material = &r.object.Materials[surface.MaterialID]
+			if r.animator != nil {
+				p.cel = r.animator.SurfaceCel(i, p.material)
+			}
+		}
+
+		// surfaces are lit by their vertex intensities, never darker than the ambient
+		// light of their sector, plus the extra light of both the sector and the surface
+		// in the colormap of their sector, the first one of the level when it has none
+		p.extraLight = float32(surface.ExtraLight)
+		colors := r.colors[0]
+		if surface.Sector >= 0 && surface.Sector < int64(len(r.sectors)) {
+			sector := r.sectors[surface.Sector]
+			p.ambientLight = float32(sector.AmbientLight)
+			p.extraLight += float32(sector.ExtraLight)
+			if sector.ColorMap >= 0 && sector.ColorMap < int64(len(r.colors)) {
+				colors = r.colors[sector.ColorMap]
+			}
+		}
+
+		p.vertices = make([]vertex, len(surface.VertexIds))
+		for idx, id := range surface.VertexIds {
+			v := vertex{position: r.object.Vertices[id], light: float32(surface.LightIntensities[idx])}
+			if textureVertexID := surface.TextureVertexIds[idx]; textureVertexID != -1 {
+				v.uv = r.object.TextureVertices[textureVertexID]
+			}
+			p.vertices[idx] = v
+		}
+
+		fb.drawPolygon(p, colors)
+	}
+}
+
+// Bounds returns the corners of the box around every vertex of the level.
+func (r *LevelRenderer) Bounds() (mgl32.Vec3, mgl32.Vec3) {
+	return bounds(r.object.Vertices)
+}
+
+func bounds(vertices []mgl32.Vec3) (mgl32.Vec3, mgl32.Vec3) {
+	if len(vertices) == 0 {
+		return mgl32.Vec3{}, mgl32.Vec3{}
+	}
+	min, max := vertices[0], vertices[0]
+	for _, v := range vertices[1:] {
+		for i := 0; i < 3; i++ {
+			if v[i] < min[i] {
+				min[i] = v[i]
+			}
+			if v[i] > max[i] {
+				max[i] = v[i]
+			}
+		}
+	}
+	return min, max
+}
+
+// JklRenderer draws a level with the 3dos of its things. Things in sectors the
+// culler did not find visible are skipped like the level surfaces.
+type JklRenderer struct {
+	level  *LevelRenderer
+	things []thingRenderer
+	culler *visibility.Culler
+}
+
+type thingRenderer struct {
+	renderer *Jk3doRenderer
+	sector   int64
+}
+
+// NewJklRenderer creates a renderer for a level and every thing in it with a 3do,
+// except the player. Culler and animator may be nil as for NewLevelRenderer.
+func NewJklRenderer(level *jktypes.Jkl, culler *visibility.Culler, animator *animation.CelAnimator) *JklRenderer {
+	r := &JklRenderer{level: NewLevelRenderer(level.Model, level.Sectors, culler, animator), culler: culler}
+	for i := range level.Things {
+		thing := &level.Things[i]
+		if thing.TemplateName == "walkplayer" {
+			continue
+		}
+		jk3do, ok := level.Jk3dos[level.Jk3doTemplates[thing.TemplateName].Jk3doName]
+		if !ok || len(jk3do.GeoSets) == 0 {
+			continue
+		}
+
+		var sector *jktypes.Sector
+		if thing.Sector >= 0 && thing.Sector < int64(len(level.Sectors)) {
+			sector = &level.Sectors[thing.Sector]
+		}
+		r.things = append(r.things, thingRenderer{renderer: NewJk3doRenderer(thing, &jk3do, sector, animator), sector: thing.Sector})
+	}
+	return r
+}
+
+func (r *JklRenderer) Render(fb *Framebuffer) {
+	r.level.Render(fb)
+	for _, thing := range r.things {
+		if r.culler == nil || r.culler.SectorVisible(thing.sector) {
+			thing.renderer.Render(fb)
+		}
+	}
+}
@@ -0,0 +1,246 @@
+package raster
+
+import (
+	"github.com/go-gl/mathgl/mgl32"
+	"github.com/joelhays/go-jk/jk/jktypes"
+	"math"
+)
+
+// untexturedColor is the color of surfaces whose material has no cels, so the
+// geometry shows even without the MAT files.
+const untexturedColor = 128
+
+type vertex struct {
+	position mgl32.Vec3 // world position
+	uv       mgl32.Vec2 // texel coordinates
+	light    float32
+}
+
+// polygon is a surface or face, drawn as a triangle fan like the opengl renderers.
+type polygon struct {
+	vertices     []vertex
+	normal       mgl32.Vec3
+	material     *jktypes.Material
+	cel          int
+	ambientLight float32
+	extraLight   float32
+}
+
+// clipVertex is a vertex in clip space with the attributes interpolated over
+// the polygon.
+type clipVertex struct {
+	clip  mgl32.Vec4
+	world mgl32.Vec3
+	uv    mgl32.Vec2
+	light float32
+}
+
+func (v clipVertex) lerp(o clipVertex, t float32) clipVertex {
+	return clipVertex{
+		clip:  v.clip.Add(o.clip.Sub(v.clip).Mul(t)),
+		world: v.world.Add(o.world.Sub(v.world).Mul(t)),
+		uv:    v.uv.Add(o.uv.Sub(v.uv).Mul(t)),
+		light: v.light + (o.light-v.light)*t,
+	}
+}
+
+// screenVertex is a vertex after the perspective divide. Attributes are divided
+// by w so they can be interpolated linearly on screen.
+type screenVertex struct {
+	x, y, z float32
+	invW    float32
+	world   mgl32.Vec3
+	uv      mgl32.Vec2
+	light   float32
+}
+
+func (fb *Framebuffer) drawPolygon(p polygon, colors *colorTable) {
+	if len(p.vertices) < 3 {
+		return
+	}
+
+	clipped := make([]clipVertex, len(p.vertices))
+	for i, v := range p.vertices {
+		clipped[i] = clipVertex{clip: fb.viewProjection.Mul4x1(v.position.Vec4(1)), world: v.position, uv: v.uv, light: v.light}
+	}
+	clipped = clipNear(clipped)
+	if len(clipped) < 3 {
+		return
+	}
+
+	screen := make([]screenVertex, len(clipped))
+	var area float32
+	for i, v := range clipped {
+		invW := 1 / v.clip.W()
+		ndcX := v.clip.X() * invW
+		ndcY := v.clip.Y() * invW
+		screen[i] = screenVertex{
+			x:     (ndcX*0.5 + 0.5) * float32(fb.width),
+			y:     (0.5 - ndcY*0.5) * float32(fb.height),
+			z:     v.clip.Z() * invW,
+			invW:  invW,
+			world: v.world.Mul(invW),
+			uv:    v.uv.Mul(invW),
+			light: v.light * invW,
+		}
+	}
+	for i := range screen {
+		a, b := screen[i], screen[(i+1)%len(screen)]
+		area += a.x*b.y - b.x*a.y
+	}
+	// front faces wind counterclockwise, which is clockwise with y pointing down
+	if area >= 0 {
+		return
+	}
+
+	shader := fragmentShader{fb: fb, polygon: &p, colors: colors}
+	if p.material != nil && p.cel >= 0 && p.cel < len(p.material.Cels) && len(p.material.Cels[p.cel].MipMaps) > 0 {
+		shader.cel = &p.material.Cels[p.cel]
+	}
+	for i := 1; i < len(screen)-1; i++ {
+		fb.drawTriangle(screen[0], screen[i], screen[i+1], &shader)
+	}
+}
+
+// clipNear clips a polygon against the near plane, z >= -w.
+func clipNear(vertices []clipVertex) []clipVertex {
+	var out []clipVertex
+	for i, v := range vertices {
+		next := vertices[(i+1)%len(vertices)]
+		d0 := v.clip.Z() + v.clip.W()
+		d1 := next.clip.Z() + next.clip.W()
+		if d0 >= 0 {
+			out = append(out, v)
+		}
+		if (d0 >= 0) != (d1 >= 0) {
+			out = append(out, v.lerp(next, d0/(d0-d1)))
+		}
+	}
+	return out
+}
+
+func edge(a, b screenVertex, x, y float32) float32 {
+	return (b.x-a.x)*(y-a.y) - (b.y-a.y)*(x-a.x)
+}
+
+func (fb *Framebuffer) drawTriangle(v0, v1, v2 screenVertex, shader *fragmentShader) {
+	area := edge(v0, v1, v2.x, v2.y)
+	if area == 0 {
+		return
+	}
+
+	minX := int(math.Max(0, math.Floor(float64(min3(v0.x, v1.x, v2.x)))))
+	maxX := int(math.Min(float64(fb.width-1), math.Ceil(float64(max3(v0.x, v1.x, v2.x)))))
+	minY := int(math.Max(0, math.Floor(float64(min3(v0.y, v1.y, v2.y)))))
+	maxY := int(math.Min(float64(fb.height-1), math.Ceil(float64(max3(v0.y, v1.y, v2.y)))))
+
+	for y := minY; y <= maxY; y++ {
+		py := float32(y) + 0.5
+		for x := minX; x <= maxX; x++ {
+			px := float32(x) + 0.5
+			b0 := edge(v1, v2, px, py) / area
+			b1 := edge(v2, v0, px, py) / area
+			b2 := edge(v0, v1, px, py) / area
+			if b0 < 0 || b1 < 0 || b2 < 0 {
+				continue
+			}
+
+			z := b0*v0.z + b1*v1.z + b2*v2.z
+			idx := y*fb.width + x
+			if z > 1 || z >= fb.depth[idx] {
+				continue
+			}
+
+			w := 1 / (b0*v0.invW + b1*v1.invW + b2*v2.invW)
+			frag := fragment{
+				world: v0.world.Mul(b0).Add(v1.world.Mul(b1)).Add(v2.world.Mul(b2)).Mul(w),
+				uv:    v0.uv.Mul(b0).Add(v1.uv.Mul(b1)).Add(v2.uv.Mul(b2)).Mul(w),
+				light: (b0*v0.light + b1*v1.light + b2*v2.light) * w,
+			}
+			r, g, b, ok := shader.shade(frag)
+			if !ok {
+				continue
+			}
+
+			fb.depth[idx] = z
+			fb.color.Pix[idx*4] = r
+			fb.color.Pix[idx*4+1] = g
+			fb.color.Pix[idx*4+2] = b
+			fb.color.Pix[idx*4+3] = 255
+		}
+	}
+}
+
+type fragment struct {
+	world mgl32.Vec3
+	uv    mgl32.Vec2
+	light float32
+}
+
+// fragmentShader does what shaders/fragment.glsl does, sampling the nearest
+// texel of the full sized cel.
+type fragmentShader struct {
+	fb      *Framebuffer
+	polygon *polygon
+	cel     *jktypes.MaterialCel
+	colors  *colorTable
+}
+
+func (s *fragmentShader) shade(frag fragment) (byte, byte, byte, bool) {
+	index := -1
+	if s.cel != nil {
+		x := wrap(frag.uv.X(), s.cel.SizeX)
+		y := wrap(frag.uv.Y(), s.cel.SizeY)
+		index = int(s.cel.MipMaps[0][y*int(s.cel.SizeX)+x])
+		if s.cel.Transparent && index == 0 {
+			return 0, 0, 0, false
+		}
+	}
+
+	if s.fb.Shading == SHADING_COLORMAP {
+		light := mgl32.Clamp(float32(math.Max(float64(frag.light), float64(s.polygon.ambientLight)))+s.polygon.extraLight, 0, 1)
+		level := int(light*63 + 0.5)
+		if index < 0 {
+			c := byte(untexturedColor * level / 63)
+			return c, c, c, true
+		}
+		c := s.colors.levels[level][index]
+		return c.R, c.G, c.B, true
+	}
+
+	// ambient, diffuse and specular light from the camera position
+	norm := s.polygon.normal.Normalize()
+	lightDirection := s.fb.viewPos.Sub(frag.world).Normalize()
+	diff := float32(math.Max(float64(norm.Dot(lightDirection)), 0))
+	reflectDirection := lightDirection.Mul(-1).Sub(norm.Mul(2 * norm.Dot(lightDirection.Mul(-1))))
+	spec := float32(math.Pow(math.Max(float64(lightDirection.Dot(reflectDirection)), 0), 32))
+	strength := 0.1 + diff + 0.5*spec
+
+	if index < 0 {
+		c := scaleChannel(untexturedColor, strength)
+		return c, c, c, true
+	}
+	c := s.colors.palette[index]
+	return scaleChannel(c.R, strength), scaleChannel(c.G, strength), scaleChannel(c.B, strength), true
+}
+
+// wrap returns the texel at coordinate v repeating a texture of the given size.
+func wrap(v float32, size int32) int {
+	i := int(math.Floor(float64(v))) % int(size)
+	if i < 0 {
+		i += int(size)
+	}
+	return i
+}
+
+func scaleChannel(c byte, strength float32) byte {
+	return byte(mgl32.Clamp(float32(c)*strength, 0, 255))
+}
+
+func min3(a, b, c float32) float32 {
+	return float32(math.Min(float64(a), math.Min(float64(b), float64(c))))
+}
+
+func max3(a, b, c float32) float32 {
+	return float32(math.Max(float64(a), math.Max(float64(b), float64(c))))
+}
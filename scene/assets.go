@@ -0,0 +1,29 @@
+package scene
+
+import (
+	"github.com/joelhays/go-jk/jk"
+	"github.com/joelhays/go-jk/jk/jkparsers"
+	"sync"
+)
+
+var (
+	assets     *jkparsers.AssetCache
+	assetsOnce sync.Once
+	diskCache  *jkparsers.DiskCache
+)
+
+// SetDiskCache makes the scenes load levels and models parsed before from cache.
+// It must be called before any scene is loaded.
+func SetDiskCache(cache *jkparsers.DiskCache) {
+	diskCache = cache
+}
+
+// sharedAssets returns the asset cache shared by every scene, so switching
+// between levels reuses the materials and models they have in common.
+func sharedAssets() *jkparsers.AssetCache {
+	assetsOnce.Do(func() {
+		assets = jkparsers.NewAssetCache(jk.GetLoader().FS(), 0)
+		assets.SetDiskCache(diskCache)
+	})
+	return assets
+}
@@ -1,44 +1,58 @@
 package scene
 
 import (
-	"github.com/go-gl/glfw/v3.2/glfw"
 	"github.com/go-gl/mathgl/mgl32"
+	"github.com/joelhays/go-jk/backend"
 	"github.com/joelhays/go-jk/camera"
 	"github.com/joelhays/go-jk/jk"
 	"github.com/joelhays/go-jk/jk/jkparsers"
 	"github.com/joelhays/go-jk/jk/jktypes"
-	"github.com/joelhays/go-jk/opengl"
+	"log"
 )
 
+// bmImageRate is the number of images per second a multi-image BM is shown with.
+const bmImageRate = 4
+
 type BMScene struct {
-	bmName        string
-	shaderProgram *opengl.ShaderProgram
-	renderers     []opengl.Renderer
-	cam           *camera.Camera
-	window        *glfw.Window
-	bmRenderer    opengl.Renderer
-	bm            *jktypes.BMFile
+	bmName  string
+	backend backend.Backend
+	window  backend.Window
+	cam     *camera.Camera
+	texture backend.TextureHandle
+	scale   mgl32.Vec2
+	bm      *jktypes.BMFile
 }
 
-func NewBMScene(bmName string, window *glfw.Window, cam *camera.Camera, shaderProgram *opengl.ShaderProgram) *BMScene {
-	return &BMScene{bmName: bmName, window: window, cam: cam, shaderProgram: shaderProgram}
+func NewBMScene(bmName string, b backend.Backend, window backend.Window, cam *camera.Camera) *BMScene {
+	return &BMScene{bmName: bmName, backend: b, window: window, cam: cam}
 }
 
 func (s *BMScene) Load() {
-	var bm jktypes.BMFile
 	fileBytes := jk.GetLoader().LoadResource(s.bmName)
-	if fileBytes != nil {
-		bm = jkparsers.NewBmParser().ParseFromBytes(fileBytes)
+	if fileBytes == nil {
+		return
+	}
+
+	parser := jkparsers.NewBmParser(jk.GetLoader().FS())
+	parser.SetFileName(s.bmName)
+	bm, err := parser.ParseFromBytes(fileBytes)
+	if err != nil {
+		log.Println(err)
+		return
 	}
 	s.bm = &bm
 }
 
 func (s *BMScene) Unload() {
-
+	if s.texture != 0 {
+		s.backend.ReleaseTexture(s.texture)
+		s.texture = 0
+	}
+	s.bm = nil
 }
 
 func (s *BMScene) Update() {
-	if s.bm != nil && s.bmRenderer == nil {
+	if s.bm != nil && len(s.bm.Images) > 0 && s.texture == 0 {
 		//w, h := s.window.GetSize()
 		w := 640
 		h := 480
@@ -57,11 +71,13 @@ func (s *BMScene) Update() {
 		}
 		//fmt.Printf("%d, %d, %+v\n", s.bm.Images[0].SizeX, s.bm.Images[0].SizeY, scale)
 
-		s.bmRenderer = opengl.NewOpenGlBmRenderer(s.bm, scale, s.shaderProgram)
-		s.renderers = append(s.renderers, s.bmRenderer)
+		s.scale = scale
+		s.texture = s.backend.UploadImage(s.bm)
 	}
 
-	if len(s.renderers) > 0 {
-		opengl.Draw(s.window, s.cam, s.renderers)
+	if s.texture != 0 {
+		// multi-image BMs hold animations and button states, show them in turn
+		image := int(s.window.GetTime()*bmImageRate) % len(s.bm.Images)
+		s.backend.DrawImage(s.texture, image, s.scale)
 	}
 }
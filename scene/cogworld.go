@@ -0,0 +1,215 @@
+package scene
+
+import (
+	"fmt"
+	"github.com/joelhays/go-jk/animation"
+	"github.com/joelhays/go-jk/cog"
+	"github.com/joelhays/go-jk/jk/jktypes"
+	"log"
+	"strings"
+)
+
+// cogWorld gives the level COGs the part of the level the viewer can change: sector
+// lights, surface and material cels and things moving between their frames. Other
+// verbs are logged once and return 0.
+type cogWorld struct {
+	level    *jktypes.Jkl
+	animator *animation.CelAnimator
+	movers   []*animation.FrameMover
+	missing  map[string]bool
+}
+
+func newCogWorld(level *jktypes.Jkl, animator *animation.CelAnimator) *cogWorld {
+	w := &cogWorld{level: level, animator: animator, missing: make(map[string]bool)}
+	for i := range level.Things {
+		w.movers = append(w.movers, animation.NewFrameMover(&level.Things[i]))
+	}
+	return w
+}
+
+func (w *cogWorld) Update(deltaTime float64) {
+	for _, mover := range w.movers {
+		mover.Update(deltaTime)
+	}
+}
+
+func (w *cogWorld) mover(thing int32) (*animation.FrameMover, error) {
+	if thing < 0 || int(thing) >= len(w.movers) {
+		return nil, fmt.Errorf("no thing %d", thing)
+	}
+	return w.movers[thing], nil
+}
+
+func (w *cogWorld) sector(sector int32) (*jktypes.Sector, error) {
+	if sector < 0 || int(sector) >= len(w.level.Sectors) {
+		return nil, fmt.Errorf("no sector %d", sector)
+	}
+	return &w.level.Sectors[sector], nil
+}
+
+func (w *cogWorld) surfaceMaterial(surface int32) (*jktypes.Material, error) {
+	if surface < 0 || int(surface) >= len(w.level.Model.Surfaces) {
+		return nil, fmt.Errorf("no surface %d", surface)
+	}
+	materialID := w.level.Model.Surfaces[surface].MaterialID
+	if materialID < 0 || materialID >= int64(len(w.level.Model.Materials)) {
+		return nil, fmt.Errorf("surface %d has no material", surface)
+	}
+	return &w.level.Model.Materials[materialID], nil
+}
+
+func (w *cogWorld) material(name string) (*jktypes.Material, error) {
+	for i := range w.level.Model.Materials {
+		if strings.EqualFold(w.level.Model.Materials[i].Name, name) {
+			return &w.level.Model.Materials[i], nil
+		}
+	}
+	return nil, fmt.Errorf("no material %s", name)
+}
+
+func (w *cogWorld) RegisterVerbs(library *cog.Library) {
+	library.Register("SetSectorLight", func(ctx *cog.Context, args cog.Args) (cog.Value, error) {
+		sector, err := w.sector(args.Int(0))
+		if err != nil {
+			return cog.Value{}, err
+		}
+		sector.ExtraLight = float64(args.Flex(1))
+		return cog.IntValue(0), nil
+	})
+	library.Register("GetSectorLight", func(ctx *cog.Context, args cog.Args) (cog.Value, error) {
+		sector, err := w.sector(args.Int(0))
+		if err != nil {
+			return cog.Value{}, err
+		}
+		return cog.FlexValue(float32(sector.ExtraLight)), nil
+	})
+
+	library.Register("SetWallCel", func(ctx *cog.Context, args cog.Args) (cog.Value, error) {
+		material, err := w.surfaceMaterial(args.Int(0))
+		if err != nil {
+			return cog.Value{}, err
+		}
+		surface := int64(args.Int(0))
+		previous := w.animator.SurfaceCel(surface, material)
+		w.animator.SetSurfaceCel(surface, material, int(args.Int(1)))
+		return cog.IntValue(int32(previous)), nil
+	})
+	library.Register("GetWallCel", func(ctx *cog.Context, args cog.Args) (cog.Value, error) {
+		material, err := w.surfaceMaterial(args.Int(0))
+		if err != nil {
+			return cog.Value{}, err
+		}
+		return cog.IntValue(int32(w.animator.SurfaceCel(int64(args.Int(0)), material))), nil
+	})
+	library.Register("SurfaceAnim", func(ctx *cog.Context, args cog.Args) (cog.Value, error) {
+		material, err := w.surfaceMaterial(args.Int(0))
+		if err != nil {
+			return cog.Value{}, err
+		}
+		w.animator.SurfaceAnim(int64(args.Int(0)), material, float64(args.Flex(1)), int64(args.Int(2)))
+		return args.Value(0), nil
+	})
+	library.Register("StopSurfaceAnim", func(ctx *cog.Context, args cog.Args) (cog.Value, error) {
+		w.animator.StopSurfaceAnim(int64(args.Int(0)))
+		return cog.IntValue(0), nil
+	})
+	library.Register("MaterialAnim", func(ctx *cog.Context, args cog.Args) (cog.Value, error) {
+		material, err := w.material(args.Str(0))
+		if err != nil {
+			return cog.Value{}, err
+		}
+		w.animator.MaterialAnim(material, float64(args.Flex(1)), int64(args.Int(2)))
+		return cog.IntValue(0), nil
+	})
+	library.Register("SetMaterialCel", func(ctx *cog.Context, args cog.Args) (cog.Value, error) {
+		material, err := w.material(args.Str(0))
+		if err != nil {
+			return cog.Value{}, err
+		}
+		previous := w.animator.MaterialCel(material)
+		w.animator.SetMaterialCel(material, int(args.Int(1)))
+		return cog.IntValue(int32(previous)), nil
+	})
+	library.Register("GetMaterialCel", func(ctx *cog.Context, args cog.Args) (cog.Value, error) {
+		material, err := w.material(args.Str(0))
+		if err != nil {
+			return cog.Value{}, err
+		}
+		return cog.IntValue(int32(w.animator.MaterialCel(material))), nil
+	})
+
+	library.Register("MoveToFrame", func(ctx *cog.Context, args cog.Args) (cog.Value, error) {
+		mover, err := w.mover(args.Int(0))
+		if err != nil {
+			return cog.Value{}, err
+		}
+		mover.MoveToFrame(int(args.Int(1)), args.Flex(2))
+		return cog.IntValue(0), nil
+	})
+	library.Register("JumpToFrame", func(ctx *cog.Context, args cog.Args) (cog.Value, error) {
+		mover, err := w.mover(args.Int(0))
+		if err != nil {
+			return cog.Value{}, err
+		}
+		mover.JumpToFrame(int(args.Int(1)))
+		return cog.IntValue(0), nil
+	})
+	library.Register("GetCurFrame", func(ctx *cog.Context, args cog.Args) (cog.Value, error) {
+		mover, err := w.mover(args.Int(0))
+		if err != nil {
+			return cog.Value{}, err
+		}
+		return cog.IntValue(int32(mover.CurFrame())), nil
+	})
+	library.Register("GetGoalFrame", func(ctx *cog.Context, args cog.Args) (cog.Value, error) {
+		mover, err := w.mover(args.Int(0))
+		if err != nil {
+			return cog.Value{}, err
+		}
+		return cog.IntValue(int32(mover.GoalFrame())), nil
+	})
+	library.Register("IsThingMoving", func(ctx *cog.Context, args cog.Args) (cog.Value, error) {
+		mover, err := w.mover(args.Int(0))
+		if err != nil {
+			return cog.Value{}, err
+		}
+		return cog.BoolValue(mover.Moving()), nil
+	})
+	library.Register("WaitForStop", func(ctx *cog.Context, args cog.Args) (cog.Value, error) {
+		mover, err := w.mover(args.Int(0))
+		if err != nil {
+			return cog.Value{}, err
+		}
+		ctx.WaitUntil(func() bool { return !mover.Moving() })
+		return cog.IntValue(0), nil
+	})
+	library.Register("StopThing", func(ctx *cog.Context, args cog.Args) (cog.Value, error) {
+		mover, err := w.mover(args.Int(0))
+		if err != nil {
+			return cog.Value{}, err
+		}
+		mover.Stop()
+		return cog.IntValue(0), nil
+	})
+	library.Register("GetThingPos", func(ctx *cog.Context, args cog.Args) (cog.Value, error) {
+		if _, err := w.mover(args.Int(0)); err != nil {
+			return cog.Value{}, err
+		}
+		return cog.VectorValue(w.level.Things[args.Int(0)].Position), nil
+	})
+	library.Register("GetThingSector", func(ctx *cog.Context, args cog.Args) (cog.Value, error) {
+		if _, err := w.mover(args.Int(0)); err != nil {
+			return cog.Value{}, err
+		}
+		return cog.IntValue(int32(w.level.Things[args.Int(0)].Sector)), nil
+	})
+
+	library.SetFallback(func(ctx *cog.Context, args cog.Args) (cog.Value, error) {
+		verb := strings.ToLower(ctx.Verb())
+		if !w.missing[verb] {
+			w.missing[verb] = true
+			log.Printf("cog verb %s is not supported by the viewer", ctx.Verb())
+		}
+		return cog.IntValue(0), nil
+	})
+}
@@ -1,37 +1,60 @@
 package scene
 
 import (
-	"github.com/go-gl/glfw/v3.2/glfw"
 	"github.com/go-gl/mathgl/mgl32"
+	"github.com/joelhays/go-jk/animation"
+	"github.com/joelhays/go-jk/backend"
 	"github.com/joelhays/go-jk/camera"
 	"github.com/joelhays/go-jk/jk"
 	"github.com/joelhays/go-jk/jk/jkparsers"
 	"github.com/joelhays/go-jk/jk/jktypes"
-	"github.com/joelhays/go-jk/opengl"
+	"log"
 )
 
 type Jk3doScene struct {
-	jk3doName     string
-	shaderProgram *opengl.ShaderProgram
-	renderers     []opengl.Renderer
-	cam           *camera.Camera
-	window        *glfw.Window
-	obj           *jktypes.Jk3doFile
-	objRenderer   opengl.Renderer
+	jk3doName    string
+	keyName      string
+	backend      backend.Backend
+	window       backend.Window
+	cam          *camera.Camera
+	obj          *jktypes.Jk3doFile
+	assets       *jkparsers.AssetLease
+	key          *jktypes.Key
+	mesh         backend.MeshHandle
+	thing        jktypes.Thing
+	keyAnimation *animation.KeyAnimation
+	lastTime     float64
 }
 
-func NewJk3doScene(jk3doName string, window *glfw.Window, cam *camera.Camera, shaderProgram *opengl.ShaderProgram) *Jk3doScene {
-	return &Jk3doScene{jk3doName: jk3doName, window: window, cam: cam, shaderProgram: shaderProgram}
+// NewJk3doScene creates a scene showing a 3do. When keyName is not empty the KEY
+// animation is played on the 3do in a loop.
+func NewJk3doScene(jk3doName string, keyName string, b backend.Backend, window backend.Window, cam *camera.Camera) *Jk3doScene {
+	return &Jk3doScene{jk3doName: jk3doName, keyName: keyName, backend: b, window: window, cam: cam}
 }
 
 func (s *Jk3doScene) Load() {
-	var obj jktypes.Jk3doFile
-	fileBytes := jk.GetLoader().LoadResource(s.jk3doName)
-	if fileBytes != nil {
-		obj = jkparsers.NewJk3doLineParser().ParseFromString(string(fileBytes))
+	s.assets = sharedAssets().NewLease()
+	obj, err := s.assets.Model(s.jk3doName, "")
+	if err != nil {
+		log.Println(err)
+		return
 	}
 
 	s.obj = &obj
+
+	if s.keyName != "" {
+		if fileBytes := jk.GetLoader().LoadResource(s.keyName); fileBytes != nil {
+			parser := jkparsers.NewKeyLineParser()
+			parser.SetFileName(s.keyName)
+			key, err := parser.ParseFromString(string(fileBytes))
+			if err != nil {
+				log.Println(err)
+			} else {
+				s.key = &key
+			}
+		}
+	}
+
 	s.cam.Position = mgl32.Vec3{0, 1, 0}
 	s.cam.Up = mgl32.Vec3{0, 0, 1}
 	s.cam.Yaw = 90
@@ -40,18 +63,43 @@ func (s *Jk3doScene) Load() {
 }
 
 func (s *Jk3doScene) Unload() {
-
+	if s.mesh != 0 {
+		s.backend.ReleaseMesh(s.mesh)
+		s.mesh = 0
+	}
+	s.obj = nil
+	s.key = nil
+	s.keyAnimation = nil
+	if s.assets != nil {
+		s.assets.Release()
+		s.assets = nil
+	}
 }
 
 func (s *Jk3doScene) Update() {
-	if s.obj != nil && s.objRenderer == nil {
-		s.window.SetInputMode(glfw.CursorMode, glfw.CursorDisabled)
+	if s.obj != nil && len(s.obj.GeoSets) > 0 && s.mesh == 0 {
+		s.window.SetCursorCaptured(true)
+
+		s.thing = jktypes.Thing{Position: mgl32.Vec3{float32(0), float32(0), float32(0)}, Yaw: 0, Pitch: 0, Roll: 0}
+		s.mesh = s.backend.Upload3do(s.obj, nil)
 
-		s.objRenderer = opengl.NewOpenGl3doRenderer(&jktypes.Thing{Position: mgl32.Vec3{float32(0), float32(0), float32(0)}, Yaw: 0, Pitch: 0, Roll: 0}, nil, s.obj, s.shaderProgram)
-		s.renderers = append(s.renderers, s.objRenderer)
+		if s.key != nil {
+			s.keyAnimation = animation.NewKeyAnimation(s.key, s.obj, jktypes.KEY_FLAG_LOOPING)
+		}
+		s.lastTime = s.window.GetTime()
 	}
 
-	if len(s.renderers) > 0 {
-		opengl.Draw(s.window, s.cam, s.renderers)
+	if s.mesh == 0 {
+		return
 	}
+
+	var pose []animation.NodePose
+	if s.keyAnimation != nil {
+		now := s.window.GetTime()
+		s.keyAnimation.Update(now - s.lastTime)
+		s.lastTime = now
+		pose = s.keyAnimation.Pose()
+	}
+
+	s.backend.Draw3do(s.mesh, &s.thing, nil, pose)
 }
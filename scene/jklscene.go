@@ -1,58 +1,134 @@
 package scene
 
 import (
-	"github.com/go-gl/glfw/v3.2/glfw"
+	"fmt"
+	"github.com/joelhays/go-jk/animation"
+	"github.com/joelhays/go-jk/backend"
 	"github.com/joelhays/go-jk/camera"
+	"github.com/joelhays/go-jk/cog"
 	"github.com/joelhays/go-jk/jk"
 	"github.com/joelhays/go-jk/jk/jkparsers"
 	"github.com/joelhays/go-jk/jk/jktypes"
-	"github.com/joelhays/go-jk/opengl"
+	"github.com/joelhays/go-jk/visibility"
+	"log"
+	"time"
 )
 
+const statsInterval = 0.5
+
+// showStats adds what the culler let through to the window title.
+var showStats bool
+
+// SetShowStats shows the visible sectors, surfaces and things in the window
+// title, to debug the culling.
+func SetShowStats(show bool) {
+	showStats = show
+}
+
 type JklScene struct {
-	jklName       string
-	shaderProgram *opengl.ShaderProgram
-	renderers     []opengl.Renderer
-	cam           *camera.Camera
-	window        *glfw.Window
-	levelRenderer opengl.Renderer
-	level         *jktypes.Jkl
+	jklName   string
+	backend   backend.Backend
+	window    backend.Window
+	cam       *camera.Camera
+	levelMesh backend.MeshHandle
+	meshes    map[string]backend.MeshHandle
+	level     *jktypes.Jkl
+	assets    *jkparsers.AssetLease
+	culler    *visibility.Culler
+	animator  *animation.CelAnimator
+	things    []thingInstance
+	drawn     int
+	pups      map[string]*jktypes.Pup
+	keys      map[string]*jktypes.Key
+	cogWorld  *cogWorld
+	vm        *cog.VM
+	programs  map[string]*cog.Program
+	sector    int64
+	statsTime float64
+	lastTime  float64
 }
 
-func NewJklScene(jklName string, window *glfw.Window, cam *camera.Camera, shaderProgram *opengl.ShaderProgram) *JklScene {
-	return &JklScene{jklName: jklName, window: window, cam: cam, shaderProgram: shaderProgram}
+// thingInstance is a thing drawn with the 3do uploaded for its template.
+type thingInstance struct {
+	mesh     backend.MeshHandle
+	thing    *jktypes.Thing
+	sector   *jktypes.Sector
+	sectorID int64
+	puppet   *animation.Puppet
+}
+
+func NewJklScene(jklName string, b backend.Backend, window backend.Window, cam *camera.Camera) *JklScene {
+	return &JklScene{jklName: jklName, backend: b, window: window, cam: cam}
 }
 
 func (s *JklScene) Load() {
 	if s.level == nil {
+		start := time.Now()
+		s.assets = sharedAssets().NewLease()
+
 		var level jktypes.Jkl
 		fileBytes := jk.GetLoader().LoadEpisode(s.jklName)
 		if fileBytes != nil {
-			level = jkparsers.NewJklLineParser().ParseFromString(string(fileBytes))
+			parser := jkparsers.NewJklLineParser(jk.GetLoader().FS())
+			parser.SetFileName(s.jklName)
+			parser.SetAssets(s.assets)
+			parser.SetDiskCache(diskCache)
+			var err error
+			level, err = parser.ParseFromString(string(fileBytes))
+			if err != nil {
+				log.Println(err)
+				return
+			}
 		}
 		s.level = &level
+		log.Printf("[INFO] loaded %s in %v: %v\n", s.jklName, time.Since(start).Round(time.Millisecond), s.assets.Stats())
 	}
 }
 
 func (s *JklScene) Unload() {
-	s.renderers = make([]opengl.Renderer, 0)
-	s.levelRenderer = nil
+	if s.levelMesh != 0 {
+		s.backend.ReleaseMesh(s.levelMesh)
+		s.levelMesh = 0
+	}
+	for _, mesh := range s.meshes {
+		s.backend.ReleaseMesh(mesh)
+	}
+	s.meshes = nil
 	s.level = nil
+	if s.assets != nil {
+		s.assets.Release()
+		s.assets = nil
+	}
+	s.culler = nil
+	s.animator = nil
+	s.things = nil
+	s.pups = nil
+	s.keys = nil
+	s.cogWorld = nil
+	s.vm = nil
+	s.programs = nil
+	s.window.SetTitle("JK Viewer")
 }
 
 func (s *JklScene) Update() {
-	if s.level != nil && s.levelRenderer == nil {
-		s.window.SetInputMode(glfw.CursorMode, glfw.CursorDisabled)
+	if s.level != nil && s.levelMesh == 0 {
+		s.window.SetCursorCaptured(true)
 
-		s.levelRenderer = opengl.NewOpenGlLevelRenderer(nil, nil, s.level.Model, s.shaderProgram)
-		s.renderers = append(s.renderers, s.levelRenderer)
+		s.culler = visibility.NewCuller(s.level)
+		s.animator = animation.NewCelAnimator()
+		s.pups = make(map[string]*jktypes.Pup)
+		s.keys = make(map[string]*jktypes.Key)
+		s.meshes = make(map[string]backend.MeshHandle)
+		s.lastTime = s.window.GetTime()
+		s.levelMesh = s.backend.UploadLevel(s.level.Model, s.level.Sectors, s.animator)
 
 		var foundPlayer bool
 		for i := 0; i < len(s.level.Things); i++ {
-			thing := s.level.Things[i]
+			thing := &s.level.Things[i]
 			if thing.TemplateName == "walkplayer" {
 				if !foundPlayer {
 					s.cam.Position = thing.Position
+					s.culler.SetSector(thing.Sector)
 					foundPlayer = true
 				}
 				continue
@@ -62,13 +138,212 @@ func (s *JklScene) Update() {
 			jk3do := s.level.Jk3dos[template.Jk3doName]
 
 			if len(jk3do.GeoSets) > 0 {
-				objRenderer := opengl.NewOpenGl3doRenderer(&thing, &template, &jk3do, s.shaderProgram)
-				s.renderers = append(s.renderers, objRenderer)
+				instance := thingInstance{thing: thing, sectorID: thing.Sector}
+				if thing.Sector >= 0 && thing.Sector < int64(len(s.level.Sectors)) {
+					instance.sector = &s.level.Sectors[thing.Sector]
+				}
+
+				// things sharing a 3do share its upload
+				mesh, ok := s.meshes[template.Jk3doName]
+				if !ok {
+					mesh = s.backend.Upload3do(&jk3do, s.animator)
+					s.meshes[template.Jk3doName] = mesh
+				}
+				instance.mesh = mesh
+				instance.puppet = s.newPuppet(&template, &jk3do)
+				s.things = append(s.things, instance)
 			}
 		}
+
+		s.loadCogs()
+	}
+
+	if s.levelMesh == 0 {
+		return
+	}
+
+	now := s.window.GetTime()
+	s.animator.Update(now - s.lastTime)
+	for _, thing := range s.things {
+		if thing.puppet != nil {
+			thing.puppet.Update(now - s.lastTime)
+		}
+	}
+	s.cogWorld.Update(now - s.lastTime)
+	if err := s.vm.Update(now - s.lastTime); err != nil {
+		log.Println(err)
+	}
+	s.lastTime = now
+
+	width, height := s.window.GetSize()
+	viewProjection := s.cam.ProjectionMatrix(width, height).Mul4(s.cam.GetViewMatrix())
+	s.culler.Update(s.cam.Position, viewProjection)
+	s.updateSector()
+
+	s.backend.DrawLevel(s.levelMesh, s.culler.VisibleSectors())
+	s.drawn = 0
+	for _, thing := range s.things {
+		if !s.culler.SectorVisible(thing.sectorID) {
+			continue
+		}
+		var pose []animation.NodePose
+		if thing.puppet != nil {
+			pose = thing.puppet.Pose()
+		}
+		s.backend.Draw3do(thing.mesh, thing.thing, thing.sector, pose)
+		s.drawn++
+	}
+
+	s.updateStats()
+}
+
+// newPuppet creates a puppet standing idle for templates with a puppet, or returns
+// nil when the template has none or its PUP cannot be loaded.
+func (s *JklScene) newPuppet(template *jktypes.Template, jk3do *jktypes.Jk3doFile) *animation.Puppet {
+	if template.PuppetName == "" || template.PuppetName == "none" {
+		return nil
+	}
+
+	pup, ok := s.pups[template.PuppetName]
+	if !ok {
+		if fileBytes := jk.GetLoader().LoadResource(template.PuppetName); fileBytes != nil {
+			parser := jkparsers.NewPupLineParser()
+			parser.SetFileName(template.PuppetName)
+			p, err := parser.ParseFromString(string(fileBytes))
+			if err != nil {
+				log.Println(err)
+			} else {
+				pup = &p
+			}
+		}
+		s.pups[template.PuppetName] = pup
+	}
+	if pup == nil {
+		return nil
+	}
+
+	puppet := animation.NewPuppet(jk3do, pup, s.loadKey)
+	if err := puppet.Play("stand"); err != nil {
+		log.Println(err)
+	}
+	return puppet
+}
+
+// loadKey loads a KEY once for all puppets using it.
+func (s *JklScene) loadKey(keyName string) (*jktypes.Key, error) {
+	if key, ok := s.keys[keyName]; ok {
+		return key, nil
+	}
+
+	fileBytes := jk.GetLoader().LoadResource(keyName)
+	if fileBytes == nil {
+		return nil, fmt.Errorf("key %s not found", keyName)
+	}
+	parser := jkparsers.NewKeyLineParser()
+	parser.SetFileName(keyName)
+	key, err := parser.ParseFromString(string(fileBytes))
+	if err != nil {
+		return nil, err
+	}
+	s.keys[keyName] = &key
+	return &key, nil
+}
+
+// loadCogs starts the COGs of the level and sends them the startup message.
+func (s *JklScene) loadCogs() {
+	s.cogWorld = newCogWorld(s.level, s.animator)
+	s.vm = cog.NewVM(cog.NewLibrary(s.cogWorld))
+	s.programs = make(map[string]*cog.Program)
+	s.sector = s.culler.CurrentSector()
+
+	for _, levelCog := range s.level.Cogs {
+		program := s.loadProgram(levelCog.Script)
+		if program == nil {
+			continue
+		}
+		if _, err := s.vm.Load(program, levelCog.Values); err != nil {
+			log.Println(err)
+		}
+	}
+
+	if err := s.vm.Broadcast(cog.NewMessage("startup")); err != nil {
+		log.Println(err)
+	}
+}
+
+// loadProgram parses and compiles a COG once for all instances using it, returning
+// nil when it cannot be loaded.
+func (s *JklScene) loadProgram(cogName string) *cog.Program {
+	if program, ok := s.programs[cogName]; ok {
+		return program
+	}
+	s.programs[cogName] = nil
+
+	fileBytes := jk.GetLoader().LoadEpisode(cogName)
+	if fileBytes == nil {
+		fileBytes = jk.GetLoader().LoadResource(cogName)
+	}
+	if fileBytes == nil {
+		log.Printf("cog %s not found", cogName)
+		return nil
+	}
+
+	parser := jkparsers.NewCogParser()
+	parser.SetFileName(cogName)
+	parsed, err := parser.ParseFromString(string(fileBytes))
+	if err != nil {
+		log.Println(err)
+		return nil
+	}
+	program, err := cog.NewProgram(cogName, &parsed)
+	if err != nil {
+		log.Println(err)
+		return nil
+	}
+	s.programs[cogName] = program
+	return program
+}
+
+// updateSector sends exited and entered to the COGs linked to the sectors the
+// camera leaves and enters.
+func (s *JklScene) updateSector() {
+	sector := s.culler.CurrentSector()
+	if sector == s.sector {
+		return
+	}
+
+	for _, change := range []struct {
+		name   string
+		sector int64
+	}{{"exited", s.sector}, {"entered", sector}} {
+		if change.sector < 0 {
+			continue
+		}
+		message := cog.NewMessage(change.name)
+		message.SenderType = cog.SENDER_TYPE_SECTOR
+		message.Sender = int32(change.sector)
+		if err := s.vm.SendLinked(message); err != nil {
+			log.Println(err)
+		}
+	}
+	s.sector = sector
+}
+
+// updateStats shows the level in the window title, and what was drawn of it
+// when SetShowStats is on.
+func (s *JklScene) updateStats() {
+	now := s.window.GetTime()
+	if now-s.statsTime < statsInterval {
+		return
 	}
+	s.statsTime = now
 
-	if len(s.renderers) > 0 {
-		opengl.Draw(s.window, s.cam, s.renderers)
+	title := "JK Viewer - " + s.jklName
+	if showStats {
+		stats := s.culler.Stats()
+		title += fmt.Sprintf(" - sector %d - sectors %d/%d, surfaces %d/%d, things %d/%d",
+			s.culler.CurrentSector(), stats.Sectors, stats.TotalSectors, stats.Surfaces, stats.TotalSurfaces,
+			s.drawn, len(s.things))
 	}
+	s.window.SetTitle(title)
 }
@@ -1,68 +1,46 @@
 package scene
 
 import (
-	"github.com/go-gl/glfw/v3.2/glfw"
-	"github.com/go-gl/mathgl/mgl32"
-	"github.com/golang-ui/nuklear/nk"
+	"github.com/joelhays/go-jk/backend"
 	"github.com/joelhays/go-jk/jk"
 	"github.com/joelhays/go-jk/jk/jkparsers"
 	"github.com/joelhays/go-jk/jk/jktypes"
-	"github.com/joelhays/go-jk/menu"
-	"github.com/joelhays/go-jk/opengl"
 	"log"
 )
 
+var menuTabs = []string{"JKL", "3DO", "BM"}
+
 type MainMenuScene struct {
-	window       *glfw.Window
-	context      *nk.Context
-	textureId    uint32
+	backend      backend.Backend
+	window       backend.Window
 	sceneManager *SceneManager
-	fontAtlas    *nk.FontAtlas
-	font         *nk.Font
-	fontHandle   *nk.UserFont
+	background   *jktypes.BMFile
+	texture      backend.TextureHandle
 	levels       []string
 	objs         []string
 	bms          []string
 	selectedTab  int
 }
 
-func NewMainMenuScene(window *glfw.Window, sceneManager *SceneManager) *MainMenuScene {
-	return &MainMenuScene{window: window, sceneManager: sceneManager}
+func NewMainMenuScene(b backend.Backend, window backend.Window, sceneManager *SceneManager) *MainMenuScene {
+	return &MainMenuScene{backend: b, window: window, sceneManager: sceneManager}
 }
 
 func (m *MainMenuScene) Load() {
-	m.context = nk.NkPlatformInit(m.window, nk.PlatformInstallCallbacks)
-	m.fontAtlas = nk.NewFontAtlas()
-	nk.NkFontStashBegin(&m.fontAtlas)
-	m.font = nk.NkFontAtlasAddFromBytes(m.fontAtlas, menu.MustAsset("assets/FreeSans.ttf"), 24, nil)
-	//m.font = nk.NkFontAtlasAddDefault(atlas, 16, nil)
-	nk.NkFontStashEnd()
-	if m.font != nil {
-		m.fontHandle = m.font.Handle()
-		nk.NkStyleSetFont(m.context, m.fontHandle)
-	}
-
 	var bmFile jktypes.BMFile
 	fileBytes := jk.GetLoader().LoadResource("bkmain.bm")
 	if fileBytes != nil {
-		bmFile = jkparsers.NewBmParser().ParseFromBytes(fileBytes)
-	}
-
-	bmRenderer := opengl.NewOpenGlBmRenderer(&bmFile, mgl32.Vec2{1, 1}, nil)
-	original, ok := bmRenderer.(*opengl.OpenGlBmRenderer)
-	if ok {
-		//*m.context.GetStyle().GetWindow().GetFixedBackground() = nk.NkStyleItemImage(nk.NkSubimageId(int32(original.GetTextureID()), 1024, 768, nk.NkRect(0, 0, 1024, 768)))
-		m.textureId = original.GetTextureID()
+		parser := jkparsers.NewBmParser(jk.GetLoader().FS())
+		parser.SetFileName("bkmain.bm")
+		var err error
+		bmFile, err = parser.ParseFromBytes(fileBytes)
+		if err != nil {
+			log.Println(err)
+		}
 	}
+	m.background = &bmFile
 
-	//bmFile2 := jk.GetLoader().LoadBM("bksingle.bm")
-	//bmRenderer2 := opengl.NewOpenGlBmRenderer(&bmFile2, nil)
-	//original2, ok2 := bmRenderer2.(*opengl.OpenGlBmRenderer)
-	//if ok2 {
-	//	*m.context.GetStyle().GetButton().GetNormal() = nk.NkStyleItemImage(nk.NkSubimageId(int32(original2.GetTextureID()), 24, 24, nk.NkRect(0, 0, 24, 24)))
-	//}
-
-	m.window.SetInputMode(glfw.CursorMode, glfw.CursorNormal)
+	m.window.SetCursorCaptured(false)
 
 	if len(m.levels) == 0 {
 		for _, gobFileName := range jk.GetLoader().LoadManifest("jkl") {
@@ -84,96 +62,41 @@ func (m *MainMenuScene) Load() {
 }
 
 func (m *MainMenuScene) Unload() {
-	//nk.NkPlatformShutdown()
+	if m.texture != 0 {
+		m.backend.ReleaseTexture(m.texture)
+		m.texture = 0
+	}
+	m.background = nil
 }
 
 func (m *MainMenuScene) Update() {
-	nk.NkPlatformNewFrame()
-
-	// Layout
-	*m.context.GetStyle().GetWindow().GetFixedBackground() = nk.NkStyleItemImage(nk.NkSubimageId(int32(m.textureId), 1024, 768, nk.NkRect(0, 0, 1024, 768)))
-
-	bounds := nk.NkRect(0, 0, 1024, 768)
-	update := nk.NkBegin(m.context, "Demo", bounds, nk.WindowBackground)
-
-	*m.context.GetStyle().GetWindow().GetFixedBackground() = nk.NkStyleItemHide()
-
-	if update > 0 {
-
-		nk.NkLayoutRowDynamic(m.context, 250, 1)
-		{
-		}
-
-		nk.NkLayoutRowStatic(m.context, 30, 1024/3, 3)
-		{
-			nk.NkSpacing(m.context, 1)
-			nk.NkLabel(m.context, "Select an item to load:", nk.TextCentered)
-		}
-
-		nk.NkLayoutRowStatic(m.context, 30, 1024/5, 5)
-		{
-			nk.NkSpacing(m.context, 1)
-			if nk.NkButtonLabel(m.context, "JKL") > 0 {
-				m.selectedTab = 0
-			}
-
-			if nk.NkButtonLabel(m.context, "3DO") > 0 {
-				m.selectedTab = 1
-			}
-
-			if nk.NkButtonLabel(m.context, "BM") > 0 {
-				m.selectedTab = 2
-			}
-		}
-
-		nk.NkLayoutRowDynamic(m.context, 30, 1)
-		{
-		}
-
-		nk.NkLayoutRowStatic(m.context, 30*10, 1024/3, 3)
-		{
-			nk.NkSpacing(m.context, 1)
-			var activeList *[]string
-			if m.selectedTab == 0 {
-				activeList = &m.levels
-			} else if m.selectedTab == 1 {
-				activeList = &m.objs
-			} else if m.selectedTab == 2 {
-				activeList = &m.bms
-			}
-			var list nk.ListView
-			nk.NkListViewBegin(m.context, &list, "level", nk.WindowBackground, 35, int32(len(*activeList)-1))
-			{
-				for l := list.Begin(); l < list.End(); l++ {
-					item := (*activeList)[l]
-					nk.NkLayoutRowDynamic(m.context, 30, 1)
-					{
-						if nk.NkButtonLabel(m.context, item) > 0 {
-							log.Println("[INFO] button pressed! " + item)
-							go m.sceneManager.LoadScene(item)
-						}
-					}
-				}
-			}
-			nk.NkListViewEnd(&list)
-		}
+	if m.background != nil && m.texture == 0 {
+		m.texture = m.backend.UploadImage(m.background)
+	}
 
-		nk.NkLayoutRowDynamic(m.context, 30, 1)
-		{
-		}
+	items := m.levels
+	if m.selectedTab == 1 {
+		items = m.objs
+	} else if m.selectedTab == 2 {
+		items = m.bms
+	}
 
-		nk.NkLayoutRowStatic(m.context, 30, 1024/3, 3)
-		{
-			nk.NkSpacing(m.context, 1)
-			if nk.NkButtonLabel(m.context, "Quit") > 0 {
-				m.window.SetShouldClose(true)
-			}
-		}
+	event := m.backend.DrawMenu(backend.MenuView{
+		Background: m.texture,
+		Title:      "Select an item to load:",
+		Tabs:       menuTabs,
+		Tab:        m.selectedTab,
+		Items:      items,
+	})
 
+	if event.Tab >= 0 {
+		m.selectedTab = event.Tab
+	}
+	if event.Item != "" {
+		log.Println("[INFO] button pressed! " + event.Item)
+		go m.sceneManager.LoadScene(event.Item)
+	}
+	if event.Quit {
+		m.window.SetShouldClose(true)
 	}
-	nk.NkEnd(m.context)
-
-	maxVertexBuffer := 512 * 1024
-	maxElementBuffer := 128 * 1024
-	nk.NkPlatformRender(nk.AntiAliasingOn, maxVertexBuffer, maxElementBuffer)
 }
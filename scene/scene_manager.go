@@ -57,3 +57,8 @@ func (m *SceneManager) Unload() {
 		scene.Unload()
 	}
 }
+
+// Active returns the key of the scene loaded last.
+func (m *SceneManager) Active() string {
+	return m.activeScene
+}
@@ -0,0 +1,375 @@
+package scene
+
+import (
+	"bytes"
+	"encoding/binary"
+	"github.com/go-gl/mathgl/mgl32"
+	"github.com/joelhays/go-jk/backend"
+	"github.com/joelhays/go-jk/backend/mock"
+	"github.com/joelhays/go-jk/camera"
+	"github.com/joelhays/go-jk/convert"
+	"github.com/joelhays/go-jk/jk"
+	"github.com/joelhays/go-jk/jk/jktypes"
+	"github.com/joelhays/go-jk/raster"
+	"image"
+	"image/color"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestMain serves _testfiles from a res2.gob, together with the BM and SFT the
+// scenes and the menu ask for, made up here as _testfiles has none.
+func TestMain(m *testing.M) {
+	dir, err := ioutil.TempDir("", "scene")
+	if err != nil {
+		log.Fatal(err)
+	}
+	code := 1
+	if err := writeTestInstall(dir); err != nil {
+		log.Println(err)
+	} else if err := jk.InitLoader(jk.Config{InstallDir: dir}); err != nil {
+		log.Println(err)
+	} else {
+		code = m.Run()
+	}
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+func writeTestInstall(dir string) error {
+	files := make(map[string][]byte)
+	root := "../_testfiles"
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			if info.Name() == "golden" {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		name, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		files[strings.ReplaceAll(filepath.ToSlash(name), "/", "\\")] = data
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if files["ui\\bm\\bkdialog.bm"], err = testBM(8, 4, 2); err != nil {
+		return err
+	}
+	if files["ui\\bm\\bkmain.bm"], err = testBM(16, 12, 1); err != nil {
+		return err
+	}
+	if files["ui\\sft\\large0.sft"], err = testSFT(' ', 'z'); err != nil {
+		return err
+	}
+
+	var archive bytes.Buffer
+	if err := jk.WriteGOB(&archive, files); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filepath.Join(dir, "res2.gob"), archive.Bytes(), 0644)
+}
+
+// testBM makes a BM of white images.
+func testBM(width int, height int, images int) ([]byte, error) {
+	var palette [256]jktypes.Vec3Byte
+	palette[1] = jktypes.Vec3Byte{R: 255, G: 255, B: 255}
+	var imgs []image.Image
+	for i := 0; i < images; i++ {
+		img := image.NewNRGBA(image.Rect(0, 0, width, height))
+		for j := 0; j < len(img.Pix); j++ {
+			img.Pix[j] = 255
+		}
+		imgs = append(imgs, img)
+	}
+
+	bm, err := convert.NewBM(imgs, palette)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if err := convert.WriteBM(&buf, &bm); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// testSFT makes a font of one pixel wide characters from first to last.
+func testSFT(first int16, last int16) ([]byte, error) {
+	var buf bytes.Buffer
+	header := jktypes.TSFTHeader{NumTables: 1}
+	copy(header.FileType[:], "SFNT")
+	if err := binary.Write(&buf, binary.LittleEndian, &header); err != nil {
+		return nil, err
+	}
+	if err := binary.Write(&buf, binary.LittleEndian, []int16{first, last}); err != nil {
+		return nil, err
+	}
+	for i := int32(0); i <= int32(last-first); i++ {
+		if err := binary.Write(&buf, binary.LittleEndian, &jktypes.TCharDef{XOffset: i, Width: 1}); err != nil {
+			return nil, err
+		}
+	}
+	bm, err := testBM(int(last-first)+1, 2, 1)
+	if err != nil {
+		return nil, err
+	}
+	buf.Write(bm)
+	return buf.Bytes(), nil
+}
+
+func newTestCamera() *camera.Camera {
+	cam := camera.NewCamera(mgl32.Vec3{0, 0, 1}, mgl32.Vec3{0, 0, 1}, 0, -90)
+	return &cam
+}
+
+func runFrames(b backend.Backend, window *backend.HeadlessWindow, sceneManager *SceneManager, cam *camera.Camera, frames int, seconds float64) {
+	for i := 0; i < frames; i++ {
+		window.Advance(seconds)
+		b.BeginFrame(cam)
+		sceneManager.Update()
+		b.EndFrame()
+		window.PollEvents()
+	}
+}
+
+// callsTo returns the calls to a backend method, e.g. "DrawImage".
+func callsTo(b *mock.Backend, method string) []string {
+	var calls []string
+	for _, call := range b.Calls() {
+		if strings.HasPrefix(call, method+" ") || call == method {
+			calls = append(calls, call)
+		}
+	}
+	return calls
+}
+
+func TestSceneManagerSwitchesScenes(t *testing.T) {
+	b := mock.NewBackend()
+	window := backend.NewHeadlessWindow(640, 480)
+	cam := newTestCamera()
+	sceneManager := NewSceneManager()
+	sceneManager.Add("3do", NewJk3doScene("rystr.3do", "", b, window, cam))
+	sceneManager.Add("bm", NewBMScene("bkdialog.bm", b, window, cam))
+
+	sceneManager.LoadScene("3do")
+	runFrames(b, window, sceneManager, cam, 1, 1.0/30)
+	if sceneManager.Active() != "3do" || b.Live() != 1 {
+		t.Errorf("%s active with %d handles, expected 3do with 1", sceneManager.Active(), b.Live())
+	}
+
+	// loading the active scene again keeps it as it is
+	sceneManager.LoadScene("3do")
+	runFrames(b, window, sceneManager, cam, 1, 1.0/30)
+	if calls := callsTo(b, "Upload3do"); len(calls) != 1 {
+		t.Errorf("3do uploaded %d times, expected once", len(calls))
+	}
+
+	sceneManager.LoadScene("bm")
+	if calls := callsTo(b, "ReleaseMesh"); len(calls) != 1 {
+		t.Errorf("the 3do was released %d times when switching scenes, expected once", len(calls))
+	}
+	b.Reset()
+	runFrames(b, window, sceneManager, cam, 1, 1.0/30)
+	if sceneManager.Active() != "bm" || len(callsTo(b, "DrawImage")) != 1 || len(callsTo(b, "Draw3do")) != 0 {
+		t.Errorf("%s active, drew %v", sceneManager.Active(), b.Calls())
+	}
+
+	sceneManager.Unload()
+	if b.Live() != 0 {
+		t.Errorf("%d handles not released", b.Live())
+	}
+}
+
+func TestJk3doScene(t *testing.T) {
+	b := mock.NewBackend()
+	window := backend.NewHeadlessWindow(640, 480)
+	cam := newTestCamera()
+	sceneManager := NewSceneManager()
+	sceneManager.Add("3do", NewJk3doScene("rystr.3do", "ryidleg.key", b, window, cam))
+
+	sceneManager.LoadScene("3do")
+	runFrames(b, window, sceneManager, cam, 3, 1.0/30)
+	if calls := callsTo(b, "Upload3do"); len(calls) != 1 {
+		t.Errorf("3do uploaded %d times, expected once", len(calls))
+	}
+	draws := callsTo(b, "Draw3do")
+	if len(draws) != 3 {
+		t.Errorf("3do drawn %d times in 3 frames", len(draws))
+	}
+	for _, draw := range draws {
+		if !strings.HasSuffix(draw, "posed=true") {
+			t.Errorf("%q, expected the key to pose the 3do", draw)
+		}
+	}
+
+	sceneManager.Unload()
+	if b.Live() != 0 {
+		t.Errorf("%d handles not released", b.Live())
+	}
+}
+
+func TestBMSceneCyclesImages(t *testing.T) {
+	b := mock.NewBackend()
+	window := backend.NewHeadlessWindow(640, 480)
+	cam := newTestCamera()
+	sceneManager := NewSceneManager()
+	sceneManager.Add("bm", NewBMScene("bkdialog.bm", b, window, cam))
+
+	sceneManager.LoadScene("bm")
+	runFrames(b, window, sceneManager, cam, 4, 1.0/bmImageRate)
+	if calls := callsTo(b, "UploadImage"); len(calls) != 1 || !strings.HasSuffix(calls[0], "images=2") {
+		t.Errorf("uploads %v, expected one of 2 images", calls)
+	}
+	var images []string
+	for _, draw := range callsTo(b, "DrawImage") {
+		images = append(images, strings.Fields(draw)[2])
+	}
+	if got := strings.Join(images, " "); got != "image=1 image=0 image=1 image=0" {
+		t.Errorf("drew %s, expected the images in turn", got)
+	}
+
+	sceneManager.Unload()
+	if b.Live() != 0 {
+		t.Errorf("%d handles not released", b.Live())
+	}
+}
+
+func TestSFTScene(t *testing.T) {
+	b := mock.NewBackend()
+	window := backend.NewHeadlessWindow(640, 480)
+	cam := newTestCamera()
+	sceneManager := NewSceneManager()
+	sceneManager.Add("sft", NewSFTScene("large0.sft", b, window, cam))
+
+	sceneManager.LoadScene("sft")
+	runFrames(b, window, sceneManager, cam, 2, 1.0/30)
+	draws := callsTo(b, "DrawQuads")
+	if len(draws) != 10 {
+		t.Errorf("text drawn %d times in 2 frames, expected 5 lines a frame", len(draws))
+	}
+	for _, draw := range draws {
+		if strings.HasSuffix(draw, "quads=0") {
+			t.Errorf("%q draws nothing", draw)
+		}
+	}
+
+	sceneManager.Unload()
+	if b.Live() != 0 {
+		t.Errorf("%d handles not released", b.Live())
+	}
+}
+
+func TestMainMenuScene(t *testing.T) {
+	b := mock.NewBackend()
+	window := backend.NewHeadlessWindow(640, 480)
+	cam := newTestCamera()
+	sceneManager := NewSceneManager()
+	sceneManager.Add("menu", NewMainMenuScene(b, window, sceneManager))
+
+	var events []backend.MenuEvent
+	b.Menu = func(view backend.MenuView) backend.MenuEvent {
+		if len(events) == 0 {
+			return backend.NoMenuEvent
+		}
+		event := events[0]
+		events = events[1:]
+		return event
+	}
+
+	sceneManager.LoadScene("menu")
+	runFrames(b, window, sceneManager, cam, 1, 1.0/30)
+	if calls := callsTo(b, "DrawMenu"); len(calls) != 1 || calls[0] != "DrawMenu tab=0 items=3" {
+		t.Errorf("menu drawn as %v, expected the 3 levels", calls)
+	}
+	if calls := callsTo(b, "UploadImage"); len(calls) != 1 {
+		t.Errorf("background uploaded %d times, expected once", len(calls))
+	}
+
+	quit := backend.NoMenuEvent
+	quit.Quit = true
+	events = []backend.MenuEvent{{Tab: 1}, quit}
+	b.Reset()
+	runFrames(b, window, sceneManager, cam, 2, 1.0/30)
+	if calls := callsTo(b, "DrawMenu"); len(calls) != 2 || calls[1] != "DrawMenu tab=1 items=6" {
+		t.Errorf("menu drawn as %v, expected the 6 3dos after switching tabs", calls)
+	}
+	if !window.ShouldClose() {
+		t.Errorf("quitting the menu did not close the window")
+	}
+
+	sceneManager.Unload()
+	if b.Live() != 0 {
+		t.Errorf("%d handles not released", b.Live())
+	}
+}
+
+func TestJklScene(t *testing.T) {
+	b := mock.NewBackend()
+	window := backend.NewHeadlessWindow(640, 480)
+	cam := newTestCamera()
+	sceneManager := NewSceneManager()
+	sceneManager.Add("level", NewJklScene("jkl\\01narshadda.jkl", b, window, cam))
+
+	sceneManager.LoadScene("level")
+	runFrames(b, window, sceneManager, cam, 3, 1.0/30)
+	if calls := callsTo(b, "UploadLevel"); len(calls) != 1 || !strings.HasSuffix(calls[0], "surfaces=4595 sectors=462") {
+		t.Errorf("level uploads %v, expected one of 4595 surfaces and 462 sectors", calls)
+	}
+	if calls := callsTo(b, "DrawLevel"); len(calls) != 3 {
+		t.Errorf("level drawn %d times in 3 frames", len(calls))
+	}
+	if calls := callsTo(b, "Upload3do"); len(calls) == 0 {
+		t.Errorf("no things uploaded")
+	}
+	if !window.CursorCaptured {
+		t.Errorf("the level did not capture the cursor")
+	}
+
+	sceneManager.Unload()
+	if b.Live() != 0 {
+		t.Errorf("%d handles not released", b.Live())
+	}
+}
+
+func TestJklSceneSoftware(t *testing.T) {
+	fb := raster.NewFramebuffer(160, 120)
+	b := raster.NewBackend(fb)
+	window := backend.NewHeadlessWindow(160, 120)
+	cam := newTestCamera()
+	sceneManager := NewSceneManager()
+	sceneManager.Add("level", NewJklScene("jkl\\m_boss15.jkl", b, window, cam))
+
+	// the camera is moved to the player start during the first frame
+	sceneManager.LoadScene("level")
+	runFrames(b, window, sceneManager, cam, 2, 1.0/30)
+	sceneManager.Unload()
+
+	var drawn int
+	img := fb.Image()
+	for y := 0; y < img.Bounds().Dy(); y++ {
+		for x := 0; x < img.Bounds().Dx(); x++ {
+			if img.RGBAAt(x, y) != (color.RGBA{A: 255}) && img.RGBAAt(x, y) != (color.RGBA{}) {
+				drawn++
+			}
+		}
+	}
+	if drawn < len(img.Pix)/4/2 {
+		t.Errorf("the level covers %d of %d pixels", drawn, len(img.Pix)/4)
+	}
+}
@@ -1,55 +1,92 @@
 package scene
 
 import (
-	"github.com/go-gl/glfw/v3.2/glfw"
-	"github.com/go-gl/mathgl/mgl32"
+	"github.com/joelhays/go-jk/backend"
 	"github.com/joelhays/go-jk/camera"
 	"github.com/joelhays/go-jk/jk"
 	"github.com/joelhays/go-jk/jk/jkparsers"
-	"github.com/joelhays/go-jk/jk/jktypes"
-	"github.com/joelhays/go-jk/opengl"
+	"github.com/joelhays/go-jk/text"
+	"log"
+	"strings"
 )
 
+const sftScenePangram = "The quick brown fox jumps over the lazy dog. 0123456789"
+
 type SFTScene struct {
-	sftName       string
-	shaderProgram *opengl.ShaderProgram
-	renderers     []opengl.Renderer
-	cam           *camera.Camera
-	window        *glfw.Window
+	sftName string
+	backend backend.Backend
+	window  backend.Window
+	cam     *camera.Camera
+	font    *text.Font
+	chars   string
 }
 
-func NewSFTScene(sftName string, window *glfw.Window, cam *camera.Camera, shaderProgram *opengl.ShaderProgram) *SFTScene {
-	return &SFTScene{sftName: sftName, window: window, cam: cam, shaderProgram: shaderProgram}
+func NewSFTScene(sftName string, b backend.Backend, window backend.Window, cam *camera.Camera) *SFTScene {
+	return &SFTScene{sftName: sftName, backend: b, window: window, cam: cam}
 }
 
 func (s *SFTScene) Load() {
-	var sft jktypes.SFTFile
 	fileBytes := jk.GetLoader().LoadResource(s.sftName)
-	if fileBytes != nil {
-		sft = jkparsers.NewSftParser().ParseFromBytes(fileBytes)
+	if fileBytes == nil {
+		return
 	}
-	//fmt.Printf("%+v\n", sft)
 
-	w, h := s.window.GetSize()
-	windowAspect := float32(w) / float32(h)
-
-	var scale mgl32.Vec2
-	imageRatio := float32(sft.BMFile.Images[0].SizeX) / float32(sft.BMFile.Images[0].SizeY) / windowAspect
-	scale = mgl32.Vec2{imageRatio, 1}
-	if imageRatio > 1 {
-		imageRatio = float32(sft.BMFile.Images[0].SizeY) / float32(sft.BMFile.Images[0].SizeX) / windowAspect
-		scale = mgl32.Vec2{1, imageRatio}
+	parser := jkparsers.NewSftParser(jk.GetLoader().FS())
+	parser.SetFileName(s.sftName)
+	sft, err := parser.ParseFromBytes(fileBytes)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	if len(sft.BMFile.Images) == 0 {
+		return
 	}
-	//fmt.Printf("%d, %d, %+v\n", sft.BMFile.Images[0].SizeX, sft.BMFile.Images[0].SizeY, scale)
+	s.font = text.NewFont(&sft)
 
-	sftRenderer := opengl.NewOpenGlBmRenderer(&sft.BMFile, scale, s.shaderProgram)
-	s.renderers = append(s.renderers, sftRenderer)
+	// every character of the font, 32 to a line
+	var lines []string
+	for _, table := range sft.CharacterTables {
+		var line []rune
+		for r := rune(table.FirstChar); r <= rune(table.LastChar); r++ {
+			if _, ok := s.font.Glyph(r); ok {
+				line = append(line, r)
+			}
+			if len(line) == 32 {
+				lines = append(lines, string(line))
+				line = nil
+			}
+		}
+		if len(line) > 0 {
+			lines = append(lines, string(line))
+		}
+	}
+	s.chars = strings.Join(lines, "\n")
 }
 
 func (s *SFTScene) Unload() {
-
+	if s.font != nil {
+		s.font.Release(s.backend)
+		s.font = nil
+	}
 }
 
 func (s *SFTScene) Update() {
-	opengl.Draw(s.window, s.cam, s.renderers)
+	if s.font == nil {
+		return
+	}
+
+	w, h := s.window.GetSize()
+	s.font.Scale = float32(h / 480)
+	if s.font.Scale < 1 {
+		s.font.Scale = 1
+	}
+	margin := 10 * s.font.Scale
+	lineHeight := s.font.LineHeight()
+
+	s.font.Draw(s.backend, s.sftName, margin, margin, text.ALIGN_LEFT)
+	y := margin + lineHeight*2
+	s.font.Draw(s.backend, sftScenePangram, margin, y, text.ALIGN_LEFT)
+	s.font.Draw(s.backend, sftScenePangram, float32(w)/2, y+lineHeight, text.ALIGN_CENTER)
+	s.font.Draw(s.backend, sftScenePangram, float32(w)-margin, y+lineHeight*2, text.ALIGN_RIGHT)
+	s.font.Draw(s.backend, s.chars, float32(w)/2, y+lineHeight*4, text.ALIGN_CENTER)
 }
@@ -12,8 +12,35 @@ uniform vec3 lightColor;
 
 uniform sampler2D objectTexture;
 
+uniform int shadingMode;
+uniform sampler2D indexTexture;
+uniform sampler2D colormapTexture;
+uniform float ambientLight;
+uniform float extraLight;
+uniform int transparent;
+
 out vec4 frag_color;
+
+// shade the palette index through the colormap light level tables
+vec4 colormapShading() {
+    float index = floor(texture(indexTexture, TexCoord).r * 255.0 + 0.5);
+    if (transparent == 1 && index == 0.0) {
+        discard;
+    }
+
+    float light = clamp(max(LightIntensity, ambientLight) + extraLight, 0.0, 1.0);
+    float level = floor(light * 63.0 + 0.5);
+
+    vec2 colormapCoord = vec2((index + 0.5) / 256.0, (level + 0.5) / 64.0);
+    return vec4(texture(colormapTexture, colormapCoord).rgb, 1.0f);
+}
+
 void main() {
+    if (shadingMode == 1) {
+        frag_color = colormapShading();
+        return;
+    }
+
     // ambient
     float ambientStrength = 0.1f;
     vec3 ambient = ambientStrength * lightColor;
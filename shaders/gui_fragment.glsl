@@ -9,6 +9,6 @@ uniform sampler2D objectTexture;
 out vec4 frag_color;
 
 void main() {
-    vec3 result = objectColor * vec3(texture(objectTexture, TexCoord));
-    frag_color = vec4(result, 1.0f);
+    vec4 texel = texture(objectTexture, TexCoord);
+    frag_color = vec4(objectColor * texel.rgb, texel.a);
 }
\ No newline at end of file
@@ -1,7 +1,7 @@
 #version 410
 layout (location = 0) in vec3 position;
 layout (location = 1) in vec3 normal;
-layout (location = 2) in vec3 uv;
+layout (location = 2) in vec2 uv;
 layout (location = 3) in float lightIntensity;
 
 out vec3 Normal;
@@ -4,61 +4,81 @@ import (
 	"fmt"
 	"github.com/joelhays/go-jk/jk"
 	"github.com/joelhays/go-jk/jk/jkparsers"
+	"log"
 )
 
 func testPupParser() {
 	p := jkparsers.NewPupLineParser()
-	pup := p.ParseFromFile("./_testfiles/rystr.pup")
+	pup, err := p.ParseFromFile("./_testfiles/rystr.pup")
+	if err != nil {
+		log.Println(err)
+	}
 	fmt.Println(fmt.Sprintf("%+v", pup))
 
 	manifest := jk.GetLoader().LoadManifest("pup")
 	for _, file := range manifest {
 		fmt.Println(file)
 		fileBytes := jk.GetLoader().LoadResource(file)
-		r := p.ParseFromString(string(fileBytes))
-		_ = r
+		p.SetFileName(file)
+		if _, err := p.ParseFromString(string(fileBytes)); err != nil {
+			log.Println(err)
+		}
 	}
 }
 
 func testKeyParser() {
 	p := jkparsers.NewKeyLineParser()
-	r := p.ParseFromFile("./_testfiles/8twalk.key")
+	r, err := p.ParseFromFile("./_testfiles/8twalk.key")
+	if err != nil {
+		log.Println(err)
+	}
 	fmt.Println(fmt.Sprintf("%+v", r))
 
 	manifest := jk.GetLoader().LoadManifest("key")
 	for _, file := range manifest {
 		fmt.Println(file)
 		fileBytes := jk.GetLoader().LoadResource(file)
-		r := p.ParseFromString(string(fileBytes))
-		_ = r
+		p.SetFileName(file)
+		if _, err := p.ParseFromString(string(fileBytes)); err != nil {
+			log.Println(err)
+		}
 	}
 }
 
 func testJklParser() {
-	p := jkparsers.NewJklLineParser()
-	r := p.ParseFromFile("./_testfiles/jkl/01narshadda.jkl")
-	_ = r
+	p := jkparsers.NewJklLineParser(jk.GetLoader().FS())
+	_, err := p.ParseFromFile("./_testfiles/jkl/01narshadda.jkl")
+	if err != nil {
+		log.Println(err)
+	}
 	//fmt.Println(fmt.Sprintf("%+v", r))
 
 	manifest := jk.GetLoader().LoadManifest("jkl")
 	for _, file := range manifest {
 		fmt.Println(file)
 		fileBytes := jk.GetLoader().LoadEpisode(file)
-		r = p.ParseFromString(string(fileBytes))
+		p.SetFileName(file)
+		if _, err := p.ParseFromString(string(fileBytes)); err != nil {
+			log.Println(err)
+		}
 	}
 }
 
 func test3doParser() {
-	p := jkparsers.NewJk3doLineParser()
-	r := p.ParseFromFile("./_testfiles/3do/rystr.3do")
-	_ = r
+	p := jkparsers.NewJk3doLineParser(jk.GetLoader().FS())
+	_, err := p.ParseFromFile("./_testfiles/3do/rystr.3do")
+	if err != nil {
+		log.Println(err)
+	}
 	//fmt.Println(fmt.Sprintf("%+v", r))
 
 	manifest := jk.GetLoader().LoadManifest("3do")
 	for _, file := range manifest {
 		fmt.Println(file)
 		fileBytes := jk.GetLoader().LoadResource(file)
-		r := p.ParseFromString(string(fileBytes))
-		_ = r
+		p.SetFileName(file)
+		if _, err := p.ParseFromString(string(fileBytes)); err != nil {
+			log.Println(err)
+		}
 	}
 }
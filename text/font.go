@@ -0,0 +1,155 @@
+// Package text lays out and draws strings in the bitmap fonts of the game.
+package text
+
+import (
+	"github.com/joelhays/go-jk/backend"
+	"github.com/joelhays/go-jk/jk/jktypes"
+	"strings"
+)
+
+type Align int
+
+const (
+	ALIGN_LEFT Align = iota
+	ALIGN_CENTER
+	ALIGN_RIGHT
+)
+
+// Font is an SFT font. Every glyph is as high as the font sheet and advances
+// the text by its own width plus Spacing, scaled by Scale.
+type Font struct {
+	Scale   float32
+	Spacing float32
+
+	tables     []jktypes.TCharacterTable
+	bm         *jktypes.BMFile
+	height     float32
+	spaceWidth float32
+	texture    backend.TextureHandle
+}
+
+func NewFont(sft *jktypes.SFTFile) *Font {
+	f := &Font{Scale: 1, Spacing: 1, tables: sft.CharacterTables, bm: &sft.BMFile}
+	if img, ok := sft.BMFile.Image(0); ok {
+		f.height = float32(img.SizeY)
+	}
+
+	// fonts without a space advance by half the average glyph
+	var width, glyphs float32
+	for _, table := range f.tables {
+		for _, def := range table.CharDefs {
+			if def.Width > 0 {
+				width += float32(def.Width)
+				glyphs++
+			}
+		}
+	}
+	if glyphs > 0 {
+		f.spaceWidth = width / glyphs / 2
+	}
+	return f
+}
+
+// Glyph returns where a character is in the font sheet, looking through every
+// character range. It is false for characters the font has no glyph for.
+func (f *Font) Glyph(r rune) (jktypes.TCharDef, bool) {
+	for _, table := range f.tables {
+		if r >= rune(table.FirstChar) && r <= rune(table.LastChar) {
+			def := table.CharDefs[r-rune(table.FirstChar)]
+			return def, def.Width > 0
+		}
+	}
+	return jktypes.TCharDef{}, false
+}
+
+// LineHeight returns the height of a line of text in pixels.
+func (f *Font) LineHeight() float32 {
+	return f.height * f.Scale
+}
+
+// advance returns the glyph of r and how far it moves the text, in unscaled
+// pixels. Characters without a glyph are drawn as '?', or as a space when the
+// font has no '?' either.
+func (f *Font) advance(r rune) (jktypes.TCharDef, bool, float32) {
+	def, ok := f.Glyph(r)
+	if !ok && r != ' ' {
+		def, ok = f.Glyph('?')
+	}
+	if !ok {
+		return def, false, f.spaceWidth + f.Spacing
+	}
+	return def, true, float32(def.Width) + f.Spacing
+}
+
+// Measure returns the width of the widest line of s and the height of all its lines, in pixels.
+func (f *Font) Measure(s string) (float32, float32) {
+	lines := strings.Split(s, "\n")
+	var width float32
+	for _, line := range lines {
+		if w := f.lineWidth(line); w > width {
+			width = w
+		}
+	}
+	return width, float32(len(lines)) * f.LineHeight()
+}
+
+func (f *Font) lineWidth(line string) float32 {
+	var width float32
+	for _, r := range line {
+		_, _, advance := f.advance(r)
+		width += advance
+	}
+	if width > 0 {
+		width -= f.Spacing
+	}
+	return width * f.Scale
+}
+
+// Layout returns a quad of the font sheet for every glyph of s. Lines are
+// separated by '\n' and placed below each other from y, the top of the first
+// line, and aligned to x.
+func (f *Font) Layout(s string, x float32, y float32, align Align) []backend.Quad {
+	var quads []backend.Quad
+	for _, line := range strings.Split(s, "\n") {
+		left := x
+		switch align {
+		case ALIGN_CENTER:
+			left -= f.lineWidth(line) / 2
+		case ALIGN_RIGHT:
+			left -= f.lineWidth(line)
+		}
+
+		for _, r := range line {
+			def, ok, advance := f.advance(r)
+			if ok {
+				quads = append(quads, backend.Quad{
+					X: left, Y: y, Width: float32(def.Width) * f.Scale, Height: f.LineHeight(),
+					SrcX: float32(def.XOffset), SrcWidth: float32(def.Width), SrcHeight: f.height,
+				})
+			}
+			left += advance * f.Scale
+		}
+		y += f.LineHeight()
+	}
+	return quads
+}
+
+// Draw draws s laid out like Layout in one batch, uploading the font sheet the
+// first time.
+func (f *Font) Draw(b backend.Backend, s string, x float32, y float32, align Align) {
+	if len(f.bm.Images) == 0 {
+		return
+	}
+	if f.texture == 0 {
+		f.texture = b.UploadImage(f.bm)
+	}
+	b.DrawQuads(f.texture, 0, f.Layout(s, x, y, align))
+}
+
+// Release releases the font sheet uploaded by Draw.
+func (f *Font) Release(b backend.Backend) {
+	if f.texture != 0 {
+		b.ReleaseTexture(f.texture)
+		f.texture = 0
+	}
+}
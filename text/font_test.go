@@ -0,0 +1,86 @@
+package text
+
+import (
+	"github.com/joelhays/go-jk/backend/mock"
+	"github.com/joelhays/go-jk/jk/jktypes"
+	"github.com/joelhays/go-jk/raster"
+	"testing"
+)
+
+// newTestFont makes a font of two character ranges, 'A'-'C' 2, 3 and 4 pixels
+// wide and 'a' 1 pixel wide, on a white sheet.
+func newTestFont() *Font {
+	sheet := jktypes.TImage{SizeX: 10, SizeY: 2, Data: make([]byte, 20)}
+	for i := range sheet.Data {
+		sheet.Data[i] = 1
+	}
+	sft := jktypes.SFTFile{
+		CharacterTables: []jktypes.TCharacterTable{
+			{FirstChar: 'A', LastChar: 'C', CharDefs: []jktypes.TCharDef{{XOffset: 0, Width: 2}, {XOffset: 2, Width: 3}, {XOffset: 5, Width: 4}}},
+			{FirstChar: 'a', LastChar: 'a', CharDefs: []jktypes.TCharDef{{XOffset: 9, Width: 1}}},
+		},
+		BMFile: jktypes.BMFile{Header: jktypes.TBMHeader{NumBits: 8, Transparent: -1}, Images: []jktypes.TImage{sheet}},
+	}
+	sft.BMFile.Palette.Palette[1] = jktypes.Vec3Byte{R: 255, G: 255, B: 255}
+	return NewFont(&sft)
+}
+
+func TestMeasure(t *testing.T) {
+	font := newTestFont()
+	if w, h := font.Measure("ABCa\nA"); w != 13 || h != 4 {
+		t.Errorf("measured %vx%v, expected 13x4", w, h)
+	}
+}
+
+func TestLayoutRightAligned(t *testing.T) {
+	font := newTestFont()
+	quads := font.Layout("Ca", 20, 0, ALIGN_RIGHT)
+	if len(quads) != 2 || quads[0].X != 14 || quads[1].X != 19 || quads[1].SrcX != 9 {
+		t.Errorf("got quads %+v, expected 'C' at 14 and 'a' at 19 from 9 of the sheet", quads)
+	}
+}
+
+func TestLayoutMissingGlyph(t *testing.T) {
+	font := newTestFont()
+	// without a '?' either, missing glyphs advance by half the average glyph
+	quads := font.Layout("B?B", 0, 0, ALIGN_LEFT)
+	if len(quads) != 2 || quads[1].X != 3+1+1.25+1 {
+		t.Errorf("got quads %+v, expected the second 'B' at %v", quads, 3+1+1.25+1)
+	}
+}
+
+func TestDraw(t *testing.T) {
+	font := newTestFont()
+	b := mock.NewBackend()
+	font.Draw(b, "AB\nCa", 0, 0, ALIGN_CENTER)
+	font.Release(b)
+	calls := b.Calls()
+	want := []string{"UploadImage 1 images=1", "DrawQuads 1 image=0 quads=4", "ReleaseTexture 1"}
+	if len(calls) != len(want) {
+		t.Fatalf("got calls %v, expected %v", calls, want)
+	}
+	for i := range want {
+		if calls[i] != want[i] {
+			t.Errorf("got calls %v, expected %v", calls, want)
+			break
+		}
+	}
+	if b.Live() != 0 {
+		t.Errorf("%d handles not released", b.Live())
+	}
+}
+
+func TestDrawSoftware(t *testing.T) {
+	font := newTestFont()
+	fb := raster.NewFramebuffer(16, 4)
+	font.Scale = 2
+	font.Draw(raster.NewBackend(fb), "AC", 0, 0, ALIGN_LEFT)
+
+	var row []byte
+	for x := 0; x < 16; x++ {
+		row = append(row, ".#"[fb.Image().RGBAAt(x, 3).R/255])
+	}
+	if string(row) != "####..########.." {
+		t.Errorf("drew %s on the last row, expected ####..########..", row)
+	}
+}
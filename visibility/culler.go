@@ -0,0 +1,307 @@
+package visibility
+
+import (
+	"github.com/go-gl/mathgl/mgl32"
+	"github.com/joelhays/go-jk/jk/jktypes"
+)
+
+const (
+	// AdjoinFlagVisible marks an adjoin that can be seen through.
+	AdjoinFlagVisible = 0x1
+
+	planeEpsilon = 0.001
+	nearW        = 0.0001
+	maxDepth     = 64
+)
+
+type Stats struct {
+	Sectors       int
+	TotalSectors  int
+	Surfaces      int
+	TotalSurfaces int
+}
+
+type rect struct {
+	minX, minY, maxX, maxY float32
+}
+
+var fullRect = rect{-1, -1, 1, 1}
+
+func (r rect) intersect(o rect) rect {
+	return rect{
+		minX: max32(r.minX, o.minX),
+		minY: max32(r.minY, o.minY),
+		maxX: min32(r.maxX, o.maxX),
+		maxY: min32(r.maxY, o.maxY),
+	}
+}
+
+func (r rect) union(o rect) rect {
+	return rect{
+		minX: min32(r.minX, o.minX),
+		minY: min32(r.minY, o.minY),
+		maxX: max32(r.maxX, o.maxX),
+		maxY: max32(r.maxY, o.maxY),
+	}
+}
+
+func (r rect) empty() bool {
+	return r.minX >= r.maxX || r.minY >= r.maxY
+}
+
+func (r rect) contains(o rect) bool {
+	return o.minX >= r.minX && o.minY >= r.minY && o.maxX <= r.maxX && o.maxY <= r.maxY
+}
+
+// Culler determines which sectors of a level can be seen from the camera by
+// walking the adjoins outwards from the camera sector. Every portal narrows the
+// screen space rectangle that the sectors behind it are visible through.
+type Culler struct {
+	level          *jktypes.Jkl
+	currentSector  int64
+	visible        []bool
+	visibleSectors []int64
+	drawnRects     []rect
+	drawn          []bool
+	viewProjection mgl32.Mat4
+	position       mgl32.Vec3
+	stats          Stats
+}
+
+func NewCuller(level *jktypes.Jkl) *Culler {
+	c := &Culler{
+		level:         level,
+		currentSector: -1,
+		visible:       make([]bool, len(level.Sectors)),
+		drawnRects:    make([]rect, len(level.Sectors)),
+		drawn:         make([]bool, len(level.Sectors)),
+	}
+	c.stats.TotalSectors = len(level.Sectors)
+	for _, surface := range level.Model.Surfaces {
+		if surface.Geo != 0 {
+			c.stats.TotalSurfaces++
+		}
+	}
+	return c
+}
+
+// SetSector sets the sector used as a starting point when searching for the
+// camera, e.g. the sector of the player start.
+func (c *Culler) SetSector(sector int64) {
+	if sector >= int64(len(c.level.Sectors)) {
+		sector = -1
+	}
+	c.currentSector = sector
+}
+
+// CurrentSector returns the sector containing the camera, or -1 when the camera
+// is outside of the level.
+func (c *Culler) CurrentSector() int64 {
+	return c.currentSector
+}
+
+// Update finds the camera sector and determines the visible sectors for the
+// given camera position and view-projection matrix. When the camera is not
+// inside any sector every sector is considered visible.
+func (c *Culler) Update(position mgl32.Vec3, viewProjection mgl32.Mat4) {
+	c.position = position
+	c.viewProjection = viewProjection
+	c.currentSector = c.FindSector(position)
+
+	for i := range c.visible {
+		c.visible[i] = false
+		c.drawn[i] = false
+	}
+	c.visibleSectors = c.visibleSectors[:0]
+
+	if c.currentSector < 0 {
+		for i := range c.visible {
+			c.markVisible(int64(i))
+		}
+	} else {
+		c.walk(c.currentSector, fullRect, 0)
+	}
+
+	c.stats.Sectors = len(c.visibleSectors)
+	c.stats.Surfaces = 0
+	for _, sectorID := range c.visibleSectors {
+		sector := c.level.Sectors[sectorID]
+		for i := sector.FirstSurface; i < sector.FirstSurface+sector.NumSurfaces; i++ {
+			if c.level.Model.Surfaces[i].Geo != 0 {
+				c.stats.Surfaces++
+			}
+		}
+	}
+}
+
+// VisibleSectors returns the sectors found by the last Update.
+func (c *Culler) VisibleSectors() []int64 {
+	return c.visibleSectors
+}
+
+// SectorVisible reports whether a sector was found visible by the last Update.
+// Negative sector ids, used by things without a sector, are always visible.
+func (c *Culler) SectorVisible(sector int64) bool {
+	if sector < 0 || sector >= int64(len(c.visible)) {
+		return true
+	}
+	return c.visible[sector]
+}
+
+func (c *Culler) Stats() Stats {
+	return c.stats
+}
+
+// FindSector returns the sector containing position. The current sector and its
+// neighbours are tested first since the camera rarely moves further than that in
+// a single frame. When no sector contains the position the current sector is
+// kept, and -1 is returned if there is none.
+func (c *Culler) FindSector(position mgl32.Vec3) int64 {
+	current := c.currentSector
+	if current >= 0 {
+		if c.sectorContains(current, position) {
+			return current
+		}
+		sector := c.level.Sectors[current]
+		for i := sector.FirstSurface; i < sector.FirstSurface+sector.NumSurfaces; i++ {
+			adjoin := c.level.Model.Surfaces[i].Adjoin
+			if adjoin < 0 {
+				continue
+			}
+			neighbour := c.level.Model.Adjoins[adjoin].Sector
+			if neighbour >= 0 && c.sectorContains(neighbour, position) {
+				return neighbour
+			}
+		}
+	}
+
+	for i := range c.level.Sectors {
+		if c.sectorContains(int64(i), position) {
+			return int64(i)
+		}
+	}
+
+	return current
+}
+
+func (c *Culler) sectorContains(sectorID int64, position mgl32.Vec3) bool {
+	sector := c.level.Sectors[sectorID]
+	for i := 0; i < 3; i++ {
+		if position[i] < sector.BoundBox.Min[i]-planeEpsilon || position[i] > sector.BoundBox.Max[i]+planeEpsilon {
+			return false
+		}
+	}
+
+	for i := sector.FirstSurface; i < sector.FirstSurface+sector.NumSurfaces; i++ {
+		if c.distanceToSurface(i, position) < -planeEpsilon {
+			return false
+		}
+	}
+	return true
+}
+
+// distanceToSurface returns the signed distance from the surface plane. Surface
+// normals point into their sector, so positive values are on the inside.
+func (c *Culler) distanceToSurface(surfaceID int64, position mgl32.Vec3) float32 {
+	surface := c.level.Model.Surfaces[surfaceID]
+	if len(surface.VertexIds) == 0 {
+		return 0
+	}
+	v0 := c.level.Model.Vertices[surface.VertexIds[0]]
+	return position.Sub(v0).Dot(surface.Normal)
+}
+
+func (c *Culler) markVisible(sectorID int64) {
+	if !c.visible[sectorID] {
+		c.visible[sectorID] = true
+		c.visibleSectors = append(c.visibleSectors, sectorID)
+	}
+}
+
+func (c *Culler) walk(sectorID int64, clip rect, depth int) {
+	if c.drawn[sectorID] && c.drawnRects[sectorID].contains(clip) {
+		return
+	}
+	if c.drawn[sectorID] {
+		c.drawnRects[sectorID] = c.drawnRects[sectorID].union(clip)
+	} else {
+		c.drawnRects[sectorID] = clip
+		c.drawn[sectorID] = true
+	}
+	c.markVisible(sectorID)
+
+	if depth >= maxDepth {
+		return
+	}
+
+	sector := c.level.Sectors[sectorID]
+	for i := sector.FirstSurface; i < sector.FirstSurface+sector.NumSurfaces; i++ {
+		surface := c.level.Model.Surfaces[i]
+		if surface.Adjoin < 0 {
+			continue
+		}
+		adjoin := c.level.Model.Adjoins[surface.Adjoin]
+		if adjoin.Flags&AdjoinFlagVisible == 0 || adjoin.Sector < 0 {
+			continue
+		}
+		if c.distanceToSurface(i, c.position) < -planeEpsilon {
+			continue // looking at the back of the portal
+		}
+
+		portal, ok := c.projectSurface(surface)
+		if !ok {
+			continue
+		}
+		portal = portal.intersect(clip)
+		if portal.empty() {
+			continue
+		}
+
+		c.walk(adjoin.Sector, portal, depth+1)
+	}
+}
+
+// projectSurface returns the normalized device coordinate bounds of a surface.
+// Surfaces crossing the near plane are treated as covering the whole screen.
+func (c *Culler) projectSurface(surface jktypes.Surface) (rect, bool) {
+	bounds := rect{minX: 1, minY: 1, maxX: -1, maxY: -1}
+	inFront := 0
+	behind := 0
+	for _, vertexID := range surface.VertexIds {
+		v := c.level.Model.Vertices[vertexID]
+		p := c.viewProjection.Mul4x1(v.Vec4(1))
+		if p.W() <= nearW {
+			behind++
+			continue
+		}
+		inFront++
+		x := p.X() / p.W()
+		y := p.Y() / p.W()
+		bounds.minX = min32(bounds.minX, x)
+		bounds.minY = min32(bounds.minY, y)
+		bounds.maxX = max32(bounds.maxX, x)
+		bounds.maxY = max32(bounds.maxY, y)
+	}
+
+	if inFront == 0 {
+		return rect{}, false
+	}
+	if behind > 0 {
+		return fullRect, true
+	}
+	return bounds, true
+}
+
+func min32(a, b float32) float32 {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func max32(a, b float32) float32 {
+	if a > b {
+		return a
+	}
+	return b
+}
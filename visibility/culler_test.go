@@ -0,0 +1,162 @@
+package visibility
+
+import (
+	"github.com/go-gl/mathgl/mgl32"
+	"github.com/joelhays/go-jk/jk"
+	"github.com/joelhays/go-jk/jk/jkparsers"
+	"github.com/joelhays/go-jk/jk/jktypes"
+	"os"
+	"testing"
+)
+
+var testLevels = []string{"01narshadda", "08escape88", "m_boss15"}
+
+func parseTestLevel(t *testing.T, name string) *jktypes.Jkl {
+	t.Helper()
+	resolver := jk.FSResolver{FS: os.DirFS("../_testfiles")}
+	data, err := resolver.ReadResource("jkl/" + name + ".jkl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	parser := jkparsers.NewJklLineParser(resolver)
+	parser.SetFileName(name + ".jkl")
+	level, err := parser.ParseFromString(string(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &level
+}
+
+func testViewProjection(eye, direction mgl32.Vec3) mgl32.Mat4 {
+	projection := mgl32.Perspective(mgl32.DegToRad(90), 4.0/3.0, 0.01, 1000)
+	return projection.Mul4(mgl32.LookAtV(eye, eye.Add(direction), mgl32.Vec3{0, 0, 1}))
+}
+
+// sectorCentroid returns the average of the vertices of a sector, inside it as
+// sectors are convex.
+func sectorCentroid(level *jktypes.Jkl, sector jktypes.Sector) mgl32.Vec3 {
+	var sum mgl32.Vec3
+	for _, id := range sector.VertexIds {
+		sum = sum.Add(level.Model.Vertices[id])
+	}
+	return sum.Mul(1 / float32(len(sector.VertexIds)))
+}
+
+func TestCullerFindsCameraSector(t *testing.T) {
+	for _, name := range testLevels {
+		level := parseTestLevel(t, name)
+		c := NewCuller(level)
+		var found int
+		for i, sector := range level.Sectors {
+			if len(sector.VertexIds) == 0 {
+				continue
+			}
+			position := sectorCentroid(level, sector)
+			c.Update(position, testViewProjection(position, mgl32.Vec3{1, 0, 0}))
+			if c.CurrentSector() < 0 || !c.sectorContains(c.CurrentSector(), position) {
+				t.Errorf("%s: the centroid of sector %d is in sector %d", name, i, c.CurrentSector())
+				continue
+			}
+			if c.CurrentSector() == int64(i) {
+				found++
+			}
+		}
+		// thin sectors can share their centroid with a neighbour
+		if found < len(level.Sectors)*9/10 {
+			t.Errorf("%s: found %d of %d sectors at their centroid", name, found, len(level.Sectors))
+		}
+
+		// outside of the level everything is visible
+		c.SetSector(-1)
+		outside := mgl32.Vec3{1e6, 1e6, 1e6}
+		c.Update(outside, testViewProjection(outside, mgl32.Vec3{1, 0, 0}))
+		if c.CurrentSector() != -1 || len(c.VisibleSectors()) != len(level.Sectors) {
+			t.Errorf("%s: outside the level in sector %d seeing %d of %d sectors", name, c.CurrentSector(),
+				len(c.VisibleSectors()), len(level.Sectors))
+		}
+	}
+}
+
+func TestCullerInteriorView(t *testing.T) {
+	for _, name := range testLevels {
+		level := parseTestLevel(t, name)
+		c := NewCuller(level)
+		for i, sector := range level.Sectors {
+			if len(sector.VertexIds) == 0 {
+				continue
+			}
+			position := sectorCentroid(level, sector)
+			c.Update(position, testViewProjection(position, mgl32.Vec3{0, 1, 0}))
+			if c.CurrentSector() != int64(i) {
+				continue
+			}
+
+			visible := c.VisibleSectors()
+			if len(visible) == 0 || len(visible) >= len(level.Sectors) || !c.SectorVisible(int64(i)) {
+				t.Errorf("%s: from sector %d %d of %d sectors are visible, expected it and fewer than all", name, i,
+					len(visible), len(level.Sectors))
+			}
+			seen := make(map[int64]bool)
+			for _, sector := range visible {
+				if seen[sector] || !c.SectorVisible(sector) {
+					t.Errorf("%s: sector %d listed twice or not visible", name, sector)
+				}
+				seen[sector] = true
+			}
+			if stats := c.Stats(); stats.Sectors != len(visible) || stats.Surfaces > stats.TotalSurfaces {
+				t.Errorf("%s: stats %+v for %d visible sectors", name, stats, len(visible))
+			}
+		}
+	}
+}
+
+// corridorLevel makes a level of sectors 1 unit long along x, each adjoining
+// the next through a visible portal, and the last adjoining the first.
+func corridorLevel(sectors int) *jktypes.Jkl {
+	level := &jktypes.Jkl{Model: &jktypes.JkMesh{}}
+	for i := 0; i <= sectors; i++ {
+		x := float32(i)
+		level.Model.Vertices = append(level.Model.Vertices,
+			mgl32.Vec3{x, -1, -1}, mgl32.Vec3{x, 1, -1}, mgl32.Vec3{x, 1, 1}, mgl32.Vec3{x, -1, 1})
+	}
+
+	portal := func(plane int, normal float32, sector int) {
+		first := int64(plane * 4)
+		level.Model.Adjoins = append(level.Model.Adjoins, jktypes.Adjoin{Flags: AdjoinFlagVisible, Mirror: -1, Sector: int64(sector)})
+		level.Model.Surfaces = append(level.Model.Surfaces, jktypes.Surface{
+			VertexIds: []int64{first, first + 1, first + 2, first + 3},
+			Normal:    mgl32.Vec3{normal, 0, 0},
+			Adjoin:    int64(len(level.Model.Adjoins) - 1),
+		})
+	}
+	for i := 0; i < sectors; i++ {
+		level.Sectors = append(level.Sectors, jktypes.Sector{
+			BoundBox:     jktypes.BoundingBox{Min: mgl32.Vec3{float32(i), -1, -1}, Max: mgl32.Vec3{float32(i + 1), 1, 1}},
+			FirstSurface: int64(len(level.Model.Surfaces)),
+			NumSurfaces:  2,
+		})
+		portal(i, 1, (i+sectors-1)%sectors)
+		portal(i+1, -1, (i+1)%sectors)
+	}
+	return level
+}
+
+func TestCullerCyclicPortals(t *testing.T) {
+	tests := []struct {
+		sectors int
+		visible int
+	}{
+		{10, 10},            // the walk comes back to the first sector
+		{200, maxDepth + 1}, // the walk stops maxDepth portals away
+	}
+	for _, test := range tests {
+		level := corridorLevel(test.sectors)
+		c := NewCuller(level)
+		eye := mgl32.Vec3{0.5, 0, 0}
+		c.Update(eye, testViewProjection(eye, mgl32.Vec3{1, 0, 0}))
+		if c.CurrentSector() != 0 || len(c.VisibleSectors()) != test.visible {
+			t.Errorf("%d sectors: in sector %d seeing %d, expected 0 seeing %d", test.sectors, c.CurrentSector(),
+				len(c.VisibleSectors()), test.visible)
+		}
+	}
+}